@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
 
 	"keeper/internal/logger"
 	"keeper/internal/server/app"
@@ -26,6 +28,30 @@ func main() {
 		panic(err)
 	}
 
+	switch cfg.Command {
+	case config.CommandRotateKey:
+		// перешифровываем данные текущим мастер-ключом
+		if err := application.RotateKey(); err != nil {
+			panic(err)
+		}
+		return
+	case config.CommandUnlock:
+		// снимаем блокировку входа с пользователей и адресов
+		if err := application.Unlock(cfg.Args); err != nil {
+			panic(err)
+		}
+		return
+	case config.CommandExportAudit:
+		// выгружаем журнал аудита в stdout, логи пишутся в stderr
+		if err := application.ExportAudit(os.Stdout, cfg.Args); err != nil {
+			panic(err)
+		}
+		return
+	case config.CommandServe:
+	default:
+		panic(fmt.Sprintf("unknown command %q", cfg.Command))
+	}
+
 	// запускаем приложение
 	if err := application.Run(); err != nil {
 		if errors.Is(err, app.ErrServerStoped) {
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	pb "keeper/proto"
+)
+
+// ErrDeleteNotConfirmed описывает отказ от удаления аккаунта.
+var ErrDeleteNotConfirmed = errors.New("удаление аккаунта не подтверждено")
+
+// deleteAccount входит в аккаунт и после подтверждения удаляет его вместе со всеми данными
+func (s *App) deleteAccount(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, password, token, err := s.signInWithPassword(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Все данные будут удалены без возможности восстановления. Для подтверждения введите имя пользователя %s:\n", username)
+	confirmation, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading confirmation: %v", err)
+		return err
+	}
+	if strings.TrimSpace(confirmation) != username {
+		fmt.Println("Удаление отменено.")
+		return ErrDeleteNotConfirmed
+	}
+
+	ctx := s.withToken(token)
+	req := &pb.DeleteAccountRequest{Password: password}
+	resp, err := client.DeleteAccount(ctx, req)
+	if err != nil {
+		log.Printf("delete account failed: %v", err)
+		printRetryAfter(err)
+		return err
+	}
+
+	// включена двухфакторная аутентификация, код из входа уже использован, нужен новый
+	if resp.TotpRequired {
+		fmt.Println(resp.Message)
+		req.TotpCode, err = getOneTimeCode(&reader)
+		if err != nil {
+			return err
+		}
+		resp, err = client.DeleteAccount(ctx, req)
+		if err != nil {
+			log.Printf("delete account failed: %v", err)
+			printRetryAfter(err)
+			return err
+		}
+	}
+
+	fmt.Println(resp.Message)
+	tables := make([]string, 0, len(resp.Deleted))
+	for table := range resp.Deleted {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("%s: %d\n", table, resp.Deleted[table])
+	}
+	s.vaultKey = nil
+	return nil
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	t.Run("account deleted after new one-time code", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nusername\n654321\n"))
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+		mockClient.On("DeleteAccount", mock.Anything, &pb.DeleteAccountRequest{Password: "password"}).
+			Return(&pb.DeleteAccountResponse{TotpRequired: true}, nil).Once()
+		mockClient.On("DeleteAccount", mock.Anything, &pb.DeleteAccountRequest{Password: "password", TotpCode: "654321"}).
+			Return(&pb.DeleteAccountResponse{Message: "deleted", Deleted: map[string]int64{"users": 1}}, nil)
+
+		err := app.deleteAccount(*reader, mockClient)
+		assert.NoError(t, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("not confirmed", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nother\n"))
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+
+		err := app.deleteAccount(*reader, mockClient)
+		assert.ErrorIs(t, err, ErrDeleteNotConfirmed)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"keeper/internal/client/config"
@@ -31,6 +32,20 @@ type App struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     *sync.WaitGroup
+
+	// ключ хранилища, если данные шифруются на клиенте
+	vaultKey []byte
+	// запись, поля которой вводит пользователь по запросу сервера
+	form atomic.Pointer[itemForm]
+	// текущий стрим команд, после переподключения заменяется новым
+	stream atomic.Pointer[commandStream]
+	// открывает стрим заново с токеном текущей сессии
+	reopen func() (pb.KeeperService_CommandClient, error)
+}
+
+// commandStream стрим команд, который горутины получения и отправки сообщений берут из App
+type commandStream struct {
+	pb.KeeperService_CommandClient
 }
 
 func New(cfg *config.Config) (*App, error) {
@@ -67,10 +82,21 @@ func (s *App) Run() error {
 	}
 
 	// Создание конфигурации TLS
-	creds := credentials.NewTLS(&tls.Config{
+	tlsConfig := &tls.Config{
 		ServerName: "keeper", // Имя вашего сервера, как указано в его сертификате
 		RootCAs:    certPool,
-	})
+	}
+
+	// клиентский сертификат предъявляется серверу, если он задан
+	if s.cfg.ClientCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.ClientCertPath, s.cfg.ClientKeyPath)
+		if err != nil {
+			log.Printf("Failed to load client certificate: %v", err)
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	creds := credentials.NewTLS(tlsConfig)
 
 	// подключаемся к серверу
 	conn, err := grpc.DialContext(s.ctx, s.cfg.ServerAddr, grpc.WithTransportCredentials(creds))
@@ -80,13 +106,7 @@ func (s *App) Run() error {
 	}
 	defer conn.Close()
 
-	// стартуем стрим
 	client := pb.NewKeeperServiceClient(conn)
-	stream, err := client.Command(s.ctx)
-	if err != nil {
-		log.Printf("could not start command: %v", err)
-		return err
-	}
 
 	// Запрос действия
 	reader := bufio.NewReader(os.Stdin)
@@ -98,10 +118,43 @@ func (s *App) Run() error {
 	switch action {
 	case "1":
 		// Регистрация
-		s.registration(*reader, client, stream)
+		s.registration(*reader, client)
 	case "2":
 		// Вход
-		s.logIn(*reader, client, stream)
+		s.logIn(*reader, client)
+	case "3":
+		// Вход и подключение двухфакторной аутентификации
+		s.enableTOTP(*reader, client)
+	case "4":
+		// Вход и привязка клиентского сертификата
+		s.bindCertificate(*reader, client)
+	case "5":
+		// Вход по клиентскому сертификату
+		s.certLogIn(*reader, client)
+	case "6":
+		// Смена пароля
+		s.changePassword(*reader, client)
+	case "7":
+		// Удаление аккаунта
+		s.deleteAccount(*reader, client)
+	case "8":
+		// Просмотр и завершение сессий
+		s.manageSessions(*reader, client)
+	case "9":
+		// Журнал аудита
+		s.showAuditLog(*reader, client)
+	case "10":
+		// Доступ к записи для другого пользователя
+		s.shareItem(*reader, client)
+	case "11":
+		// Организации и командные коллекции
+		s.manageOrganizations(*reader, client)
+	case "12":
+		// Корзина удаленных записей
+		s.manageTrash(*reader, client)
+	case "13":
+		// История изменений записи
+		s.showHistory(*reader, client)
 	default:
 		log.Printf("invalid action selected")
 		return ErrActionSelected
@@ -116,6 +169,17 @@ func (s *App) getAction(reader bufio.Reader) (string, error) {
 	fmt.Println("\nВыбирете действие:")
 	fmt.Println("1) Register")
 	fmt.Println("2) Login")
+	fmt.Println("3) Enable 2FA")
+	fmt.Println("4) Bind certificate")
+	fmt.Println("5) Login with certificate")
+	fmt.Println("6) Change password")
+	fmt.Println("7) Delete account")
+	fmt.Println("8) Sessions")
+	fmt.Println("9) Audit log")
+	fmt.Println("10) Share item")
+	fmt.Println("11) Organizations")
+	fmt.Println("12) Trash")
+	fmt.Println("13) History")
 	action, err := reader.ReadString('\n')
 	if err != nil {
 		log.Printf("error reading action: %v", err)
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pb "keeper/proto"
+)
+
+// auditPageSize количество событий журнала на одной странице
+const auditPageSize = 20
+
+// auditActions названия событий журнала аудита для пользователя
+var auditActions = map[string]string{
+	"login_success":    "вход",
+	"login_failure":    "неудачный вход",
+	"item_read":        "чтение",
+	"item_create":      "создание",
+	"item_update":      "изменение",
+	"item_delete":      "удаление",
+	"item_restore":     "восстановление",
+	"item_export":      "экспорт",
+	"item_share":       "открытие доступа",
+	"item_unshare":     "закрытие доступа",
+	"trash_empty":      "очистка корзины",
+	"revision_read":    "просмотр версии",
+	"revision_restore": "восстановление версии",
+}
+
+// showAuditLog входит в аккаунт и постранично показывает журнал аудита, от новых событий к старым
+func (s *App) showAuditLog(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.withToken(token)
+	req := &pb.ListAuditEventsRequest{PageSize: auditPageSize}
+	fmt.Println("\nЖурнал аудита:")
+	for {
+		resp, err := client.ListAuditEvents(ctx, req)
+		if err != nil {
+			log.Printf("list audit events failed: %v", err)
+			return err
+		}
+		for _, event := range resp.Events {
+			fmt.Println(formatAuditEvent(event))
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+
+		fmt.Println("Введите + для следующей страницы или пустую строку, чтобы продолжить:")
+		choice, err := reader.ReadString('\n')
+		if err != nil {
+			log.Printf("error reading choice: %v", err)
+			return err
+		}
+		if strings.TrimSpace(choice) != "+" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+
+	return s.startSession(username, token, client)
+}
+
+// formatAuditEvent возвращает строку журнала: время, событие, запись, адрес и сессию
+func formatAuditEvent(event *pb.AuditEvent) string {
+	action, ok := auditActions[event.Action]
+	if !ok {
+		action = event.Action
+	}
+
+	line := time.Unix(event.CreatedAtUnix, 0).Format(sessionTimeLayout) + " " + action
+	if event.Item != "" {
+		line += " " + event.Item
+	}
+	if event.Ip != "" {
+		line += ", " + event.Ip
+	}
+	if event.SessionId != "" {
+		line += ", сессия " + event.SessionId
+	}
+	return line
+}
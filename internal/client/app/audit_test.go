@@ -0,0 +1,78 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShowAuditLog(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	expectLogin := func() {
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+		mockClient.On("ListAuditEvents", mock.Anything, &pb.ListAuditEventsRequest{PageSize: auditPageSize}).
+			Return(&pb.ListAuditEventsResponse{
+				Events:        []*pb.AuditEvent{{Id: 5, Action: "item_read", Item: "mail"}},
+				NextPageToken: "5",
+			}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+	}
+
+	t.Run("next page", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n+\n"))
+
+		expectLogin()
+		mockClient.On("ListAuditEvents", mock.Anything, &pb.ListAuditEventsRequest{PageSize: auditPageSize, PageToken: "5"}).
+			Return(&pb.ListAuditEventsResponse{Events: []*pb.AuditEvent{{Id: 1, Action: "login_success"}}}, nil)
+
+		err := app.showAuditLog(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("first page only", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n\n"))
+
+		expectLogin()
+
+		err := app.showAuditLog(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
+
+func TestFormatAuditEvent(t *testing.T) {
+	line := formatAuditEvent(&pb.AuditEvent{Action: "item_read", Item: "mail", Ip: "10.0.0.1", SessionId: "s1"})
+	assert.True(t, strings.HasSuffix(line, " чтение mail, 10.0.0.1, сессия s1"))
+
+	// неизвестное событие показывается как есть
+	line = formatAuditEvent(&pb.AuditEvent{Action: "new_action"})
+	assert.True(t, strings.HasSuffix(line, " new_action"))
+}
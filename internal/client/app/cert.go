@@ -0,0 +1,85 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strings"
+
+	"keeper/internal/client/service"
+	pb "keeper/proto"
+)
+
+// bindCertificate входит в аккаунт по паролю и привязывает к нему предъявленный клиентский сертификат
+func (s *App) bindCertificate(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.BindCertificate(s.withToken(token), &pb.BindCertificateRequest{})
+	if err != nil {
+		log.Printf("bind certificate failed: %v", err)
+		return err
+	}
+	fmt.Println(resp.Message)
+	for _, identity := range resp.Identities {
+		fmt.Println(identity)
+	}
+
+	return s.startSession(username, token, client)
+}
+
+// certLogIn входит в аккаунт, к которому привязан клиентский сертификат, без пароля.
+// Если данные шифруются на клиенте, пароль все равно нужен, чтобы открыть хранилище.
+func (s *App) certLogIn(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	req := &pb.CertLoginRequest{}
+	resp, err := client.CertLogin(s.withDevice(), req)
+	if err != nil {
+		log.Printf("login failed: %v", err)
+		printRetryAfter(err)
+		return err
+	}
+
+	// включена двухфакторная аутентификация, повторяем вход с одноразовым кодом
+	if resp.TotpRequired {
+		fmt.Println(resp.Message)
+		req.TotpCode, err = getOneTimeCode(&reader)
+		if err != nil {
+			return err
+		}
+		resp, err = client.CertLogin(s.withDevice(), req)
+		if err != nil {
+			log.Printf("login failed: %v", err)
+			printRetryAfter(err)
+			return err
+		}
+	}
+
+	params, err := client.GetVaultParams(s.ctx, &pb.VaultParamsRequest{Username: resp.Username})
+	if err != nil {
+		log.Printf("get vault params failed: %v", err)
+		return err
+	}
+	if params.ClientEncryption {
+		fmt.Println("Введите пароль, чтобы открыть хранилище:")
+		password, err := reader.ReadString('\n')
+		if err != nil {
+			log.Printf("error reading password: %v", err)
+			return err
+		}
+		_, encKey, err := service.DeriveKeys(strings.TrimSpace(password), params.KdfSalt)
+		if err != nil {
+			log.Printf("key derivation failed: %v", err)
+			return err
+		}
+		s.vaultKey, err = service.Open(resp.WrappedVaultKey, encKey)
+		if err != nil {
+			log.Printf("failed to unlock vault: %v", err)
+			return err
+		}
+	}
+	fmt.Println(resp.Message)
+
+	return s.startSession(resp.Username, resp.Token, client)
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCertLogIn(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	t.Run("certificate not accepted", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader(""))
+
+		mockClient.On("CertLogin", mock.Anything, &pb.CertLoginRequest{}).
+			Return(nil, errors.New("certificate not accepted"))
+
+		err := app.certLogIn(*reader, mockClient)
+		assert.EqualError(t, err, "certificate not accepted")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("one-time code requested", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("123456\n"))
+
+		mockClient.On("CertLogin", mock.Anything, &pb.CertLoginRequest{}).
+			Return(&pb.LoginResponse{TotpRequired: true}, nil).Once()
+		mockClient.On("CertLogin", mock.Anything, &pb.CertLoginRequest{TotpCode: "123456"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token", Username: "username"}, nil)
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		hasToken := mock.MatchedBy(func(ctx context.Context) bool {
+			md, ok := metadata.FromOutgoingContext(ctx)
+			return ok && len(md.Get(tokenMetadataKey)) == 1 && md.Get(tokenMetadataKey)[0] == "secret-token"
+		})
+		mockClient.On("Command", hasToken).Return(nil, errors.New("stream failed"))
+
+		err := app.certLogIn(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
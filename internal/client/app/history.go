@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "keeper/proto"
+)
+
+// ErrHistoryCommand описывает ввод, который не является номером версии или командой истории.
+var ErrHistoryCommand = errors.New("неверная команда истории")
+
+// команды пункта истории записей
+const (
+	// revisionLimitPrefix меняет количество хранимых версий: limit::[количество]
+	revisionLimitPrefix = "limit::"
+	// restoreRevisionPrefix восстанавливает версию по номеру в списке: restore::[номер]
+	restoreRevisionPrefix = "restore::"
+)
+
+// showHistory входит в аккаунт и показывает историю записи: прежние версии можно просмотреть
+// или восстановить. Вместо названия записи можно изменить количество хранимых версий.
+func (s *App) showHistory(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Введите название записи или limit::[количество], чтобы изменить число хранимых версий:")
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading title: %v", err)
+		return err
+	}
+	title := strings.TrimSpace(line)
+
+	ctx := s.withToken(token)
+	if value, found := strings.CutPrefix(title, revisionLimitPrefix); found {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("invalid revision limit: %s", value)
+			return ErrHistoryCommand
+		}
+		resp, err := client.SetRevisionLimit(ctx, &pb.SetRevisionLimitRequest{Limit: int32(limit)})
+		if err != nil {
+			log.Printf("set revision limit failed: %v", err)
+			return err
+		}
+		fmt.Println(resp.Message)
+		return s.startSession(username, token, client)
+	}
+
+	resp, err := client.ListRevisions(ctx, &pb.ListRevisionsRequest{Title: title})
+	if err != nil {
+		log.Printf("list revisions failed: %v", err)
+		return err
+	}
+	if len(resp.Revisions) == 0 {
+		fmt.Println("\nУ записи нет прежних версий.")
+		return s.startSession(username, token, client)
+	}
+
+	fmt.Println("\nПрежние версии:")
+	for i, revision := range resp.Revisions {
+		fmt.Println(formatRevision(i+1, revision))
+	}
+	fmt.Println("Введите номер версии для просмотра, restore::[номер] для восстановления или пустую строку, чтобы продолжить:")
+	choice, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading choice: %v", err)
+		return err
+	}
+	choice = strings.TrimSpace(choice)
+	if choice == "" {
+		return s.startSession(username, token, client)
+	}
+
+	number, restore := strings.CutPrefix(choice, restoreRevisionPrefix)
+	index, err := strconv.Atoi(number)
+	if err != nil || index < 1 || index > len(resp.Revisions) {
+		log.Printf("invalid history command: %s", choice)
+		return ErrHistoryCommand
+	}
+	revisionID := resp.Revisions[index-1].Id
+
+	if restore {
+		restored, err := client.RestoreRevision(ctx, &pb.RestoreRevisionRequest{Title: title, RevisionId: revisionID})
+		if err != nil {
+			log.Printf("restore revision failed: %v", err)
+			return err
+		}
+		fmt.Println(restored.Message)
+		return s.startSession(username, token, client)
+	}
+
+	revision, err := client.GetRevision(ctx, &pb.GetRevisionRequest{Title: title, RevisionId: revisionID})
+	if err != nil {
+		log.Printf("get revision failed: %v", err)
+		return err
+	}
+	// данные, зашифрованные на клиенте, расшифровываются ключом хранилища
+	s.printItem(revision.Item)
+	return s.startSession(username, token, client)
+}
+
+// formatRevision возвращает строку истории: номер, версию, название и кто и когда ее заменил
+func formatRevision(number int, revision *pb.Revision) string {
+	return fmt.Sprintf("%d) версия %d: %s, заменена %s пользователем %s, сессия %s", number, revision.Version, revision.Title,
+		time.Unix(revision.CreatedAtUnix, 0).Format(sessionTimeLayout), revision.Author, revision.SessionId)
+}
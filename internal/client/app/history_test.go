@@ -0,0 +1,101 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShowHistory(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	expectLogin := func() {
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+	}
+	history := &pb.ListRevisionsResponse{Revisions: []*pb.Revision{
+		{Id: 21, Version: 3, Title: "wifi"},
+		{Id: 17, Version: 2, Title: "wifi"},
+	}}
+
+	t.Run("view revision", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nwifi\n2\n"))
+
+		expectLogin()
+		mockClient.On("ListRevisions", mock.Anything, &pb.ListRevisionsRequest{Title: "wifi"}).Return(history, nil)
+		mockClient.On("GetRevision", mock.Anything, &pb.GetRevisionRequest{Title: "wifi", RevisionId: 17}).
+			Return(&pb.GetRevisionResponse{Item: &pb.Item{Title: "wifi", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "old"}}}}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.showHistory(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("restore revision", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nwifi\nrestore::1\n"))
+
+		expectLogin()
+		mockClient.On("ListRevisions", mock.Anything, &pb.ListRevisionsRequest{Title: "wifi"}).Return(history, nil)
+		mockClient.On("RestoreRevision", mock.Anything, &pb.RestoreRevisionRequest{Title: "wifi", RevisionId: 21}).
+			Return(&pb.RestoreRevisionResponse{Message: "ok", Version: 5}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.showHistory(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("set limit", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nlimit::3\n"))
+
+		expectLogin()
+		mockClient.On("SetRevisionLimit", mock.Anything, &pb.SetRevisionLimitRequest{Limit: 3}).
+			Return(&pb.SetRevisionLimitResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.showHistory(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("unknown number", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nwifi\nrestore::3\n"))
+
+		expectLogin()
+		mockClient.On("ListRevisions", mock.Anything, &pb.ListRevisionsRequest{Title: "wifi"}).Return(history, nil)
+
+		err := app.showHistory(*reader, mockClient)
+		assert.Equal(t, ErrHistoryCommand, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
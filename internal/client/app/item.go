@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"keeper/internal/client/service"
+	pb "keeper/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// binaryFilePrefix перед путем к файлу в поле бинарных данных: данные читаются из файла
+const binaryFilePrefix = "@"
+
+// itemField поле записи, которое пользователь вводит отдельной строкой
+type itemField struct {
+	prompt string
+	set    func(value string) error
+}
+
+// itemForm запись, поля которой пользователь вводит по одному. Так в полях можно
+// использовать любые символы, в том числе "::".
+type itemForm struct {
+	item   *pb.Item
+	fields []itemField
+	next   int
+	// данные записи шифруются ключом хранилища перед отправкой
+	seal bool
+}
+
+// newItemForm создает форму записи того же типа, что и шаблон template
+func newItemForm(template *pb.Item, seal bool) *itemForm {
+	item := proto.Clone(template).(*pb.Item)
+	form := &itemForm{item: item, seal: seal}
+	form.add("Название:", func(value string) error {
+		item.Title = value
+		return nil
+	})
+
+	switch payload := item.Payload.(type) {
+	case *pb.Item_Login:
+		form.add("Логин:", func(value string) error { payload.Login.Login = value; return nil })
+		form.add("Пароль:", func(value string) error { payload.Login.Password = value; return nil })
+		form.add("Метаданные:", func(value string) error { payload.Login.Meta = value; return nil })
+	case *pb.Item_Text:
+		form.add("Текст:", func(value string) error { payload.Text.Text = value; return nil })
+		form.add("Метаданные:", func(value string) error { payload.Text.Meta = value; return nil })
+	case *pb.Item_Card:
+		form.add("Номер карты:", func(value string) error { payload.Card.Number = value; return nil })
+		form.add("Срок действия (MM/YY):", func(value string) error { payload.Card.ExpirationDate = value; return nil })
+		form.add("Владелец карты:", func(value string) error { payload.Card.Owner = value; return nil })
+		form.add("cvv:", func(value string) error { payload.Card.Cvv = value; return nil })
+		form.add("Метаданные:", func(value string) error { payload.Card.Meta = value; return nil })
+	case *pb.Item_Binary:
+		form.add("Данные или @[путь к файлу]:", func(value string) error {
+			path, found := strings.CutPrefix(value, binaryFilePrefix)
+			if !found {
+				payload.Binary.Data = []byte(value)
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			payload.Binary.Data = data
+			return nil
+		})
+		form.add("Метаданные:", func(value string) error { payload.Binary.Meta = value; return nil })
+	}
+	return form
+}
+
+func (f *itemForm) add(prompt string, set func(value string) error) {
+	f.fields = append(f.fields, itemField{prompt: prompt, set: set})
+}
+
+// prompt возвращает приглашение для ввода следующего поля
+func (f *itemForm) prompt() string {
+	return f.fields[f.next].prompt
+}
+
+// fill заполняет следующее поле записи. Возвращает true, когда заполнены все поля.
+// При ошибке поле нужно ввести заново.
+func (f *itemForm) fill(value string) (bool, error) {
+	if err := f.fields[f.next].set(value); err != nil {
+		return false, err
+	}
+	f.next++
+	return f.next == len(f.fields), nil
+}
+
+// readItem запрашивает у пользователя поля записи того же типа, что и шаблон template
+func readItem(reader *bufio.Reader, template *pb.Item) (*pb.Item, error) {
+	form := newItemForm(template, false)
+	for {
+		fmt.Println(form.prompt())
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			log.Printf("error reading item field: %v", err)
+			return nil, err
+		}
+		done, err := form.fill(strings.TrimSpace(line))
+		if err != nil {
+			log.Printf("invalid item field: %v", err)
+			return nil, err
+		}
+		if done {
+			return form.item, nil
+		}
+	}
+}
+
+// sealItem шифрует запись вместе с названием ключом хранилища. Название остается открытым,
+// чтобы сервер мог найти запись, а при чтении клиент сверяет его с зашифрованным.
+func sealItem(item *pb.Item, vaultKey []byte) (*pb.Item, error) {
+	data, err := proto.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := service.Seal(data, vaultKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Item{Title: item.Title, Payload: &pb.Item_Sealed{Sealed: sealed}}, nil
+}
+
+// openItem расшифровывает запись, зашифрованную на клиенте. Для данных, сохраненных до перехода
+// на protobuf, возвращает их строкой по шаблону типа записи.
+func openItem(item *pb.Item, vaultKey []byte) (*pb.Item, string, error) {
+	sealed, ok := item.Payload.(*pb.Item_Sealed)
+	if !ok {
+		return item, "", nil
+	}
+	plainText, err := service.Open(sealed.Sealed, vaultKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	opened := &pb.Item{}
+	if err := proto.Unmarshal(plainText, opened); err != nil {
+		return nil, string(plainText), nil
+	}
+	if opened.Title != item.Title {
+		return nil, "", fmt.Errorf("data belongs to item %q", opened.Title)
+	}
+	return opened, "", nil
+}
+
+// formatItem возвращает данные записи для вывода пользователю
+func formatItem(item *pb.Item) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Ваши данные: %s\n", item.Title)
+
+	var meta string
+	switch payload := item.Payload.(type) {
+	case *pb.Item_Login:
+		fmt.Fprintf(&builder, "логин: %s\nпароль: %s\n", payload.Login.Login, payload.Login.Password)
+		meta = payload.Login.Meta
+	case *pb.Item_Text:
+		fmt.Fprintf(&builder, "текст: %s\n", payload.Text.Text)
+		meta = payload.Text.Meta
+	case *pb.Item_Card:
+		fmt.Fprintf(&builder, "номер карты: %s\nсрок действия: %s\nвладелец: %s\ncvv: %s\n",
+			payload.Card.Number, payload.Card.ExpirationDate, payload.Card.Owner, payload.Card.Cvv)
+		meta = payload.Card.Meta
+	case *pb.Item_Binary:
+		if utf8.Valid(payload.Binary.Data) {
+			fmt.Fprintf(&builder, "данные: %s\n", payload.Binary.Data)
+		} else {
+			fmt.Fprintf(&builder, "данные (base64): %s\n", base64.StdEncoding.EncodeToString(payload.Binary.Data))
+		}
+		meta = payload.Binary.Meta
+	}
+	if meta != "" {
+		fmt.Fprintf(&builder, "метаданные: %s\n", meta)
+	}
+	return builder.String()
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"testing"
+
+	"keeper/internal/client/service"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestItemForm(t *testing.T) {
+	template := &pb.Item{Payload: &pb.Item_Card{Card: &pb.CardItem{}}}
+	form := newItemForm(template, false)
+
+	var done bool
+	for _, value := range []string{"bank::x", "4111 1111 1111 1111", "12/29", "IVAN", "123", ""} {
+		assert.False(t, done)
+		var err error
+		done, err = form.fill(value)
+		assert.NoError(t, err)
+	}
+	assert.True(t, done)
+	assert.True(t, proto.Equal(&pb.Item{Title: "bank::x", Payload: &pb.Item_Card{Card: &pb.CardItem{
+		Number: "4111 1111 1111 1111", ExpirationDate: "12/29", Owner: "IVAN", Cvv: "123",
+	}}}, form.item))
+	// шаблон не меняется
+	assert.Empty(t, template.Title)
+}
+
+func TestSealedItem(t *testing.T) {
+	vaultKey := []byte("thisis32byteencryptionkey1234567")
+	item := &pb.Item{Title: "wifi", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "admin", Password: "secret"}}}
+
+	t.Run("sealed and opened", func(t *testing.T) {
+		sealed, err := sealItem(item, vaultKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "wifi", sealed.Title)
+		assert.NotEmpty(t, sealed.GetSealed())
+
+		opened, _, err := openItem(sealed, vaultKey)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(item, opened))
+	})
+
+	t.Run("data of another item", func(t *testing.T) {
+		sealed, _ := sealItem(item, vaultKey)
+		sealed.Title = "bank"
+
+		_, _, err := openItem(sealed, vaultKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("legacy sealed text", func(t *testing.T) {
+		sealed, _ := service.Seal([]byte("login::password::meta"), vaultKey)
+
+		opened, legacy, err := openItem(&pb.Item{Title: "wifi", Payload: &pb.Item_Sealed{Sealed: sealed}}, vaultKey)
+		assert.NoError(t, err)
+		assert.Nil(t, opened)
+		assert.Equal(t, "login::password::meta", legacy)
+	})
+}
+
+func TestFormatItem(t *testing.T) {
+	item := &pb.Item{Title: "wifi", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "admin", Password: "se::cret", Meta: "home"}}}
+	assert.Equal(t, "Ваши данные: wifi\nлогин: admin\nпароль: se::cret\nметаданные: home\n", formatItem(item))
+
+	binary := &pb.Item{Title: "key", Payload: &pb.Item_Binary{Binary: &pb.BinaryItem{Data: []byte{0xff, 0x00}}}}
+	assert.Equal(t, "Ваши данные: key\nданные (base64): /wA=\n", formatItem(binary))
+}
@@ -2,45 +2,180 @@ package app
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"keeper/internal/client/service"
 	pb "keeper/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-func (s *App) logIn(reader bufio.Reader, client pb.KeeperServiceClient, stream pb.KeeperService_CommandClient) error {
-	username, password, err := getCredentials(reader)
+// tokenMetadataKey ключ метаданных gRPC, в котором передается токен сессии
+const tokenMetadataKey = "token"
+
+// deviceMetadataKey ключ метаданных gRPC, в котором при входе передается название устройства
+const deviceMetadataKey = "device"
+
+func (s *App) logIn(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
 	if err != nil {
 		return err
 	}
+	return s.startSession(username, token, client)
+}
+
+// signIn запрашивает логин, пароль и при необходимости одноразовый код и возвращает токен сессии
+func (s *App) signIn(reader *bufio.Reader, client pb.KeeperServiceClient) (string, string, error) {
+	username, _, token, err := s.signInWithPassword(reader, client)
+	return username, token, err
+}
+
+// signInWithPassword выполняет вход так же, как signIn, и дополнительно возвращает пароль,
+// отправленный серверу: при шифровании на клиенте это ключ, выведенный из мастер-пароля
+func (s *App) signInWithPassword(reader *bufio.Reader, client pb.KeeperServiceClient) (string, string, string, error) {
+	username, password, err := getCredentials(reader)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// параметры шифрования нужны до входа: при шифровании на клиенте пароль не отправляется на сервер
+	params, err := client.GetVaultParams(s.ctx, &pb.VaultParamsRequest{Username: username})
+	if err != nil {
+		log.Printf("get vault params failed: %v", err)
+		return "", "", "", err
+	}
+
+	authPassword := password
+	var encKey []byte
+	if params.ClientEncryption {
+		authPassword, encKey, err = service.DeriveKeys(password, params.KdfSalt)
+		if err != nil {
+			log.Printf("key derivation failed: %v", err)
+			return "", "", "", err
+		}
+	}
 
 	// Отправка запроса на авторизацию
-	resp, err := client.Login(s.ctx, &pb.LoginRequest{Username: username, Password: password})
+	req := &pb.LoginRequest{Username: username, Password: authPassword}
+	resp, err := client.Login(s.withDevice(), req)
 	if err != nil {
 		log.Printf("login failed: %v", err)
-		return err
+		printRetryAfter(err)
+		return "", "", "", err
+	}
+
+	// включена двухфакторная аутентификация, повторяем вход с одноразовым кодом
+	if resp.TotpRequired {
+		fmt.Println(resp.Message)
+		req.TotpCode, err = getOneTimeCode(reader)
+		if err != nil {
+			return "", "", "", err
+		}
+		resp, err = client.Login(s.withDevice(), req)
+		if err != nil {
+			log.Printf("login failed: %v", err)
+			printRetryAfter(err)
+			return "", "", "", err
+		}
+	}
+
+	if params.ClientEncryption {
+		s.vaultKey, err = service.Open(resp.WrappedVaultKey, encKey)
+		if err != nil {
+			log.Printf("failed to unlock vault: %v", err)
+			return "", "", "", err
+		}
 	}
 	fmt.Println(resp.Message)
 
-	s.startSession(username, stream)
-	return nil
+	return username, authPassword, resp.Token, nil
 }
 
-func (s *App) startSession(username string, stream pb.KeeperService_CommandClient) error {
+// retryAfter возвращает время, через которое сервер разрешит повторить вход после блокировки
+func retryAfter(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if retry, ok := detail.(*errdetails.RetryInfo); ok {
+			return retry.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, false
+}
 
-	// Отправка начального сообщения для инициализации
-	err := s.send(stream, username, "/init")
+// printRetryAfter сообщает пользователю, через сколько можно повторить вход, если сервер его временно заблокировал
+func printRetryAfter(err error) {
+	if wait, ok := retryAfter(err); ok {
+		fmt.Printf("Слишком много неудачных попыток. Повторите через %v.\n", wait)
+	}
+}
+
+// getOneTimeCode читает одноразовый код или код восстановления
+func getOneTimeCode(reader *bufio.Reader) (string, error) {
+	code, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading code: %v", err)
+		return "", err
+	}
+	return strings.TrimSpace(code), nil
+}
+
+// withDevice добавляет название устройства в метаданные запроса на вход, оно показывается в списке сессий
+func (s *App) withDevice() context.Context {
+	if s.cfg.DeviceName == "" {
+		return s.ctx
+	}
+	return metadata.AppendToOutgoingContext(s.ctx, deviceMetadataKey, s.cfg.DeviceName)
+}
+
+// withToken добавляет токен сессии в метаданные запроса
+func (s *App) withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(s.ctx, tokenMetadataKey, token)
+}
+
+func (s *App) startSession(username string, token string, client pb.KeeperServiceClient) error {
+	// стартуем стрим, сервер определяет пользователя по токену сессии
+	s.reopen = func() (pb.KeeperService_CommandClient, error) {
+		return s.openStream(username, token, client)
+	}
+	stream, err := s.reopen()
 	if err != nil {
 		return err
 	}
+	s.stream.Store(&commandStream{stream})
 
 	// Горутина для получения сообщений от сервера
-	go s.getData(stream)
+	go s.getData()
 
 	// Горутина для чтения пользовательского ввода и отправки сообщений
-	go s.sendData(stream, username)
+	go s.sendData(username)
 
 	s.wg.Wait() // Ожидание завершения горутины
-	stream.CloseSend()
+	s.stream.Load().CloseSend()
 	return nil
 }
+
+// openStream открывает стрим команд с токеном сессии и отправляет начальное сообщение
+func (s *App) openStream(username string, token string, client pb.KeeperServiceClient) (pb.KeeperService_CommandClient, error) {
+	stream, err := client.Command(s.withToken(token))
+	if err != nil {
+		log.Printf("could not start command: %v", err)
+		return nil, err
+	}
+
+	// Отправка начального сообщения для инициализации
+	err = s.send(stream, username, "/init")
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
@@ -7,13 +7,20 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"keeper/internal/client/config"
+	"keeper/internal/client/service"
 	"keeper/internal/mocks"
 	pb "keeper/proto"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func TestLogIn(t *testing.T) {
@@ -33,7 +40,7 @@ func TestLogIn(t *testing.T) {
 		input := "invalid_input_format\n"
 		reader := bufio.NewReader(strings.NewReader(input))
 
-		err := app.logIn(*reader, mockClient, mockStream)
+		err := app.logIn(*reader, mockClient)
 		assert.Error(t, err)
 		assert.Equal(t, ErrCredentialsFormat, err)
 
@@ -45,14 +52,94 @@ func TestLogIn(t *testing.T) {
 		input := "username password\n"
 		reader := bufio.NewReader(strings.NewReader(input))
 
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
 		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
 			Return(nil, errors.New("login failed"))
 
-		err := app.logIn(*reader, mockClient, mockStream)
+		err := app.logIn(*reader, mockClient)
 		assert.Error(t, err)
 		assert.EqualError(t, err, "login failed")
 
 		mockClient.AssertExpectations(t)
 		mockStream.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
 	})
+
+	t.Run("stream opened with session token", func(t *testing.T) {
+		input := "username password\n"
+		reader := bufio.NewReader(strings.NewReader(input))
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+		hasToken := mock.MatchedBy(func(ctx context.Context) bool {
+			md, ok := metadata.FromOutgoingContext(ctx)
+			return ok && len(md.Get(tokenMetadataKey)) == 1 && md.Get(tokenMetadataKey)[0] == "secret-token"
+		})
+		mockClient.On("Command", hasToken).Return(nil, errors.New("stream failed"))
+
+		err := app.logIn(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockStream.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+	t.Run("client encryption unlocks vault", func(t *testing.T) {
+		input := "username password\n"
+		reader := bufio.NewReader(strings.NewReader(input))
+
+		salt, _ := service.GenerateSalt()
+		authKey, encKey, _ := service.DeriveKeys("password", salt)
+		vaultKey, _ := service.GenerateVaultKey()
+		wrappedKey, _ := service.Seal(vaultKey, encKey)
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{ClientEncryption: true, KdfSalt: salt}, nil)
+		// вместо пароля на сервер уходит выведенный ключ
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: authKey}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token", WrappedVaultKey: wrappedKey}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.logIn(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+		assert.Equal(t, vaultKey, app.vaultKey)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("one-time code requested", func(t *testing.T) {
+		input := "username password\n123456\n"
+		reader := bufio.NewReader(strings.NewReader(input))
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "code", TotpRequired: true}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password", TotpCode: "123456"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+
+		username, token, err := app.signIn(reader, mockClient)
+		assert.NoError(t, err)
+		assert.Equal(t, "username", username)
+		assert.Equal(t, "secret-token", token)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	st, _ := status.New(codes.ResourceExhausted, "too many failed attempts").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(30 * time.Second)})
+
+	wait, ok := retryAfter(st.Err())
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+
+	_, ok = retryAfter(status.Error(codes.Unauthenticated, "wrong credentials"))
+	assert.False(t, ok)
 }
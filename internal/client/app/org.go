@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	pb "keeper/proto"
+)
+
+// ErrOrgCommand описывает ввод, не соответствующий ни одному шаблону команд организаций.
+var ErrOrgCommand = errors.New("неверная команда организации")
+
+// removeMember роль в шаблоне участника, которая удаляет его из организации
+const removeMember = "-"
+
+// orgRoles роли участников из шаблона ввода
+var orgRoles = map[string]pb.OrgRole{
+	"owner":  pb.OrgRole_ORG_ROLE_OWNER,
+	"admin":  pb.OrgRole_ORG_ROLE_ADMIN,
+	"member": pb.OrgRole_ORG_ROLE_MEMBER,
+	"ro":     pb.OrgRole_ORG_ROLE_READ_ONLY,
+}
+
+// orgRoleNames названия ролей в списке организаций
+var orgRoleNames = map[pb.OrgRole]string{
+	pb.OrgRole_ORG_ROLE_OWNER:     "владелец",
+	pb.OrgRole_ORG_ROLE_ADMIN:     "администратор",
+	pb.OrgRole_ORG_ROLE_MEMBER:    "участник",
+	pb.OrgRole_ORG_ROLE_READ_ONLY: "только чтение",
+}
+
+// itemTemplates шаблоны командных записей по типу из команды
+var itemTemplates = map[string]*pb.Item{
+	"password": {Payload: &pb.Item_Login{Login: &pb.LoginItem{}}},
+	"text":     {Payload: &pb.Item_Text{Text: &pb.TextItem{}}},
+	"bytes":    {Payload: &pb.Item_Binary{Binary: &pb.BinaryItem{}}},
+	"card":     {Payload: &pb.Item_Card{Card: &pb.CardItem{}}},
+}
+
+// manageOrganizations входит в аккаунт, показывает организации пользователя
+// и выполняет одну команду управления организацией
+func (s *App) manageOrganizations(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.withToken(token)
+	resp, err := client.ListOrganizations(ctx, &pb.ListOrganizationsRequest{})
+	if err != nil {
+		log.Printf("list organizations failed: %v", err)
+		return err
+	}
+
+	fmt.Println("\nОрганизации:")
+	for _, org := range resp.Organizations {
+		fmt.Printf("%s (%s): %s\n", org.Name, orgRoleNames[org.Role], strings.Join(org.Collections, ", "))
+	}
+	fmt.Println("Введите команду по шаблону или пустую строку, чтобы продолжить:")
+	fmt.Println("org::[организация] - создать организацию")
+	fmt.Println("member::[организация]::[пользователь]::[роль] - роль owner, admin, member или ro, минус (-) удаляет участника")
+	fmt.Println("collection::[организация]::[коллекция] - создать коллекцию")
+	fmt.Println("item::[организация]::[коллекция]::[тип] - тип password, text, bytes или card, поля записи вводятся следующими строками")
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading organization command: %v", err)
+		return err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return s.startSession(username, token, client)
+	}
+
+	var message string
+	parts := strings.SplitN(line, "::", 5)
+	switch {
+	case parts[0] == "org" && len(parts) == 2:
+		var resp *pb.CreateOrganizationResponse
+		resp, err = client.CreateOrganization(ctx, &pb.CreateOrganizationRequest{Name: parts[1]})
+		message = resp.GetMessage()
+	case parts[0] == "member" && len(parts) == 4 && parts[3] == removeMember:
+		var resp *pb.RemoveOrgMemberResponse
+		resp, err = client.RemoveOrgMember(ctx, &pb.RemoveOrgMemberRequest{Organization: parts[1], Username: parts[2]})
+		message = resp.GetMessage()
+	case parts[0] == "member" && len(parts) == 4:
+		role, ok := orgRoles[parts[3]]
+		if !ok {
+			log.Printf("invalid role: %s", parts[3])
+			return ErrOrgCommand
+		}
+		var resp *pb.SetOrgMemberResponse
+		resp, err = client.SetOrgMember(ctx, &pb.SetOrgMemberRequest{Organization: parts[1], Username: parts[2], Role: role})
+		message = resp.GetMessage()
+	case parts[0] == "collection" && len(parts) == 3:
+		var resp *pb.CreateCollectionResponse
+		resp, err = client.CreateCollection(ctx, &pb.CreateCollectionRequest{Organization: parts[1], Name: parts[2]})
+		message = resp.GetMessage()
+	case parts[0] == "item" && len(parts) == 4:
+		template, ok := itemTemplates[parts[3]]
+		if !ok {
+			log.Printf("invalid item type: %s", parts[3])
+			return ErrOrgCommand
+		}
+		var item *pb.Item
+		if item, err = readItem(&reader, template); err != nil {
+			return err
+		}
+		var resp *pb.CreateCollectionItemResponse
+		resp, err = client.CreateCollectionItem(ctx, &pb.CreateCollectionItemRequest{
+			Organization: parts[1],
+			Collection:   parts[2],
+			Item:         item,
+		})
+		message = resp.GetMessage()
+	default:
+		log.Printf("invalid organization command: %s", line)
+		return ErrOrgCommand
+	}
+	if err != nil {
+		log.Printf("organization command failed: %v", err)
+		return err
+	}
+	fmt.Println(message)
+	return s.startSession(username, token, client)
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestManageOrganizations(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	expectLogin := func() {
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+		mockClient.On("ListOrganizations", mock.Anything, &pb.ListOrganizationsRequest{}).
+			Return(&pb.ListOrganizationsResponse{Organizations: []*pb.Organization{{Name: "acme", Collections: []string{"devops"}}}}, nil)
+	}
+
+	t.Run("organization created", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\norg::acme\n"))
+
+		expectLogin()
+		mockClient.On("CreateOrganization", mock.Anything, &pb.CreateOrganizationRequest{Name: "acme"}).
+			Return(&pb.CreateOrganizationResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageOrganizations(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("read-only member added", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nmember::acme::bob::ro\n"))
+
+		expectLogin()
+		mockClient.On("SetOrgMember", mock.Anything, &pb.SetOrgMemberRequest{
+			Organization: "acme",
+			Username:     "bob",
+			Role:         pb.OrgRole_ORG_ROLE_READ_ONLY,
+		}).Return(&pb.SetOrgMemberResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageOrganizations(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("member removed", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nmember::acme::bob::-\n"))
+
+		expectLogin()
+		mockClient.On("RemoveOrgMember", mock.Anything, &pb.RemoveOrgMemberRequest{Organization: "acme", Username: "bob"}).
+			Return(&pb.RemoveOrgMemberResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageOrganizations(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("team item created", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nitem::acme::devops::password\nvpn\nadmin\nse::cret\nmeta\n"))
+
+		expectLogin()
+		mockClient.On("CreateCollectionItem", mock.Anything, &pb.CreateCollectionItemRequest{
+			Organization: "acme",
+			Collection:   "devops",
+			Item:         &pb.Item{Title: "vpn", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "admin", Password: "se::cret", Meta: "meta"}}},
+		}).Return(&pb.CreateCollectionItemResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageOrganizations(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\ncollection::acme::devops\n"))
+
+		expectLogin()
+		mockClient.On("CreateCollection", mock.Anything, &pb.CreateCollectionRequest{Organization: "acme", Name: "devops"}).
+			Return(nil, errors.New("permission denied"))
+
+		err := app.manageOrganizations(*reader, mockClient)
+		assert.EqualError(t, err, "permission denied")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nmember::acme::bob::boss\n"))
+
+		expectLogin()
+
+		err := app.manageOrganizations(*reader, mockClient)
+		assert.Equal(t, ErrOrgCommand, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
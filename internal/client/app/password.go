@@ -0,0 +1,88 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"keeper/internal/client/service"
+	pb "keeper/proto"
+)
+
+// ErrPasswordFormat описывает пустой пароль или пароль с пробелами, который нельзя будет ввести при входе.
+var ErrPasswordFormat = errors.New("пароль не должен быть пустым или содержать пробелы")
+
+// changePassword входит в аккаунт и меняет пароль. При шифровании на клиенте ключ хранилища
+// заново шифруется ключом из нового пароля, данные при этом не перешифровываются.
+func (s *App) changePassword(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, oldPassword, token, err := s.signInWithPassword(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Введите новый пароль:")
+	newPassword, err := getNewPassword(&reader)
+	if err != nil {
+		return err
+	}
+
+	req := &pb.ChangePasswordRequest{OldPassword: oldPassword, NewPassword: newPassword}
+	if s.vaultKey != nil {
+		err = rewrapVault(req, newPassword, s.vaultKey)
+		if err != nil {
+			log.Printf("failed to rewrap vault key: %v", err)
+			return err
+		}
+	}
+
+	resp, err := client.ChangePassword(s.withToken(token), req)
+	if err != nil {
+		log.Printf("change password failed: %v", err)
+		printRetryAfter(err)
+		return err
+	}
+	fmt.Println(resp.Message)
+
+	return s.startSession(username, token, client)
+}
+
+// getNewPassword читает новый пароль
+func getNewPassword(reader *bufio.Reader) (string, error) {
+	password, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading password: %v", err)
+		return "", err
+	}
+	password = strings.TrimSpace(password)
+	if password == "" || strings.ContainsAny(password, " \t") {
+		log.Printf("invalid password format")
+		return "", ErrPasswordFormat
+	}
+	return password, nil
+}
+
+// rewrapVault выводит ключи из нового пароля с новой солью: на сервер вместо пароля уходит
+// первый ключ, вторым шифруется текущий ключ хранилища.
+func rewrapVault(req *pb.ChangePasswordRequest, newPassword string, vaultKey []byte) error {
+	salt, err := service.GenerateSalt()
+	if err != nil {
+		return err
+	}
+
+	authKey, encKey, err := service.DeriveKeys(newPassword, salt)
+	if err != nil {
+		return err
+	}
+
+	wrappedKey, err := service.Seal(vaultKey, encKey)
+	if err != nil {
+		return err
+	}
+
+	req.NewPassword = authKey
+	req.KdfSalt = salt
+	req.WrappedVaultKey = wrappedKey
+	return nil
+}
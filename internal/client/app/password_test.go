@@ -0,0 +1,96 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/client/service"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChangePassword(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	t.Run("password changed", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username old\nnew\n"))
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "old"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+		mockClient.On("ChangePassword", mock.Anything, &pb.ChangePasswordRequest{OldPassword: "old", NewPassword: "new"}).
+			Return(&pb.ChangePasswordResponse{Message: "changed"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.changePassword(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("vault key rewrapped", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username old\nnew\n"))
+		salt, _ := service.GenerateSalt()
+		authKey, encKey, _ := service.DeriveKeys("old", salt)
+		vaultKey, _ := service.GenerateVaultKey()
+		wrappedKey, _ := service.Seal(vaultKey, encKey)
+
+		// ключ хранилища должен открываться ключом из нового пароля и новой соли
+		rewrapped := mock.MatchedBy(func(req *pb.ChangePasswordRequest) bool {
+			newAuthKey, newEncKey, err := service.DeriveKeys("new", req.KdfSalt)
+			if err != nil || req.OldPassword != authKey || req.NewPassword != newAuthKey || req.KdfSalt == salt {
+				return false
+			}
+			opened, err := service.Open(req.WrappedVaultKey, newEncKey)
+			return err == nil && string(opened) == string(vaultKey)
+		})
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{ClientEncryption: true, KdfSalt: salt}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: authKey}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token", WrappedVaultKey: wrappedKey}, nil)
+		mockClient.On("ChangePassword", mock.Anything, rewrapped).
+			Return(&pb.ChangePasswordResponse{Message: "changed"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.changePassword(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("invalid new password", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username old\nnew password\n"))
+
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "old"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+
+		err := app.changePassword(*reader, mockClient)
+		assert.ErrorIs(t, err, ErrPasswordFormat)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
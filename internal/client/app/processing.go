@@ -3,14 +3,26 @@ package app
 import (
 	"bufio"
 	"io"
+	"strings"
+	"time"
 
 	pb "keeper/proto"
 	"log"
 	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func (s *App) getData(stream pb.KeeperService_CommandClient) {
+// reconnectAttempts число попыток переподключить стрим после потери соединения с сервером
+const reconnectAttempts = 10
+
+// reconnectDelay пауза перед попыткой переподключения
+var reconnectDelay = 3 * time.Second
+
+func (s *App) getData() {
 	defer s.wg.Done()
+	stream := s.stream.Load()
 	for {
 		select {
 		case <-s.ctx.Done():
@@ -31,7 +43,7 @@ func (s *App) getData(stream pb.KeeperService_CommandClient) {
 
 			select {
 			case msg := <-msgChan:
-				log.Println(msg.Message)
+				s.printMessage(msg)
 			case err := <-errChan:
 				if err == io.EOF {
 					log.Printf("Stream closed by server")
@@ -39,6 +51,14 @@ func (s *App) getData(stream pb.KeeperService_CommandClient) {
 					return
 				}
 				log.Printf("error receiving message: %v", err)
+				// сервер недоступен, например перезапускается: продолжаем сессию в новом стриме
+				if status.Code(err) == codes.Unavailable {
+					if reopened, ok := s.reconnect(); ok {
+						stream = &commandStream{reopened}
+						s.stream.Store(stream)
+						continue
+					}
+				}
 				s.cancel()
 				return
 			case <-s.ctx.Done():
@@ -49,7 +69,7 @@ func (s *App) getData(stream pb.KeeperService_CommandClient) {
 
 }
 
-func (s *App) sendData(stream pb.KeeperService_CommandClient, username string) {
+func (s *App) sendData(username string) {
 	defer s.wg.Done()
 	scanner := bufio.NewScanner(os.Stdin)
 
@@ -76,7 +96,19 @@ func (s *App) sendData(stream pb.KeeperService_CommandClient, username string) {
 
 			select {
 			case msg := <-textChan:
-				err := s.send(stream, username, msg)
+				var err error
+				stream := s.stream.Load()
+				form := s.form.Load()
+				switch {
+				case form != nil && !isStreamCommand(msg):
+					err = s.fillForm(stream, username, form, msg)
+				case form != nil && strings.TrimSpace(msg) != helpCommand:
+					// команда отменяет ввод полей записи, подсказка оставляет форму
+					s.form.CompareAndSwap(form, nil)
+					err = s.send(stream, username, msg)
+				default:
+					err = s.send(stream, username, msg)
+				}
 				if err != nil {
 					s.cancel()
 				}
@@ -94,6 +126,44 @@ func (s *App) sendData(stream pb.KeeperService_CommandClient, username string) {
 
 }
 
+// reconnect открывает стрим заново с токеном текущей сессии. Сервер продолжает диалог
+// с того места, где он прервался, в том числе после перезапуска.
+func (s *App) reconnect() (pb.KeeperService_CommandClient, bool) {
+	// поля записи, которые вводил пользователь, сервер запросит заново
+	s.form.Store(nil)
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		select {
+		case <-s.ctx.Done():
+			return nil, false
+		case <-time.After(reconnectDelay):
+		}
+
+		log.Printf("Переподключение к серверу (%d/%d)...", attempt, reconnectAttempts)
+		stream, err := s.reopen()
+		if err == nil {
+			return stream, true
+		}
+		// сессия завершена: продолжить ее нельзя
+		if status.Code(err) == codes.Unauthenticated {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// helpCommand команда подсказки стрима команд
+const helpCommand = "/help"
+
+// isStreamCommand проверяет, что ввод - команда стрима, доступная в любом состоянии,
+// в том числе во время ввода полей записи
+func isStreamCommand(value string) bool {
+	switch strings.TrimSpace(value) {
+	case "/back", "/cancel", helpCommand, "/menu":
+		return true
+	}
+	return false
+}
+
 func (s *App) send(stream pb.KeeperService_CommandClient, username string, msg string) error {
 	if err := stream.Send(&pb.CommandMessage{Username: username, Message: msg}); err != nil {
 		log.Printf("error sending message: %v", err)
@@ -101,3 +171,62 @@ func (s *App) send(stream pb.KeeperService_CommandClient, username string, msg s
 	}
 	return nil
 }
+
+// printMessage выводит сообщение сервера. Данные записи форматирует клиент,
+// по шаблону записи клиент начинает запрашивать у пользователя ее поля.
+func (s *App) printMessage(msg *pb.CommandMessage) {
+	if msg.ItemTemplate != nil {
+		form := newItemForm(msg.ItemTemplate, msg.PayloadPrompt && s.vaultKey != nil)
+		s.form.Store(form)
+		log.Println(msg.Message)
+		log.Println(form.prompt())
+		return
+	}
+	if msg.Item != nil {
+		s.printItem(msg.Item)
+		return
+	}
+	log.Println(msg.Message)
+}
+
+// printItem выводит данные записи, расшифровывая данные, зашифрованные на клиенте
+func (s *App) printItem(item *pb.Item) {
+	opened, legacy, err := openItem(item, s.vaultKey)
+	if err != nil {
+		log.Printf("failed to decrypt data: %v", err)
+		return
+	}
+	if opened == nil {
+		log.Printf("Ваши данные:\n%s", legacy)
+		return
+	}
+	log.Print(formatItem(opened))
+}
+
+// fillForm заполняет следующее поле записи и, когда заполнены все поля, отправляет запись серверу.
+// Данные записи, которую сервер просил зашифровать, шифруются ключом хранилища.
+func (s *App) fillForm(stream pb.KeeperService_CommandClient, username string, form *itemForm, value string) error {
+	done, err := form.fill(value)
+	if err != nil {
+		log.Printf("Не верный формат данных: %v", err)
+	}
+	if !done {
+		log.Println(form.prompt())
+		return nil
+	}
+	s.form.CompareAndSwap(form, nil)
+
+	item := form.item
+	if form.seal {
+		item, err = sealItem(item, s.vaultKey)
+		if err != nil {
+			log.Printf("failed to encrypt data: %v", err)
+			return err
+		}
+	}
+	if err := stream.Send(&pb.CommandMessage{Username: username, Item: item}); err != nil {
+		log.Printf("error sending message: %v", err)
+		return err
+	}
+	return nil
+}
@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"log"
 
+	"keeper/internal/client/service"
 	pb "keeper/proto"
 	"strings"
 )
 
-func getCredentials(reader bufio.Reader) (string, string, error) {
+func getCredentials(reader *bufio.Reader) (string, string, error) {
 	fmt.Println("Введите username и password через пробел. Пример: username password")
 	credentials, err := reader.ReadString('\n')
 	if err != nil {
@@ -27,20 +28,63 @@ func getCredentials(reader bufio.Reader) (string, string, error) {
 	return username, password, nil
 }
 
-func (s *App) registration(reader bufio.Reader, client pb.KeeperServiceClient, stream pb.KeeperService_CommandClient) error {
-	username, password, err := getCredentials(reader)
+func (s *App) registration(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, password, err := getCredentials(&reader)
 	if err != nil {
 		return err
 	}
 
+	req := &pb.RegisterRequest{Username: username, Password: password}
+	var vaultKey []byte
+	if s.cfg.ClientEncryption {
+		req, vaultKey, err = newVaultRegisterRequest(username, password)
+		if err != nil {
+			log.Printf("failed to create vault: %v", err)
+			return err
+		}
+	}
+
 	// Отправка запроса на регистрацию
-	resp, err := client.Register(s.ctx, &pb.RegisterRequest{Username: username, Password: password})
+	resp, err := client.Register(s.withDevice(), req)
 	if err != nil {
 		log.Printf("registration failed: %v", err)
+		printRetryAfter(err)
 		return err
 	}
+	s.vaultKey = vaultKey
 	fmt.Println(resp.Message)
 
-	s.startSession(username, stream)
-	return nil
+	return s.startSession(username, resp.Token, client)
+}
+
+// newVaultRegisterRequest готовит регистрацию с шифрованием на клиенте:
+// создает ключ хранилища и шифрует его ключом, выведенным из мастер-пароля.
+func newVaultRegisterRequest(username string, password string) (*pb.RegisterRequest, []byte, error) {
+	salt, err := service.GenerateSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authKey, encKey, err := service.DeriveKeys(password, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vaultKey, err := service.GenerateVaultKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrappedKey, err := service.Seal(vaultKey, encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &pb.RegisterRequest{
+		Username:         username,
+		Password:         authKey,
+		ClientEncryption: true,
+		KdfSalt:          salt,
+		WrappedVaultKey:  wrappedKey,
+	}, vaultKey, nil
 }
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"keeper/internal/client/config"
+	"keeper/internal/client/service"
 	"keeper/internal/mocks"
 	pb "keeper/proto"
 	"strings"
@@ -18,7 +20,7 @@ func TestGetCredentials(t *testing.T) {
 	t.Run("successful input", func(t *testing.T) {
 		input := "username password\n"
 		reader := bufio.NewReader(strings.NewReader(input))
-		username, password, err := getCredentials(*reader)
+		username, password, err := getCredentials(reader)
 		assert.NoError(t, err)
 		assert.Equal(t, "username", username)
 		assert.Equal(t, "password", password)
@@ -27,7 +29,7 @@ func TestGetCredentials(t *testing.T) {
 	t.Run("invalid input format", func(t *testing.T) {
 		input := "invalid_input_format\n"
 		reader := bufio.NewReader(strings.NewReader(input))
-		username, password, err := getCredentials(*reader)
+		username, password, err := getCredentials(reader)
 		assert.Error(t, err)
 		assert.Equal(t, ErrCredentialsFormat, err)
 		assert.Equal(t, "", username)
@@ -36,7 +38,7 @@ func TestGetCredentials(t *testing.T) {
 
 	t.Run("error reading input", func(t *testing.T) {
 		reader := bufio.NewReader(strings.NewReader(""))
-		_, _, err := getCredentials(*reader)
+		_, _, err := getCredentials(reader)
 		assert.Error(t, err)
 	})
 }
@@ -46,6 +48,7 @@ func TestRegistration(t *testing.T) {
 	mockStream := new(mocks.KeeperService_CommandClient)
 	app := &App{
 		ctx: context.Background(),
+		cfg: &config.Config{},
 		wg:  &sync.WaitGroup{},
 	}
 
@@ -55,7 +58,7 @@ func TestRegistration(t *testing.T) {
 		mockClient.On("Register", mock.Anything, &pb.RegisterRequest{Username: "username", Password: "password"}).
 			Return(nil, errors.New("registration failed"))
 
-		err := app.registration(*reader, mockClient, mockStream)
+		err := app.registration(*reader, mockClient)
 		assert.Error(t, err)
 		assert.EqualError(t, err, "registration failed")
 
@@ -67,7 +70,7 @@ func TestRegistration(t *testing.T) {
 		input := "invalid_input_format\n"
 		reader := bufio.NewReader(strings.NewReader(input))
 
-		err := app.registration(*reader, mockClient, mockStream)
+		err := app.registration(*reader, mockClient)
 		assert.Error(t, err)
 		assert.Equal(t, ErrCredentialsFormat, err)
 
@@ -78,10 +81,39 @@ func TestRegistration(t *testing.T) {
 	t.Run("error reading input", func(t *testing.T) {
 		reader := bufio.NewReader(strings.NewReader(""))
 
-		err := app.registration(*reader, mockClient, mockStream)
+		err := app.registration(*reader, mockClient)
 		assert.Error(t, err)
 
 		mockClient.AssertExpectations(t)
 		mockStream.AssertExpectations(t)
 	})
+	t.Run("client encryption", func(t *testing.T) {
+		input := "username password\n"
+		reader := bufio.NewReader(strings.NewReader(input))
+		e2eApp := &App{
+			ctx: context.Background(),
+			cfg: &config.Config{ClientEncryption: true},
+			wg:  &sync.WaitGroup{},
+		}
+
+		var sent *pb.RegisterRequest
+		mockClient.On("Register", mock.Anything, mock.MatchedBy(func(req *pb.RegisterRequest) bool {
+			sent = req
+			return req.ClientEncryption && req.Password != "password"
+		})).Return(&pb.RegisterResponse{Token: "secret-token"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := e2eApp.registration(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		// ключ хранилища расшифровывается ключом, выведенным из пароля
+		_, encKey, err := service.DeriveKeys("password", sent.KdfSalt)
+		assert.NoError(t, err)
+		vaultKey, err := service.Open(sent.WrappedVaultKey, encKey)
+		assert.NoError(t, err)
+		assert.Equal(t, vaultKey, e2eApp.vaultKey)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
 }
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "keeper/proto"
+)
+
+// ErrSessionNumber описывает ввод номера сессии, которой нет в списке.
+var ErrSessionNumber = errors.New("неверный номер сессии")
+
+// sessionTimeLayout формат времени в списке сессий
+const sessionTimeLayout = "2006-01-02 15:04"
+
+// manageSessions входит в аккаунт, показывает активные сессии и по выбору пользователя завершает одну из них
+func (s *App) manageSessions(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.withToken(token)
+	resp, err := client.ListSessions(ctx, &pb.ListSessionsRequest{})
+	if err != nil {
+		log.Printf("list sessions failed: %v", err)
+		return err
+	}
+
+	fmt.Println("\nАктивные сессии:")
+	for i, session := range resp.Sessions {
+		fmt.Printf("%d) %s\n", i+1, formatSession(session))
+	}
+	fmt.Println("Введите номер сессии, чтобы завершить ее, или пустую строку, чтобы продолжить:")
+
+	choice, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading session number: %v", err)
+		return err
+	}
+	choice = strings.TrimSpace(choice)
+	if choice == "" {
+		return s.startSession(username, token, client)
+	}
+
+	number, err := strconv.Atoi(choice)
+	if err != nil || number < 1 || number > len(resp.Sessions) {
+		log.Printf("invalid session number: %s", choice)
+		return ErrSessionNumber
+	}
+	session := resp.Sessions[number-1]
+
+	revokeResp, err := client.RevokeSession(ctx, &pb.RevokeSessionRequest{SessionId: session.Id})
+	if err != nil {
+		log.Printf("revoke session failed: %v", err)
+		return err
+	}
+	fmt.Println(revokeResp.Message)
+
+	// токен текущей сессии больше не действует
+	if session.Current {
+		s.vaultKey = nil
+		return nil
+	}
+	return s.startSession(username, token, client)
+}
+
+// formatSession возвращает строку списка сессий: устройство, адрес, время входа и последней активности
+func formatSession(session *pb.SessionInfo) string {
+	device := session.Device
+	if device == "" {
+		device = "неизвестное устройство"
+	}
+	ip := session.Ip
+	if ip == "" {
+		ip = "адрес неизвестен"
+	}
+
+	line := fmt.Sprintf("%s, %s, вход %s, активность %s", device, ip,
+		time.Unix(session.CreatedAtUnix, 0).Format(sessionTimeLayout),
+		time.Unix(session.LastSeenAtUnix, 0).Format(sessionTimeLayout))
+	if session.Current {
+		line += " (текущая)"
+	}
+	if session.Connected {
+		line += " (подключена)"
+	}
+	return line
+}
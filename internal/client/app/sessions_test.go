@@ -0,0 +1,99 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestManageSessions(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+			DeviceName: "laptop",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	sessions := &pb.ListSessionsResponse{Sessions: []*pb.SessionInfo{
+		{Id: "current", Device: "laptop", Current: true},
+		{Id: "other", Device: "phone", Connected: true},
+	}}
+	// при входе серверу передается название устройства
+	withDevice := mock.MatchedBy(func(ctx context.Context) bool {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		devices := md.Get(deviceMetadataKey)
+		return len(devices) == 1 && devices[0] == "laptop"
+	})
+	expectLogin := func() {
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", withDevice, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+		mockClient.On("ListSessions", mock.Anything, &pb.ListSessionsRequest{}).Return(sessions, nil)
+	}
+
+	t.Run("other session revoked", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n2\n"))
+
+		expectLogin()
+		mockClient.On("RevokeSession", mock.Anything, &pb.RevokeSessionRequest{SessionId: "other"}).
+			Return(&pb.RevokeSessionResponse{Message: "revoked"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageSessions(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("current session revoked", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n1\n"))
+
+		// стрим не открывается, токен уже не действует
+		expectLogin()
+		mockClient.On("RevokeSession", mock.Anything, &pb.RevokeSessionRequest{SessionId: "current"}).
+			Return(&pb.RevokeSessionResponse{Message: "revoked"}, nil)
+
+		err := app.manageSessions(*reader, mockClient)
+		assert.NoError(t, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("invalid session number", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n3\n"))
+
+		expectLogin()
+
+		err := app.manageSessions(*reader, mockClient)
+		assert.ErrorIs(t, err, ErrSessionNumber)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
+
+func TestFormatSession(t *testing.T) {
+	line := formatSession(&pb.SessionInfo{Current: true, Connected: true})
+	assert.Contains(t, line, "неизвестное устройство")
+	assert.Contains(t, line, "адрес неизвестен")
+	assert.True(t, strings.HasSuffix(line, "(текущая) (подключена)"))
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	pb "keeper/proto"
+)
+
+// ErrShareFormat описывает ввод, не соответствующий шаблону доступа к записи.
+var ErrShareFormat = errors.New("неверный формат доступа")
+
+// revokeAccess отметка в шаблоне доступа, которая закрывает доступ
+const revokeAccess = "-"
+
+// shareAccess уровни доступа из шаблона ввода
+var shareAccess = map[string]pb.SharePermission{
+	"r":  pb.SharePermission_SHARE_PERMISSION_READ,
+	"rw": pb.SharePermission_SHARE_PERMISSION_WRITE,
+}
+
+// shareItem входит в аккаунт и открывает или закрывает другому пользователю доступ к записи
+func (s *App) shareItem(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Введите данные по шаблону: [название]::[пользователь]::[доступ]")
+	fmt.Println("Доступ: r - чтение, rw - чтение и запись, минус (-) закрывает доступ")
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading share: %v", err)
+		return err
+	}
+
+	parts := strings.Split(strings.TrimSpace(line), "::")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		log.Printf("invalid share format: %s", line)
+		return ErrShareFormat
+	}
+	title, recipient, access := parts[0], parts[1], parts[2]
+
+	ctx := s.withToken(token)
+	if access == revokeAccess {
+		resp, err := client.RevokeShare(ctx, &pb.RevokeShareRequest{Title: title, Recipient: recipient})
+		if err != nil {
+			log.Printf("revoke share failed: %v", err)
+			return err
+		}
+		fmt.Println(resp.Message)
+		return s.startSession(username, token, client)
+	}
+
+	permission, ok := shareAccess[access]
+	if !ok {
+		log.Printf("invalid access: %s", access)
+		return ErrShareFormat
+	}
+	resp, err := client.ShareItem(ctx, &pb.ShareItemRequest{Title: title, Recipient: recipient, Permission: permission})
+	if err != nil {
+		log.Printf("share item failed: %v", err)
+		return err
+	}
+	fmt.Println(resp.Message)
+	return s.startSession(username, token, client)
+}
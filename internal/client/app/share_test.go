@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShareItem(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	expectLogin := func() {
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+	}
+
+	t.Run("read-write access", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nbank of X::bob::rw\n"))
+
+		expectLogin()
+		mockClient.On("ShareItem", mock.Anything, &pb.ShareItemRequest{
+			Title:      "bank of X",
+			Recipient:  "bob",
+			Permission: pb.SharePermission_SHARE_PERMISSION_WRITE,
+		}).Return(&pb.ShareItemResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.shareItem(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("access revoked", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nbank of X::bob::-\n"))
+
+		expectLogin()
+		mockClient.On("RevokeShare", mock.Anything, &pb.RevokeShareRequest{Title: "bank of X", Recipient: "bob"}).
+			Return(&pb.RevokeShareResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.shareItem(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("unknown access", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nbank of X::bob::x\n"))
+
+		expectLogin()
+
+		err := app.shareItem(*reader, mockClient)
+		assert.Equal(t, ErrShareFormat, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("incorrect format", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nbank of X\n"))
+
+		expectLogin()
+
+		err := app.shareItem(*reader, mockClient)
+		assert.Equal(t, ErrShareFormat, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	pb "keeper/proto"
+
+	"github.com/mdp/qrterminal/v3"
+)
+
+// enableTOTP входит в аккаунт и подключает двухфакторную аутентификацию:
+// показывает otpauth URI и QR-код, проверяет первый код из приложения и выводит коды восстановления.
+func (s *App) enableTOTP(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+	ctx := s.withToken(token)
+
+	enrollResp, err := client.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	if err != nil {
+		log.Printf("enroll totp failed: %v", err)
+		return err
+	}
+
+	fmt.Println("Отсканируйте QR-код в приложении-аутентификаторе или добавьте ссылку вручную:")
+	qrterminal.GenerateHalfBlock(enrollResp.Uri, qrterminal.L, os.Stdout)
+	fmt.Println(enrollResp.Uri)
+	fmt.Printf("Секрет: %s\n", enrollResp.Secret)
+	fmt.Println("Введите код из приложения:")
+
+	code, err := getOneTimeCode(&reader)
+	if err != nil {
+		return err
+	}
+
+	confirmResp, err := client.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: code})
+	if err != nil {
+		log.Printf("confirm totp failed: %v", err)
+		return err
+	}
+	fmt.Println(confirmResp.Message)
+	for _, recoveryCode := range confirmResp.RecoveryCodes {
+		fmt.Println(recoveryCode)
+	}
+
+	return s.startSession(username, token, client)
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "keeper/proto"
+)
+
+// ErrTrashCommand описывает ввод, который не является номером записи корзины или командой очистки.
+var ErrTrashCommand = errors.New("неверная команда корзины")
+
+// emptyTrashCommand команда, которая окончательно удаляет все записи корзины
+const emptyTrashCommand = "empty"
+
+// manageTrash входит в аккаунт, показывает корзину и восстанавливает запись по номеру или очищает корзину
+func (s *App) manageTrash(reader bufio.Reader, client pb.KeeperServiceClient) error {
+	username, token, err := s.signIn(&reader, client)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.withToken(token)
+	resp, err := client.ListTrash(ctx, &pb.ListTrashRequest{})
+	if err != nil {
+		log.Printf("list trash failed: %v", err)
+		return err
+	}
+	if len(resp.Items) == 0 {
+		fmt.Println("\nКорзина пуста.")
+		return s.startSession(username, token, client)
+	}
+
+	fmt.Println("\nКорзина:")
+	for i, item := range resp.Items {
+		fmt.Println(formatTrashItem(i+1, item))
+	}
+	fmt.Println("Введите номер записи для восстановления, empty для очистки корзины или пустую строку, чтобы продолжить:")
+	choice, err := reader.ReadString('\n')
+	if err != nil {
+		log.Printf("error reading choice: %v", err)
+		return err
+	}
+
+	switch choice = strings.TrimSpace(choice); choice {
+	case "":
+	case emptyTrashCommand:
+		resp, err := client.EmptyTrash(ctx, &pb.EmptyTrashRequest{})
+		if err != nil {
+			log.Printf("empty trash failed: %v", err)
+			return err
+		}
+		fmt.Println(resp.Message)
+	default:
+		number, err := strconv.Atoi(choice)
+		if err != nil || number < 1 || number > len(resp.Items) {
+			log.Printf("invalid trash command: %s", choice)
+			return ErrTrashCommand
+		}
+		restored, err := client.RestoreItem(ctx, &pb.RestoreItemRequest{Id: resp.Items[number-1].Id})
+		if err != nil {
+			log.Printf("restore item failed: %v", err)
+			return err
+		}
+		fmt.Println(restored.Message)
+	}
+
+	return s.startSession(username, token, client)
+}
+
+// formatTrashItem возвращает строку корзины: номер, название, время удаления и окончательного удаления
+func formatTrashItem(number int, item *pb.TrashItem) string {
+	return fmt.Sprintf("%d) %s, удалена %s, будет удалена окончательно %s", number, item.Title,
+		time.Unix(item.DeletedAtUnix, 0).Format(sessionTimeLayout),
+		time.Unix(item.ExpiresAtUnix, 0).Format(sessionTimeLayout))
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"keeper/internal/client/config"
+	"keeper/internal/mocks"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestManageTrash(t *testing.T) {
+	mockClient := new(mocks.KeeperServiceClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &App{
+		ctx: ctx,
+		cfg: &config.Config{
+			ServerAddr: "localhost:50051",
+		},
+		wg: &sync.WaitGroup{},
+	}
+
+	expectLogin := func() {
+		mockClient.On("GetVaultParams", mock.Anything, &pb.VaultParamsRequest{Username: "username"}).
+			Return(&pb.VaultParamsResponse{}, nil)
+		mockClient.On("Login", mock.Anything, &pb.LoginRequest{Username: "username", Password: "password"}).
+			Return(&pb.LoginResponse{Message: "ok", Token: "secret-token"}, nil)
+	}
+	trash := &pb.ListTrashResponse{Items: []*pb.TrashItem{
+		{Id: 7, Title: "wifi"},
+		{Id: 3, Title: "bank of X"},
+	}}
+
+	t.Run("restore by number", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n2\n"))
+
+		expectLogin()
+		mockClient.On("ListTrash", mock.Anything, &pb.ListTrashRequest{}).Return(trash, nil)
+		mockClient.On("RestoreItem", mock.Anything, &pb.RestoreItemRequest{Id: 3}).
+			Return(&pb.RestoreItemResponse{Message: "ok"}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageTrash(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("empty trash", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\nempty\n"))
+
+		expectLogin()
+		mockClient.On("ListTrash", mock.Anything, &pb.ListTrashRequest{}).Return(trash, nil)
+		mockClient.On("EmptyTrash", mock.Anything, &pb.EmptyTrashRequest{}).
+			Return(&pb.EmptyTrashResponse{Message: "ok", Deleted: 2}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageTrash(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("unknown number", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n5\n"))
+
+		expectLogin()
+		mockClient.On("ListTrash", mock.Anything, &pb.ListTrashRequest{}).Return(trash, nil)
+
+		err := app.manageTrash(*reader, mockClient)
+		assert.Equal(t, ErrTrashCommand, err)
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+
+	t.Run("empty list", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("username password\n"))
+
+		expectLogin()
+		mockClient.On("ListTrash", mock.Anything, &pb.ListTrashRequest{}).Return(&pb.ListTrashResponse{}, nil)
+		mockClient.On("Command", mock.Anything).Return(nil, errors.New("stream failed"))
+
+		err := app.manageTrash(*reader, mockClient)
+		assert.EqualError(t, err, "stream failed")
+
+		mockClient.AssertExpectations(t)
+		mockClient.ExpectedCalls = nil
+	})
+}
+
+func TestFormatTrashItem(t *testing.T) {
+	deletedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	item := &pb.TrashItem{Id: 7, Title: "wifi", DeletedAtUnix: deletedAt.Unix(), ExpiresAtUnix: deletedAt.Add(30 * 24 * time.Hour).Unix()}
+
+	assert.Equal(t, "1) wifi, удалена 2026-10-01 12:00, будет удалена окончательно 2026-10-31 12:00", formatTrashItem(1, item))
+}
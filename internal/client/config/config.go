@@ -3,20 +3,33 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
 )
 
 var flagServerAddr string
 var flagCertPath string
+var flagClientEncryption bool
+var flagClientCertPath string
+var flagClientKeyPath string
+var flagDeviceName string
 
 const (
 	envServerAddress = "SERVER_ADDRESS"
 	envCertPath      = "CERT_PATH"
+	envClientEncrypt = "CLIENT_ENCRYPTION"
+	envClientCert    = "CLIENT_CERT_PATH"
+	envClientKey     = "CLIENT_KEY_PATH"
+	envDeviceName    = "DEVICE_NAME"
 )
 
 // Config определяет конфигурацию приложения, собираемую из аргументов командной строки и переменных окружения.
 type Config struct {
-	ServerAddr string // Адрес и порт для подключения к серверу.
-	CertPath   string // путь до файла с сертификатом
+	ServerAddr       string // Адрес и порт для подключения к серверу.
+	CertPath         string // путь до файла с сертификатом
+	ClientEncryption bool   // шифрование данных на клиенте для новых аккаунтов
+	ClientCertPath   string // путь до клиентского сертификата для mTLS
+	ClientKeyPath    string // путь до закрытого ключа клиентского сертификата
+	DeviceName       string // название устройства в списке сессий, по умолчанию имя хоста
 }
 
 // GetConfig парсит аргументы командной строки и переменные окружения,
@@ -28,6 +41,10 @@ func GetConfig() (*Config, error) {
 	// парсим аргументы командной строки
 	flag.StringVar(&flagServerAddr, "a", "localhost:50051", "address and port to connect server")
 	flag.StringVar(&flagCertPath, "cr", "certs/keeper.crt", "path to cert")
+	flag.BoolVar(&flagClientEncryption, "e2e", false, "encrypt data on client for new accounts")
+	flag.StringVar(&flagClientCertPath, "cc", "", "path to client certificate")
+	flag.StringVar(&flagClientKeyPath, "ck", "", "path to client certificate key")
+	flag.StringVar(&flagDeviceName, "dn", "", "device name shown in the session list (default hostname)")
 	flag.Parse()
 
 	// если есть переменные окружения, используем их значения
@@ -37,9 +54,33 @@ func GetConfig() (*Config, error) {
 	if envCert := os.Getenv(envCertPath); envCert != "" {
 		flagCertPath = envCert
 	}
+	if envEncrypt := os.Getenv(envClientEncrypt); envEncrypt != "" {
+		encrypt, err := strconv.ParseBool(envEncrypt)
+		if err != nil {
+			return nil, err
+		}
+		flagClientEncryption = encrypt
+	}
+	if envCert := os.Getenv(envClientCert); envCert != "" {
+		flagClientCertPath = envCert
+	}
+	if envKey := os.Getenv(envClientKey); envKey != "" {
+		flagClientKeyPath = envKey
+	}
+	if envDevice := os.Getenv(envDeviceName); envDevice != "" {
+		flagDeviceName = envDevice
+	}
+	if flagDeviceName == "" {
+		// имя хоста не обязательно, без него сессия просто останется без названия
+		flagDeviceName, _ = os.Hostname()
+	}
 
 	return &Config{
-		ServerAddr: flagServerAddr,
-		CertPath:   flagCertPath,
+		ServerAddr:       flagServerAddr,
+		CertPath:         flagCertPath,
+		ClientEncryption: flagClientEncryption,
+		ClientCertPath:   flagClientCertPath,
+		ClientKeyPath:    flagClientKeyPath,
+		DeviceName:       flagDeviceName,
 	}, nil
 }
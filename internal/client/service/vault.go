@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// параметры argon2id для вывода ключей из мастер-пароля
+const (
+	kdfTime    uint32 = 3
+	kdfMemory  uint32 = 64 * 1024
+	kdfThreads uint8  = 2
+	keySize           = 32
+	saltSize          = 16
+)
+
+// ErrCipherTextShort описывает ошибку расшифровки слишком короткого шифртекста.
+var ErrCipherTextShort = errors.New("ciphertext too short")
+
+// generateRandom генерирует криптостойкие случайные байты заданного размера
+func generateRandom(size int) ([]byte, error) {
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GenerateSalt генерирует соль для вывода ключей из мастер-пароля
+func GenerateSalt() (string, error) {
+	salt, err := generateRandom(saltSize)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// GenerateVaultKey генерирует случайный ключ хранилища, которым шифруются данные
+func GenerateVaultKey() ([]byte, error) {
+	return generateRandom(keySize)
+}
+
+// DeriveKeys выводит из мастер-пароля два независимых ключа.
+// Первый передается серверу вместо пароля для входа, второй не покидает клиент и шифрует ключ хранилища.
+func DeriveKeys(password string, salt string) (string, []byte, error) {
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	master := argon2.IDKey([]byte(password), saltBytes, kdfTime, kdfMemory, kdfThreads, 2*keySize)
+	authKey, encKey := master[:keySize], master[keySize:]
+	return hex.EncodeToString(authKey), encKey, nil
+}
+
+// Seal шифрует данные ключом с помощью AES-GCM и возвращает hex-представление
+func Seal(plainText []byte, key []byte) (string, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := generateRandom(aesgcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+
+	cipherText := aesgcm.Seal(nonce, nonce, plainText, nil)
+	return hex.EncodeToString(cipherText), nil
+}
+
+// Open расшифровывает данные, зашифрованные Seal
+func Open(cipherTextHex string, key []byte) ([]byte, error) {
+	cipherText, err := hex.DecodeString(cipherTextHex)
+	if err != nil {
+		return nil, err
+	}
+
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aesgcm.NonceSize()
+	if len(cipherText) < nonceSize {
+		return nil, ErrCipherTextShort
+	}
+
+	nonce, cipherText := cipherText[:nonceSize], cipherText[nonceSize:]
+	return aesgcm.Open(nil, nonce, cipherText, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(aesblock)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestDeriveKeys проверяет, что ключи детерминированы и не совпадают между собой
+func TestDeriveKeys(t *testing.T) {
+	salt, err := GenerateSalt()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	authKey, encKey, err := DeriveKeys("password", salt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	otherAuthKey, otherEncKey, err := DeriveKeys("password", salt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if authKey != otherAuthKey || !bytes.Equal(encKey, otherEncKey) {
+		t.Errorf("Expected equal keys for the same password and salt")
+	}
+	if len(encKey) != keySize {
+		t.Errorf("Expected key length %d, got %d", keySize, len(encKey))
+	}
+
+	wrongAuthKey, _, err := DeriveKeys("wrong", salt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if wrongAuthKey == authKey {
+		t.Errorf("Expected different keys for different passwords")
+	}
+}
+
+// TestDeriveKeysInvalidSalt проверяет ошибку при некорректной соли
+func TestDeriveKeysInvalidSalt(t *testing.T) {
+	_, _, err := DeriveKeys("password", "not hex")
+	if err == nil {
+		t.Fatalf("Expected error for invalid salt, got nil")
+	}
+}
+
+// TestSealOpen проверяет функции Seal и Open
+func TestSealOpen(t *testing.T) {
+	key, err := GenerateVaultKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sealed, err := Seal([]byte("secret"), key)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+
+	plainText, err := Open(sealed, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if string(plainText) != "secret" {
+		t.Errorf("Expected 'secret', got '%s'", plainText)
+	}
+
+	otherKey, _ := GenerateVaultKey()
+	if _, err := Open(sealed, otherKey); err == nil {
+		t.Errorf("Expected error when opening with another key")
+	}
+}
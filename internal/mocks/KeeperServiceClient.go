@@ -17,6 +17,117 @@ type KeeperServiceClient struct {
 	mock.Mock
 }
 
+// BindCertificate provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) BindCertificate(ctx context.Context, in *keeper.BindCertificateRequest, opts ...grpc.CallOption) (*keeper.BindCertificateResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BindCertificate")
+	}
+
+	var r0 *keeper.BindCertificateResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.BindCertificateRequest, ...grpc.CallOption) (*keeper.BindCertificateResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.BindCertificateRequest, ...grpc.CallOption) *keeper.BindCertificateResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.BindCertificateResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.BindCertificateRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CertLogin provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) CertLogin(ctx context.Context, in *keeper.CertLoginRequest, opts ...grpc.CallOption) (*keeper.LoginResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CertLogin")
+	}
+
+	var r0 *keeper.LoginResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CertLoginRequest, ...grpc.CallOption) (*keeper.LoginResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CertLoginRequest, ...grpc.CallOption) *keeper.LoginResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.LoginResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.CertLoginRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ChangePassword provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ChangePassword(ctx context.Context, in *keeper.ChangePasswordRequest, opts ...grpc.CallOption) (*keeper.ChangePasswordResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ChangePassword")
+	}
+
+	var r0 *keeper.ChangePasswordResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ChangePasswordRequest, ...grpc.CallOption) (*keeper.ChangePasswordResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ChangePasswordRequest, ...grpc.CallOption) *keeper.ChangePasswordResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ChangePasswordResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ChangePasswordRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Command provides a mock function with given fields: ctx, opts
 func (_m *KeeperServiceClient) Command(ctx context.Context, opts ...grpc.CallOption) (keeper.KeeperService_CommandClient, error) {
 	_va := make([]interface{}, len(opts))
@@ -54,8 +165,8 @@ func (_m *KeeperServiceClient) Command(ctx context.Context, opts ...grpc.CallOpt
 	return r0, r1
 }
 
-// Login provides a mock function with given fields: ctx, in, opts
-func (_m *KeeperServiceClient) Login(ctx context.Context, in *keeper.LoginRequest, opts ...grpc.CallOption) (*keeper.LoginResponse, error) {
+// ConfirmTOTP provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ConfirmTOTP(ctx context.Context, in *keeper.ConfirmTOTPRequest, opts ...grpc.CallOption) (*keeper.ConfirmTOTPResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -66,23 +177,23 @@ func (_m *KeeperServiceClient) Login(ctx context.Context, in *keeper.LoginReques
 	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
-		panic("no return value specified for Login")
+		panic("no return value specified for ConfirmTOTP")
 	}
 
-	var r0 *keeper.LoginResponse
+	var r0 *keeper.ConfirmTOTPResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, *keeper.LoginRequest, ...grpc.CallOption) (*keeper.LoginResponse, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ConfirmTOTPRequest, ...grpc.CallOption) (*keeper.ConfirmTOTPResponse, error)); ok {
 		return rf(ctx, in, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, *keeper.LoginRequest, ...grpc.CallOption) *keeper.LoginResponse); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ConfirmTOTPRequest, ...grpc.CallOption) *keeper.ConfirmTOTPResponse); ok {
 		r0 = rf(ctx, in, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*keeper.LoginResponse)
+			r0 = ret.Get(0).(*keeper.ConfirmTOTPResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, *keeper.LoginRequest, ...grpc.CallOption) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ConfirmTOTPRequest, ...grpc.CallOption) error); ok {
 		r1 = rf(ctx, in, opts...)
 	} else {
 		r1 = ret.Error(1)
@@ -91,8 +202,45 @@ func (_m *KeeperServiceClient) Login(ctx context.Context, in *keeper.LoginReques
 	return r0, r1
 }
 
-// Register provides a mock function with given fields: ctx, in, opts
-func (_m *KeeperServiceClient) Register(ctx context.Context, in *keeper.RegisterRequest, opts ...grpc.CallOption) (*keeper.RegisterResponse, error) {
+// Connect provides a mock function with given fields: ctx, opts
+func (_m *KeeperServiceClient) Connect(ctx context.Context, opts ...grpc.CallOption) (keeper.KeeperService_ConnectClient, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Connect")
+	}
+
+	var r0 keeper.KeeperService_ConnectClient
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, ...grpc.CallOption) (keeper.KeeperService_ConnectClient, error)); ok {
+		return rf(ctx, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, ...grpc.CallOption) keeper.KeeperService_ConnectClient); ok {
+		r0 = rf(ctx, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(keeper.KeeperService_ConnectClient)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateCollection provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) CreateCollection(ctx context.Context, in *keeper.CreateCollectionRequest, opts ...grpc.CallOption) (*keeper.CreateCollectionResponse, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -103,23 +251,1022 @@ func (_m *KeeperServiceClient) Register(ctx context.Context, in *keeper.Register
 	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
-		panic("no return value specified for Register")
+		panic("no return value specified for CreateCollection")
 	}
 
-	var r0 *keeper.RegisterResponse
+	var r0 *keeper.CreateCollectionResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RegisterRequest, ...grpc.CallOption) (*keeper.RegisterResponse, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateCollectionRequest, ...grpc.CallOption) (*keeper.CreateCollectionResponse, error)); ok {
 		return rf(ctx, in, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RegisterRequest, ...grpc.CallOption) *keeper.RegisterResponse); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateCollectionRequest, ...grpc.CallOption) *keeper.CreateCollectionResponse); ok {
 		r0 = rf(ctx, in, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*keeper.RegisterResponse)
+			r0 = ret.Get(0).(*keeper.CreateCollectionResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RegisterRequest, ...grpc.CallOption) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.CreateCollectionRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateCollectionItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) CreateCollectionItem(ctx context.Context, in *keeper.CreateCollectionItemRequest, opts ...grpc.CallOption) (*keeper.CreateCollectionItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateCollectionItem")
+	}
+
+	var r0 *keeper.CreateCollectionItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateCollectionItemRequest, ...grpc.CallOption) (*keeper.CreateCollectionItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateCollectionItemRequest, ...grpc.CallOption) *keeper.CreateCollectionItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.CreateCollectionItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.CreateCollectionItemRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) CreateItem(ctx context.Context, in *keeper.CreateItemRequest, opts ...grpc.CallOption) (*keeper.CreateItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateItem")
+	}
+
+	var r0 *keeper.CreateItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateItemRequest, ...grpc.CallOption) (*keeper.CreateItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateItemRequest, ...grpc.CallOption) *keeper.CreateItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.CreateItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.CreateItemRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateOrganization provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) CreateOrganization(ctx context.Context, in *keeper.CreateOrganizationRequest, opts ...grpc.CallOption) (*keeper.CreateOrganizationResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateOrganization")
+	}
+
+	var r0 *keeper.CreateOrganizationResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateOrganizationRequest, ...grpc.CallOption) (*keeper.CreateOrganizationResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.CreateOrganizationRequest, ...grpc.CallOption) *keeper.CreateOrganizationResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.CreateOrganizationResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.CreateOrganizationRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteAccount provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) DeleteAccount(ctx context.Context, in *keeper.DeleteAccountRequest, opts ...grpc.CallOption) (*keeper.DeleteAccountResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteAccount")
+	}
+
+	var r0 *keeper.DeleteAccountResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.DeleteAccountRequest, ...grpc.CallOption) (*keeper.DeleteAccountResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.DeleteAccountRequest, ...grpc.CallOption) *keeper.DeleteAccountResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.DeleteAccountResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.DeleteAccountRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) DeleteItem(ctx context.Context, in *keeper.DeleteItemRequest, opts ...grpc.CallOption) (*keeper.DeleteItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteItem")
+	}
+
+	var r0 *keeper.DeleteItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.DeleteItemRequest, ...grpc.CallOption) (*keeper.DeleteItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.DeleteItemRequest, ...grpc.CallOption) *keeper.DeleteItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.DeleteItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.DeleteItemRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EmptyTrash provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) EmptyTrash(ctx context.Context, in *keeper.EmptyTrashRequest, opts ...grpc.CallOption) (*keeper.EmptyTrashResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EmptyTrash")
+	}
+
+	var r0 *keeper.EmptyTrashResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.EmptyTrashRequest, ...grpc.CallOption) (*keeper.EmptyTrashResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.EmptyTrashRequest, ...grpc.CallOption) *keeper.EmptyTrashResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.EmptyTrashResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.EmptyTrashRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EnrollTOTP provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) EnrollTOTP(ctx context.Context, in *keeper.EnrollTOTPRequest, opts ...grpc.CallOption) (*keeper.EnrollTOTPResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EnrollTOTP")
+	}
+
+	var r0 *keeper.EnrollTOTPResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.EnrollTOTPRequest, ...grpc.CallOption) (*keeper.EnrollTOTPResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.EnrollTOTPRequest, ...grpc.CallOption) *keeper.EnrollTOTPResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.EnrollTOTPResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.EnrollTOTPRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) GetItem(ctx context.Context, in *keeper.GetItemRequest, opts ...grpc.CallOption) (*keeper.GetItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetItem")
+	}
+
+	var r0 *keeper.GetItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.GetItemRequest, ...grpc.CallOption) (*keeper.GetItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.GetItemRequest, ...grpc.CallOption) *keeper.GetItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.GetItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.GetItemRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevision provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) GetRevision(ctx context.Context, in *keeper.GetRevisionRequest, opts ...grpc.CallOption) (*keeper.GetRevisionResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRevision")
+	}
+
+	var r0 *keeper.GetRevisionResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.GetRevisionRequest, ...grpc.CallOption) (*keeper.GetRevisionResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.GetRevisionRequest, ...grpc.CallOption) *keeper.GetRevisionResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.GetRevisionResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.GetRevisionRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetVaultParams provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) GetVaultParams(ctx context.Context, in *keeper.VaultParamsRequest, opts ...grpc.CallOption) (*keeper.VaultParamsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetVaultParams")
+	}
+
+	var r0 *keeper.VaultParamsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.VaultParamsRequest, ...grpc.CallOption) (*keeper.VaultParamsResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.VaultParamsRequest, ...grpc.CallOption) *keeper.VaultParamsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.VaultParamsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.VaultParamsRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAuditEvents provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ListAuditEvents(ctx context.Context, in *keeper.ListAuditEventsRequest, opts ...grpc.CallOption) (*keeper.ListAuditEventsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAuditEvents")
+	}
+
+	var r0 *keeper.ListAuditEventsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListAuditEventsRequest, ...grpc.CallOption) (*keeper.ListAuditEventsResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListAuditEventsRequest, ...grpc.CallOption) *keeper.ListAuditEventsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ListAuditEventsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ListAuditEventsRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListItems provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ListItems(ctx context.Context, in *keeper.ListItemsRequest, opts ...grpc.CallOption) (*keeper.ListItemsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListItems")
+	}
+
+	var r0 *keeper.ListItemsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListItemsRequest, ...grpc.CallOption) (*keeper.ListItemsResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListItemsRequest, ...grpc.CallOption) *keeper.ListItemsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ListItemsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ListItemsRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListOrganizations provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ListOrganizations(ctx context.Context, in *keeper.ListOrganizationsRequest, opts ...grpc.CallOption) (*keeper.ListOrganizationsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListOrganizations")
+	}
+
+	var r0 *keeper.ListOrganizationsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListOrganizationsRequest, ...grpc.CallOption) (*keeper.ListOrganizationsResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListOrganizationsRequest, ...grpc.CallOption) *keeper.ListOrganizationsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ListOrganizationsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ListOrganizationsRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListRevisions provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ListRevisions(ctx context.Context, in *keeper.ListRevisionsRequest, opts ...grpc.CallOption) (*keeper.ListRevisionsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListRevisions")
+	}
+
+	var r0 *keeper.ListRevisionsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListRevisionsRequest, ...grpc.CallOption) (*keeper.ListRevisionsResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListRevisionsRequest, ...grpc.CallOption) *keeper.ListRevisionsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ListRevisionsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ListRevisionsRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ListSessions(ctx context.Context, in *keeper.ListSessionsRequest, opts ...grpc.CallOption) (*keeper.ListSessionsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListSessions")
+	}
+
+	var r0 *keeper.ListSessionsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListSessionsRequest, ...grpc.CallOption) (*keeper.ListSessionsResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListSessionsRequest, ...grpc.CallOption) *keeper.ListSessionsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ListSessionsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ListSessionsRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListTrash provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ListTrash(ctx context.Context, in *keeper.ListTrashRequest, opts ...grpc.CallOption) (*keeper.ListTrashResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListTrash")
+	}
+
+	var r0 *keeper.ListTrashResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListTrashRequest, ...grpc.CallOption) (*keeper.ListTrashResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ListTrashRequest, ...grpc.CallOption) *keeper.ListTrashResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ListTrashResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ListTrashRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Login provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) Login(ctx context.Context, in *keeper.LoginRequest, opts ...grpc.CallOption) (*keeper.LoginResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Login")
+	}
+
+	var r0 *keeper.LoginResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.LoginRequest, ...grpc.CallOption) (*keeper.LoginResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.LoginRequest, ...grpc.CallOption) *keeper.LoginResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.LoginResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.LoginRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Register provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) Register(ctx context.Context, in *keeper.RegisterRequest, opts ...grpc.CallOption) (*keeper.RegisterResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Register")
+	}
+
+	var r0 *keeper.RegisterResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RegisterRequest, ...grpc.CallOption) (*keeper.RegisterResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RegisterRequest, ...grpc.CallOption) *keeper.RegisterResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.RegisterResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RegisterRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveOrgMember provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) RemoveOrgMember(ctx context.Context, in *keeper.RemoveOrgMemberRequest, opts ...grpc.CallOption) (*keeper.RemoveOrgMemberResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveOrgMember")
+	}
+
+	var r0 *keeper.RemoveOrgMemberResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RemoveOrgMemberRequest, ...grpc.CallOption) (*keeper.RemoveOrgMemberResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RemoveOrgMemberRequest, ...grpc.CallOption) *keeper.RemoveOrgMemberResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.RemoveOrgMemberResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RemoveOrgMemberRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) RestoreItem(ctx context.Context, in *keeper.RestoreItemRequest, opts ...grpc.CallOption) (*keeper.RestoreItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RestoreItem")
+	}
+
+	var r0 *keeper.RestoreItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RestoreItemRequest, ...grpc.CallOption) (*keeper.RestoreItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RestoreItemRequest, ...grpc.CallOption) *keeper.RestoreItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.RestoreItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RestoreItemRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreRevision provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) RestoreRevision(ctx context.Context, in *keeper.RestoreRevisionRequest, opts ...grpc.CallOption) (*keeper.RestoreRevisionResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RestoreRevision")
+	}
+
+	var r0 *keeper.RestoreRevisionResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RestoreRevisionRequest, ...grpc.CallOption) (*keeper.RestoreRevisionResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RestoreRevisionRequest, ...grpc.CallOption) *keeper.RestoreRevisionResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.RestoreRevisionResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RestoreRevisionRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeSession provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) RevokeSession(ctx context.Context, in *keeper.RevokeSessionRequest, opts ...grpc.CallOption) (*keeper.RevokeSessionResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RevokeSession")
+	}
+
+	var r0 *keeper.RevokeSessionResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RevokeSessionRequest, ...grpc.CallOption) (*keeper.RevokeSessionResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RevokeSessionRequest, ...grpc.CallOption) *keeper.RevokeSessionResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.RevokeSessionResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RevokeSessionRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeShare provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) RevokeShare(ctx context.Context, in *keeper.RevokeShareRequest, opts ...grpc.CallOption) (*keeper.RevokeShareResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RevokeShare")
+	}
+
+	var r0 *keeper.RevokeShareResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RevokeShareRequest, ...grpc.CallOption) (*keeper.RevokeShareResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.RevokeShareRequest, ...grpc.CallOption) *keeper.RevokeShareResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.RevokeShareResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.RevokeShareRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetOrgMember provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) SetOrgMember(ctx context.Context, in *keeper.SetOrgMemberRequest, opts ...grpc.CallOption) (*keeper.SetOrgMemberResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetOrgMember")
+	}
+
+	var r0 *keeper.SetOrgMemberResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.SetOrgMemberRequest, ...grpc.CallOption) (*keeper.SetOrgMemberResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.SetOrgMemberRequest, ...grpc.CallOption) *keeper.SetOrgMemberResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.SetOrgMemberResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.SetOrgMemberRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetRevisionLimit provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) SetRevisionLimit(ctx context.Context, in *keeper.SetRevisionLimitRequest, opts ...grpc.CallOption) (*keeper.SetRevisionLimitResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetRevisionLimit")
+	}
+
+	var r0 *keeper.SetRevisionLimitResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.SetRevisionLimitRequest, ...grpc.CallOption) (*keeper.SetRevisionLimitResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.SetRevisionLimitRequest, ...grpc.CallOption) *keeper.SetRevisionLimitResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.SetRevisionLimitResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.SetRevisionLimitRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ShareItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) ShareItem(ctx context.Context, in *keeper.ShareItemRequest, opts ...grpc.CallOption) (*keeper.ShareItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ShareItem")
+	}
+
+	var r0 *keeper.ShareItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ShareItemRequest, ...grpc.CallOption) (*keeper.ShareItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.ShareItemRequest, ...grpc.CallOption) *keeper.ShareItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.ShareItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.ShareItemRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateItem provides a mock function with given fields: ctx, in, opts
+func (_m *KeeperServiceClient) UpdateItem(ctx context.Context, in *keeper.UpdateItemRequest, opts ...grpc.CallOption) (*keeper.UpdateItemResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateItem")
+	}
+
+	var r0 *keeper.UpdateItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.UpdateItemRequest, ...grpc.CallOption) (*keeper.UpdateItemResponse, error)); ok {
+		return rf(ctx, in, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *keeper.UpdateItemRequest, ...grpc.CallOption) *keeper.UpdateItemResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keeper.UpdateItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *keeper.UpdateItemRequest, ...grpc.CallOption) error); ok {
 		r1 = rf(ctx, in, opts...)
 	} else {
 		r1 = ret.Error(1)
@@ -9,6 +9,8 @@ import (
 	mock "github.com/stretchr/testify/mock"
 
 	storage "keeper/internal/server/storage"
+
+	time "time"
 )
 
 // Provider is an autogenerated mock type for the Provider type
@@ -16,17 +18,145 @@ type Provider struct {
 	mock.Mock
 }
 
-// AddClient provides a mock function with given fields: ctx, clientID, username, state
-func (_m *Provider) AddClient(ctx context.Context, clientID string, username string, state service.State) error {
-	ret := _m.Called(ctx, clientID, username, state)
+// AddAuditEvent provides a mock function with given fields: ctx, event
+func (_m *Provider) AddAuditEvent(ctx context.Context, event storage.AuditEvent) error {
+	ret := _m.Called(ctx, event)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddAuditEvent")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.AuditEvent) error); ok {
+		r0 = rf(ctx, event)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddClient provides a mock function with given fields: ctx, client
+func (_m *Provider) AddClient(ctx context.Context, client storage.Client) error {
+	ret := _m.Called(ctx, client)
 
 	if len(ret) == 0 {
 		panic("no return value specified for AddClient")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, service.State) error); ok {
-		r0 = rf(ctx, clientID, username, state)
+	if rf, ok := ret.Get(0).(func(context.Context, storage.Client) error); ok {
+		r0 = rf(ctx, client)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BindCertificate provides a mock function with given fields: ctx, username, identities
+func (_m *Provider) BindCertificate(ctx context.Context, username string, identities []string) error {
+	ret := _m.Called(ctx, username, identities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BindCertificate")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) error); ok {
+		r0 = rf(ctx, username, identities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ChangePassword provides a mock function with given fields: ctx, username, passwordHash, vault, keepSessionID
+func (_m *Provider) ChangePassword(ctx context.Context, username string, passwordHash string, vault storage.Vault, keepSessionID string) (int64, error) {
+	ret := _m.Called(ctx, username, passwordHash, vault, keepSessionID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ChangePassword")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, storage.Vault, string) (int64, error)); ok {
+		return rf(ctx, username, passwordHash, vault, keepSessionID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, storage.Vault, string) int64); ok {
+		r0 = rf(ctx, username, passwordHash, vault, keepSessionID)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, storage.Vault, string) error); ok {
+		r1 = rf(ctx, username, passwordHash, vault, keepSessionID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConfirmTOTP provides a mock function with given fields: ctx, username, step, recoveryCodeHashes
+func (_m *Provider) ConfirmTOTP(ctx context.Context, username string, step int64, recoveryCodeHashes []string) error {
+	ret := _m.Called(ctx, username, step, recoveryCodeHashes)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConfirmTOTP")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, []string) error); ok {
+		r0 = rf(ctx, username, step, recoveryCodeHashes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateCollection provides a mock function with given fields: ctx, orgID, name
+func (_m *Provider) CreateCollection(ctx context.Context, orgID int64, name string) (int64, error) {
+	ret := _m.Called(ctx, orgID, name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateCollection")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) (int64, error)); ok {
+		return rf(ctx, orgID, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) int64); ok {
+		r0 = rf(ctx, orgID, name)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, string) error); ok {
+		r1 = rf(ctx, orgID, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateCollectionItem provides a mock function with given fields: ctx, row, seal
+func (_m *Provider) CreateCollectionItem(ctx context.Context, row storage.DataRow, seal storage.SealFunc) error {
+	ret := _m.Called(ctx, row, seal)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateCollectionItem")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.DataRow, storage.SealFunc) error); ok {
+		r0 = rf(ctx, row, seal)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -34,17 +164,63 @@ func (_m *Provider) AddClient(ctx context.Context, clientID string, username str
 	return r0
 }
 
-// CreateData provides a mock function with given fields: ctx, username, title, data_type, data
-func (_m *Provider) CreateData(ctx context.Context, username string, title string, data_type service.DataType, data string) error {
-	ret := _m.Called(ctx, username, title, data_type, data)
+// CreateData provides a mock function with given fields: ctx, row, seal
+func (_m *Provider) CreateData(ctx context.Context, row storage.DataRow, seal storage.SealFunc) error {
+	ret := _m.Called(ctx, row, seal)
 
 	if len(ret) == 0 {
 		panic("no return value specified for CreateData")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, service.DataType, string) error); ok {
-		r0 = rf(ctx, username, title, data_type, data)
+	if rf, ok := ret.Get(0).(func(context.Context, storage.DataRow, storage.SealFunc) error); ok {
+		r0 = rf(ctx, row, seal)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateOrganization provides a mock function with given fields: ctx, owner
+func (_m *Provider) CreateOrganization(ctx context.Context, owner storage.OrgMember) (int64, error) {
+	ret := _m.Called(ctx, owner)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateOrganization")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.OrgMember) (int64, error)); ok {
+		return rf(ctx, owner)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, storage.OrgMember) int64); ok {
+		r0 = rf(ctx, owner)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, storage.OrgMember) error); ok {
+		r1 = rf(ctx, owner)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateSession provides a mock function with given fields: ctx, session, tokenHash
+func (_m *Provider) CreateSession(ctx context.Context, session storage.Session, tokenHash string) error {
+	ret := _m.Called(ctx, session, tokenHash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateSession")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.Session, string) error); ok {
+		r0 = rf(ctx, session, tokenHash)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -52,17 +228,53 @@ func (_m *Provider) CreateData(ctx context.Context, username string, title strin
 	return r0
 }
 
-// CreateUser provides a mock function with given fields: ctx, username, password
-func (_m *Provider) CreateUser(ctx context.Context, username string, password string) error {
-	ret := _m.Called(ctx, username, password)
+// CreateUser provides a mock function with given fields: ctx, username, password, vault
+func (_m *Provider) CreateUser(ctx context.Context, username string, password string, vault storage.Vault) error {
+	ret := _m.Called(ctx, username, password, vault)
 
 	if len(ret) == 0 {
 		panic("no return value specified for CreateUser")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, username, password)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, storage.Vault) error); ok {
+		r0 = rf(ctx, username, password, vault)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUserKey provides a mock function with given fields: ctx, username, key
+func (_m *Provider) CreateUserKey(ctx context.Context, username string, key storage.UserKey) error {
+	ret := _m.Called(ctx, username, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateUserKey")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.UserKey) error); ok {
+		r0 = rf(ctx, username, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteCollectionItem provides a mock function with given fields: ctx, itemID
+func (_m *Provider) DeleteCollectionItem(ctx context.Context, itemID int64) error {
+	ret := _m.Called(ctx, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteCollectionItem")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, itemID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -70,17 +282,121 @@ func (_m *Provider) CreateUser(ctx context.Context, username string, password st
 	return r0
 }
 
-// ExistUser provides a mock function with given fields: ctx, username, password
-func (_m *Provider) ExistUser(ctx context.Context, username string, password string) error {
-	ret := _m.Called(ctx, username, password)
+// DeleteLoginAttempts provides a mock function with given fields: ctx, keys
+func (_m *Provider) DeleteLoginAttempts(ctx context.Context, keys []string) (int64, error) {
+	ret := _m.Called(ctx, keys)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteLoginAttempts")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) (int64, error)); ok {
+		return rf(ctx, keys)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string) int64); ok {
+		r0 = rf(ctx, keys)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, keys)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteSession provides a mock function with given fields: ctx, username, sessionID
+func (_m *Provider) DeleteSession(ctx context.Context, username string, sessionID string) error {
+	ret := _m.Called(ctx, username, sessionID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for ExistUser")
+		panic("no return value specified for DeleteSession")
 	}
 
 	var r0 error
 	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, username, password)
+		r0 = rf(ctx, username, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUser provides a mock function with given fields: ctx, username
+func (_m *Provider) DeleteUser(ctx context.Context, username string) (map[string]int64, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteUser")
+	}
+
+	var r0 map[string]int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (map[string]int64, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]int64); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int64)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EmptyTrash provides a mock function with given fields: ctx, username
+func (_m *Provider) EmptyTrash(ctx context.Context, username string) (int64, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EmptyTrash")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int64, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int64); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FinishRotation provides a mock function with given fields: ctx, rotationID
+func (_m *Provider) FinishRotation(ctx context.Context, rotationID string) error {
+	ret := _m.Called(ctx, rotationID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FinishRotation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, rotationID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -118,27 +434,29 @@ func (_m *Provider) GetAllClients(ctx context.Context) ([]storage.Client, error)
 	return r0, r1
 }
 
-// GetData provides a mock function with given fields: ctx, username, title
-func (_m *Provider) GetData(ctx context.Context, username string, title string) (string, error) {
-	ret := _m.Called(ctx, username, title)
+// GetAuditEventsAfter provides a mock function with given fields: ctx, afterID, limit
+func (_m *Provider) GetAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]storage.AuditEvent, error) {
+	ret := _m.Called(ctx, afterID, limit)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetData")
+		panic("no return value specified for GetAuditEventsAfter")
 	}
 
-	var r0 string
+	var r0 []storage.AuditEvent
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) (string, error)); ok {
-		return rf(ctx, username, title)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]storage.AuditEvent, error)); ok {
+		return rf(ctx, afterID, limit)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
-		r0 = rf(ctx, username, title)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []storage.AuditEvent); ok {
+		r0 = rf(ctx, afterID, limit)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.AuditEvent)
+		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, username, title)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, afterID, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -146,29 +464,29 @@ func (_m *Provider) GetData(ctx context.Context, username string, title string)
 	return r0, r1
 }
 
-// GetTitlesByUser provides a mock function with given fields: ctx, username
-func (_m *Provider) GetTitlesByUser(ctx context.Context, username string) ([]string, error) {
-	ret := _m.Called(ctx, username)
+// GetCertificateUsers provides a mock function with given fields: ctx, identities
+func (_m *Provider) GetCertificateUsers(ctx context.Context, identities []string) ([]string, error) {
+	ret := _m.Called(ctx, identities)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetTitlesByUser")
+		panic("no return value specified for GetCertificateUsers")
 	}
 
 	var r0 []string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) ([]string, error)); ok {
-		return rf(ctx, username)
+	if rf, ok := ret.Get(0).(func(context.Context, []string) ([]string, error)); ok {
+		return rf(ctx, identities)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
-		r0 = rf(ctx, username)
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []string); ok {
+		r0 = rf(ctx, identities)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, username)
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, identities)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -176,53 +494,1357 @@ func (_m *Provider) GetTitlesByUser(ctx context.Context, username string) ([]str
 	return r0, r1
 }
 
-// Init provides a mock function with given fields:
-func (_m *Provider) Init() error {
-	ret := _m.Called()
+// GetCollection provides a mock function with given fields: ctx, orgID, name
+func (_m *Provider) GetCollection(ctx context.Context, orgID int64, name string) (storage.Collection, error) {
+	ret := _m.Called(ctx, orgID, name)
 
 	if len(ret) == 0 {
-		panic("no return value specified for Init")
+		panic("no return value specified for GetCollection")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func() error); ok {
-		r0 = rf()
+	var r0 storage.Collection
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) (storage.Collection, error)); ok {
+		return rf(ctx, orgID, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) storage.Collection); ok {
+		r0 = rf(ctx, orgID, name)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(storage.Collection)
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context, int64, string) error); ok {
+		r1 = rf(ctx, orgID, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// RemoveClient provides a mock function with given fields: ctx, clientID
-func (_m *Provider) RemoveClient(ctx context.Context, clientID string) error {
-	ret := _m.Called(ctx, clientID)
+// GetCollectionRevision provides a mock function with given fields: ctx, itemID, revisionID
+func (_m *Provider) GetCollectionRevision(ctx context.Context, itemID int64, revisionID int64) (storage.Revision, error) {
+	ret := _m.Called(ctx, itemID, revisionID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for RemoveClient")
+		panic("no return value specified for GetCollectionRevision")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, clientID)
+	var r0 storage.Revision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) (storage.Revision, error)); ok {
+		return rf(ctx, itemID, revisionID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) storage.Revision); ok {
+		r0 = rf(ctx, itemID, revisionID)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(storage.Revision)
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, itemID, revisionID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// UpdateClientState provides a mock function with given fields: ctx, clientID, state
-func (_m *Provider) UpdateClientState(ctx context.Context, clientID string, state service.State) error {
-	ret := _m.Called(ctx, clientID, state)
+// GetData provides a mock function with given fields: ctx, username, titleIndex
+func (_m *Provider) GetData(ctx context.Context, username string, titleIndex string) (storage.DataRow, error) {
+	ret := _m.Called(ctx, username, titleIndex)
 
 	if len(ret) == 0 {
-		panic("no return value specified for UpdateClientState")
+		panic("no return value specified for GetData")
+	}
+
+	var r0 storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (storage.DataRow, error)); ok {
+		return rf(ctx, username, titleIndex)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) storage.DataRow); ok {
+		r0 = rf(ctx, username, titleIndex)
+	} else {
+		r0 = ret.Get(0).(storage.DataRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, username, titleIndex)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDataAfter provides a mock function with given fields: ctx, afterID, limit
+func (_m *Provider) GetDataAfter(ctx context.Context, afterID int64, limit int) ([]storage.DataRow, error) {
+	ret := _m.Called(ctx, afterID, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDataAfter")
+	}
+
+	var r0 []storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]storage.DataRow, error)); ok {
+		return rf(ctx, afterID, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []storage.DataRow); ok {
+		r0 = rf(ctx, afterID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.DataRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, afterID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLatestUserKey provides a mock function with given fields: ctx, username
+func (_m *Provider) GetLatestUserKey(ctx context.Context, username string) (storage.UserKey, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLatestUserKey")
+	}
+
+	var r0 storage.UserKey
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (storage.UserKey, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) storage.UserKey); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(storage.UserKey)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLoginAttempts provides a mock function with given fields: ctx, keys
+func (_m *Provider) GetLoginAttempts(ctx context.Context, keys []string) ([]storage.LoginAttempt, error) {
+	ret := _m.Called(ctx, keys)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLoginAttempts")
+	}
+
+	var r0 []storage.LoginAttempt
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) ([]storage.LoginAttempt, error)); ok {
+		return rf(ctx, keys)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []storage.LoginAttempt); ok {
+		r0 = rf(ctx, keys)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.LoginAttempt)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, keys)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMembership provides a mock function with given fields: ctx, orgName, username
+func (_m *Provider) GetMembership(ctx context.Context, orgName string, username string) (storage.OrgMember, error) {
+	ret := _m.Called(ctx, orgName, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMembership")
+	}
+
+	var r0 storage.OrgMember
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (storage.OrgMember, error)); ok {
+		return rf(ctx, orgName, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) storage.OrgMember); ok {
+		r0 = rf(ctx, orgName, username)
+	} else {
+		r0 = ret.Get(0).(storage.OrgMember)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, orgName, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPasswordHash provides a mock function with given fields: ctx, username
+func (_m *Provider) GetPasswordHash(ctx context.Context, username string) (string, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetPasswordHash")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPlainTitlesAfter provides a mock function with given fields: ctx, afterID, limit
+func (_m *Provider) GetPlainTitlesAfter(ctx context.Context, afterID int64, limit int) ([]storage.DataRow, error) {
+	ret := _m.Called(ctx, afterID, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetPlainTitlesAfter")
+	}
+
+	var r0 []storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]storage.DataRow, error)); ok {
+		return rf(ctx, afterID, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []storage.DataRow); ok {
+		r0 = rf(ctx, afterID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.DataRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, afterID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevision provides a mock function with given fields: ctx, itemID, revisionID
+func (_m *Provider) GetRevision(ctx context.Context, itemID int64, revisionID int64) (storage.Revision, error) {
+	ret := _m.Called(ctx, itemID, revisionID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRevision")
+	}
+
+	var r0 storage.Revision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) (storage.Revision, error)); ok {
+		return rf(ctx, itemID, revisionID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) storage.Revision); ok {
+		r0 = rf(ctx, itemID, revisionID)
+	} else {
+		r0 = ret.Get(0).(storage.Revision)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, itemID, revisionID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevisionsAfter provides a mock function with given fields: ctx, afterID, limit
+func (_m *Provider) GetRevisionsAfter(ctx context.Context, afterID int64, limit int) ([]storage.RevisionRow, error) {
+	ret := _m.Called(ctx, afterID, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRevisionsAfter")
+	}
+
+	var r0 []storage.RevisionRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]storage.RevisionRow, error)); ok {
+		return rf(ctx, afterID, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []storage.RevisionRow); ok {
+		r0 = rf(ctx, afterID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.RevisionRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, afterID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRotation provides a mock function with given fields: ctx, rotationID
+func (_m *Provider) GetRotation(ctx context.Context, rotationID string) (storage.Rotation, error) {
+	ret := _m.Called(ctx, rotationID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRotation")
+	}
+
+	var r0 storage.Rotation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (storage.Rotation, error)); ok {
+		return rf(ctx, rotationID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) storage.Rotation); ok {
+		r0 = rf(ctx, rotationID)
+	} else {
+		r0 = ret.Get(0).(storage.Rotation)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, rotationID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetServerSecret provides a mock function with given fields: ctx, name, value
+func (_m *Provider) GetServerSecret(ctx context.Context, name string, value string) (string, error) {
+	ret := _m.Called(ctx, name, value)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetServerSecret")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (string, error)); ok {
+		return rf(ctx, name, value)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, name, value)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, name, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSession provides a mock function with given fields: ctx, tokenHash
+func (_m *Provider) GetSession(ctx context.Context, tokenHash string) (storage.Session, error) {
+	ret := _m.Called(ctx, tokenHash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSession")
+	}
+
+	var r0 storage.Session
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (storage.Session, error)); ok {
+		return rf(ctx, tokenHash)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) storage.Session); ok {
+		r0 = rf(ctx, tokenHash)
+	} else {
+		r0 = ret.Get(0).(storage.Session)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, tokenHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSharedData provides a mock function with given fields: ctx, username, itemID
+func (_m *Provider) GetSharedData(ctx context.Context, username string, itemID int64) (storage.DataRow, storage.Share, error) {
+	ret := _m.Called(ctx, username, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSharedData")
+	}
+
+	var r0 storage.DataRow
+	var r1 storage.Share
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (storage.DataRow, storage.Share, error)); ok {
+		return rf(ctx, username, itemID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) storage.DataRow); ok {
+		r0 = rf(ctx, username, itemID)
+	} else {
+		r0 = ret.Get(0).(storage.DataRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) storage.Share); ok {
+		r1 = rf(ctx, username, itemID)
+	} else {
+		r1 = ret.Get(1).(storage.Share)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, int64) error); ok {
+		r2 = rf(ctx, username, itemID)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetSharedTitles provides a mock function with given fields: ctx, username
+func (_m *Provider) GetSharedTitles(ctx context.Context, username string) ([]storage.DataRow, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSharedTitles")
+	}
+
+	var r0 []storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]storage.DataRow, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []storage.DataRow); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.DataRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetShares provides a mock function with given fields: ctx, itemID
+func (_m *Provider) GetShares(ctx context.Context, itemID int64) ([]storage.Share, error) {
+	ret := _m.Called(ctx, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetShares")
+	}
+
+	var r0 []storage.Share
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]storage.Share, error)); ok {
+		return rf(ctx, itemID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []storage.Share); ok {
+		r0 = rf(ctx, itemID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Share)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, itemID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTOTP provides a mock function with given fields: ctx, username
+func (_m *Provider) GetTOTP(ctx context.Context, username string) (storage.TOTP, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTOTP")
+	}
+
+	var r0 storage.TOTP
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (storage.TOTP, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) storage.TOTP); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(storage.TOTP)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTeamData provides a mock function with given fields: ctx, username, itemID
+func (_m *Provider) GetTeamData(ctx context.Context, username string, itemID int64) (storage.DataRow, storage.OrgMember, error) {
+	ret := _m.Called(ctx, username, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTeamData")
+	}
+
+	var r0 storage.DataRow
+	var r1 storage.OrgMember
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (storage.DataRow, storage.OrgMember, error)); ok {
+		return rf(ctx, username, itemID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) storage.DataRow); ok {
+		r0 = rf(ctx, username, itemID)
+	} else {
+		r0 = ret.Get(0).(storage.DataRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) storage.OrgMember); ok {
+		r1 = rf(ctx, username, itemID)
+	} else {
+		r1 = ret.Get(1).(storage.OrgMember)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, int64) error); ok {
+		r2 = rf(ctx, username, itemID)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetTeamTitles provides a mock function with given fields: ctx, username
+func (_m *Provider) GetTeamTitles(ctx context.Context, username string) ([]storage.DataRow, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTeamTitles")
+	}
+
+	var r0 []storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]storage.DataRow, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []storage.DataRow); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.DataRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTitlesByUser provides a mock function with given fields: ctx, username
+func (_m *Provider) GetTitlesByUser(ctx context.Context, username string) ([]storage.DataRow, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTitlesByUser")
+	}
+
+	var r0 []storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]storage.DataRow, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []storage.DataRow); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.DataRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserKey provides a mock function with given fields: ctx, username, version
+func (_m *Provider) GetUserKey(ctx context.Context, username string, version int) (storage.UserKey, error) {
+	ret := _m.Called(ctx, username, version)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserKey")
+	}
+
+	var r0 storage.UserKey
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) (storage.UserKey, error)); ok {
+		return rf(ctx, username, version)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) storage.UserKey); ok {
+		r0 = rf(ctx, username, version)
+	} else {
+		r0 = ret.Get(0).(storage.UserKey)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, username, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserKeysAfter provides a mock function with given fields: ctx, afterID, limit
+func (_m *Provider) GetUserKeysAfter(ctx context.Context, afterID int64, limit int) ([]storage.KeyRow, error) {
+	ret := _m.Called(ctx, afterID, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserKeysAfter")
+	}
+
+	var r0 []storage.KeyRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]storage.KeyRow, error)); ok {
+		return rf(ctx, afterID, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []storage.KeyRow); ok {
+		r0 = rf(ctx, afterID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.KeyRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, afterID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetVault provides a mock function with given fields: ctx, username
+func (_m *Provider) GetVault(ctx context.Context, username string) (storage.Vault, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetVault")
+	}
+
+	var r0 storage.Vault
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (storage.Vault, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) storage.Vault); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(storage.Vault)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HasCertificate provides a mock function with given fields: ctx, username
+func (_m *Provider) HasCertificate(ctx context.Context, username string) (bool, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for HasCertificate")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (bool, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Init provides a mock function with given fields:
+func (_m *Provider) Init() error {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Init")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListAuditEvents provides a mock function with given fields: ctx, username, beforeID, limit
+func (_m *Provider) ListAuditEvents(ctx context.Context, username string, beforeID int64, limit int) ([]storage.AuditEvent, error) {
+	ret := _m.Called(ctx, username, beforeID, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAuditEvents")
+	}
+
+	var r0 []storage.AuditEvent
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) ([]storage.AuditEvent, error)); ok {
+		return rf(ctx, username, beforeID, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int) []storage.AuditEvent); ok {
+		r0 = rf(ctx, username, beforeID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.AuditEvent)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int) error); ok {
+		r1 = rf(ctx, username, beforeID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCollectionRevisions provides a mock function with given fields: ctx, itemID
+func (_m *Provider) ListCollectionRevisions(ctx context.Context, itemID int64) ([]storage.Revision, error) {
+	ret := _m.Called(ctx, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListCollectionRevisions")
+	}
+
+	var r0 []storage.Revision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]storage.Revision, error)); ok {
+		return rf(ctx, itemID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []storage.Revision); ok {
+		r0 = rf(ctx, itemID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Revision)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, itemID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCollections provides a mock function with given fields: ctx, orgID
+func (_m *Provider) ListCollections(ctx context.Context, orgID int64) ([]storage.Collection, error) {
+	ret := _m.Called(ctx, orgID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListCollections")
+	}
+
+	var r0 []storage.Collection
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]storage.Collection, error)); ok {
+		return rf(ctx, orgID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []storage.Collection); ok {
+		r0 = rf(ctx, orgID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Collection)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, orgID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListMemberships provides a mock function with given fields: ctx, username
+func (_m *Provider) ListMemberships(ctx context.Context, username string) ([]storage.OrgMember, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListMemberships")
+	}
+
+	var r0 []storage.OrgMember
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]storage.OrgMember, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []storage.OrgMember); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.OrgMember)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListRevisions provides a mock function with given fields: ctx, itemID
+func (_m *Provider) ListRevisions(ctx context.Context, itemID int64) ([]storage.Revision, error) {
+	ret := _m.Called(ctx, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListRevisions")
+	}
+
+	var r0 []storage.Revision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]storage.Revision, error)); ok {
+		return rf(ctx, itemID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []storage.Revision); ok {
+		r0 = rf(ctx, itemID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Revision)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, itemID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: ctx, username, now
+func (_m *Provider) ListSessions(ctx context.Context, username string, now time.Time) ([]storage.Session, error) {
+	ret := _m.Called(ctx, username, now)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListSessions")
+	}
+
+	var r0 []storage.Session
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) ([]storage.Session, error)); ok {
+		return rf(ctx, username, now)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) []storage.Session); ok {
+		r0 = rf(ctx, username, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Session)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, username, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListTrash provides a mock function with given fields: ctx, username
+func (_m *Provider) ListTrash(ctx context.Context, username string) ([]storage.DataRow, error) {
+	ret := _m.Called(ctx, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListTrash")
+	}
+
+	var r0 []storage.DataRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]storage.DataRow, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []storage.DataRow); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.DataRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeTrash provides a mock function with given fields: ctx, before
+func (_m *Provider) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PurgeTrash")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (int64, error)); ok {
+		return rf(ctx, before)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordLoginFailure provides a mock function with given fields: ctx, key, lockout
+func (_m *Provider) RecordLoginFailure(ctx context.Context, key string, lockout storage.LockoutFunc) (storage.LoginAttempt, error) {
+	ret := _m.Called(ctx, key, lockout)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordLoginFailure")
+	}
+
+	var r0 storage.LoginAttempt
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.LockoutFunc) (storage.LoginAttempt, error)); ok {
+		return rf(ctx, key, lockout)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.LockoutFunc) storage.LoginAttempt); ok {
+		r0 = rf(ctx, key, lockout)
+	} else {
+		r0 = ret.Get(0).(storage.LoginAttempt)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, storage.LockoutFunc) error); ok {
+		r1 = rf(ctx, key, lockout)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveClient provides a mock function with given fields: ctx, clientID
+func (_m *Provider) RemoveClient(ctx context.Context, clientID string) error {
+	ret := _m.Called(ctx, clientID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveClient")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, clientID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveOrgMember provides a mock function with given fields: ctx, orgID, username
+func (_m *Provider) RemoveOrgMember(ctx context.Context, orgID int64, username string) error {
+	ret := _m.Called(ctx, orgID, username)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveOrgMember")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) error); ok {
+		r0 = rf(ctx, orgID, username)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveStaleClients provides a mock function with given fields: ctx, now
+func (_m *Provider) RemoveStaleClients(ctx context.Context, now time.Time) error {
+	ret := _m.Called(ctx, now)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveStaleClients")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) error); ok {
+		r0 = rf(ctx, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReplaceData provides a mock function with given fields: ctx, update
+func (_m *Provider) ReplaceData(ctx context.Context, update storage.CipherUpdate) error {
+	ret := _m.Called(ctx, update)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReplaceData")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.CipherUpdate) error); ok {
+		r0 = rf(ctx, update)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreData provides a mock function with given fields: ctx, username, itemID
+func (_m *Provider) RestoreData(ctx context.Context, username string, itemID int64) error {
+	ret := _m.Called(ctx, username, itemID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RestoreData")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, username, itemID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveEncryptedTitles provides a mock function with given fields: ctx, rows
+func (_m *Provider) SaveEncryptedTitles(ctx context.Context, rows []storage.DataRow) error {
+	ret := _m.Called(ctx, rows)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveEncryptedTitles")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []storage.DataRow) error); ok {
+		r0 = rf(ctx, rows)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveItemShares provides a mock function with given fields: ctx, shares
+func (_m *Provider) SaveItemShares(ctx context.Context, shares storage.ItemShares) error {
+	ret := _m.Called(ctx, shares)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveItemShares")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ItemShares) error); ok {
+		r0 = rf(ctx, shares)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveOrgMember provides a mock function with given fields: ctx, member
+func (_m *Provider) SaveOrgMember(ctx context.Context, member storage.OrgMember) error {
+	ret := _m.Called(ctx, member)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveOrgMember")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.OrgMember) error); ok {
+		r0 = rf(ctx, member)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveReencryptedData provides a mock function with given fields: ctx, rotationID, updates, lastID
+func (_m *Provider) SaveReencryptedData(ctx context.Context, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	ret := _m.Called(ctx, rotationID, updates, lastID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveReencryptedData")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []storage.CipherUpdate, int64) error); ok {
+		r0 = rf(ctx, rotationID, updates, lastID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveReencryptedRevisions provides a mock function with given fields: ctx, rotationID, updates, lastID
+func (_m *Provider) SaveReencryptedRevisions(ctx context.Context, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	ret := _m.Called(ctx, rotationID, updates, lastID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveReencryptedRevisions")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []storage.CipherUpdate, int64) error); ok {
+		r0 = rf(ctx, rotationID, updates, lastID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveRewrappedKeys provides a mock function with given fields: ctx, rotationID, updates, lastID
+func (_m *Provider) SaveRewrappedKeys(ctx context.Context, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	ret := _m.Called(ctx, rotationID, updates, lastID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveRewrappedKeys")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []storage.CipherUpdate, int64) error); ok {
+		r0 = rf(ctx, rotationID, updates, lastID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveTOTP provides a mock function with given fields: ctx, username, secret
+func (_m *Provider) SaveTOTP(ctx context.Context, username string, secret string) error {
+	ret := _m.Called(ctx, username, secret)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveTOTP")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, username, secret)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetRevisionLimit provides a mock function with given fields: ctx, username, limit
+func (_m *Provider) SetRevisionLimit(ctx context.Context, username string, limit int) error {
+	ret := _m.Called(ctx, username, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetRevisionLimit")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) error); ok {
+		r0 = rf(ctx, username, limit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TouchSession provides a mock function with given fields: ctx, sessionID, seenAt
+func (_m *Provider) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	ret := _m.Called(ctx, sessionID, seenAt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for TouchSession")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, sessionID, seenAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TrashData provides a mock function with given fields: ctx, username, itemID, deletedAt
+func (_m *Provider) TrashData(ctx context.Context, username string, itemID int64, deletedAt time.Time) error {
+	ret := _m.Called(ctx, username, itemID, deletedAt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for TrashData")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, time.Time) error); ok {
+		r0 = rf(ctx, username, itemID, deletedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateClientState provides a mock function with given fields: ctx, clientID, state, _a3
+func (_m *Provider) UpdateClientState(ctx context.Context, clientID string, state service.State, _a3 string) error {
+	ret := _m.Called(ctx, clientID, state, _a3)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateClientState")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, service.State, string) error); ok {
+		r0 = rf(ctx, clientID, state, _a3)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateCollectionItem provides a mock function with given fields: ctx, row, version, author
+func (_m *Provider) UpdateCollectionItem(ctx context.Context, row storage.DataRow, version int64, author storage.Revision) error {
+	ret := _m.Called(ctx, row, version, author)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateCollectionItem")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.DataRow, int64, storage.Revision) error); ok {
+		r0 = rf(ctx, row, version, author)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateData provides a mock function with given fields: ctx, row, version, author
+func (_m *Provider) UpdateData(ctx context.Context, row storage.DataRow, version int64, author storage.Revision) error {
+	ret := _m.Called(ctx, row, version, author)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateData")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.DataRow, int64, storage.Revision) error); ok {
+		r0 = rf(ctx, row, version, author)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdatePasswordHash provides a mock function with given fields: ctx, username, passwordHash
+func (_m *Provider) UpdatePasswordHash(ctx context.Context, username string, passwordHash string) error {
+	ret := _m.Called(ctx, username, passwordHash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdatePasswordHash")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, service.State) error); ok {
-		r0 = rf(ctx, clientID, state)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, username, passwordHash)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -230,6 +1852,62 @@ func (_m *Provider) UpdateClientState(ctx context.Context, clientID string, stat
 	return r0
 }
 
+// UseRecoveryCode provides a mock function with given fields: ctx, username, codeHash
+func (_m *Provider) UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error) {
+	ret := _m.Called(ctx, username, codeHash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UseRecoveryCode")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (bool, error)); ok {
+		return rf(ctx, username, codeHash)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, username, codeHash)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, username, codeHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseTOTPStep provides a mock function with given fields: ctx, username, step
+func (_m *Provider) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	ret := _m.Called(ctx, username, step)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UseTOTPStep")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (bool, error)); ok {
+		return rf(ctx, username, step)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) bool); ok {
+		r0 = rf(ctx, username, step)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, username, step)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewProvider creates a new instance of Provider. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewProvider(t interface {
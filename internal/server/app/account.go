@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeleteAccount удаляет пользователя и все его данные. Кроме токена сессии нужен пароль,
+// а если включен TOTP, еще и одноразовый код. После удаления закрываются все стримы пользователя.
+func (s *server) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	keys := attemptKeys(ctx, id.Username)
+	if err := s.checkLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := s.provider.GetPasswordHash(ctx, id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get password hash of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to delete account")
+	}
+	match, _, err := service.CheckPassword(req.Password, passwordHash)
+	if err != nil || !match {
+		s.recordLoginFailure(keys)
+		return nil, status.Error(codes.PermissionDenied, "wrong password")
+	}
+
+	err = s.checkSecondFactor(id.Username, req.TotpCode)
+	if err != nil {
+		if errors.Is(err, ErrTOTPRequired) {
+			return &pb.DeleteAccountResponse{
+				Message:      "Введите новый одноразовый код из приложения или код восстановления.",
+				TotpRequired: true,
+			}, nil
+		}
+		if errors.Is(err, ErrTOTPInvalid) {
+			s.recordLoginFailure(keys)
+			return nil, status.Error(codes.PermissionDenied, "invalid one-time code")
+		}
+		logger.Log.Sugar().Errorf("Failed to check one-time code of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to check one-time code")
+	}
+
+	deleted, err := s.provider.DeleteUser(ctx, id.Username)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrLastOwner) {
+			return nil, status.Error(codes.FailedPrecondition, "appoint another owner of organization before deleting account")
+		}
+		logger.Log.Sugar().Errorf("Failed to delete account %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to delete account")
+	}
+	s.resetLoginFailures(id.Username)
+
+	// закрываются стримы всех сессий, в том числе текущей
+	s.revokeStreams(id.Username, "\nАккаунт удален, сессия завершена.", func(string) bool { return true })
+	logger.Log.Sugar().Infof("Account %s deleted: %v", id.Username, deleted)
+
+	return &pb.DeleteAccountResponse{
+		Message: "Аккаунт и все данные удалены.",
+		Deleted: deleted,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		clients:  make(map[string]*client),
+		cfg:      &config.Config{SessionTTL: time.Hour, LoginMaxFailures: 5},
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "current"})
+	passwordHash, _ := service.HashPassword("password")
+
+	t.Run("account deleted", func(t *testing.T) {
+		current, other := newClient(), newClient()
+		current.sessionID, other.sessionID = "current", "other"
+		server.clients[username+"::1"] = current
+		server.clients[username+"::2"] = other
+		deleted := map[string]int64{"users": 1, "user_data": 3, "sessions": 2}
+
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("DeleteUser", mock.Anything, username).Return(deleted, nil)
+
+		resp, err := server.DeleteAccount(ctx, &pb.DeleteAccountRequest{Password: "password"})
+		assert.NoError(t, err)
+		assert.Equal(t, deleted, resp.Deleted)
+
+		// закрываются стримы всех сессий пользователя, включая текущую
+		assert.True(t, isClosed(current.revoked))
+		assert.True(t, isClosed(other.revoked))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+		server.clients = make(map[string]*client)
+	})
+
+	t.Run("last owner of organization", func(t *testing.T) {
+		current := newClient()
+		current.sessionID = "current"
+		server.clients[username+"::1"] = current
+
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("DeleteUser", mock.Anything, username).Return(nil, sqlite.ErrLastOwner)
+
+		resp, err := server.DeleteAccount(ctx, &pb.DeleteAccountRequest{Password: "password"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.FailedPrecondition, st.Code())
+		// аккаунт не удален, сессии продолжают работать
+		assert.False(t, isClosed(current.revoked))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+		server.clients = make(map[string]*client)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		mockProvider.On("GetLoginAttempts", mock.Anything, []string{"user:" + username}).Return(nil, nil)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("RecordLoginFailure", mock.Anything, "user:"+username, mock.Anything).Return(storage.LoginAttempt{}, nil)
+
+		resp, err := server.DeleteAccount(ctx, &pb.DeleteAccountRequest{Password: "wrong"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.PermissionDenied, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("one-time code required", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{Secret: "sealed", Confirmed: true}, nil)
+
+		resp, err := server.DeleteAccount(ctx, &pb.DeleteAccountRequest{Password: "password"})
+		assert.NoError(t, err)
+		assert.True(t, resp.TotpRequired)
+		assert.Empty(t, resp.Deleted)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		resp, err := server.DeleteAccount(context.Background(), &pb.DeleteAccountRequest{Password: "password"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+}
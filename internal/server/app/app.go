@@ -18,14 +18,25 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 )
 
 type client struct {
-	stream pb.KeeperService_CommandServer
-	ch     chan *pb.CommandMessage
-	done   chan struct{}
-	state  service.State
+	// сообщения и уведомления, которые отправляет клиенту горутина отправки стрима
+	ch    chan *pb.CommandMessage
+	done  chan struct{}
+	state service.State
+	// данные незавершенного действия в JSON, сохраняются вместе с состоянием
+	context string
+	// сессия, с токеном которой открыт стрим
+	sessionID string
+	// клиент стрима Connect: не ведет диалог, поэтому хранится только в памяти
+	ephemeral bool
+	// закрывается, когда сессия отозвана и стрим нужно завершить
+	revoked      chan struct{}
+	revokeOnce   sync.Once
+	revokeReason string
+	// закрывается, когда горутина отправки сообщений клиенту завершилась
+	stopped chan struct{}
 }
 
 type server struct {
@@ -34,8 +45,11 @@ type server struct {
 	mu       sync.Mutex
 	cfg      *config.Config
 	provider storage.Provider
-	ctx      context.Context
-	cancel   context.CancelFunc
+	keyring  *service.Keyring
+	// секрет фиктивных солей GetVaultParams, не меняется при ротации мастер-ключа
+	fakeSaltSecret string
+	ctx            context.Context
+	cancel         context.CancelFunc
 }
 
 // ErrServerStoped описывает ошибку, возникающую при остановке сервера.
@@ -56,14 +70,48 @@ func New(cfg *config.Config) (*server, error) {
 		return nil, err
 	}
 
+	// связка мастер-ключей: текущий и старые, которые еще нужны во время ротации
+	keyring, err := service.NewKeyring(cfg.SecretID, cfg.Secret, cfg.OldSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	// секрет создается при первом запуске и дальше хранится в БД
+	candidate, err := service.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	fakeSaltSecret, err := provider.GetServerSecret(context.Background(), fakeSaltSecretName, candidate)
+	if err != nil {
+		return nil, err
+	}
+
 	// контекст необходим для остановки всех горутин
 	ctx, cancel := context.WithCancel(context.Background())
-	return &server{clients: make(map[string]*client), cfg: cfg, provider: provider, ctx: ctx, cancel: cancel}, nil
+	return &server{clients: make(map[string]*client), cfg: cfg, provider: provider, keyring: keyring,
+		fakeSaltSecret: fakeSaltSecret, ctx: ctx, cancel: cancel}, nil
 }
 
 func (s *server) Run() error {
+	// Шифрование названий записей, сохраненных до появления слепого индекса
+	if err := s.encryptPlainTitles(); err != nil {
+		logger.Log.Sugar().Errorf("Failed to encrypt titles: %v", err)
+		return ErrServerStart
+	}
+
+	// диалоги клиентов, которые были подключены до перезапуска
+	if err := s.loadClientsFromDB(); err != nil {
+		logger.Log.Sugar().Errorf("Failed to load clients: %v", err)
+		return ErrServerStart
+	}
+
+	// удаление из корзин записей с истекшим сроком хранения
+	go s.runTrashPurger()
+	// удаление диалогов сессий, истекших во время работы сервера
+	go s.runStaleClientsCleaner()
+
 	// Загрузка сертификата сервера и закрытого ключа
-	creds, err := credentials.NewServerTLSFromFile(s.cfg.CertPath, s.cfg.CertKeyPath)
+	creds, err := s.serverCredentials()
 	if err != nil {
 		logger.Log.Sugar().Errorf("Failed to generate credentials: %v", err)
 		return ErrServerStart
@@ -75,7 +123,11 @@ func (s *server) Run() error {
 		return ErrServerStart
 	}
 
-	gs := grpc.NewServer(grpc.Creds(creds))
+	gs := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.UnaryInterceptor(s.unaryAuthInterceptor),
+		grpc.StreamInterceptor(s.streamAuthInterceptor),
+	)
 	pb.RegisterKeeperServiceServer(gs, s)
 
 	// Создание канала для ошибок
@@ -141,19 +193,22 @@ func (s *server) Shutdown(gs *grpc.Server) {
 	}
 }
 
+// loadClientsFromDB восстанавливает после перезапуска диалоги клиентов, сессии которых еще действуют.
+// Клиенты загружаются без стрима и продолжают диалог, когда переподключаются с тем же токеном.
 func (s *server) loadClientsFromDB() error {
+	if err := s.provider.RemoveStaleClients(s.ctx, time.Now()); err != nil {
+		return err
+	}
 	clients, err := s.provider.GetAllClients(s.ctx)
 	if err != nil {
 		return err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, clientData := range clients {
-		client := &client{
-			ch:    make(chan *pb.CommandMessage, 100),
-			done:  make(chan struct{}),
-			state: service.State(clientData.State),
-		}
-		s.addClient(clientData.Username, clientData.ClientID, client)
+		s.clients[clientData.ClientID] = detachedClient(clientData.SessionID, service.State(clientData.State), clientData.Context)
 	}
+	logger.Log.Sugar().Infof("Loaded %d saved conversations", len(clients))
 	return nil
 }
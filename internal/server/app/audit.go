@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultAuditPageSize размер страницы журнала, если клиент его не указал
+	defaultAuditPageSize = 20
+	// maxAuditPageSize ограничивает размер страницы, запрошенный клиентом
+	maxAuditPageSize = 100
+	// auditExportBatchSize количество событий, читаемых из БД за один запрос при экспорте
+	auditExportBatchSize = 500
+	// operatorPrefix отмечает в журнале события оператора сервера, чтобы они не попали в журнал пользователя
+	operatorPrefix = "operator:"
+)
+
+// audit записывает событие журнала аудита без записи, например вход
+func (s *server) audit(ctx context.Context, username string, action service.AuditAction, sessionID string) {
+	s.recordAudit(ctx, storage.AuditEvent{Username: username, Action: action, SessionID: sessionID})
+}
+
+// auditItem записывает событие с записью. Запись указывается по id, ее название в журнал не попадает.
+// id записей коллекций и личных записей независимы, поэтому запись коллекции отмечается отдельно.
+func (s *server) auditItem(ctx context.Context, username string, action service.AuditAction, row storage.DataRow) {
+	s.recordAudit(ctx, storage.AuditEvent{Username: username, Action: action, ItemID: row.ID, CollectionItem: row.CollectionID != 0})
+}
+
+// recordAudit дополняет событие сессией из контекста запроса, если он аутентифицирован, адресом из данных
+// о подключении и временем и записывает его. Ошибка записи не прерывает действие и только логируется.
+func (s *server) recordAudit(ctx context.Context, event storage.AuditEvent) {
+	if event.SessionID == "" {
+		if id, err := identityFromContext(ctx); err == nil {
+			event.SessionID = id.SessionID
+		}
+	}
+	event.IP = peerIP(ctx)
+	event.CreatedAt = time.Now()
+
+	if err := s.provider.AddAuditEvent(s.ctx, event); err != nil {
+		logger.Log.Sugar().Errorf("Failed to write audit event %s of %s: %v", event.Action, event.Username, err)
+	}
+}
+
+// ListAuditEvents возвращает страницу журнала аудита пользователя от новых событий к старым.
+// Токен следующей страницы - идентификатор последнего события на странице.
+func (s *server) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultAuditPageSize
+	}
+	if pageSize > maxAuditPageSize {
+		pageSize = maxAuditPageSize
+	}
+
+	var beforeID int64
+	if req.PageToken != "" {
+		beforeID, err = strconv.ParseInt(req.PageToken, 10, 64)
+		if err != nil || beforeID <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	// лишнее событие показывает, есть ли следующая страница
+	events, err := s.provider.ListAuditEvents(ctx, id.Username, beforeID, pageSize+1)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to list audit events of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to list audit events")
+	}
+
+	resp := &pb.ListAuditEventsResponse{}
+	if len(events) > pageSize {
+		events = events[:pageSize]
+		resp.NextPageToken = strconv.FormatInt(events[pageSize-1].ID, 10)
+	}
+	titles, err := s.auditTitles(id.Username, events)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get titles of audit events of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to list audit events")
+	}
+	resp.Events = make([]*pb.AuditEvent, 0, len(events))
+	for _, event := range events {
+		item := event.Item
+		if event.ItemID != 0 {
+			item = titles[auditItemKey{id: event.ItemID, collection: event.CollectionItem}]
+			if item == "" {
+				item = fmt.Sprintf("запись #%d удалена или недоступна", event.ItemID)
+			}
+		}
+		resp.Events = append(resp.Events, &pb.AuditEvent{
+			Id:            event.ID,
+			Action:        string(event.Action),
+			Item:          item,
+			SessionId:     event.SessionID,
+			Ip:            event.IP,
+			CreatedAtUnix: event.CreatedAt.Unix(),
+		})
+	}
+	return resp, nil
+}
+
+// auditItemKey указывает запись в событии журнала: личную запись или запись коллекции
+type auditItemKey struct {
+	id         int64
+	collection bool
+}
+
+// auditTitles расшифровывает названия записей из событий журнала. Названия берутся из записей,
+// доступных пользователю сейчас, и из его корзины, поэтому у окончательно удаленных записей названия нет.
+func (s *server) auditTitles(username string, events []storage.AuditEvent) (map[auditItemKey]string, error) {
+	titles := make(map[auditItemKey]string)
+	hasItems := false
+	for _, event := range events {
+		hasItems = hasItems || event.ItemID != 0
+	}
+	if !hasItems {
+		return titles, nil
+	}
+
+	rows, err := s.listItems(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.CollectionID != 0 {
+			titles[auditItemKey{id: row.ID, collection: true}] = row.Collection + "/" + row.Title
+			continue
+		}
+		titles[auditItemKey{id: row.ID}] = row.Title
+	}
+
+	trashed, err := s.provider.ListTrash(s.ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range trashed {
+		if titles[auditItemKey{id: row.ID}], err = s.openTitle(row); err != nil {
+			return nil, err
+		}
+	}
+	return titles, nil
+}
+
+// ExportAudit выгружает журнал аудита в формате JSON Lines, по одному событию в строке.
+// Записи в событиях указываются по id, названия в выгрузку не попадают.
+// Если переданы имена пользователей, выгружаются только их события.
+// Сама выгрузка записывается в журнал: оператор и пользователи, по которым она выполнена.
+func (s *server) ExportAudit(w io.Writer, usernames []string) error {
+	s.recordAudit(s.ctx, storage.AuditEvent{
+		Username: operatorPrefix + operatorName(),
+		Action:   service.AUDIT_EXPORT,
+		Item:     strings.Join(usernames, ","),
+	})
+
+	filter := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		filter[username] = true
+	}
+
+	encoder := json.NewEncoder(w)
+	var afterID int64
+	exported := 0
+	for {
+		events, err := s.provider.GetAuditEventsAfter(s.ctx, afterID, auditExportBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			logger.Log.Sugar().Infof("Exported %d audit events", exported)
+			return nil
+		}
+
+		for _, event := range events {
+			if len(filter) > 0 && !filter[event.Username] {
+				continue
+			}
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+			exported++
+		}
+		afterID = events[len(events)-1].ID
+	}
+}
+
+// operatorName возвращает имя пользователя ОС, от которого запущена команда сервера
+func operatorName() string {
+	current, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return current.Username
+}
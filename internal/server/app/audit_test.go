@@ -0,0 +1,242 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// auditEventOf сопоставляет событие журнала аудита по пользователю и действию
+func auditEventOf(username string, action service.AuditAction) interface{} {
+	return mock.MatchedBy(func(event storage.AuditEvent) bool {
+		return event.Username == username && event.Action == action
+	})
+}
+
+func TestAudit(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		ctx:      context.Background(),
+	}
+
+	t.Run("session and address saved", func(t *testing.T) {
+		ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+		ctx = withPeerAddr(ctx, "10.0.0.1:51000")
+		saved := mock.MatchedBy(func(event storage.AuditEvent) bool {
+			return event.Action == service.ITEM_READ && event.ItemID == 7 && !event.CollectionItem && event.Item == "" &&
+				event.SessionID == "session-id" && event.IP == "10.0.0.1" && !event.CreatedAt.IsZero()
+		})
+		mockProvider.On("AddAuditEvent", mock.Anything, saved).Return(nil)
+
+		server.auditItem(ctx, "alice", service.ITEM_READ, storage.DataRow{ID: 7})
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("new session of login", func(t *testing.T) {
+		saved := mock.MatchedBy(func(event storage.AuditEvent) bool {
+			return event.Action == service.LOGIN_SUCCESS && event.SessionID == "new-session"
+		})
+		mockProvider.On("AddAuditEvent", mock.Anything, saved).Return(nil)
+
+		server.audit(context.Background(), "alice", service.LOGIN_SUCCESS, "new-session")
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("write error ignored", func(t *testing.T) {
+		mockProvider.On("AddAuditEvent", mock.Anything, mock.Anything).Return(errors.New("db error"))
+
+		server.audit(context.Background(), "alice", service.LOGIN_FAILURE, "")
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestListAuditEvents(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	// запись коллекции с тем же id, что и личная запись 5
+	orgKey, _ := service.GenerateDataKey()
+	wrappedOrgKey, _ := service.EncryptRecord(orgKey, dataKey, 1, service.OrgKeyAAD("acme", username))
+	teamIndex := service.TitleIndex(orgKey, "vpn")
+	teamCipher, _ := service.EncryptRecord("vpn", orgKey, 1, service.CollectionTitleAAD(3, teamIndex))
+	teamRows := []storage.DataRow{{ID: 5, Username: "alice", TitleIndex: teamIndex, TitleCipher: teamCipher, OrgID: 2, CollectionID: 3, Collection: "acme/infra"}}
+	member := storage.OrgMember{OrgID: 2, OrgName: "acme", Username: username, Role: service.ORG_MEMBER, WrappedKey: wrappedOrgKey}
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "current"})
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	events := []storage.AuditEvent{
+		{ID: 12, Username: username, Action: service.ITEM_READ, ItemID: 5, SessionID: "current", CreatedAt: created},
+		{ID: 11, Username: username, Action: service.LOGIN_SUCCESS, SessionID: "current", CreatedAt: created},
+		{ID: 7, Username: username, Action: service.LOGIN_FAILURE, IP: "10.0.0.1", CreatedAt: created},
+	}
+
+	// expectTitles возвращает запись 5 в списке записей и запись 6 в корзине. Названия сохранены
+	// до шифрования названий, поэтому открытое название лежит в слепом индексе
+	expectTitles := func() {
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return([]storage.DataRow{{ID: 5, Username: username, TitleIndex: "mail"}}, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return(teamRows, nil)
+		mockProvider.On("ListMemberships", mock.Anything, username).Return([]storage.OrgMember{member}, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("ListTrash", mock.Anything, username).Return([]storage.DataRow{{ID: 6, Username: username, TitleIndex: "bank"}}, nil)
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		expectTitles()
+		mockProvider.On("ListAuditEvents", mock.Anything, username, int64(0), 3).Return(events, nil)
+
+		resp, err := server.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{PageSize: 2})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Events, 2)
+		assert.Equal(t, "item_read", resp.Events[0].Action)
+		assert.Equal(t, "mail", resp.Events[0].Item)
+		assert.Equal(t, created.Unix(), resp.Events[0].CreatedAtUnix)
+		assert.Equal(t, "11", resp.NextPageToken)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("titles of trashed and purged items", func(t *testing.T) {
+		expectTitles()
+		mockProvider.On("ListAuditEvents", mock.Anything, username, int64(0), defaultAuditPageSize+1).Return([]storage.AuditEvent{
+			{ID: 15, Username: username, Action: service.ITEM_CREATE, ItemID: 5, CollectionItem: true, CreatedAt: created},
+			{ID: 14, Username: username, Action: service.ITEM_DELETE, ItemID: 6, CreatedAt: created},
+			{ID: 13, Username: username, Action: service.ITEM_READ, ItemID: 9, CreatedAt: created},
+		}, nil)
+
+		resp, err := server.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{})
+		assert.NoError(t, err)
+		if assert.Len(t, resp.Events, 3) {
+			// у записи коллекции свой id, который может совпасть с id личной записи
+			assert.Equal(t, "acme/infra/vpn", resp.Events[0].Item)
+			assert.Equal(t, "bank", resp.Events[1].Item)
+			assert.Equal(t, "запись #9 удалена или недоступна", resp.Events[2].Item)
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		mockProvider.On("ListAuditEvents", mock.Anything, username, int64(11), defaultAuditPageSize+1).Return(events[2:], nil)
+
+		resp, err := server.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{PageToken: "11"})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Events, 1)
+		assert.Empty(t, resp.NextPageToken)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("page size limited", func(t *testing.T) {
+		mockProvider.On("ListAuditEvents", mock.Anything, username, int64(0), maxAuditPageSize+1).Return(nil, nil)
+
+		resp, err := server.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{PageSize: 1000})
+		assert.NoError(t, err)
+		assert.Empty(t, resp.Events)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("invalid page token", func(t *testing.T) {
+		resp, err := server.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{PageToken: "abc"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		resp, err := server.ListAuditEvents(context.Background(), &pb.ListAuditEventsRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+}
+
+func TestExportAudit(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		ctx:      context.Background(),
+	}
+
+	first := []storage.AuditEvent{
+		{ID: 1, Username: "alice", Action: service.LOGIN_SUCCESS},
+		{ID: 2, Username: "bob", Action: service.LOGIN_FAILURE},
+	}
+	second := []storage.AuditEvent{
+		{ID: 3, Username: "alice", Action: service.ITEM_CREATE, ItemID: 5},
+	}
+
+	t.Run("all events", func(t *testing.T) {
+		mockProvider.On("AddAuditEvent", mock.Anything, mock.MatchedBy(func(event storage.AuditEvent) bool {
+			return event.Action == service.AUDIT_EXPORT && strings.HasPrefix(event.Username, operatorPrefix) && event.Item == ""
+		})).Return(nil)
+		mockProvider.On("GetAuditEventsAfter", mock.Anything, int64(0), auditExportBatchSize).Return(first, nil)
+		mockProvider.On("GetAuditEventsAfter", mock.Anything, int64(2), auditExportBatchSize).Return(second, nil)
+		mockProvider.On("GetAuditEventsAfter", mock.Anything, int64(3), auditExportBatchSize).Return(nil, nil)
+
+		var out bytes.Buffer
+		err := server.ExportAudit(&out, nil)
+		assert.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(t, lines, 3)
+		var event storage.AuditEvent
+		assert.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+		assert.Equal(t, second[0], event)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("filtered by user", func(t *testing.T) {
+		mockProvider.On("AddAuditEvent", mock.Anything, mock.MatchedBy(func(event storage.AuditEvent) bool {
+			return event.Action == service.AUDIT_EXPORT && event.Item == "bob"
+		})).Return(nil)
+		mockProvider.On("GetAuditEventsAfter", mock.Anything, int64(0), auditExportBatchSize).Return(first, nil)
+		mockProvider.On("GetAuditEventsAfter", mock.Anything, int64(2), auditExportBatchSize).Return(second, nil)
+		mockProvider.On("GetAuditEventsAfter", mock.Anything, int64(3), auditExportBatchSize).Return(nil, nil)
+
+		var out bytes.Buffer
+		err := server.ExportAudit(&out, []string{"bob"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+		assert.Contains(t, out.String(), `"action":"login_failure"`)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
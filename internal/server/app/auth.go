@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenMetadataKey ключ метаданных gRPC, в котором клиент передает токен сессии
+const tokenMetadataKey = "token"
+
+// deviceMetadataKey ключ метаданных gRPC, в котором клиент передает название устройства при входе
+const deviceMetadataKey = "device"
+
+// maxDeviceLength ограничивает название устройства, которое задает клиент
+const maxDeviceLength = 64
+
+// sessionTouchInterval не чаще этого интервала обновляется время последней активности сессии
+const sessionTouchInterval = time.Minute
+
+// ErrIdentityNotFound описывает ошибку отсутствия аутентифицированного пользователя в контексте.
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// identity описывает аутентифицированного пользователя и его сессию
+type identity struct {
+	Username  string
+	SessionID string
+}
+
+type identityKey struct{}
+
+// методы, для вызова которых токен не нужен
+var publicMethods = map[string]bool{
+	pb.KeeperService_Login_FullMethodName:          true,
+	pb.KeeperService_Register_FullMethodName:       true,
+	pb.KeeperService_GetVaultParams_FullMethodName: true,
+	pb.KeeperService_CertLogin_FullMethodName:      true,
+}
+
+func withIdentity(ctx context.Context, id identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// identityFromContext возвращает пользователя, которого аутентифицировал перехватчик
+func identityFromContext(ctx context.Context) (identity, error) {
+	id, ok := ctx.Value(identityKey{}).(identity)
+	if !ok {
+		return identity{}, ErrIdentityNotFound
+	}
+	return id, nil
+}
+
+// issueSession создает новую сессию пользователя и возвращает ее токен и идентификатор
+func (s *server) issueSession(ctx context.Context, username string) (string, string, error) {
+	token, err := service.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := storage.Session{
+		ID:        uuid.NewString(),
+		Username:  username,
+		Device:    deviceName(ctx),
+		IP:        peerIP(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.SessionTTL),
+	}
+	err = s.provider.CreateSession(ctx, session, service.GetTokenHash(token))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to create session: %v", err)
+		return "", "", err
+	}
+	return token, session.ID, nil
+}
+
+// deviceName возвращает название устройства из метаданных запроса
+func deviceName(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	devices := md.Get(deviceMetadataKey)
+	if len(devices) == 0 {
+		return ""
+	}
+	device := strings.TrimSpace(devices[0])
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+	return device
+}
+
+// touchSession обновляет время последней активности сессии, если оно устарело.
+// Ошибка не мешает запросу и только логируется.
+func (s *server) touchSession(sessionID string, lastSeenAt time.Time) time.Time {
+	now := time.Now()
+	if now.Sub(lastSeenAt) < sessionTouchInterval {
+		return lastSeenAt
+	}
+	if err := s.provider.TouchSession(s.ctx, sessionID, now); err != nil {
+		logger.Log.Sugar().Errorf("Failed to update session activity: %v", err)
+		return lastSeenAt
+	}
+	return now
+}
+
+// authenticate проверяет токен из метаданных запроса и кладет пользователя в контекст
+func (s *server) authenticate(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing metadata")
+	}
+
+	tokens := md.Get(tokenMetadataKey)
+	if len(tokens) == 0 || tokens[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	session, err := s.provider.GetSession(ctx, service.GetTokenHash(tokens[0]))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, status.Error(codes.Unauthenticated, "token expired")
+	}
+
+	s.touchSession(session.ID, session.LastSeenAt)
+
+	return withIdentity(ctx, identity{Username: session.Username, SessionID: session.ID}), nil
+}
+
+// unaryAuthInterceptor проверяет токен для всех unary методов, кроме входа и регистрации
+func (s *server) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream подменяет контекст стрима на контекст с аутентифицированным пользователем
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authStream) Context() context.Context {
+	return a.ctx
+}
+
+// streamAuthInterceptor проверяет токен при открытии стрима
+func (s *server) streamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestAuthenticate тестирует проверку токена сессии
+func TestAuthenticate(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+	}
+
+	token := "sometoken"
+	tokenHash := service.GetTokenHash(token)
+	ctxWithToken := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tokenMetadataKey, token))
+
+	t.Run("valid token", func(t *testing.T) {
+		session := storage.Session{ID: "session-id", Username: "testuser", ExpiresAt: time.Now().Add(time.Hour)}
+		mockProvider.On("GetSession", mock.Anything, tokenHash).Return(session, nil)
+		mockProvider.On("TouchSession", mock.Anything, "session-id", mock.Anything).Return(nil)
+
+		ctx, err := server.authenticate(ctxWithToken)
+		assert.NoError(t, err)
+		id, err := identityFromContext(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, identity{Username: "testuser", SessionID: "session-id"}, id)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("recent activity not updated", func(t *testing.T) {
+		session := storage.Session{ID: "session-id", Username: "testuser", LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+		mockProvider.On("GetSession", mock.Anything, tokenHash).Return(session, nil)
+
+		_, err := server.authenticate(ctxWithToken)
+		assert.NoError(t, err)
+		// обновление было только в предыдущем подтесте
+		mockProvider.AssertNumberOfCalls(t, "TouchSession", 1)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		_, err := server.authenticate(metadata.NewIncomingContext(context.Background(), metadata.MD{}))
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		mockProvider.On("GetSession", mock.Anything, tokenHash).Return(storage.Session{}, errors.New("not found"))
+
+		_, err := server.authenticate(ctxWithToken)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		session := storage.Session{ID: "session-id", Username: "testuser", ExpiresAt: time.Now().Add(-time.Hour)}
+		mockProvider.On("GetSession", mock.Anything, tokenHash).Return(session, nil)
+
+		_, err := server.authenticate(ctxWithToken)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+// TestUnaryAuthInterceptor тестирует, что вход и регистрация доступны без токена
+func TestUnaryAuthInterceptor(t *testing.T) {
+	server := &server{
+		provider: new(mocks.Provider),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	t.Run("public method", func(t *testing.T) {
+		info := &grpc.UnaryServerInfo{FullMethod: pb.KeeperService_Login_FullMethodName}
+		resp, err := server.unaryAuthInterceptor(context.Background(), nil, info, handler)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", resp)
+	})
+
+	t.Run("protected method without token", func(t *testing.T) {
+		info := &grpc.UnaryServerInfo{FullMethod: "/keeper.KeeperService/Other"}
+		resp, err := server.unaryAuthInterceptor(context.Background(), nil, info, handler)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrClientCA описывает ошибку загрузки CA клиентских сертификатов.
+	ErrClientCA = errors.New("failed to load client CA")
+	// ErrNoClientCert описывает запрос без проверенного клиентского сертификата.
+	ErrNoClientCert = errors.New("client certificate not presented")
+	// ErrCertNotBound описывает сертификат, который не закреплен ни за одним пользователем.
+	ErrCertNotBound = errors.New("certificate is not bound")
+	// ErrCertAmbiguous описывает сертификат, имена которого закреплены за разными пользователями.
+	ErrCertAmbiguous = errors.New("certificate is bound to several users")
+	// ErrCertRequired описывает вход по паролю без сертификата, привязанного к пользователю.
+	ErrCertRequired = errors.New("client certificate required")
+)
+
+// serverCredentials загружает TLS сертификат сервера. Если задан CA клиентов, сервер
+// запрашивает и проверяет клиентский сертификат, но не требует его: вход по паролю остается доступным.
+func (s *server) serverCredentials() (credentials.TransportCredentials, error) {
+	if s.cfg.ClientCAPath == "" {
+		return credentials.NewServerTLSFromFile(s.cfg.CertPath, s.cfg.CertKeyPath)
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertPath, s.cfg.CertKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := os.ReadFile(s.cfg.ClientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(ca) {
+		return nil, ErrClientCA
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}), nil
+}
+
+// peerCertificate возвращает клиентский сертификат, проверенный при TLS рукопожатии
+func peerCertificate(ctx context.Context) (*x509.Certificate, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, ErrNoClientCert
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, ErrNoClientCert
+	}
+	return tlsInfo.State.VerifiedChains[0][0], nil
+}
+
+// certificateUser возвращает пользователя, за которым закреплен клиентский сертификат
+func (s *server) certificateUser(ctx context.Context) (string, error) {
+	cert, err := peerCertificate(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	usernames, err := s.provider.GetCertificateUsers(ctx, service.CertIdentities(cert))
+	if err != nil {
+		return "", err
+	}
+	switch len(usernames) {
+	case 0:
+		return "", ErrCertNotBound
+	case 1:
+		return usernames[0], nil
+	default:
+		return "", ErrCertAmbiguous
+	}
+}
+
+// checkCertificateFactor в режиме second-factor проверяет, что пользователь с привязанным
+// сертификатом предъявил именно его. Пользователи без сертификата входят только по паролю.
+func (s *server) checkCertificateFactor(ctx context.Context, username string) error {
+	if s.cfg.ClientCAPath == "" || s.cfg.CertMode != config.CertModeSecondFactor {
+		return nil
+	}
+
+	bound, err := s.provider.HasCertificate(s.ctx, username)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return nil
+	}
+
+	certUser, err := s.certificateUser(ctx)
+	if err != nil {
+		if errors.Is(err, ErrNoClientCert) || errors.Is(err, ErrCertNotBound) || errors.Is(err, ErrCertAmbiguous) {
+			return ErrCertRequired
+		}
+		return err
+	}
+	if certUser != username {
+		return ErrCertRequired
+	}
+	return nil
+}
+
+// BindCertificate закрепляет за пользователем клиентский сертификат, с которым открыто соединение
+func (s *server) BindCertificate(ctx context.Context, req *pb.BindCertificateRequest) (*pb.BindCertificateResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if s.cfg.ClientCAPath == "" {
+		return nil, status.Error(codes.FailedPrecondition, "mutual TLS disabled")
+	}
+
+	cert, err := peerCertificate(ctx)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "client certificate required")
+	}
+	identities := service.CertIdentities(cert)
+	if len(identities) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "certificate has no subject or SAN")
+	}
+
+	err = s.provider.BindCertificate(ctx, id.Username, identities)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrConflict) {
+			return nil, status.Error(codes.AlreadyExists, "certificate bound to another user")
+		}
+		logger.Log.Sugar().Errorf("Failed to bind certificate to %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to bind certificate")
+	}
+	logger.Log.Sugar().Infof("Certificate %v bound to %s", identities, id.Username)
+
+	return &pb.BindCertificateResponse{
+		Message:    "Сертификат привязан к аккаунту.",
+		Identities: identities,
+	}, nil
+}
+
+// CertLogin выполняет вход по привязанному клиентскому сертификату без пароля
+func (s *server) CertLogin(ctx context.Context, req *pb.CertLoginRequest) (*pb.LoginResponse, error) {
+	if s.cfg.ClientCAPath == "" || s.cfg.CertMode != config.CertModeLogin {
+		return nil, status.Error(codes.FailedPrecondition, "certificate login disabled")
+	}
+
+	if err := s.checkLockout(ctx, attemptKeys(ctx, "")); err != nil {
+		return nil, err
+	}
+
+	username, err := s.certificateUser(ctx)
+	if err != nil {
+		logger.Log.Sugar().Warnf("Certificate login rejected: %v", err)
+		s.recordLoginFailure(attemptKeys(ctx, ""))
+		return nil, status.Error(codes.Unauthenticated, "certificate not accepted")
+	}
+
+	// сертификат подтверждает только первый фактор, подбор одноразового кода ограничивается так же, как при входе по паролю
+	keys := attemptKeys(ctx, username)
+	if err := s.checkLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.completeLogin(ctx, username, req.TotpCode)
+	if isAuthFailure(err) {
+		s.recordLoginFailure(keys)
+		s.audit(ctx, username, service.LOGIN_FAILURE, "")
+	}
+	if err == nil && !resp.TotpRequired {
+		s.resetLoginFailures(username)
+	}
+	return resp, err
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// withPeerCertificate возвращает контекст соединения, в котором клиент предъявил проверенный сертификат
+func withPeerCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestCertLogin(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{SessionTTL: time.Hour, ClientCAPath: "ca.crt", CertMode: config.CertModeLogin},
+		ctx:      context.Background(),
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, EmailAddresses: []string{"alice@example.com"}}
+	identities := []string{"subject:CN=alice", "email:alice@example.com"}
+	ctx := withPeerCertificate(context.Background(), cert)
+
+	t.Run("bound certificate", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetCertificateUsers", mock.Anything, identities).Return([]string{"alice"}, nil)
+		mockProvider.On("GetTOTP", mock.Anything, "alice").Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf("alice"), mock.Anything).Return(nil)
+
+		resp, err := server.CertLogin(ctx, &pb.CertLoginRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", resp.Username)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("certificate bound to several users", func(t *testing.T) {
+		mockProvider.On("GetCertificateUsers", mock.Anything, identities).Return([]string{"alice", "bob"}, nil)
+
+		resp, err := server.CertLogin(ctx, &pb.CertLoginRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		resp, err := server.CertLogin(context.Background(), &pb.CertLoginRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+
+	t.Run("disabled in second-factor mode", func(t *testing.T) {
+		server.cfg.CertMode = config.CertModeSecondFactor
+		defer func() { server.cfg.CertMode = config.CertModeLogin }()
+
+		resp, err := server.CertLogin(ctx, &pb.CertLoginRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.FailedPrecondition, st.Code())
+	})
+}
+
+func TestLoginWithCertificateFactor(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{SessionTTL: time.Hour, ClientCAPath: "ca.crt", CertMode: config.CertModeSecondFactor},
+		ctx:      context.Background(),
+	}
+
+	passwordHash, _ := service.HashPassword("password")
+	req := &pb.LoginRequest{Username: "alice", Password: "password"}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+
+	t.Run("bound certificate presented", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, "alice").Return(passwordHash, nil)
+		mockProvider.On("HasCertificate", mock.Anything, "alice").Return(true, nil)
+		mockProvider.On("GetCertificateUsers", mock.Anything, []string{"subject:CN=alice"}).Return([]string{"alice"}, nil)
+		mockProvider.On("GetTOTP", mock.Anything, "alice").Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf("alice"), mock.Anything).Return(nil)
+
+		resp, err := server.Login(withPeerCertificate(context.Background(), cert), req)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("certificate of another user", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, "alice").Return(passwordHash, nil)
+		mockProvider.On("HasCertificate", mock.Anything, "alice").Return(true, nil)
+		mockProvider.On("GetCertificateUsers", mock.Anything, []string{"subject:CN=alice"}).Return([]string{"bob"}, nil)
+
+		resp, err := server.Login(withPeerCertificate(context.Background(), cert), req)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("certificate not presented", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, "alice").Return(passwordHash, nil)
+		mockProvider.On("HasCertificate", mock.Anything, "alice").Return(true, nil)
+
+		resp, err := server.Login(context.Background(), req)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("user without certificate", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, "alice").Return(passwordHash, nil)
+		mockProvider.On("HasCertificate", mock.Anything, "alice").Return(false, nil)
+		mockProvider.On("GetTOTP", mock.Anything, "alice").Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf("alice"), mock.Anything).Return(nil)
+
+		resp, err := server.Login(context.Background(), req)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestBindCertificate(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{ClientCAPath: "ca.crt", CertMode: config.CertModeLogin},
+		ctx:      context.Background(),
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, DNSNames: []string{"laptop"}}
+	identities := []string{"subject:CN=alice", "dns:laptop"}
+	ctx := withIdentity(withPeerCertificate(context.Background(), cert), identity{Username: "alice", SessionID: "session"})
+
+	t.Run("certificate bound", func(t *testing.T) {
+		mockProvider.On("BindCertificate", mock.Anything, "alice", identities).Return(nil)
+
+		resp, err := server.BindCertificate(ctx, &pb.BindCertificateRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, identities, resp.Identities)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("certificate of another user", func(t *testing.T) {
+		mockProvider.On("BindCertificate", mock.Anything, "alice", identities).Return(sqlite.ErrConflict)
+
+		resp, err := server.BindCertificate(ctx, &pb.BindCertificateRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.AlreadyExists, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("certificate not presented", func(t *testing.T) {
+		ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session"})
+
+		resp, err := server.BindCertificate(ctx, &pb.BindCertificateRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.FailedPrecondition, st.Code())
+	})
+}
@@ -1,34 +1,55 @@
 package app
 
 import (
-	"errors"
-	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"keeper/internal/logger"
 	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
 	pb "keeper/proto"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func newClient(stream pb.KeeperService_CommandServer) *client {
-	return &client{stream: stream, ch: make(chan *pb.CommandMessage, 100), done: make(chan struct{}), state: service.CONNECTED}
+// staleClientsInterval период, с которым сервер удаляет сохраненные диалоги истекших сессий
+const staleClientsInterval = 10 * time.Minute
+
+func newClient() *client {
+	return &client{
+		ch:      make(chan *pb.CommandMessage, 100),
+		done:    make(chan struct{}),
+		state:   service.CONNECTED,
+		revoked: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// revoke просит обработчик стрима отправить клиенту уведомление и закрыть стрим
+func (c *client) revoke(reason string) {
+	c.revokeOnce.Do(func() {
+		c.revokeReason = reason
+		close(c.revoked)
+	})
 }
 
 func (s *server) Command(stream pb.KeeperService_CommandServer) error {
-	client := newClient(stream)
+	client := newClient()
 	recvChan := make(chan *pb.CommandMessage)
-	errChan := make(chan error)
+	// буфер позволяет горутине чтения завершиться, если обработчик уже вернулся
+	errChan := make(chan error, 1)
 	stopRecvChan := make(chan struct{})
 
 	// Горутин для отправки сообщений клиенту
 	go func() {
+		defer close(client.stopped)
 		for {
 			select {
 			case msg := <-client.ch:
-				if err := client.stream.Send(msg); err != nil {
+				if err := stream.Send(msg); err != nil {
 					logger.Log.Sugar().Errorf("Error sending message to %s: %v", msg.Username, err)
 				}
 			// завершаем горутину если контекст отменен или клиент отключился
@@ -57,8 +78,14 @@ func (s *server) Command(stream pb.KeeperService_CommandServer) error {
 		}
 	}()
 
+	// пользователь уже проверен перехватчиком по токену сессии
+	id, err := identityFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+
 	// обрабатываем запросы клиента
-	err := s.clientProcessing(client, recvChan, stopRecvChan, errChan, stream)
+	err = s.clientProcessing(id, client, recvChan, stopRecvChan, errChan, stream)
 	if err != nil {
 		return err
 	}
@@ -68,199 +95,281 @@ func (s *server) Command(stream pb.KeeperService_CommandServer) error {
 func (s *server) removeClient(clientID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.dropClient(clientID)
+}
+
+// dropClient удаляет клиента из памяти и БД, вызывается под s.mu
+func (s *server) dropClient(clientID string) {
 	if client, exists := s.clients[clientID]; exists {
 		close(client.done) // Останавливаем горутину клиента
 		close(client.ch)   // Закрываем канал клиента
 		delete(s.clients, clientID)
 
-		err := s.provider.RemoveClient(s.ctx, clientID)
-		if err != nil {
-			logger.Log.Sugar().Errorf("Failed to remove client from DB: %v", err)
+		if !client.ephemeral {
+			err := s.provider.RemoveClient(s.ctx, clientID)
+			if err != nil {
+				logger.Log.Sugar().Errorf("Failed to remove client from DB: %v", err)
+			}
 		}
 
 		logger.Log.Sugar().Infof("%s disconnected", clientID)
 	}
 }
 
+// detachClient отключает стрим клиента, но сохраняет его диалог, чтобы клиент мог продолжить его,
+// переподключившись с тем же токеном. Строка клиента в БД остается. Клиент без незавершенного
+// действия удаляется: продолжать нечего.
+func (s *server) detachClient(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, exists := s.clients[clientID]; exists {
+		if client.state == service.CONNECTED {
+			s.dropClient(clientID)
+			return
+		}
+		close(client.done)
+		close(client.ch)
+		s.clients[clientID] = detachedClient(client.sessionID, client.state, client.context)
+		logger.Log.Sugar().Infof("%s disconnected, conversation saved", clientID)
+	}
+}
+
+// removeStaleClients удаляет из БД и памяти сохраненные диалоги сессий, которые истекли или завершены
+// к моменту now. Стримы клиентов не затрагиваются: истекшую сессию завершает перехватчик.
+func (s *server) removeStaleClients(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.provider.RemoveStaleClients(s.ctx, now); err != nil {
+		logger.Log.Sugar().Errorf("Failed to remove stale clients: %v", err)
+		return
+	}
+	clients, err := s.provider.GetAllClients(s.ctx)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get clients: %v", err)
+		return
+	}
+
+	saved := make(map[string]bool, len(clients))
+	for _, clientData := range clients {
+		saved[clientData.ClientID] = true
+	}
+	removed := 0
+	for clientID, client := range s.clients {
+		if client.revoked != nil || saved[clientID] {
+			continue
+		}
+		close(client.done)
+		close(client.ch)
+		delete(s.clients, clientID)
+		removed++
+	}
+	if removed > 0 {
+		logger.Log.Sugar().Infof("Removed %d stale conversations", removed)
+	}
+}
+
+// runStaleClientsCleaner каждые staleClientsInterval удаляет диалоги истекших сессий.
+// При запуске сервера их удаляет loadClientsFromDB. Завершается при остановке сервера.
+func (s *server) runStaleClientsCleaner() {
+	ticker := time.NewTicker(staleClientsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.removeStaleClients(now)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// attachClient регистрирует стрим клиента. Если у сессии есть сохраненный диалог, стрим
+// продолжает его: получает id клиента, состояние и данные незавершенного действия.
+func (s *server) attachClient(username string, client *client) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for clientID, saved := range s.clients {
+		if saved.revoked != nil || saved.sessionID != client.sessionID || strings.Split(clientID, "::")[0] != username {
+			continue
+		}
+		close(saved.done)
+		close(saved.ch)
+		client.state = saved.state
+		client.context = saved.context
+		s.clients[clientID] = client
+		return clientID, true
+	}
+
+	// Генерация уникального идентификатора
+	clientID := username + "::" + uuid.NewString()
+	s.addClient(username, clientID, client)
+	return clientID, false
+}
+
+// detachedClient создает клиента без стрима с сохраненным диалогом сессии
+func detachedClient(sessionID string, state service.State, context string) *client {
+	return &client{
+		ch:        make(chan *pb.CommandMessage, 100),
+		done:      make(chan struct{}),
+		state:     state,
+		sessionID: sessionID,
+		context:   context,
+	}
+}
+
 func (s *server) addClient(username string, clientID string, client *client) {
 
 	s.clients[clientID] = client
-	err := s.provider.AddClient(s.ctx, clientID, username, client.state)
+	err := s.provider.AddClient(s.ctx, storage.Client{
+		ClientID:  clientID,
+		Username:  username,
+		State:     int(client.state),
+		SessionID: client.sessionID,
+		Context:   client.context,
+	})
 	if err != nil {
 		logger.Log.Sugar().Errorf("Failed to add client to DB: %v", err)
 	}
 }
 
-func (s *server) clientProcessing(client *client, recvChan chan *pb.CommandMessage, stopRecvChan chan struct{}, errChan chan error, stream pb.KeeperService_CommandServer) error {
+func (s *server) clientProcessing(id identity, client *client, recvChan chan *pb.CommandMessage, stopRecvChan chan struct{}, errChan chan error, stream pb.KeeperService_CommandServer) error {
 	var username string
 	var clientID string
-	var createdType service.DataType
-	dataTitles := make(map[string]string)
+	// время последней активности сессии, при подключении его уже обновила проверка токена
+	lastSeen := time.Now()
+	conv := newConversation(s, stream.Context(), id, client)
 
 	for {
 		select {
 		// завершаем горутину если контекст отменен
 		case <-s.ctx.Done():
-			return nil
+			// сервер останавливается: клиент переподключится и продолжит диалог
+			return status.Error(codes.Unavailable, "server is shutting down")
 		case msg := <-recvChan:
 
-			// авторизация при подключении
+			// имя пользователя в сообщении должно совпадать с владельцем токена
+			if msg.Username != "" && msg.Username != id.Username {
+				logger.Log.Sugar().Warnf("Session of %s sent message as %s, rejected", id.Username, msg.Username)
+				client.ch <- &pb.CommandMessage{Message: "\nОтказано в доступе."}
+				continue
+			}
+
+			// регистрация клиента при подключении
+			var resumed bool
 			if username == "" {
-				s.mu.Lock()
-				username = msg.Username
-				// Генерация уникального идентификатора
-				clientID = username + "::" + uuid.NewString()
-				s.addClient(username, clientID, client)
-				s.mu.Unlock()
+				username = id.Username
+				client.sessionID = id.SessionID
+				clientID, resumed = s.attachClient(username, client)
 				logger.Log.Sugar().Infof("%s connected", username)
+
+				vault, err := s.provider.GetVault(s.ctx, username)
+				if err != nil {
+					logger.Log.Sugar().Errorf("Failed to get vault params: %v", err)
+				}
+				conv.clientID = clientID
+				conv.clientEncryption = vault.ClientEncryption
+
+				// клиент переподключился с тем же токеном посреди действия: продолжаем диалог
+				resumed = resumed && client.state != service.CONNECTED
+				if resumed {
+					conv.restore(client.context)
+					conv.Reply("\nСессия восстановлена.")
+					commands.Resume(conv)
+				}
 			}
 
 			logger.Log.Sugar().Infof("Received command from %s: %s", username, msg.Message)
+			lastSeen = s.touchSession(id.SessionID, lastSeen)
+			// первое сообщение стрима только открывает продолженный диалог
+			if resumed && msg.Message == service.CommandInit {
+				continue
+			}
 
 			// машина состояний
-			switch client.state {
-			case service.CONNECTED:
-				client.ch <- &pb.CommandMessage{Message: "\nВыбирете действие:\n1) GET\n2) CREATE"}
-				err := s.updateState(client, clientID, service.SELECT_ACTION)
-				if err != nil {
-					continue
-				}
-			case service.SELECT_ACTION:
-				switch msg.Message {
-				case "1": // GET
-					resultMes, err := s.getUserTitles(username, client, dataTitles)
-					if err != nil {
-						if errors.Is(err, ErrTitlesNotFound) {
-							client.ch <- &pb.CommandMessage{Message: "\nУ вас нет сохраненных данных."}
-							err := s.updateState(client, clientID, service.CONNECTED)
-							if err != nil {
-								continue
-							}
-						}
-						continue
-					}
-					client.ch <- &pb.CommandMessage{Message: resultMes}
-					err = s.updateState(client, clientID, service.GET_DATA)
-					if err != nil {
-						continue
-					}
-				case "2": // CREATE
-					client.ch <- &pb.CommandMessage{Message: "\nЧто хотите создать:\n1) логин/пароль\n2) текстовые данные\n3) банковскую карту\n4) бинарные данные"}
-					err := s.updateState(client, clientID, service.CHOSE_CREATE_DATA)
-					if err != nil {
-						continue
-					}
-				}
-			case service.GET_DATA:
-				if title, ok := dataTitles[msg.Message]; ok {
-					data, err := s.getData(username, title)
-					if err != nil {
-						continue
-					}
-					client.ch <- &pb.CommandMessage{Message: data}
-					err = s.updateState(client, clientID, service.CONNECTED)
-					if err != nil {
-						continue
-					}
-					dataTitles = make(map[string]string)
-				}
-			case service.CHOSE_CREATE_DATA:
-				switch msg.Message {
-				case "1": // пароли
-					client.ch <- &pb.CommandMessage{Message: "\nВведите данны по шаблону: [название]::[логин]::[пароль]::[метадата]"}
-					err := s.updateState(client, clientID, service.CREATE_DATA)
-					if err != nil {
-						continue
-					}
-					createdType = service.PASSWORD
-				case "2": // текст
-					client.ch <- &pb.CommandMessage{Message: "\nВведите данны по шаблону: [название]::[данные]::[метадата]"}
-					err := s.updateState(client, clientID, service.CREATE_DATA)
-					if err != nil {
-						continue
-					}
-					createdType = service.TEXT
-				case "3": // карта
-					client.ch <- &pb.CommandMessage{Message: "\nВведите данны по шаблону: [название]::[номер карты]::[срок действия]::[владелец карты]::[cvv]::[метадата]"}
-					err := s.updateState(client, clientID, service.CREATE_DATA)
-					if err != nil {
-						continue
-					}
-					createdType = service.CARD
-				case "4": // бинарные данные
-					client.ch <- &pb.CommandMessage{Message: "\nВведите данны по шаблону: [название]::[данные]::[метадата]"}
-					err := s.updateState(client, clientID, service.CREATE_DATA)
-					if err != nil {
-						continue
-					}
-					createdType = service.BYTE
-				default:
-					client.ch <- &pb.CommandMessage{Message: "\nВыбрано не cуществующее днйствие!\nЧто хотите создать:\n1) логин/пароль\n2) текстовые данные\n3) банковскую карту"}
-				}
-			case service.CREATE_DATA:
-				title, err := s.createData(msg.Message, username, createdType)
-				if err != nil {
-					if errors.Is(err, ErrCreateFormat) {
-						client.ch <- &pb.CommandMessage{Message: "\nНе верный формат данных."}
-					}
-					continue
-				}
+			conv.msg = msg
+			commands.Handle(conv, strings.TrimSpace(msg.Message))
 
-				client.ch <- &pb.CommandMessage{Message: "\nДанные записаны!"}
-				err = s.updateState(client, clientID, service.CONNECTED)
-				if err != nil {
-					continue
-				}
-				go s.broadcastMessage(username, clientID, title)
+		case <-client.revoked:
+			// сессия отозвана: останавливаем отправку, чтобы уведомление было последним сообщением, и закрываем стрим
+			close(stopRecvChan)
+			s.removeClient(clientID)
+			<-client.stopped
+			if err := stream.Send(&pb.CommandMessage{Username: "server", Message: client.revokeReason}); err != nil {
+				logger.Log.Sugar().Errorf("Error sending message to %s: %v", username, err)
 			}
+			return status.Error(codes.Unauthenticated, "session revoked")
 
 		case err := <-errChan:
 			close(stopRecvChan)
+			s.detachClient(clientID)
 			if err == io.EOF {
-				s.removeClient(clientID)
 				return nil
 			}
-			s.removeClient(clientID)
 			return err
 		}
 	}
 }
 
-func (s *server) broadcastMessage(username string, id string, title string) {
+// broadcastMessage отправляет уведомление в стримы пользователя, открытые в других сессиях,
+// а при пустом sessionID - во все его стримы. Уведомление передается горутине отправки
+// стрима, поэтому не мешает ответам на команды.
+func (s *server) broadcastMessage(username string, sessionID string, message string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for clientID, client := range s.clients {
-		var n string
-		parts := strings.Split(clientID, "::")
-		n, _ = parts[0], parts[1]
-
-		if n == username && clientID != id {
-			msg := &pb.CommandMessage{
-				Username: "server",
-				Message:  fmt.Sprintf("ОБНОВЛЕНИЕ! Новая запись: %s", title),
-			}
+		// клиенты, восстановленные из БД, не связаны со стримом
+		if client.revoked == nil || (sessionID != "" && client.sessionID == sessionID) || strings.Split(clientID, "::")[0] != username {
+			continue
+		}
+		select {
+		case client.ch <- &pb.CommandMessage{Username: "server", Message: message}:
+		default:
+			logger.Log.Sugar().Errorf("Failed to notify %s: send buffer is full", username)
+		}
+	}
+}
 
-			err := client.stream.Send(msg)
-			if err != nil {
-				logger.Log.Sugar().Errorf("Error sending message to %s: %v", n, err)
-
-				// Делаем две дополнительные попытки переотправки
-				maxRetries := 2
-				for retries := 0; retries < maxRetries; retries++ {
-					err = client.stream.Send(msg)
-					if err == nil {
-						break
-					}
-					logger.Log.Sugar().Errorf("Retry %d: Error sending message to %s: %v", retries+1, n, err)
-				}
-			}
+// revokeStreams завершает стримы пользователя в сессиях, для которых match возвращает true,
+// и возвращает количество закрытых стримов
+func (s *server) revokeStreams(username string, reason string, match func(sessionID string) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked := 0
+	for clientID, client := range s.clients {
+		if !match(client.sessionID) || strings.Split(clientID, "::")[0] != username {
+			continue
+		}
+		// у клиента без стрима удаляем сохраненный диалог: сессию продолжить уже нельзя
+		if client.revoked == nil {
+			s.dropClient(clientID)
+			continue
+		}
+		client.revoke(reason)
+		revoked++
+	}
+	return revoked
+}
+
+// connectedSessions возвращает сессии пользователя, у которых открыт стрим
+func (s *server) connectedSessions(username string) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connected := make(map[string]bool)
+	for clientID, client := range s.clients {
+		if client.revoked == nil || strings.Split(clientID, "::")[0] != username {
+			continue
 		}
+		connected[client.sessionID] = true
 	}
+	return connected
 }
 
-func (s *server) updateState(client *client, clientID string, state service.State) error {
+// updateState сохраняет состояние клиента и данные незавершенного действия
+func (s *server) updateState(client *client, clientID string, state service.State, context string) error {
 	client.state = state
-	err := s.provider.UpdateClientState(s.ctx, clientID, service.SELECT_ACTION)
+	client.context = context
+	err := s.provider.UpdateClientState(s.ctx, clientID, state, context)
 	if err != nil {
 		logger.Log.Sugar().Errorf("Failed to update client state: %v", err)
 		return err
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"io"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	pb "keeper/proto"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Connect обрабатывает типизированный протокол стрима. Запросы выполняются теми же методами,
+// что и unary RPC, а уведомления других сессий приходят клиенту событиями.
+func (s *server) Connect(stream pb.KeeperService_ConnectServer) error {
+	// пользователь уже проверен перехватчиком по токену сессии
+	id, err := identityFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+
+	client := newClient()
+	client.sessionID = id.SessionID
+	client.ephemeral = true
+	clientID := id.Username + "::" + uuid.NewString()
+	s.mu.Lock()
+	s.clients[clientID] = client
+	s.mu.Unlock()
+	defer s.removeClient(clientID)
+	logger.Log.Sugar().Infof("%s connected", id.Username)
+
+	recvChan := make(chan *pb.ClientFrame)
+	// буфер позволяет горутине чтения завершиться, если обработчик уже вернулся
+	errChan := make(chan error, 1)
+
+	// Горутина для получения запросов клиента
+	go func() {
+		for {
+			frame, err := stream.Recv()
+			if err != nil {
+				errChan <- err
+				return
+			}
+			select {
+			case recvChan <- frame:
+			case <-client.done:
+				return
+			}
+		}
+	}()
+
+	// все кадры отправляет только этот цикл, поэтому ответы и события не перемешиваются
+	for {
+		select {
+		case <-s.ctx.Done():
+			// сервер останавливается: клиент может переподключиться и повторить запросы без ответа
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case frame := <-recvChan:
+			if err := stream.Send(s.handleFrame(stream.Context(), frame)); err != nil {
+				logger.Log.Sugar().Errorf("Error sending frame to %s: %v", id.Username, err)
+				return err
+			}
+		case msg, ok := <-client.ch:
+			// канал закрывается, когда сервер останавливается или клиент удален
+			if !ok {
+				return status.Error(codes.Unavailable, "stream closed")
+			}
+			if err := stream.Send(eventFrame(pb.EventType_EVENT_TYPE_NOTIFICATION, msg.Message)); err != nil {
+				logger.Log.Sugar().Errorf("Error sending event to %s: %v", id.Username, err)
+				return err
+			}
+		case <-client.revoked:
+			if err := stream.Send(eventFrame(pb.EventType_EVENT_TYPE_SESSION_REVOKED, client.revokeReason)); err != nil {
+				logger.Log.Sugar().Errorf("Error sending event to %s: %v", id.Username, err)
+			}
+			return status.Error(codes.Unauthenticated, "session revoked")
+		case err := <-errChan:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handleFrame выполняет запрос клиента и возвращает ответ с тем же request_id
+func (s *server) handleFrame(ctx context.Context, frame *pb.ClientFrame) *pb.ServerFrame {
+	reply, err := s.dispatchFrame(ctx, frame)
+	if err != nil {
+		st := status.Convert(err)
+		reply = &pb.ServerFrame{Frame: &pb.ServerFrame_Error{Error: &pb.Error{Code: uint32(st.Code()), Message: st.Message()}}}
+	}
+	reply.RequestId = frame.RequestId
+	return reply
+}
+
+// dispatchFrame передает запрос методу, который выполняет его в unary RPC
+func (s *server) dispatchFrame(ctx context.Context, frame *pb.ClientFrame) (*pb.ServerFrame, error) {
+	switch request := frame.Request.(type) {
+	case *pb.ClientFrame_ListItems:
+		resp, err := s.ListItems(ctx, request.ListItems)
+		if err != nil {
+			return nil, err
+		}
+		return resultFrame(&pb.Result{Response: &pb.Result_ListItems{ListItems: resp}}), nil
+
+	case *pb.ClientFrame_GetItem:
+		resp, err := s.GetItem(ctx, request.GetItem)
+		if err != nil {
+			return nil, err
+		}
+		return resultFrame(&pb.Result{Response: &pb.Result_GetItem{GetItem: resp}}), nil
+
+	case *pb.ClientFrame_CreateItem:
+		if request.CreateItem.GetItem().GetPayload() == nil {
+			return s.createPrompt(ctx, request.CreateItem)
+		}
+		resp, err := s.CreateItem(ctx, request.CreateItem)
+		if err != nil {
+			return nil, err
+		}
+		return resultFrame(&pb.Result{Response: &pb.Result_CreateItem{CreateItem: resp}}), nil
+
+	case *pb.ClientFrame_UpdateItem:
+		if request.UpdateItem.GetItem().GetPayload() == nil {
+			return s.updatePrompt(ctx, request.UpdateItem)
+		}
+		resp, err := s.UpdateItem(ctx, request.UpdateItem)
+		if err != nil {
+			return nil, err
+		}
+		return resultFrame(&pb.Result{Response: &pb.Result_UpdateItem{UpdateItem: resp}}), nil
+
+	case *pb.ClientFrame_DeleteItem:
+		resp, err := s.DeleteItem(ctx, request.DeleteItem)
+		if err != nil {
+			return nil, err
+		}
+		return resultFrame(&pb.Result{Response: &pb.Result_DeleteItem{DeleteItem: resp}}), nil
+
+	default:
+		return nil, status.Error(codes.InvalidArgument, "unknown request")
+	}
+}
+
+// createPrompt запрашивает у клиента данные новой записи по ее типу
+func (s *server) createPrompt(ctx context.Context, req *pb.CreateItemRequest) (*pb.ServerFrame, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if _, ok := pb.ItemType_name[int32(req.Type)]; !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown item type")
+	}
+
+	vault, err := s.provider.GetVault(ctx, id.Username)
+	if err != nil {
+		return nil, itemStatus(id.Username, err)
+	}
+	return promptFrame(&pb.Prompt{
+		Message:      "Введите данные записи",
+		ItemTemplate: itemTemplate(service.DataType(req.Type)),
+		Seal:         vault.ClientEncryption,
+	}), nil
+}
+
+// updatePrompt запрашивает у клиента новые данные записи, которую пользователь может изменить
+func (s *server) updatePrompt(ctx context.Context, req *pb.UpdateItemRequest) (*pb.ServerFrame, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title required")
+	}
+
+	vault, err := s.provider.GetVault(ctx, id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get vault params: %v", err)
+		return nil, status.Error(codes.Internal, "failed to update item")
+	}
+	row, err := s.findItem(ctx, id.Username, req.Owner, req.Collection, req.Title)
+	if err != nil {
+		return nil, updateStatus(id.Username, err)
+	}
+	target, err := s.editableData(id.Username, row, vault.ClientEncryption)
+	if err != nil {
+		return nil, updateStatus(id.Username, err)
+	}
+	return promptFrame(&pb.Prompt{
+		Message:      "Введите новые данные записи",
+		ItemTemplate: itemTemplate(target.row.DataType),
+		Seal:         target.sealed,
+		Version:      target.row.Version,
+	}), nil
+}
+
+func resultFrame(result *pb.Result) *pb.ServerFrame {
+	return &pb.ServerFrame{Frame: &pb.ServerFrame_Result{Result: result}}
+}
+
+func promptFrame(prompt *pb.Prompt) *pb.ServerFrame {
+	return &pb.ServerFrame{Frame: &pb.ServerFrame_Prompt{Prompt: prompt}}
+}
+
+func eventFrame(eventType pb.EventType, message string) *pb.ServerFrame {
+	return &pb.ServerFrame{Frame: &pb.ServerFrame_Event{Event: &pb.Event{Type: eventType, Message: message}}}
+}
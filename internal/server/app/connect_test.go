@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// connectStream стрим Connect: запросы клиента берутся из recv, кадры сервера пишутся в sent
+type connectStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv chan *pb.ClientFrame
+	sent chan *pb.ServerFrame
+}
+
+func newConnectStream(ctx context.Context) *connectStream {
+	return &connectStream{ctx: ctx, recv: make(chan *pb.ClientFrame), sent: make(chan *pb.ServerFrame, 10)}
+}
+
+func (c *connectStream) Context() context.Context {
+	return c.ctx
+}
+
+func (c *connectStream) Send(frame *pb.ServerFrame) error {
+	c.sent <- frame
+	return nil
+}
+
+func (c *connectStream) Recv() (*pb.ClientFrame, error) {
+	frame, ok := <-c.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+func TestHandleFrame(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	expectKeys := func() {
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+		mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+	}
+
+	item := &pb.Item{Title: "wifi", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "admin", Password: "secret"}}}
+	plainText, _ := encodeItem(item, service.PASSWORD)
+	index := service.TitleIndex(dataKey, "wifi")
+	row := storage.DataRow{ID: 7, Username: "alice", TitleIndex: index, DataType: service.PASSWORD, Version: 4}
+	row.Data, _ = service.EncryptRecord(plainText, dataKey, 1, service.RecordAAD("alice", 7, service.PASSWORD, "wifi"))
+
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+
+	t.Run("result", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+
+		reply := server.handleFrame(ctx, &pb.ClientFrame{RequestId: "1", Request: &pb.ClientFrame_GetItem{GetItem: &pb.GetItemRequest{Title: "wifi"}}})
+		assert.Equal(t, "1", reply.RequestId)
+		if assert.NotNil(t, reply.GetResult().GetGetItem()) {
+			assert.True(t, proto.Equal(item, reply.GetResult().GetGetItem().Item))
+			assert.Equal(t, int64(4), reply.GetResult().GetGetItem().Version)
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("create prompt", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{ClientEncryption: true}, nil)
+
+		reply := server.handleFrame(ctx, &pb.ClientFrame{RequestId: "2", Request: &pb.ClientFrame_CreateItem{CreateItem: &pb.CreateItemRequest{Type: pb.ItemType_ITEM_TYPE_CARD}}})
+		assert.Equal(t, "2", reply.RequestId)
+		prompt := reply.GetPrompt()
+		if assert.NotNil(t, prompt) {
+			assert.NotNil(t, prompt.ItemTemplate.GetCard())
+			assert.True(t, prompt.Seal)
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("update prompt", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+
+		reply := server.handleFrame(ctx, &pb.ClientFrame{RequestId: "3", Request: &pb.ClientFrame_UpdateItem{UpdateItem: &pb.UpdateItemRequest{Title: "wifi"}}})
+		prompt := reply.GetPrompt()
+		if assert.NotNil(t, prompt) {
+			assert.NotNil(t, prompt.ItemTemplate.GetLogin())
+			assert.False(t, prompt.Seal)
+			assert.Equal(t, int64(4), prompt.Version)
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("error", func(t *testing.T) {
+		reply := server.handleFrame(ctx, &pb.ClientFrame{RequestId: "4", Request: &pb.ClientFrame_UpdateItem{UpdateItem: &pb.UpdateItemRequest{}}})
+		assert.Equal(t, "4", reply.RequestId)
+		assert.Equal(t, uint32(codes.InvalidArgument), reply.GetError().GetCode())
+
+		reply = server.handleFrame(ctx, &pb.ClientFrame{RequestId: "5"})
+		assert.Equal(t, uint32(codes.InvalidArgument), reply.GetError().GetCode())
+	})
+}
+
+func TestConnect(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+
+	// connect открывает стрим и дожидается регистрации клиента по ответу на первый запрос
+	connect := func(stream *connectStream) chan error {
+		done := make(chan error, 1)
+		go func() { done <- server.Connect(stream) }()
+		stream.recv <- &pb.ClientFrame{RequestId: "1"}
+		reply := <-stream.sent
+		assert.Equal(t, "1", reply.RequestId)
+		assert.NotNil(t, reply.GetError())
+		return done
+	}
+
+	t.Run("notification and revocation", func(t *testing.T) {
+		stream := newConnectStream(ctx)
+		done := connect(stream)
+
+		server.notifyUser("alice", "Вам открыт доступ к записи: wifi")
+		event := (<-stream.sent).GetEvent()
+		if assert.NotNil(t, event) {
+			assert.Equal(t, pb.EventType_EVENT_TYPE_NOTIFICATION, event.Type)
+			assert.Equal(t, "Вам открыт доступ к записи: wifi", event.Message)
+		}
+
+		assert.Equal(t, 1, server.revokeStreams("alice", "Сессия завершена.", func(sessionID string) bool { return sessionID == "session-id" }))
+		event = (<-stream.sent).GetEvent()
+		if assert.NotNil(t, event) {
+			assert.Equal(t, pb.EventType_EVENT_TYPE_SESSION_REVOKED, event.Type)
+			assert.Equal(t, "Сессия завершена.", event.Message)
+		}
+		st, _ := status.FromError(<-done)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+		assert.Empty(t, server.clients)
+
+		// клиенты Connect не сохраняются в БД
+		mockProvider.AssertNotCalled(t, "AddClient", mock.Anything, mock.Anything)
+		mockProvider.AssertNotCalled(t, "RemoveClient", mock.Anything, mock.Anything)
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("client closed stream", func(t *testing.T) {
+		stream := newConnectStream(ctx)
+		done := connect(stream)
+		close(stream.recv)
+
+		assert.NoError(t, <-done)
+		assert.Empty(t, server.clients)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("client removed", func(t *testing.T) {
+		stream := newConnectStream(ctx)
+		done := connect(stream)
+		// закрытый канал уведомлений завершает стрим, а не отправляет пустое событие
+		for clientID := range server.clients {
+			server.removeClient(clientID)
+		}
+
+		st, _ := status.FromError(<-done)
+		assert.Equal(t, codes.Unavailable, st.Code())
+		close(stream.recv)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
@@ -0,0 +1,390 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+)
+
+// conversation диалог стрима команд: состояние клиента и данные незавершенного действия
+type conversation struct {
+	s        *server
+	ctx      context.Context
+	id       identity
+	client   *client
+	clientID string
+	// данные записей шифрует клиент
+	clientEncryption bool
+	// сообщение клиента, которое обрабатывает машина состояний
+	msg *pb.CommandMessage
+
+	createdType service.DataType
+	dataTitles  map[string]storage.DataRow
+	editing     editTarget
+}
+
+func newConversation(s *server, ctx context.Context, id identity, client *client) *conversation {
+	return &conversation{s: s, ctx: ctx, id: id, client: client, dataTitles: make(map[string]storage.DataRow)}
+}
+
+func (c *conversation) State() service.State {
+	return c.client.state
+}
+
+// SetState сохраняет состояние вместе с данными незавершенного действия, чтобы продолжить
+// диалог после переподключения клиента или перезапуска сервера
+func (c *conversation) SetState(state service.State) {
+	saved, err := json.Marshal(c.savedContext())
+	if err != nil {
+		logger.Log.Sugar().Errorf("Error marshalling conversation context: %v", err)
+	}
+	// ошибку сохранения состояния уже записала в лог updateState, в памяти состояние изменено
+	_ = c.s.updateState(c.client, c.clientID, state, string(saved))
+}
+
+func (c *conversation) Reply(message string) {
+	c.send(&pb.CommandMessage{Message: message})
+}
+
+func (c *conversation) Reset() {
+	c.createdType = 0
+	c.dataTitles = make(map[string]storage.DataRow)
+	c.editing = editTarget{}
+}
+
+func (c *conversation) send(msg *pb.CommandMessage) {
+	c.client.ch <- msg
+}
+
+// conversationContext данные незавершенного действия, которые сохраняются в БД. Названия записей
+// не сохраняются открытыми: записи хранятся по id и при восстановлении читаются заново.
+type conversationContext struct {
+	CreatedType service.DataType `json:"created_type"`
+	// номер записи в показанном клиенту списке и ее id
+	Titles map[string]int64 `json:"titles,omitempty"`
+	// изменяемая запись и ее версия на момент выбора
+	EditingID      int64 `json:"editing_id,omitempty"`
+	EditingVersion int64 `json:"editing_version,omitempty"`
+}
+
+func (c *conversation) savedContext() conversationContext {
+	saved := conversationContext{CreatedType: c.createdType, Titles: make(map[string]int64)}
+	for number, row := range c.dataTitles {
+		saved.Titles[number] = row.ID
+	}
+	if c.editing.row.ID != 0 {
+		saved.EditingID = c.editing.row.ID
+		saved.EditingVersion = c.editing.row.Version
+	}
+	return saved
+}
+
+// restore восстанавливает данные незавершенного действия. Записи, которые удалены или стали
+// недоступны, пропускаются, а изменение записи сохраняет версию на момент выбора, поэтому
+// изменение, сделанное за время отключения, приведет к конфликту.
+func (c *conversation) restore(data string) {
+	if data == "" {
+		return
+	}
+	var saved conversationContext
+	if err := json.Unmarshal([]byte(data), &saved); err != nil {
+		logger.Log.Sugar().Errorf("Error unmarshalling conversation context: %v", err)
+		return
+	}
+	c.createdType = saved.CreatedType
+	if len(saved.Titles) == 0 && saved.EditingID == 0 {
+		return
+	}
+
+	rows, err := c.s.listItems(c.id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to restore conversation of %s: %v", c.id.Username, err)
+		return
+	}
+	byID := make(map[int64]storage.DataRow, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+	for number, itemID := range saved.Titles {
+		if row, ok := byID[itemID]; ok {
+			c.dataTitles[number] = row
+		}
+	}
+	if row, ok := byID[saved.EditingID]; ok {
+		target, err := c.s.editableData(c.id.Username, row, c.clientEncryption)
+		if err != nil {
+			return
+		}
+		target.row.Version = saved.EditingVersion
+		c.editing = target
+	}
+}
+
+// createTypes типы записей в порядке пунктов меню создания
+var createTypes = []struct {
+	title    string
+	dataType service.DataType
+}{
+	{"логин/пароль", service.PASSWORD},
+	{"текстовые данные", service.TEXT},
+	{"банковскую карту", service.CARD},
+	{"бинарные данные", service.BYTE},
+}
+
+// commands машина состояний стрима команд. Новое действие добавляется регистрацией
+// обработчиков его состояний и пункта главного меню.
+var commands = newCommands()
+
+func newCommands() *service.Machine[*conversation] {
+	m := service.NewMachine[*conversation](service.SELECT_ACTION)
+
+	// после подключения и завершения действия меню открывается любым сообщением
+	m.Register(service.CONNECTED, service.StateHandler[*conversation]{
+		Help: "Отправьте любое сообщение, чтобы открыть меню.",
+		Back: service.SELECT_ACTION,
+		Handle: func(c *conversation, input string) (service.State, error) {
+			return service.SELECT_ACTION, nil
+		},
+	})
+
+	m.AddAction("GET", service.GET_DATA)
+	m.Register(service.GET_DATA, service.StateHandler[*conversation]{
+		Help:   "Введите номер записи, данные которой хотите получить.",
+		Back:   service.SELECT_ACTION,
+		Enter:  titlesPrompt("получить"),
+		Handle: (*conversation).getItem,
+	})
+
+	m.AddAction("CREATE", service.CHOSE_CREATE_DATA)
+	m.Register(service.CHOSE_CREATE_DATA, service.StateHandler[*conversation]{
+		Help:   "Введите номер типа записи.",
+		Back:   service.SELECT_ACTION,
+		Enter:  (*conversation).createTypesPrompt,
+		Handle: (*conversation).chooseCreateType,
+	})
+	m.Register(service.CREATE_DATA, service.StateHandler[*conversation]{
+		Help: "Заполните поля записи.",
+		Back: service.CHOSE_CREATE_DATA,
+		Enter: func(c *conversation) bool {
+			c.send(itemPrompt("\nВведите данные записи:", c.createdType, c.clientEncryption))
+			return true
+		},
+		Handle: (*conversation).createItem,
+	})
+
+	m.AddAction("UPDATE", service.CHOSE_UPDATE_DATA)
+	m.Register(service.CHOSE_UPDATE_DATA, service.StateHandler[*conversation]{
+		Help:   "Введите номер записи, которую хотите изменить.",
+		Back:   service.SELECT_ACTION,
+		Enter:  titlesPrompt("изменить"),
+		Handle: (*conversation).chooseUpdateItem,
+	})
+	m.Register(service.UPDATE_DATA, service.StateHandler[*conversation]{
+		Help: "Заполните новые название и поля записи.",
+		Back: service.CHOSE_UPDATE_DATA,
+		Enter: func(c *conversation) bool {
+			// запись могла стать недоступной, пока клиент был отключен
+			if c.editing.row.ID == 0 {
+				return false
+			}
+			// данные чужих записей шифрует сервер, поэтому клиент отправляет их открытыми
+			c.send(itemPrompt("\nВведите новые данные записи:", c.editing.row.DataType, c.editing.sealed))
+			return true
+		},
+		Handle: (*conversation).updateItem,
+	})
+
+	m.AddAction("DELETE", service.CHOSE_DELETE_DATA)
+	m.Register(service.CHOSE_DELETE_DATA, service.StateHandler[*conversation]{
+		Help:   "Введите номер записи, которую хотите переместить в корзину.",
+		Back:   service.SELECT_ACTION,
+		Enter:  titlesPrompt("удалить"),
+		Handle: (*conversation).deleteItem,
+	})
+	return m
+}
+
+// titlesPrompt отправляет клиенту список записей для действия action. Уже показанный список,
+// в том числе восстановленный после переподключения, показывается с прежними номерами.
+func titlesPrompt(action string) func(c *conversation) bool {
+	return func(c *conversation) bool {
+		if len(c.dataTitles) > 0 {
+			c.Reply(formatTitles(c.id.Username, action, c.dataTitles))
+			return true
+		}
+		resultMes, err := c.s.getUserTitles(c.id.Username, c.client, action, c.dataTitles)
+		if err != nil {
+			if errors.Is(err, ErrTitlesNotFound) {
+				c.Reply("\nУ вас нет сохраненных данных.")
+				return false
+			}
+			c.Reply("\nНе удалось получить список записей.")
+			return false
+		}
+		c.Reply(resultMes)
+		return true
+	}
+}
+
+func (c *conversation) getItem(input string) (service.State, error) {
+	row, ok := c.dataTitles[input]
+	if !ok {
+		return service.GET_DATA, service.ErrUnknownInput
+	}
+	item, err := c.s.readItem(c.id.Username, row, c.clientEncryption)
+	if err != nil {
+		c.Reply("\nНе удалось получить данные записи.")
+		return service.GET_DATA, nil
+	}
+	c.send(&pb.CommandMessage{Item: item})
+	c.s.auditItem(c.ctx, c.id.Username, service.ITEM_READ, row)
+	c.Reset()
+	return service.CONNECTED, nil
+}
+
+func (c *conversation) createTypesPrompt() bool {
+	var builder strings.Builder
+	builder.WriteString("\nЧто хотите создать:")
+	for i, createType := range createTypes {
+		fmt.Fprintf(&builder, "\n%d) %s", i+1, createType.title)
+	}
+	c.Reply(builder.String())
+	return true
+}
+
+func (c *conversation) chooseCreateType(input string) (service.State, error) {
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(createTypes) {
+		return service.CHOSE_CREATE_DATA, service.ErrUnknownInput
+	}
+	c.createdType = createTypes[number-1].dataType
+	return service.CREATE_DATA, nil
+}
+
+func (c *conversation) createItem(string) (service.State, error) {
+	if c.msg.Item == nil {
+		return service.CREATE_DATA, service.ErrUnknownInput
+	}
+
+	var created storage.DataRow
+	var err error
+	if c.clientEncryption {
+		created, err = c.s.createSealedData(c.msg.Item, c.id.Username, c.createdType)
+	} else {
+		created, err = c.s.createData(c.msg.Item, c.id.Username, c.createdType)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCreateFormat):
+			c.send(itemPrompt(itemFormatMessage(err), c.createdType, c.clientEncryption))
+		case errors.Is(err, ErrNotSealed):
+			c.send(itemPrompt("\nДанные должны быть зашифрованы на клиенте.", c.createdType, c.clientEncryption))
+		case errors.Is(err, sqlite.ErrCreateData):
+			c.send(itemPrompt("\nЗапись с таким названием уже есть.", c.createdType, c.clientEncryption))
+		default:
+			logger.Log.Sugar().Errorf("Failed to create item of %s: %v", c.id.Username, err)
+			c.Reply("\nНе удалось сохранить запись.")
+			c.Reset()
+			return service.CONNECTED, nil
+		}
+		return service.CREATE_DATA, nil
+	}
+
+	c.Reply("\nДанные записаны!")
+	c.s.auditItem(c.ctx, c.id.Username, service.ITEM_CREATE, created)
+	go c.s.broadcastMessage(c.id.Username, c.id.SessionID, fmt.Sprintf("ОБНОВЛЕНИЕ! Новая запись: %s", created.Title))
+	c.Reset()
+	return service.CONNECTED, nil
+}
+
+func (c *conversation) chooseUpdateItem(input string) (service.State, error) {
+	row, ok := c.dataTitles[input]
+	if !ok {
+		return service.CHOSE_UPDATE_DATA, service.ErrUnknownInput
+	}
+	c.dataTitles = make(map[string]storage.DataRow)
+	target, err := c.s.editableData(c.id.Username, row, c.clientEncryption)
+	if err != nil {
+		if errors.Is(err, ErrReadOnly) {
+			c.Reply("\nНет доступа на изменение записи.")
+		}
+		return service.CONNECTED, nil
+	}
+	c.editing = target
+	return service.UPDATE_DATA, nil
+}
+
+func (c *conversation) updateItem(string) (service.State, error) {
+	if c.msg.Item == nil {
+		return service.UPDATE_DATA, service.ErrUnknownInput
+	}
+
+	title, err := c.s.updateData(c.id, c.editing, c.msg.Item)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCreateFormat):
+			c.send(itemPrompt(itemFormatMessage(err), c.editing.row.DataType, c.editing.sealed))
+			return service.UPDATE_DATA, nil
+		case errors.Is(err, ErrNotSealed):
+			c.send(itemPrompt("\nДанные должны быть зашифрованы на клиенте.", c.editing.row.DataType, c.editing.sealed))
+			return service.UPDATE_DATA, nil
+		case errors.Is(err, sqlite.ErrTitleExists):
+			c.send(itemPrompt("\nЗапись с таким названием уже есть.", c.editing.row.DataType, c.editing.sealed))
+			return service.UPDATE_DATA, nil
+		case errors.Is(err, sqlite.ErrConflict):
+			c.Reply("\nЗапись изменена на другом устройстве, выберите ее заново.")
+		default:
+			logger.Log.Sugar().Errorf("Failed to update item of %s: %v", c.id.Username, err)
+			c.Reply("\nНе удалось изменить запись.")
+		}
+		c.Reset()
+		return service.CONNECTED, nil
+	}
+
+	c.Reply("\nДанные изменены!")
+	c.s.auditItem(c.ctx, c.id.Username, service.ITEM_UPDATE, c.editing.row)
+	c.s.notifyItemOwner(c.id.Username, c.editing.row.Username, title)
+	c.Reset()
+	return service.CONNECTED, nil
+}
+
+func (c *conversation) deleteItem(input string) (service.State, error) {
+	row, ok := c.dataTitles[input]
+	if !ok {
+		return service.CHOSE_DELETE_DATA, service.ErrUnknownInput
+	}
+	c.dataTitles = make(map[string]storage.DataRow)
+	expiresAt, err := c.s.trashData(c.id.Username, row)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotOwner):
+			c.Reply("\nУдалять можно только свои записи.")
+		case errors.Is(err, ErrNoDeleteAccess):
+			c.Reply("\nНет доступа на удаление записи коллекции.")
+		case errors.Is(err, sqlite.ErrDataNotFound):
+			c.Reply("\nЗапись уже удалена.")
+		default:
+			logger.Log.Sugar().Errorf("Failed to delete item of %s: %v", c.id.Username, err)
+			c.Reply("\nНе удалось удалить запись.")
+		}
+		return service.CONNECTED, nil
+	}
+
+	if row.CollectionID != 0 {
+		c.Reply("\nЗапись коллекции удалена.")
+	} else {
+		c.Reply(fmt.Sprintf("\nЗапись перемещена в корзину, ее можно восстановить до %s.", expiresAt.Format("2006-01-02 15:04")))
+	}
+	c.s.auditItem(c.ctx, c.id.Username, service.ITEM_DELETE, row)
+	c.s.notifyDeleted(c.id.Username, c.id.SessionID, row)
+	return service.CONNECTED, nil
+}
@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestConversation(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	expectKeys := func() {
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+		mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+	}
+	expectState := func() {
+		mockProvider.On("UpdateClientState", mock.Anything, "alice::1", mock.Anything, mock.Anything).Return(nil).Maybe()
+	}
+
+	id := identity{Username: "alice", SessionID: "session-id"}
+	newConv := func(state service.State) *conversation {
+		client := newClient()
+		client.state = state
+		conv := newConversation(server, context.Background(), id, client)
+		conv.clientID = "alice::1"
+		return conv
+	}
+	// handle передает машине состояний текстовое сообщение клиента
+	handle := func(conv *conversation, input string) {
+		conv.msg = &pb.CommandMessage{Message: input}
+		commands.Handle(conv, input)
+	}
+	// replies возвращает сообщения, отправленные клиенту
+	replies := func(conv *conversation) []*pb.CommandMessage {
+		var sent []*pb.CommandMessage
+		for len(conv.client.ch) > 0 {
+			sent = append(sent, <-conv.client.ch)
+		}
+		return sent
+	}
+
+	t.Run("item created", func(t *testing.T) {
+		expectState()
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("CreateData", mock.Anything, mock.MatchedBy(func(row storage.DataRow) bool {
+			return row.DataType == service.CARD
+		}), mock.Anything).Return(nil)
+		conv := newConv(service.CONNECTED)
+
+		handle(conv, "x")
+		assert.Equal(t, service.SELECT_ACTION, conv.State())
+		assert.Equal(t, "\nВыбирете действие:\n1) GET\n2) CREATE\n3) UPDATE\n4) DELETE", replies(conv)[0].Message)
+
+		handle(conv, "2")
+		assert.Equal(t, service.CHOSE_CREATE_DATA, conv.State())
+		handle(conv, "3")
+		assert.Equal(t, service.CREATE_DATA, conv.State())
+		sent := replies(conv)
+		if assert.Len(t, sent, 2) {
+			assert.NotNil(t, sent[1].ItemTemplate.GetCard())
+		}
+
+		conv.msg = &pb.CommandMessage{Item: &pb.Item{Title: "bank", Payload: &pb.Item_Card{Card: &pb.CardItem{
+			Number: "4111111111111111", ExpirationDate: "12/29", Cvv: "123",
+		}}}}
+		commands.Handle(conv, "")
+		assert.Equal(t, service.CONNECTED, conv.State())
+		assert.Equal(t, "\nДанные записаны!", replies(conv)[0].Message)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("back to item type", func(t *testing.T) {
+		expectState()
+		conv := newConv(service.CHOSE_CREATE_DATA)
+
+		handle(conv, "1")
+		handle(conv, service.CommandBack)
+		assert.Equal(t, service.CHOSE_CREATE_DATA, conv.State())
+		sent := replies(conv)
+		if assert.Len(t, sent, 2) {
+			assert.NotNil(t, sent[0].ItemTemplate.GetLogin())
+			assert.Contains(t, sent[1].Message, "Что хотите создать:")
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("cancelled update", func(t *testing.T) {
+		expectState()
+		conv := newConv(service.UPDATE_DATA)
+		conv.editing = editTarget{row: storage.DataRow{ID: 7, Title: "wifi"}}
+
+		handle(conv, service.CommandCancel)
+		assert.Equal(t, service.SELECT_ACTION, conv.State())
+		assert.Equal(t, editTarget{}, conv.editing)
+		assert.Equal(t, "\nДействие отменено.", replies(conv)[0].Message)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unknown item type", func(t *testing.T) {
+		expectState()
+		conv := newConv(service.CHOSE_CREATE_DATA)
+
+		handle(conv, "9")
+		assert.Equal(t, service.CHOSE_CREATE_DATA, conv.State())
+		sent := replies(conv)
+		if assert.Len(t, sent, 2) {
+			assert.Contains(t, sent[0].Message, "Неизвестная команда")
+			assert.Contains(t, sent[1].Message, "4) бинарные данные")
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestResumeConversation(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+	mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+
+	encryptedRow := func(id int64, title string, version int64) storage.DataRow {
+		index := service.TitleIndex(dataKey, title)
+		titleCipher, _ := service.EncryptRecord(title, dataKey, 1, service.TitleAAD("alice", index))
+		return storage.DataRow{ID: id, Username: "alice", TitleIndex: index, TitleCipher: titleCipher, DataType: service.TEXT, Version: version}
+	}
+	id := identity{Username: "alice", SessionID: "session-id"}
+
+	t.Run("context saved and restored", func(t *testing.T) {
+		// состояние сохраняется в БД то, которое запрошено
+		mockProvider.On("UpdateClientState", mock.Anything, "alice::1", service.UPDATE_DATA, mock.Anything).Return(nil)
+
+		client := newClient()
+		conv := newConversation(server, context.Background(), id, client)
+		conv.clientID = "alice::1"
+		conv.dataTitles["1"] = encryptedRow(7, "wifi", 3)
+		conv.dataTitles["2"] = encryptedRow(8, "bank", 1)
+		conv.editing = editTarget{row: encryptedRow(7, "wifi", 3)}
+		conv.SetState(service.UPDATE_DATA)
+		assert.NotContains(t, client.context, "wifi")
+
+		// за время отключения запись 8 удалена, а запись 7 изменена
+		mockProvider.On("GetTitlesByUser", mock.Anything, "alice").Return([]storage.DataRow{encryptedRow(7, "wifi", 4)}, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, "alice").Return(nil, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, "alice").Return(nil, nil)
+		current := encryptedRow(7, "wifi", 4)
+		mockProvider.On("GetData", mock.Anything, "alice", current.TitleIndex).Return(current, nil)
+
+		resumed := newConversation(server, context.Background(), id, newClient())
+		resumed.restore(client.context)
+		if assert.Len(t, resumed.dataTitles, 1) {
+			assert.Equal(t, "wifi", resumed.dataTitles["1"].Title)
+		}
+		assert.Equal(t, int64(7), resumed.editing.row.ID)
+		// версия на момент выбора: изменение приведет к конфликту
+		assert.Equal(t, int64(3), resumed.editing.row.Version)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("conversation loaded after restart", func(t *testing.T) {
+		mockProvider.On("RemoveStaleClients", mock.Anything, mock.Anything).Return(nil)
+		mockProvider.On("GetAllClients", mock.Anything).Return([]storage.Client{
+			{ClientID: "alice::1", Username: "alice", State: int(service.CREATE_DATA), SessionID: "session-id", Context: `{"created_type":3}`},
+		}, nil)
+
+		assert.NoError(t, server.loadClientsFromDB())
+		// клиент без стрима не получает уведомлений
+		server.notifyUser("alice", "ОБНОВЛЕНИЕ!")
+		assert.Empty(t, server.clients["alice::1"].ch)
+
+		// переподключение с тем же токеном продолжает диалог
+		client := newClient()
+		client.sessionID = "session-id"
+		clientID, resumed := server.attachClient("alice", client)
+		assert.True(t, resumed)
+		assert.Equal(t, "alice::1", clientID)
+		assert.Equal(t, service.CREATE_DATA, client.state)
+
+		conv := newConversation(server, context.Background(), id, client)
+		conv.restore(client.context)
+		assert.Equal(t, service.CARD, conv.createdType)
+
+		// после отключения диалог снова ждет клиента
+		server.detachClient(clientID)
+		assert.Nil(t, server.clients["alice::1"].revoked)
+		assert.Equal(t, service.CREATE_DATA, server.clients["alice::1"].state)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("saved conversation of revoked session", func(t *testing.T) {
+		mockProvider.On("RemoveClient", mock.Anything, "alice::1").Return(nil)
+
+		assert.Equal(t, 0, server.revokeStreams("alice", "Сессия завершена.", func(sessionID string) bool { return sessionID == "session-id" }))
+		assert.Empty(t, server.clients)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("stale conversations removed", func(t *testing.T) {
+		server.clients["alice::1"] = detachedClient("expired-session", service.CREATE_DATA, "")
+		server.clients["alice::2"] = detachedClient("session-id", service.CREATE_DATA, "")
+		connected := newClient()
+		server.clients["alice::3"] = connected
+		now := time.Now()
+		mockProvider.On("RemoveStaleClients", mock.Anything, now).Return(nil)
+		mockProvider.On("GetAllClients", mock.Anything).Return([]storage.Client{
+			{ClientID: "alice::2", Username: "alice", State: int(service.CREATE_DATA), SessionID: "session-id"},
+			{ClientID: "alice::3", Username: "alice", State: int(service.CONNECTED), SessionID: "session-id"},
+		}, nil)
+
+		server.removeStaleClients(now)
+		assert.NotContains(t, server.clients, "alice::1")
+		assert.Contains(t, server.clients, "alice::2")
+		// стрим истекшей сессии завершает перехватчик, а не очистка
+		assert.Same(t, connected, server.clients["alice::3"])
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+		server.clients = make(map[string]*client)
+	})
+
+	t.Run("idle client not saved after disconnect", func(t *testing.T) {
+		mockProvider.On("AddClient", mock.Anything, mock.Anything).Return(nil)
+		mockProvider.On("RemoveClient", mock.Anything, mock.Anything).Return(nil)
+
+		client := newClient()
+		client.sessionID = "session-id"
+		clientID, _ := server.attachClient("alice", client)
+		server.detachClient(clientID)
+		assert.Empty(t, server.clients)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("new session", func(t *testing.T) {
+		mockProvider.On("AddClient", mock.Anything, mock.MatchedBy(func(c storage.Client) bool {
+			return c.Username == "alice" && c.SessionID == "other-session"
+		})).Return(nil)
+
+		client := newClient()
+		client.sessionID = "other-session"
+		_, resumed := server.attachClient("alice", client)
+		assert.False(t, resumed)
+		assert.Equal(t, service.CONNECTED, client.state)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
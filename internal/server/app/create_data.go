@@ -1,83 +1,115 @@
 package app
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
 	"keeper/internal/logger"
 	"keeper/internal/server/service"
-	"strings"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-var ErrCreateFormat = errors.New("incorrect data format")
-
-func (s *server) createData(msg string, username string, createdType service.DataType) (string, error) {
-	var partsCount int
-	switch createdType {
-	case service.PASSWORD:
-		partsCount = 4
-	case service.TEXT:
-		partsCount = 3
-	case service.BYTE:
-		partsCount = 3
-	case service.CARD:
-		partsCount = 6
+// firstItemVersion версия новой записи
+const firstItemVersion = 1
+
+// createData сохраняет запись, зашифрованную ключом пользователя, и возвращает ее с присвоенным id
+func (s *server) createData(item *pb.Item, username string, createdType service.DataType) (storage.DataRow, error) {
+	data, err := encodeItem(item, createdType)
+	if err != nil {
+		return storage.DataRow{}, err
 	}
+	title := item.Title
 
-	// разбиваем полученные данные по разделителю
-	parts := strings.Split(msg, "::")
-	if len(parts) != partsCount {
-		return "", ErrCreateFormat
+	version, dataKey, err := s.currentUserKey(username)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+
+	row, err := s.newDataRow(username, title, createdType)
+	if err != nil {
+		return storage.DataRow{}, err
 	}
 
-	createDataMap := make(map[string]string)
-	var title, meta string
-
-	// собираем мапу с данными в зависимости от типа данных
-	switch createdType {
-	case service.PASSWORD:
-		var login, pass string
-		title, login, pass, meta = parts[0], parts[1], parts[2], parts[3]
-		createDataMap["login"] = login
-		createDataMap["password"] = pass
-		createDataMap["meta"] = meta
-	case service.TEXT:
-		var text string
-		title, text, meta = parts[0], parts[1], parts[2]
-		createDataMap["text"] = text
-		createDataMap["meta"] = meta
-	case service.BYTE:
-		var bytes string
-		title, bytes, meta = parts[0], parts[1], parts[2]
-		createDataMap["bytes"] = bytes
-		createDataMap["meta"] = meta
-	case service.CARD:
-		var cardNum, expirationDate, owner, cvv string
-		title, cardNum, expirationDate, owner, cvv, meta = parts[0], parts[1], parts[2], parts[3], parts[4], parts[5]
-		createDataMap["card_num"] = cardNum
-		createDataMap["expiration_date"] = expirationDate
-		createDataMap["owner"] = owner
-		createDataMap["cvv"] = cvv
-		createDataMap["meta"] = meta
+	// шифруем данные ключом пользователя с привязкой к id записи, который известен только после вставки
+	seal := func(id int64) (string, error) {
+		row.ID = id
+		cipherText, err := service.EncryptRecord(data, dataKey, version, recordAAD(row))
+		if err != nil {
+			logger.Log.Sugar().Errorf("Encryption error: %v\n", err)
+		}
+		return cipherText, err
 	}
 
-	// сериализуем мапу
-	createDataJson, err := json.Marshal(createDataMap)
+	// сохраняем данные
+	err = s.provider.CreateData(s.ctx, row, seal)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Error marshalling map to JSON: %v", err)
-		return "", err
+		return storage.DataRow{}, err
 	}
+	return row, nil
+}
+
+// ErrNotSealed описывает ошибку получения незашифрованных данных от клиента, который шифрует данные сам.
+var ErrNotSealed = errors.New("data is not sealed by client")
 
-	// шифруем данные
-	cipherText, err := service.Encrypt(string(createDataJson), s.cfg.Secret)
+// createSealedData сохраняет данные, зашифрованные на клиенте ключом хранилища.
+// Данные сохраняются как есть, название шифруется ключом пользователя на сервере.
+func (s *server) createSealedData(item *pb.Item, username string, createdType service.DataType) (storage.DataRow, error) {
+	sealed, err := sealedPayload(item)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Encryption error: %v\n", err)
-		return "", err
+		return storage.DataRow{}, err
 	}
+	title := item.Title
 
-	// сохраняем данные
-	err = s.provider.CreateData(s.ctx, username, title, service.PASSWORD, cipherText)
+	row, err := s.newDataRow(username, title, createdType)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+
+	err = s.provider.CreateData(s.ctx, row, func(id int64) (string, error) {
+		row.ID = id
+		return service.ClientSealedPrefix + sealed, nil
+	})
 	if err != nil {
-		return "", err
+		return storage.DataRow{}, err
 	}
-	return title, nil
+	return row, nil
+}
+
+// CreateItem создает запись пользователя. Тип записи определяется ее данными, а пользователь,
+// который шифрует данные сам, передает зашифрованные данные и тип записи.
+func (s *server) CreateItem(ctx context.Context, req *pb.CreateItemRequest) (*pb.CreateItemResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	vault, err := s.provider.GetVault(ctx, id.Username)
+	if err != nil {
+		return nil, itemStatus(id.Username, err)
+	}
+
+	var row storage.DataRow
+	if vault.ClientEncryption {
+		if _, ok := pb.ItemType_name[int32(req.Type)]; !ok {
+			return nil, status.Error(codes.InvalidArgument, "unknown item type")
+		}
+		row, err = s.createSealedData(req.Item, id.Username, service.DataType(req.Type))
+	} else {
+		dataType, ok := itemDataType(req.Item)
+		if !ok {
+			return nil, itemStatus(id.Username, ErrCreateFormat)
+		}
+		row, err = s.createData(req.Item, id.Username, dataType)
+	}
+	if err != nil {
+		return nil, itemStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_CREATE, row)
+	go s.broadcastMessage(id.Username, id.SessionID, fmt.Sprintf("ОБНОВЛЕНИЕ! Новая запись: %s", row.Title))
+	return &pb.CreateItemResponse{Message: "Данные записаны!", Version: firstItemVersion}, nil
 }
@@ -8,39 +8,82 @@ import (
 	"keeper/internal/mocks"
 	"keeper/internal/server/config"
 	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestCreateData(t *testing.T) {
 	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
 	server := &server{
 		provider: mockProvider,
 		cfg:      &config.Config{Secret: "thisis32byteencryptionkey1234567"},
+		keyring:  keyring,
 		ctx:      context.Background(),
 	}
 
 	username := "testuser"
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := server.keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+
+	// createdRow сопоставляет новую запись: название сохраняется только слепым индексом и шифртекстом
+	createdRow := func(dataType service.DataType) interface{} {
+		index := service.TitleIndex(dataKey, "title")
+		return mock.MatchedBy(func(row storage.DataRow) bool {
+			header, body, err := service.ParseHeader(row.TitleCipher)
+			if err != nil || !header.Bound {
+				return false
+			}
+			title, err := service.DecryptWithAAD(body, dataKey, service.TitleAAD(username, index))
+			return err == nil && title == "title" && row.TitleIndex == index &&
+				row.Username == username && row.DataType == dataType
+		})
+	}
 
 	t.Run("successful password creation", func(t *testing.T) {
-		msg := "title::login::password::metadata"
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "login", Password: "pass::word", Meta: "metadata"}}}
 		dataType := service.PASSWORD
-		mockProvider.On("CreateData", mock.Anything, username, "title", mock.Anything, mock.Anything).Return(nil)
+		var cipherText string
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("CreateData", mock.Anything, createdRow(dataType), mock.MatchedBy(func(seal storage.SealFunc) bool {
+			cipherText, _ = seal(42)
+			return true
+		})).Return(nil)
 
-		_, err := server.createData(msg, username, dataType)
+		_, err := server.createData(item, username, dataType)
 		assert.NoError(t, err)
 
+		// данные привязаны к владельцу, id, типу и названию записи
+		header, body, err := service.ParseHeader(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, service.KeyHeader{Version: 1, Bound: true}, header)
+		plainText, err := service.DecryptWithAAD(body, dataKey, service.RecordAAD(username, 42, dataType, "title"))
+		assert.NoError(t, err)
+		stored, err := decodeItem("title", dataType, plainText)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(item, stored))
+
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
 	})
 
 	t.Run("successful text creation", func(t *testing.T) {
-		msg := "title::text::metadata"
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "text", Meta: "metadata"}}}
 		dataType := service.TEXT
-		mockProvider.On("CreateData", mock.Anything, username, "title", mock.Anything, mock.Anything).Return(nil)
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("CreateData", mock.Anything, createdRow(dataType), mock.Anything).Return(nil)
 
-		_, err := server.createData(msg, username, dataType)
+		_, err := server.createData(item, username, dataType)
 		assert.NoError(t, err)
 
 		mockProvider.AssertExpectations(t)
@@ -48,11 +91,15 @@ func TestCreateData(t *testing.T) {
 	})
 
 	t.Run("successful card creation", func(t *testing.T) {
-		msg := "title::cardnum::expdate::owner::cvv::metadata"
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Card{Card: &pb.CardItem{
+			Number: "4111 1111 1111 1111", ExpirationDate: "12/29", Owner: "owner", Cvv: "123", Meta: "metadata",
+		}}}
 		dataType := service.CARD
-		mockProvider.On("CreateData", mock.Anything, username, "title", mock.Anything, mock.Anything).Return(nil)
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("CreateData", mock.Anything, createdRow(dataType), mock.Anything).Return(nil)
 
-		_, err := server.createData(msg, username, dataType)
+		_, err := server.createData(item, username, dataType)
 		assert.NoError(t, err)
 
 		mockProvider.AssertExpectations(t)
@@ -60,24 +107,171 @@ func TestCreateData(t *testing.T) {
 	})
 
 	t.Run("incorrect format", func(t *testing.T) {
-		msg := "title::login"
-		dataType := service.PASSWORD
+		// данные другого типа
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "text"}}}
 
-		_, err := server.createData(msg, username, dataType)
-		assert.Error(t, err)
+		_, err := server.createData(item, username, service.PASSWORD)
 		assert.Equal(t, ErrCreateFormat, err)
 	})
 
+	t.Run("invalid card", func(t *testing.T) {
+		card := &pb.CardItem{Number: "4111 1111 1111 1111", ExpirationDate: "12/29", Cvv: "123"}
+		invalid := []struct {
+			change func(card *pb.CardItem)
+			err    error
+		}{
+			{func(card *pb.CardItem) { card.Number = "4111" }, ErrCardNumber},
+			{func(card *pb.CardItem) { card.ExpirationDate = "2029-12" }, ErrCardExpiration},
+			{func(card *pb.CardItem) { card.Cvv = "12a" }, ErrCardCVV},
+		}
+		for _, tt := range invalid {
+			changed := proto.Clone(card).(*pb.CardItem)
+			tt.change(changed)
+
+			_, err := server.createData(&pb.Item{Title: "title", Payload: &pb.Item_Card{Card: changed}}, username, service.CARD)
+			assert.Equal(t, tt.err, err)
+			assert.ErrorIs(t, err, ErrCreateFormat)
+		}
+	})
+
 	t.Run("provider error", func(t *testing.T) {
-		msg := "title::login::password::metadata"
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "login", Password: "password"}}}
 		dataType := service.PASSWORD
-		mockProvider.On("CreateData", mock.Anything, username, "title", dataType, mock.Anything).Return(errors.New("provider error"))
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("CreateData", mock.Anything, createdRow(dataType), mock.Anything).Return(errors.New("provider error"))
 
-		_, err := server.createData(msg, username, dataType)
+		_, err := server.createData(item, username, dataType)
 		assert.Error(t, err)
 		assert.Equal(t, "provider error", err.Error())
 
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
 	})
+	t.Run("sealed data stored as is", func(t *testing.T) {
+		sealed, _ := service.Encrypt("login::password::metadata", server.cfg.Secret)
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Sealed{Sealed: sealed}}
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("CreateData", mock.Anything, createdRow(service.PASSWORD), mock.MatchedBy(func(seal storage.SealFunc) bool {
+			data, err := seal(1)
+			return err == nil && data == service.ClientSealedPrefix+sealed
+		})).Return(nil)
+
+		created, err := server.createSealedData(item, username, service.PASSWORD)
+		assert.NoError(t, err)
+		assert.Equal(t, "title", created.Title)
+		// id записи нужен журналу аудита вместо названия
+		assert.Equal(t, int64(1), created.ID)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("sealed data required", func(t *testing.T) {
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "login"}}}
+
+		_, err := server.createSealedData(item, username, service.PASSWORD)
+		assert.Equal(t, ErrNotSealed, err)
+	})
+
+	t.Run("sealed data incorrect format", func(t *testing.T) {
+		item := &pb.Item{Title: "title", Payload: &pb.Item_Sealed{Sealed: "not-hex"}}
+
+		_, err := server.createSealedData(item, username, service.PASSWORD)
+		assert.Equal(t, ErrCreateFormat, err)
+	})
+}
+
+func TestCreateItem(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	expectKeys := func() {
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+		mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+	}
+	createdType := func(dataType service.DataType) interface{} {
+		return mock.MatchedBy(func(row storage.DataRow) bool { return row.DataType == dataType })
+	}
+
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+	codeOf := func(err error) codes.Code {
+		st, _ := status.FromError(err)
+		return st.Code()
+	}
+
+	t.Run("typed item", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("CreateData", mock.Anything, createdType(service.CARD), mock.Anything).Return(nil)
+
+		resp, err := server.CreateItem(ctx, &pb.CreateItemRequest{Item: &pb.Item{Title: "bank", Payload: &pb.Item_Card{Card: &pb.CardItem{
+			Number: "4111111111111111", ExpirationDate: "12/29", Cvv: "123",
+		}}}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(firstItemVersion), resp.Version)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("client-encrypted item", func(t *testing.T) {
+		sealed, _ := service.Encrypt("payload", "thisis32byteencryptionkey1234567")
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{ClientEncryption: true}, nil)
+		mockProvider.On("CreateData", mock.Anything, createdType(service.TEXT), mock.Anything).Return(nil)
+
+		_, err := server.CreateItem(ctx, &pb.CreateItemRequest{
+			Item: &pb.Item{Title: "note", Payload: &pb.Item_Sealed{Sealed: sealed}},
+			Type: pb.ItemType_ITEM_TYPE_TEXT,
+		})
+		assert.NoError(t, err)
+
+		// открытые данные от клиента, который шифрует данные сам, не принимаются
+		_, err = server.CreateItem(ctx, &pb.CreateItemRequest{Item: &pb.Item{Title: "note", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "x"}}}})
+		assert.Equal(t, codes.InvalidArgument, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("title taken", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("CreateData", mock.Anything, mock.Anything, mock.Anything).Return(sqlite.ErrCreateData)
+
+		_, err := server.CreateItem(ctx, &pb.CreateItemRequest{Item: &pb.Item{Title: "note", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "x"}}}})
+		assert.Equal(t, codes.AlreadyExists, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("item without data", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+
+		_, err := server.CreateItem(ctx, &pb.CreateItemRequest{Item: &pb.Item{Title: "note"}})
+		assert.Equal(t, codes.InvalidArgument, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := server.CreateItem(context.Background(), &pb.CreateItemRequest{})
+		assert.Equal(t, codes.Unauthenticated, codeOf(err))
+	})
 }
@@ -1,41 +1,151 @@
 package app
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"keeper/internal/logger"
 	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
 	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func (s *server) getData(username string, title string) (string, error) {
+func (s *server) getData(username string, title string) (*pb.Item, error) {
 
-	jsonString, err := s.provider.GetData(s.ctx, username, title)
+	row, err := s.findData(username, title)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	decryptedJson, err := service.Decrypt(jsonString, s.cfg.Secret)
+	plainText, bound, err := s.decryptRecord(row)
 	if err != nil {
 		logger.Log.Sugar().Errorf("Decryption error: %v\n", err)
-		return "", err
+		return nil, err
+	}
+	if !bound && s.cfg.StrictAAD {
+		logger.Log.Sugar().Errorf("Record %d of %s is not bound to owner", row.ID, username)
+		return nil, ErrUnboundData
 	}
 
-	dataMap := make(map[string]string)
+	item, err := decodeItem(title, row.DataType, plainText)
+	if err != nil {
+		return nil, err
+	}
 
-	// Преобразование JSON-строки в карту
-	err = json.Unmarshal([]byte(decryptedJson), &dataMap)
+	if !bound {
+		// запись сохранена до привязки к владельцу, перешифровываем ее при чтении
+		if err := s.bindRecord(row, plainText); err != nil {
+			logger.Log.Sugar().Errorf("Failed to bind record %d: %v", row.ID, err)
+		}
+	}
+
+	return item, nil
+}
+
+// getSealedData возвращает данные, зашифрованные на клиенте. Сервер их не расшифровывает.
+func (s *server) getSealedData(username string, title string) (*pb.Item, error) {
+	row, err := s.findData(username, title)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Error unmarshalling JSON: %v", err)
-		return "", err
+		return nil, err
+	}
+
+	sealed, found := strings.CutPrefix(row.Data, service.ClientSealedPrefix)
+	if !found {
+		logger.Log.Sugar().Errorf("Data of %s is not sealed by client", username)
+		return nil, ErrNotSealed
 	}
+	return &pb.Item{Title: title, Payload: &pb.Item_Sealed{Sealed: sealed}}, nil
+}
 
-	var builder strings.Builder
-	builder.WriteString("Ваши данные:\n")
+// readItem возвращает данные записи из списка записей пользователя: своей, общей или командной
+func (s *server) readItem(username string, row storage.DataRow, clientEncryption bool) (*pb.Item, error) {
+	switch {
+	case row.CollectionID != 0:
+		return s.getTeamData(username, row.ID)
+	case row.Username != username:
+		return s.getSharedData(username, row.ID)
+	case clientEncryption:
+		// чужие и командные записи шифрует сервер, даже если свои данные пользователь шифрует сам
+		return s.getSealedData(username, row.Title)
+	default:
+		return s.getData(username, row.Title)
+	}
+}
 
-	for key, value := range dataMap {
-		builder.WriteString(fmt.Sprintf("%s: %s\n", key, value))
+// findItem ищет запись, доступную пользователю, по названию: свою, общую запись владельца owner
+// или командную запись коллекции collection (организация/коллекция)
+func (s *server) findItem(ctx context.Context, username string, owner string, collection string, title string) (storage.DataRow, error) {
+	if collection != "" {
+		rows, err := s.getTeamTitles(username)
+		if err != nil {
+			return storage.DataRow{}, err
+		}
+		for _, row := range rows {
+			if row.Collection == collection && row.Title == title {
+				return row, nil
+			}
+		}
+		return storage.DataRow{}, sqlite.ErrDataNotFound
 	}
 
-	return builder.String(), nil
+	if owner == "" {
+		owner = username
+	}
+	// ключ названий создается при первом обращении, поэтому владелец должен существовать
+	if owner != username {
+		if _, err := s.provider.GetVault(ctx, owner); err != nil {
+			if errors.Is(err, sqlite.ErrUserNotFound) {
+				return storage.DataRow{}, sqlite.ErrDataNotFound
+			}
+			return storage.DataRow{}, err
+		}
+	}
+	return s.findData(owner, title)
+}
+
+// GetItem возвращает данные своей записи, общей записи или записи коллекции и ее версию.
+// Данные, которые пользователь шифрует сам, возвращаются зашифрованными.
+func (s *server) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.GetItemResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title required")
+	}
+
+	vault, err := s.provider.GetVault(ctx, id.Username)
+	if err != nil {
+		return nil, itemStatus(id.Username, err)
+	}
+	row, err := s.findItem(ctx, id.Username, req.Owner, req.Collection, req.Title)
+	if err != nil {
+		return nil, itemStatus(id.Username, err)
+	}
+	item, err := s.readItem(id.Username, row, vault.ClientEncryption)
+	if err != nil {
+		return nil, itemStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_READ, row)
+	return &pb.GetItemResponse{Item: item, Version: row.Version}, nil
+}
+
+// findData ищет запись пользователя по слепому индексу названия
+func (s *server) findData(username string, title string) (storage.DataRow, error) {
+	index, err := s.titleIndex(username, title)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+
+	row, err := s.provider.GetData(s.ctx, username, index)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+	row.Title = title
+	return row, nil
 }
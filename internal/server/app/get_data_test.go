@@ -9,21 +9,36 @@ import (
 	"keeper/internal/mocks"
 	"keeper/internal/server/config"
 	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestGetData(t *testing.T) {
 	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
 	server := &server{
 		provider: mockProvider,
 		cfg:      &config.Config{Secret: "thisis32byteencryptionkey1234567"},
+		keyring:  keyring,
 		ctx:      context.Background(),
 	}
 
 	username := "testuser"
 	title := "testtitle"
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := server.keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	// запись ищется по слепому индексу, вычисленному ключом пользователя первой версии
+	index := service.TitleIndex(dataKey, title)
+	row := storage.DataRow{ID: 1, Username: username, TitleIndex: index, DataType: service.PASSWORD}
+	bindCall := mock.MatchedBy(func(update storage.CipherUpdate) bool { return update.ID == row.ID })
 
 	t.Run("successful data retrieval", func(t *testing.T) {
 		// Mocking GetData
@@ -32,15 +47,15 @@ func TestGetData(t *testing.T) {
 			"password": "testpassword",
 		}
 		dataMapJSON, _ := json.Marshal(dataMap)
-		encryptedData, _ := service.Encrypt(string(dataMapJSON), server.cfg.Secret)
-		mockProvider.On("GetData", mock.Anything, username, title).Return(encryptedData, nil)
+		row.Data, _ = service.EncryptRecord(string(dataMapJSON), dataKey, 1, service.RecordAAD(username, row.ID, row.DataType, title))
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
 
-		message, err := server.getData(username, title)
+		item, err := server.getData(username, title)
 		assert.NoError(t, err)
-		assert.NotNil(t, message)
-		assert.Contains(t, message, "Ваши данные:\n")
-		assert.Contains(t, message, "login: testlogin\n")
-		assert.Contains(t, message, "password: testpassword\n")
+		assert.Equal(t, title, item.Title)
+		assert.Equal(t, "testlogin", item.GetLogin().Login)
+		assert.Equal(t, "testpassword", item.GetLogin().Password)
 
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
@@ -48,11 +63,13 @@ func TestGetData(t *testing.T) {
 
 	t.Run("data decryption error", func(t *testing.T) {
 		// Mocking GetData
-		mockProvider.On("GetData", mock.Anything, username, title).Return("invalid encrypted data", nil)
+		row.Data = "invalid encrypted data"
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
 
-		message, err := server.getData(username, title)
+		item, err := server.getData(username, title)
 		assert.Error(t, err)
-		assert.Equal(t, "", message)
+		assert.Nil(t, item)
 
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
@@ -60,12 +77,13 @@ func TestGetData(t *testing.T) {
 
 	t.Run("data unmarshalling error", func(t *testing.T) {
 		// Mocking GetData
-		encryptedData, _ := service.Encrypt("invalid json", server.cfg.Secret)
-		mockProvider.On("GetData", mock.Anything, username, title).Return(encryptedData, nil)
+		row.Data, _ = service.Encrypt("invalid json", server.cfg.Secret)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
 
-		message, err := server.getData(username, title)
+		item, err := server.getData(username, title)
 		assert.Error(t, err)
-		assert.Equal(t, "", message)
+		assert.Nil(t, item)
 
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
@@ -73,13 +91,189 @@ func TestGetData(t *testing.T) {
 
 	t.Run("provider error", func(t *testing.T) {
 		// Mocking GetData
-		mockProvider.On("GetData", mock.Anything, username, title).Return("", fmt.Errorf("provider error"))
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(storage.DataRow{}, fmt.Errorf("provider error"))
 
-		message, err := server.getData(username, title)
+		item, err := server.getData(username, title)
 		assert.Error(t, err)
-		assert.Equal(t, "", message)
+		assert.Nil(t, item)
 
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
 	})
+	t.Run("legacy data bound on read", func(t *testing.T) {
+		row.Data, _ = service.Encrypt(`{"password":"secret"}`, server.cfg.Secret)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		var bound string
+		mockProvider.On("ReplaceData", mock.Anything, mock.MatchedBy(func(update storage.CipherUpdate) bool {
+			bound = update.New
+			return update.ID == row.ID && update.Old == row.Data
+		})).Return(nil)
+
+		item, err := server.getData(username, title)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", item.GetLogin().Password)
+
+		// перешифрованная запись привязана к владельцу
+		header, body, err := service.ParseHeader(bound)
+		assert.NoError(t, err)
+		assert.True(t, header.Bound)
+		plainText, err := service.DecryptWithAAD(body, dataKey, service.RecordAAD(username, row.ID, row.DataType, title))
+		assert.NoError(t, err)
+		assert.Equal(t, `{"password":"secret"}`, plainText)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("data encrypted with user key without binding", func(t *testing.T) {
+		dataKey, _ := service.GenerateDataKey()
+		wrappedKey, _ := server.keyring.Wrap(dataKey)
+		encryptedData, _ := service.Encrypt(`{"password":"secret"}`, dataKey)
+		row.Data = "u2:" + encryptedData
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 2).Return(storage.UserKey{Version: 2, WrappedKey: wrappedKey}, nil)
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(storage.UserKey{Version: 2, WrappedKey: wrappedKey}, nil)
+		mockProvider.On("ReplaceData", mock.Anything, bindCall).Return(nil)
+
+		item, err := server.getData(username, title)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", item.GetLogin().Password)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("data moved from another record", func(t *testing.T) {
+		// шифртекст записи 2 скопирован в запись 1
+		row.Data, _ = service.EncryptRecord(`{"text":"secret"}`, dataKey, 1, service.RecordAAD(username, 2, row.DataType, title))
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
+
+		item, err := server.getData(username, title)
+		assert.Error(t, err)
+		assert.Nil(t, item)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unbound data rejected in strict mode", func(t *testing.T) {
+		server.cfg.StrictAAD = true
+		defer func() { server.cfg.StrictAAD = false }()
+		row.Data, _ = service.Encrypt(`{"text":"secret"}`, server.cfg.Secret)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, username, index).Return(row, nil)
+
+		_, err := server.getData(username, title)
+		assert.Equal(t, ErrUnboundData, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestGetItem(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	expectKeys := func() {
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+		mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+	}
+
+	item := &pb.Item{Title: "wifi", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "admin", Password: "se::cret"}}}
+	plainText, _ := encodeItem(item, service.PASSWORD)
+	index := service.TitleIndex(dataKey, "wifi")
+	row := storage.DataRow{ID: 7, Username: "alice", TitleIndex: index, DataType: service.PASSWORD, Version: 4}
+	row.Data, _ = service.EncryptRecord(plainText, dataKey, 1, service.RecordAAD("alice", 7, service.PASSWORD, "wifi"))
+
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+	codeOf := func(err error) codes.Code {
+		st, _ := status.FromError(err)
+		return st.Code()
+	}
+
+	t.Run("own item", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+
+		resp, err := server.GetItem(ctx, &pb.GetItemRequest{Title: "wifi"})
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(item, resp.Item))
+		assert.Equal(t, int64(4), resp.Version)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("client-encrypted item", func(t *testing.T) {
+		sealed := row
+		sealed.Data = service.ClientSealedPrefix + "abcdef"
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{ClientEncryption: true}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(sealed, nil)
+
+		resp, err := server.GetItem(ctx, &pb.GetItemRequest{Title: "wifi"})
+		assert.NoError(t, err)
+		assert.Equal(t, "wifi", resp.Item.Title)
+		assert.Equal(t, "abcdef", resp.Item.GetSealed())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("item not found", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", mock.Anything).Return(storage.DataRow{}, sqlite.ErrDataNotFound)
+
+		_, err := server.GetItem(ctx, &pb.GetItemRequest{Title: "bank"})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("owner not found", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetVault", mock.Anything, "mallory").Return(storage.Vault{}, sqlite.ErrUserNotFound)
+
+		_, err := server.GetItem(ctx, &pb.GetItemRequest{Title: "wifi", Owner: "mallory"})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unknown collection", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, "alice").Return(nil, nil)
+
+		_, err := server.GetItem(ctx, &pb.GetItemRequest{Title: "vpn", Collection: "acme/devops"})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("title required", func(t *testing.T) {
+		_, err := server.GetItem(ctx, &pb.GetItemRequest{})
+		assert.Equal(t, codes.InvalidArgument, codeOf(err))
+	})
 }
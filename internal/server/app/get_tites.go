@@ -1,30 +1,43 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"keeper/internal/logger"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
 	"sort"
 	"strconv"
 	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var ErrTitlesNotFound = errors.New("titles not found")
 
-func (s *server) getUserTitles(username string, client *client, dataTitles map[string]string) (string, error) {
-	userTitles, err := s.provider.GetTitlesByUser(s.ctx, username)
+// getUserTitles собирает нумерованный список записей пользователя, записей, к которым ему открыт доступ,
+// и записей коллекций его организаций.
+// Расшифрованные записи сохраняются в dataTitles по номеру в списке, action дополняет заголовок списка.
+func (s *server) getUserTitles(username string, client *client, action string, dataTitles map[string]storage.DataRow) (string, error) {
+	rows, err := s.listItems(username)
 	if err != nil {
 		return "", err
 	}
-	if len(userTitles) == 0 {
+	if len(rows) == 0 {
 		return "", ErrTitlesNotFound
 
 	}
-	// Перенос значений из titles в dataTitles
-	for i, title := range userTitles {
+	for i, row := range rows {
 		key := fmt.Sprintf("%d", i+1) // Создание ключа "1", "2", ...
-		dataTitles[key] = title       // Присвоение значения из titles
+		dataTitles[key] = row         // Присвоение записи с расшифрованным названием
 	}
+	return formatTitles(username, action, dataTitles), nil
+}
 
+// formatTitles возвращает нумерованный список записей из dataTitles
+func formatTitles(username string, action string, dataTitles map[string]storage.DataRow) string {
 	// Сортировка ключей
 	var keys []int
 	for key := range dataTitles {
@@ -35,12 +48,76 @@ func (s *server) getUserTitles(username string, client *client, dataTitles map[s
 
 	// Создание строки с перечислением элементов dataTitles
 	var builder strings.Builder
-	builder.WriteString("\nЧто хотите получить:\n")
+	builder.WriteString(fmt.Sprintf("\nЧто хотите %s:\n", action))
 
 	for _, numKey := range keys {
 		key := fmt.Sprintf("%d", numKey)
-		builder.WriteString(fmt.Sprintf("%s) %s\n", key, dataTitles[key]))
+		row := dataTitles[key]
+		if row.CollectionID != 0 {
+			// запись коллекции организации
+			builder.WriteString(fmt.Sprintf("%s) %s (%s)\n", key, row.Title, row.Collection))
+			continue
+		}
+		if row.Username != username {
+			// чужая запись, к которой открыт доступ
+			builder.WriteString(fmt.Sprintf("%s) %s (от %s)\n", key, row.Title, row.Username))
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("%s) %s\n", key, row.Title))
+	}
+
+	return builder.String()
+}
+
+// listItems возвращает записи пользователя, записи, к которым ему открыт доступ,
+// и записи коллекций его организаций с расшифрованными названиями
+func (s *server) listItems(username string) ([]storage.DataRow, error) {
+	userRows, err := s.provider.GetTitlesByUser(s.ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	sharedRows, err := s.provider.GetSharedTitles(s.ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	userRows = append(userRows, sharedRows...)
+	for i := range userRows {
+		userRows[i].Title, err = s.openTitle(userRows[i])
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to decrypt title of record %d: %v", userRows[i].ID, err)
+			return nil, err
+		}
 	}
 
-	return builder.String(), nil
+	// названия командных записей уже расшифрованы ключами организаций
+	teamRows, err := s.getTeamTitles(username)
+	if err != nil {
+		return nil, err
+	}
+	return append(userRows, teamRows...), nil
+}
+
+// ListItems возвращает записи, доступные пользователю, без данных
+func (s *server) ListItems(ctx context.Context, _ *pb.ListItemsRequest) (*pb.ListItemsResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	rows, err := s.listItems(id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to list items of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to list items")
+	}
+	items := make([]*pb.ItemInfo, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, &pb.ItemInfo{
+			Title:      row.Title,
+			Owner:      row.Username,
+			Type:       pb.ItemType(row.DataType),
+			Version:    row.Version,
+			Collection: row.Collection,
+		})
+	}
+	return &pb.ListItemsResponse{Items: items}, nil
 }
@@ -1,34 +1,53 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"keeper/internal/mocks"
 	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
 	pb "keeper/proto"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestGetUserTitles(t *testing.T) {
 	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
 	server := &server{
 		provider: mockProvider,
+		keyring:  keyring,
+		ctx:      context.Background(),
 	}
 
 	username := "testuser"
-	dataTitles := make(map[string]string)
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := server.keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+
+	// encryptedRow возвращает запись с названием, зашифрованным ключом пользователя
+	encryptedRow := func(id int64, title string) storage.DataRow {
+		index := service.TitleIndex(dataKey, title)
+		titleCipher, _ := service.EncryptRecord(title, dataKey, 1, service.TitleAAD(username, index))
+		return storage.DataRow{ID: id, Username: username, TitleIndex: index, TitleCipher: titleCipher}
+	}
+	dataTitles := make(map[string]storage.DataRow)
 	client := &client{
 		ch:    make(chan *pb.CommandMessage, 1),
 		state: service.CONNECTED,
 	}
 
 	t.Run("no saved data", func(t *testing.T) {
-		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return([]string{}, nil)
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return([]storage.DataRow{}, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return(nil, nil)
 
-		message, err := server.getUserTitles(username, client, dataTitles)
+		message, err := server.getUserTitles(username, client, "получить", dataTitles)
 		assert.Error(t, err)
 		assert.Equal(t, ErrTitlesNotFound, err)
 		assert.Equal(t, "", message)
@@ -39,9 +58,18 @@ func TestGetUserTitles(t *testing.T) {
 
 	t.Run("titles available", func(t *testing.T) {
 		titles := []string{"Title 1", "Title 2", "Title 3"}
-		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return(titles, nil)
+		rows := []storage.DataRow{
+			encryptedRow(1, "Title 1"),
+			encryptedRow(2, "Title 2"),
+			// название записи, сохраненной до шифрования названий
+			{ID: 3, Username: username, TitleIndex: "Title 3"},
+		}
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return(rows, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
 
-		message, err := server.getUserTitles(username, client, dataTitles)
+		message, err := server.getUserTitles(username, client, "получить", dataTitles)
 		assert.NoError(t, err)
 		assert.NotEqual(t, "", message)
 		assert.Equal(t, service.CONNECTED, client.state) // state should not change in this case
@@ -51,7 +79,7 @@ func TestGetUserTitles(t *testing.T) {
 
 		for i, title := range titles {
 			key := fmt.Sprintf("%d", i+1)
-			assert.Equal(t, title, dataTitles[key])
+			assert.Equal(t, title, dataTitles[key].Title)
 		}
 
 		mockProvider.AssertExpectations(t)
@@ -61,7 +89,7 @@ func TestGetUserTitles(t *testing.T) {
 	t.Run("provider error", func(t *testing.T) {
 		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return(nil, fmt.Errorf("provider error"))
 
-		message, err := server.getUserTitles(username, client, dataTitles)
+		message, err := server.getUserTitles(username, client, "получить", dataTitles)
 		assert.Error(t, err)
 		assert.Equal(t, "", message)
 		assert.Equal(t, service.CONNECTED, client.state) // state should not change in this case
@@ -69,4 +97,124 @@ func TestGetUserTitles(t *testing.T) {
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
 	})
+
+	t.Run("title moved from another record", func(t *testing.T) {
+		row := encryptedRow(1, "Title 1")
+		// шифртекст названия скопирован к записи с другим индексом
+		row.TitleIndex = encryptedRow(2, "Title 2").TitleIndex
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return([]storage.DataRow{row}, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+
+		message, err := server.getUserTitles(username, client, "получить", make(map[string]storage.DataRow))
+		assert.Error(t, err)
+		assert.Equal(t, "", message)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("shared items listed after own", func(t *testing.T) {
+		ownerKey, _ := service.GenerateDataKey()
+		ownerWrapped, _ := server.keyring.Wrap(ownerKey)
+		index := service.TitleIndex(ownerKey, "wifi")
+		titleCipher, _ := service.EncryptRecord("wifi", ownerKey, 1, service.TitleAAD("alice", index))
+		shared := storage.DataRow{ID: 9, Username: "alice", TitleIndex: index, TitleCipher: titleCipher}
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return([]storage.DataRow{encryptedRow(1, "Title 1")}, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return([]storage.DataRow{shared}, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(storage.UserKey{Version: 1, WrappedKey: ownerWrapped}, nil)
+
+		titles := make(map[string]storage.DataRow)
+		message, err := server.getUserTitles(username, client, "получить", titles)
+		assert.NoError(t, err)
+		assert.Equal(t, "\nЧто хотите получить:\n1) Title 1\n2) wifi (от alice)\n", message)
+		assert.Equal(t, int64(9), titles["2"].ID)
+		assert.Equal(t, "alice", titles["2"].Username)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("shared items only", func(t *testing.T) {
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return([]storage.DataRow{{ID: 9, Username: "alice", TitleIndex: "wifi"}}, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return(nil, nil)
+
+		message, err := server.getUserTitles(username, client, "получить", make(map[string]storage.DataRow))
+		assert.NoError(t, err)
+		assert.Equal(t, "\nЧто хотите получить:\n1) wifi (от alice)\n", message)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team items listed with collection", func(t *testing.T) {
+		orgKey, _ := service.GenerateDataKey()
+		wrappedOrgKey, _ := service.EncryptRecord(orgKey, dataKey, 1, service.OrgKeyAAD("acme", username))
+		index := service.TitleIndex(orgKey, "vpn")
+		titleCipher, _ := service.EncryptRecord("vpn", orgKey, 1, service.CollectionTitleAAD(5, index))
+		team := storage.DataRow{ID: 11, Username: "alice", TitleIndex: index, TitleCipher: titleCipher, OrgID: 2, CollectionID: 5, Collection: "acme/devops"}
+		member := storage.OrgMember{OrgID: 2, OrgName: "acme", Username: username, Role: service.ORG_READ_ONLY, WrappedKey: wrappedOrgKey}
+		mockProvider.On("GetTitlesByUser", mock.Anything, username).Return([]storage.DataRow{encryptedRow(1, "Title 1")}, nil)
+		mockProvider.On("GetSharedTitles", mock.Anything, username).Return(nil, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return([]storage.DataRow{team}, nil)
+		mockProvider.On("ListMemberships", mock.Anything, username).Return([]storage.OrgMember{member}, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(userKey, nil)
+
+		titles := make(map[string]storage.DataRow)
+		message, err := server.getUserTitles(username, client, "получить", titles)
+		assert.NoError(t, err)
+		assert.Equal(t, "\nЧто хотите получить:\n1) Title 1\n2) vpn (acme/devops)\n", message)
+		assert.Equal(t, int64(5), titles["2"].CollectionID)
+		assert.Equal(t, "vpn", titles["2"].Title)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestListItems(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := server.keyring.Wrap(dataKey)
+	index := service.TitleIndex(dataKey, "wifi")
+	titleCipher, _ := service.EncryptRecord("wifi", dataKey, 1, service.TitleAAD("bob", index))
+	ctx := withIdentity(context.Background(), identity{Username: "bob", SessionID: "session-id"})
+
+	t.Run("own and shared items", func(t *testing.T) {
+		mockProvider.On("GetUserKey", mock.Anything, "bob", 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+		mockProvider.On("GetTitlesByUser", mock.Anything, "bob").Return([]storage.DataRow{
+			{ID: 1, Username: "bob", TitleIndex: index, TitleCipher: titleCipher, DataType: service.PASSWORD, Version: 3},
+		}, nil)
+		// название записи, сохраненной до шифрования названий
+		mockProvider.On("GetSharedTitles", mock.Anything, "bob").Return([]storage.DataRow{
+			{ID: 2, Username: "alice", TitleIndex: "bank", DataType: service.CARD, Version: 1},
+		}, nil)
+		mockProvider.On("GetTeamTitles", mock.Anything, "bob").Return(nil, nil)
+
+		resp, err := server.ListItems(ctx, &pb.ListItemsRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, []*pb.ItemInfo{
+			{Title: "wifi", Owner: "bob", Type: pb.ItemType_ITEM_TYPE_LOGIN, Version: 3},
+			{Title: "bank", Owner: "alice", Type: pb.ItemType_ITEM_TYPE_CARD, Version: 1},
+		}, resp.Items)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := server.ListItems(context.Background(), &pb.ListItemsRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
 }
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrCreateFormat описывает данные записи, которые не подходят к ее типу.
+	ErrCreateFormat = errors.New("incorrect data format")
+	// ErrCardNumber описывает номер карты не из 12-19 цифр.
+	ErrCardNumber = fmt.Errorf("%w: card number must contain 12 to 19 digits", ErrCreateFormat)
+	// ErrCardExpiration описывает срок действия карты не в формате MM/YY.
+	ErrCardExpiration = fmt.Errorf("%w: card expiration date must be MM/YY", ErrCreateFormat)
+	// ErrCardCVV описывает cvv не из 3-4 цифр.
+	ErrCardCVV = fmt.Errorf("%w: card cvv must contain 3 or 4 digits", ErrCreateFormat)
+)
+
+// itemFormatMessages сообщения клиенту об ошибках в данных карты
+var itemFormatMessages = map[error]string{
+	ErrCardNumber:     "\nНомер карты должен содержать от 12 до 19 цифр.",
+	ErrCardExpiration: "\nСрок действия карты нужно указать в формате MM/YY.",
+	ErrCardCVV:        "\ncvv карты должен содержать 3 или 4 цифры.",
+}
+
+// itemFormatMessage возвращает сообщение клиенту об ошибке в данных записи
+func itemFormatMessage(err error) string {
+	if message, ok := itemFormatMessages[err]; ok {
+		return message
+	}
+	return "\nНе верный формат данных."
+}
+
+var (
+	cardNumberPattern     = regexp.MustCompile(`^[0-9]{12,19}$`)
+	cardExpirationPattern = regexp.MustCompile(`^(0[1-9]|1[0-2])/[0-9]{2}$`)
+	cardCVVPattern        = regexp.MustCompile(`^[0-9]{3,4}$`)
+)
+
+// itemTemplate возвращает пустую запись типа dataType, по которой клиент запрашивает поля у пользователя
+func itemTemplate(dataType service.DataType) *pb.Item {
+	switch dataType {
+	case service.PASSWORD:
+		return &pb.Item{Payload: &pb.Item_Login{Login: &pb.LoginItem{}}}
+	case service.TEXT:
+		return &pb.Item{Payload: &pb.Item_Text{Text: &pb.TextItem{}}}
+	case service.CARD:
+		return &pb.Item{Payload: &pb.Item_Card{Card: &pb.CardItem{}}}
+	default:
+		return &pb.Item{Payload: &pb.Item_Binary{Binary: &pb.BinaryItem{}}}
+	}
+}
+
+// itemPrompt запрашивает у клиента данные записи типа dataType. Если sealed, клиент шифрует их сам.
+func itemPrompt(message string, dataType service.DataType, sealed bool) *pb.CommandMessage {
+	return &pb.CommandMessage{Message: message, ItemTemplate: itemTemplate(dataType), PayloadPrompt: sealed}
+}
+
+// itemDataType возвращает тип записи по ее данным. Для данных, зашифрованных на клиенте, тип неизвестен.
+func itemDataType(item *pb.Item) (service.DataType, bool) {
+	switch item.GetPayload().(type) {
+	case *pb.Item_Login:
+		return service.PASSWORD, true
+	case *pb.Item_Text:
+		return service.TEXT, true
+	case *pb.Item_Card:
+		return service.CARD, true
+	case *pb.Item_Binary:
+		return service.BYTE, true
+	default:
+		return 0, false
+	}
+}
+
+// validateItem проверяет, что у записи есть название, а ее данные подходят к типу dataType
+func validateItem(item *pb.Item, dataType service.DataType) error {
+	if item.GetTitle() == "" {
+		return ErrCreateFormat
+	}
+	itemType, ok := itemDataType(item)
+	if !ok || itemType != dataType {
+		return ErrCreateFormat
+	}
+
+	card := item.GetCard()
+	if card == nil {
+		return nil
+	}
+	if !cardNumberPattern.MatchString(strings.ReplaceAll(card.Number, " ", "")) {
+		return ErrCardNumber
+	}
+	if !cardExpirationPattern.MatchString(card.ExpirationDate) {
+		return ErrCardExpiration
+	}
+	if !cardCVVPattern.MatchString(card.Cvv) {
+		return ErrCardCVV
+	}
+	return nil
+}
+
+// encodeItem проверяет запись и сериализует ее данные без названия: название хранится отдельно
+func encodeItem(item *pb.Item, dataType service.DataType) (string, error) {
+	if err := validateItem(item, dataType); err != nil {
+		return "", err
+	}
+	data, err := proto.Marshal(&pb.Item{Payload: item.Payload})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Error marshalling item: %v", err)
+		return "", err
+	}
+	return string(data), nil
+}
+
+// sealedPayload возвращает данные записи, зашифрованные на клиенте
+func sealedPayload(item *pb.Item) (string, error) {
+	sealed, ok := item.GetPayload().(*pb.Item_Sealed)
+	if !ok {
+		return "", ErrNotSealed
+	}
+	if item.Title == "" || !service.IsSealed(sealed.Sealed) {
+		return "", ErrCreateFormat
+	}
+	return sealed.Sealed, nil
+}
+
+// decodeItem восстанавливает запись из расшифрованных данных. Записи, сохраненные до перехода
+// на protobuf, хранятся в JSON, их вид определяется набором полей.
+func decodeItem(title string, dataType service.DataType, plainText string) (*pb.Item, error) {
+	if !strings.HasPrefix(plainText, "{") {
+		item := &pb.Item{}
+		if err := proto.Unmarshal([]byte(plainText), item); err != nil {
+			logger.Log.Sugar().Errorf("Error unmarshalling item: %v", err)
+			return nil, err
+		}
+		if itemType, ok := itemDataType(item); !ok || itemType != dataType {
+			logger.Log.Sugar().Errorf("Item data does not match data type %d", dataType)
+			return nil, ErrCreateFormat
+		}
+		item.Title = title
+		return item, nil
+	}
+
+	dataMap := make(map[string]string)
+	if err := json.Unmarshal([]byte(plainText), &dataMap); err != nil {
+		logger.Log.Sugar().Errorf("Error unmarshalling JSON: %v", err)
+		return nil, err
+	}
+
+	// до исправления типа записи все записи сохранялись с типом PASSWORD, поэтому тип JSON-записи
+	// определяется по ее полям, а не по dataType
+	has := func(key string) bool {
+		_, ok := dataMap[key]
+		return ok
+	}
+	item := &pb.Item{Title: title}
+	switch {
+	case has("card_num"):
+		item.Payload = &pb.Item_Card{Card: &pb.CardItem{
+			Number:         dataMap["card_num"],
+			ExpirationDate: dataMap["expiration_date"],
+			Owner:          dataMap["owner"],
+			Cvv:            dataMap["cvv"],
+			Meta:           dataMap["meta"],
+		}}
+	case has("text"):
+		item.Payload = &pb.Item_Text{Text: &pb.TextItem{Text: dataMap["text"], Meta: dataMap["meta"]}}
+	case has("bytes"):
+		item.Payload = &pb.Item_Binary{Binary: &pb.BinaryItem{Data: []byte(dataMap["bytes"]), Meta: dataMap["meta"]}}
+	default:
+		item.Payload = &pb.Item_Login{Login: &pb.LoginItem{Login: dataMap["login"], Password: dataMap["password"], Meta: dataMap["meta"]}}
+	}
+	return item, nil
+}
+
+// itemStatus преобразует ошибку чтения или создания записи в ответ клиенту
+func itemStatus(username string, err error) error {
+	switch {
+	case errors.Is(err, sqlite.ErrDataNotFound):
+		return status.Error(codes.NotFound, "item not found")
+	case errors.Is(err, ErrCreateFormat):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotSealed):
+		return status.Error(codes.InvalidArgument, "data must be sealed by client")
+	case errors.Is(err, sqlite.ErrCreateData):
+		return status.Error(codes.AlreadyExists, "item with this title already exists")
+	default:
+		logger.Log.Sugar().Errorf("Item operation of %s failed: %v", username, err)
+		return status.Error(codes.Internal, "item operation failed")
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"testing"
+
+	"keeper/internal/server/service"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDecodeItem(t *testing.T) {
+	t.Run("stored item", func(t *testing.T) {
+		item := &pb.Item{Title: "bank", Payload: &pb.Item_Binary{Binary: &pb.BinaryItem{Data: []byte{0, 0xff, ':', ':'}, Meta: "key"}}}
+		plainText, err := encodeItem(item, service.BYTE)
+		assert.NoError(t, err)
+
+		decoded, err := decodeItem("bank", service.BYTE, plainText)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(item, decoded))
+	})
+
+	t.Run("legacy json", func(t *testing.T) {
+		// до исправления типа записи все записи сохранялись с типом PASSWORD
+		legacy := []struct {
+			plainText string
+			item      *pb.Item
+		}{
+			{`{"login":"admin","password":"secret","meta":"vpn"}`,
+				&pb.Item{Title: "t", Payload: &pb.Item_Login{Login: &pb.LoginItem{Login: "admin", Password: "secret", Meta: "vpn"}}}},
+			{`{"text":"note","meta":""}`,
+				&pb.Item{Title: "t", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "note"}}}},
+			{`{"bytes":"raw","meta":"m"}`,
+				&pb.Item{Title: "t", Payload: &pb.Item_Binary{Binary: &pb.BinaryItem{Data: []byte("raw"), Meta: "m"}}}},
+			{`{"card_num":"4111","expiration_date":"12/29","owner":"IVAN","cvv":"123","meta":""}`,
+				&pb.Item{Title: "t", Payload: &pb.Item_Card{Card: &pb.CardItem{Number: "4111", ExpirationDate: "12/29", Owner: "IVAN", Cvv: "123"}}}},
+		}
+		for _, tt := range legacy {
+			decoded, err := decodeItem("t", service.PASSWORD, tt.plainText)
+			assert.NoError(t, err)
+			assert.True(t, proto.Equal(tt.item, decoded), tt.plainText)
+		}
+	})
+
+	t.Run("data of another type", func(t *testing.T) {
+		plainText, _ := encodeItem(&pb.Item{Title: "t", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "note"}}}, service.TEXT)
+
+		_, err := decodeItem("t", service.PASSWORD, plainText)
+		assert.Equal(t, ErrCreateFormat, err)
+	})
+}
@@ -0,0 +1,242 @@
+package app
+
+import (
+	"errors"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+)
+
+// первая версия ключа пользователя
+const firstKeyVersion = 1
+
+// titleBatchSize количество записей, названия которых шифруются за одну транзакцию
+const titleBatchSize = 500
+
+// currentUserKey возвращает текущий ключ пользователя в расшифрованном виде.
+// Если ключа еще нет, создает его и сохраняет зашифрованным мастер-ключом.
+func (s *server) currentUserKey(username string) (int, string, error) {
+	key, err := s.provider.GetLatestUserKey(s.ctx, username)
+	if errors.Is(err, sqlite.ErrKeyNotFound) {
+		key, err = s.createUserKey(username)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	dataKey, err := s.keyring.Unwrap(key.WrappedKey)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to unwrap key of %s: %v", username, err)
+		return 0, "", err
+	}
+	return key.Version, dataKey, nil
+}
+
+// createUserKey генерирует ключ пользователя и сохраняет его зашифрованным мастер-ключом
+func (s *server) createUserKey(username string) (storage.UserKey, error) {
+	dataKey, err := service.GenerateDataKey()
+	if err != nil {
+		return storage.UserKey{}, err
+	}
+
+	wrappedKey, err := s.keyring.Wrap(dataKey)
+	if err != nil {
+		return storage.UserKey{}, err
+	}
+
+	key := storage.UserKey{Version: firstKeyVersion, WrappedKey: wrappedKey}
+	err = s.provider.CreateUserKey(s.ctx, username, key)
+	if errors.Is(err, sqlite.ErrConflict) {
+		// ключ уже создан параллельной сессией
+		return s.provider.GetLatestUserKey(s.ctx, username)
+	}
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to create key for %s: %v", username, err)
+		return storage.UserKey{}, err
+	}
+	return key, nil
+}
+
+// ErrUnboundData описывает запись без привязки к владельцу в строгом режиме.
+var ErrUnboundData = errors.New("record is not bound to owner")
+
+// recordAAD возвращает дополнительные данные, к которым привязан шифртекст записи
+func recordAAD(row storage.DataRow) []byte {
+	return service.RecordAAD(row.Username, row.ID, row.DataType, row.Title)
+}
+
+// encryptRecord шифрует данные текущим ключом пользователя и привязывает их к записи
+func (s *server) encryptRecord(row storage.DataRow, plainText string) (string, error) {
+	return s.sealForUser(row.Username, plainText, recordAAD(row))
+}
+
+// sealForUser шифрует данные текущим ключом пользователя с дополнительными данными
+func (s *server) sealForUser(username string, plainText string, additionalData []byte) (string, error) {
+	version, dataKey, err := s.currentUserKey(username)
+	if err != nil {
+		return "", err
+	}
+	return service.EncryptRecord(plainText, dataKey, version, additionalData)
+}
+
+// openForUser расшифровывает данные, зашифрованные sealForUser
+func (s *server) openForUser(username string, cipherText string, additionalData []byte) (string, error) {
+	header, body, err := service.ParseHeader(cipherText)
+	if err != nil {
+		return "", err
+	}
+	if !header.Bound {
+		return "", ErrUnboundData
+	}
+
+	dataKey, err := s.userDataKey(username, header.Version)
+	if err != nil {
+		return "", err
+	}
+	return service.DecryptWithAAD(body, dataKey, additionalData)
+}
+
+// userDataKey возвращает расшифрованный ключ пользователя заданной версии
+func (s *server) userDataKey(username string, version int) (string, error) {
+	key, err := s.provider.GetUserKey(s.ctx, username, version)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := s.keyring.Unwrap(key.WrappedKey)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to unwrap key of %s: %v", username, err)
+		return "", err
+	}
+	return dataKey, nil
+}
+
+// decryptRecord расшифровывает запись ключом пользователя из заголовка.
+// Общие записи расшифровываются ключом записи, выданным владельцу.
+// Данные без заголовка записаны до появления ключей пользователей и зашифрованы одним из мастер-ключей.
+// bound равен false для записей, зашифрованных без дополнительных данных.
+func (s *server) decryptRecord(row storage.DataRow) (plainText string, bound bool, err error) {
+	header, body, err := service.ParseHeader(row.Data)
+	if err != nil {
+		return "", false, err
+	}
+	if header.Version == 0 {
+		plainText, err = s.keyring.Unwrap(body)
+		return plainText, false, err
+	}
+	if header.Shared {
+		// общая запись зашифрована ключом записи, копия ключа для владельца лежит в самой записи
+		itemKey, err := s.openItemKey(row.ID, row.Username, row.ItemKey, header.Version)
+		if err != nil {
+			return "", false, err
+		}
+		plainText, err = service.DecryptWithAAD(body, itemKey, recordAAD(row))
+		return plainText, true, err
+	}
+
+	dataKey, err := s.userDataKey(row.Username, header.Version)
+	if err != nil {
+		return "", false, err
+	}
+
+	var additionalData []byte
+	if header.Bound {
+		additionalData = recordAAD(row)
+	}
+	plainText, err = service.DecryptWithAAD(body, dataKey, additionalData)
+	return plainText, header.Bound, err
+}
+
+// bindRecord перешифровывает запись, сохраненную без дополнительных данных, с привязкой к владельцу
+func (s *server) bindRecord(row storage.DataRow, plainText string) error {
+	cipherText, err := s.encryptRecord(row, plainText)
+	if err != nil {
+		return err
+	}
+	return s.provider.ReplaceData(s.ctx, storage.CipherUpdate{ID: row.ID, Old: row.Data, New: cipherText})
+}
+
+// titleKey возвращает ключ пользователя первой версии, из которого выводится ключ слепого индекса названий.
+// Первая версия не меняется при ротации, поэтому индексы не нужно пересчитывать.
+func (s *server) titleKey(username string) (string, error) {
+	dataKey, err := s.userDataKey(username, firstKeyVersion)
+	if !errors.Is(err, sqlite.ErrKeyNotFound) {
+		return dataKey, err
+	}
+
+	key, err := s.createUserKey(username)
+	if err != nil {
+		return "", err
+	}
+	return s.keyring.Unwrap(key.WrappedKey)
+}
+
+// titleIndex вычисляет слепой индекс названия записи пользователя
+func (s *server) titleIndex(username string, title string) (string, error) {
+	dataKey, err := s.titleKey(username)
+	if err != nil {
+		return "", err
+	}
+	return service.TitleIndex(dataKey, title), nil
+}
+
+// newDataRow готовит новую запись: вычисляет слепой индекс и шифрует название
+func (s *server) newDataRow(username string, title string, dataType service.DataType) (storage.DataRow, error) {
+	index, err := s.titleIndex(username, title)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+	titleCipher, err := s.sealForUser(username, title, service.TitleAAD(username, index))
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+	return storage.DataRow{
+		Username:    username,
+		Title:       title,
+		TitleIndex:  index,
+		TitleCipher: titleCipher,
+		DataType:    dataType,
+	}, nil
+}
+
+// openTitle расшифровывает название записи.
+// У записей, сохраненных до шифрования названий, открытое название лежит в слепом индексе.
+func (s *server) openTitle(row storage.DataRow) (string, error) {
+	if row.TitleCipher == "" {
+		return row.TitleIndex, nil
+	}
+	return s.openForUser(row.Username, row.TitleCipher, service.TitleAAD(row.Username, row.TitleIndex))
+}
+
+// encryptPlainTitles шифрует названия записей, сохраненных до шифрования названий,
+// и заменяет открытые названия слепыми индексами
+func (s *server) encryptPlainTitles() error {
+	var afterID int64
+	for {
+		rows, err := s.provider.GetPlainTitlesAfter(s.ctx, afterID, titleBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for i, row := range rows {
+			encrypted, err := s.newDataRow(row.Username, row.TitleIndex, row.DataType)
+			if err != nil {
+				logger.Log.Sugar().Errorf("Failed to encrypt title of record %d: %v", row.ID, err)
+				return err
+			}
+			encrypted.ID = row.ID
+			rows[i] = encrypted
+		}
+
+		if err := s.provider.SaveEncryptedTitles(s.ctx, rows); err != nil {
+			return err
+		}
+		logger.Log.Sugar().Infof("Encrypted titles of %d records", len(rows))
+		afterID = rows[len(rows)-1].ID
+	}
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCurrentUserKey(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{Secret: "thisis32byteencryptionkey1234567"},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+
+	t.Run("existing key", func(t *testing.T) {
+		dataKey, _ := service.GenerateDataKey()
+		wrappedKey, _ := server.keyring.Wrap(dataKey)
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(storage.UserKey{Version: 3, WrappedKey: wrappedKey}, nil)
+
+		version, key, err := server.currentUserKey(username)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, version)
+		assert.Equal(t, dataKey, key)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("key created on first use", func(t *testing.T) {
+		var created storage.UserKey
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(storage.UserKey{}, sqlite.ErrKeyNotFound)
+		mockProvider.On("CreateUserKey", mock.Anything, username, mock.MatchedBy(func(key storage.UserKey) bool {
+			created = key
+			return key.Version == firstKeyVersion
+		})).Return(nil)
+
+		version, key, err := server.currentUserKey(username)
+		assert.NoError(t, err)
+		assert.Equal(t, firstKeyVersion, version)
+
+		// ключ сохранен зашифрованным мастер-ключом
+		unwrapped, err := server.keyring.Unwrap(created.WrappedKey)
+		assert.NoError(t, err)
+		assert.Equal(t, key, unwrapped)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestDecryptRecord(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{Secret: "thisis32byteencryptionkey1234567"},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	row := storage.DataRow{ID: 1, Username: username, Title: "title", DataType: service.TEXT}
+
+	t.Run("legacy data encrypted with master key", func(t *testing.T) {
+		row.Data, _ = service.Encrypt("secret", server.cfg.Secret)
+
+		plainText, bound, err := server.decryptRecord(row)
+		assert.NoError(t, err)
+		assert.False(t, bound)
+		assert.Equal(t, "secret", plainText)
+	})
+
+	t.Run("data encrypted with another user's key", func(t *testing.T) {
+		ownKey, _ := service.GenerateDataKey()
+		otherKey, _ := service.GenerateDataKey()
+		wrappedKey, _ := server.keyring.Wrap(ownKey)
+		row.Data, _ = service.EncryptRecord("secret", otherKey, 1, recordAAD(row))
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+
+		_, _, err := server.decryptRecord(row)
+		assert.Error(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("relabelled record", func(t *testing.T) {
+		dataKey, _ := service.GenerateDataKey()
+		wrappedKey, _ := server.keyring.Wrap(dataKey)
+		row.Data, _ = service.EncryptRecord("secret", dataKey, 1, recordAAD(row))
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+
+		plainText, bound, err := server.decryptRecord(row)
+		assert.NoError(t, err)
+		assert.True(t, bound)
+		assert.Equal(t, "secret", plainText)
+
+		// тип записи изменен в БД
+		relabelled := row
+		relabelled.DataType = service.CARD
+		_, _, err = server.decryptRecord(relabelled)
+		assert.Error(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestTitleIndex(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+
+	t.Run("index of first key version", func(t *testing.T) {
+		dataKey, _ := service.GenerateDataKey()
+		wrappedKey, _ := server.keyring.Wrap(dataKey)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+
+		index, err := server.titleIndex(username, "mail")
+		assert.NoError(t, err)
+		assert.Equal(t, service.TitleIndex(dataKey, "mail"), index)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("key created for new user", func(t *testing.T) {
+		var created storage.UserKey
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{}, sqlite.ErrKeyNotFound)
+		mockProvider.On("CreateUserKey", mock.Anything, username, mock.MatchedBy(func(key storage.UserKey) bool {
+			created = key
+			return key.Version == 1
+		})).Return(nil)
+
+		index, err := server.titleIndex(username, "mail")
+		assert.NoError(t, err)
+		dataKey, _ := server.keyring.Unwrap(created.WrappedKey)
+		assert.Equal(t, service.TitleIndex(dataKey, "mail"), index)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestEncryptPlainTitles(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := server.keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+
+	// у записей, сохраненных до шифрования названий, открытое название лежит в TitleIndex
+	mockProvider.On("GetPlainTitlesAfter", mock.Anything, int64(0), titleBatchSize).
+		Return([]storage.DataRow{{ID: 4, Username: "testuser", TitleIndex: "bank", DataType: service.PASSWORD}}, nil)
+	mockProvider.On("GetPlainTitlesAfter", mock.Anything, int64(4), titleBatchSize).Return(nil, nil)
+	mockProvider.On("GetUserKey", mock.Anything, "testuser", 1).Return(userKey, nil)
+	mockProvider.On("GetLatestUserKey", mock.Anything, "testuser").Return(userKey, nil)
+	var saved []storage.DataRow
+	mockProvider.On("SaveEncryptedTitles", mock.Anything, mock.MatchedBy(func(rows []storage.DataRow) bool {
+		saved = rows
+		return len(rows) == 1
+	})).Return(nil)
+
+	err := server.encryptPlainTitles()
+	assert.NoError(t, err)
+
+	// открытое название заменено слепым индексом и шифртекстом
+	assert.Equal(t, int64(4), saved[0].ID)
+	assert.Equal(t, service.TitleIndex(dataKey, "bank"), saved[0].TitleIndex)
+	title, err := server.openTitle(saved[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "bank", title)
+
+	mockProvider.AssertExpectations(t)
+}
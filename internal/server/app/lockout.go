@@ -0,0 +1,186 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// префиксы ключей, по которым считаются неудачные попытки входа
+const (
+	userAttemptPrefix = "user:"
+	peerAttemptPrefix = "ip:"
+)
+
+// ErrUnlockTargets описывает вызов unlock без пользователей и адресов.
+var ErrUnlockTargets = errors.New("unlock requires usernames or ip:address arguments")
+
+// loginFailureWindow время без ошибок, после которого счетчик попыток начинается заново
+const loginFailureWindow = 24 * time.Hour
+
+// userAttemptKey возвращает ключ счетчика попыток входа в аккаунт
+func userAttemptKey(username string) string {
+	return userAttemptPrefix + username
+}
+
+// peerIP возвращает адрес клиента без порта. Если адрес неизвестен, возвращается пустая строка.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// peerAttemptKey возвращает ключ счетчика попыток входа с адреса клиента.
+// Если адрес неизвестен, возвращается пустая строка.
+func peerAttemptKey(ctx context.Context) string {
+	ip := peerIP(ctx)
+	if ip == "" {
+		return ""
+	}
+	return peerAttemptPrefix + ip
+}
+
+// attemptKeys возвращает ключи счетчиков для имени пользователя и адреса клиента
+func attemptKeys(ctx context.Context, username string) []string {
+	var keys []string
+	if username != "" {
+		keys = append(keys, userAttemptKey(username))
+	}
+	if key := peerAttemptKey(ctx); key != "" {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// checkLockout возвращает ResourceExhausted с RetryInfo, если вход по одному из ключей заблокирован
+func (s *server) checkLockout(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	attempts, err := s.provider.GetLoginAttempts(ctx, keys)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get login attempts: %v", err)
+		return status.Error(codes.Internal, "failed to check login attempts")
+	}
+
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, attempt := range attempts {
+		if wait := attempt.LockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return lockoutError(retryAfter)
+	}
+	return nil
+}
+
+// lockoutError описывает блокировку входа. Время ожидания передается в RetryInfo,
+// чтобы клиент мог повторить запрос без разбора текста ошибки.
+func lockoutError(retryAfter time.Duration) error {
+	// округляем вверх, чтобы клиент не пришел за секунду до снятия блокировки
+	retryAfter = (retryAfter + time.Second - 1).Truncate(time.Second)
+
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("too many failed attempts, retry after %v", retryAfter))
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// recordLoginFailure увеличивает счетчики ошибок входа и при превышении лимита блокирует вход.
+// Ошибки хранилища только логируются, чтобы не подменять ими ответ на неудачный вход.
+func (s *server) recordLoginFailure(keys []string) {
+	now := time.Now()
+	for _, key := range keys {
+		limit := s.cfg.LoginMaxFailures
+		if strings.HasPrefix(key, peerAttemptPrefix) {
+			limit = s.cfg.LoginMaxIPFailures
+		}
+
+		attempt, err := s.provider.RecordLoginFailure(s.ctx, key, s.nextAttempt(limit, now))
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to record login failure for %s: %v", key, err)
+			continue
+		}
+		if attempt.LockedUntil.After(now) {
+			logger.Log.Sugar().Warnf("Login for %s locked until %v after %d failures", key, attempt.LockedUntil.Format(time.RFC3339), attempt.Failures)
+		}
+	}
+}
+
+// nextAttempt возвращает правило блокировки: после limit ошибок вход блокируется,
+// каждая следующая ошибка удваивает блокировку. Нулевой limit отключает блокировку.
+func (s *server) nextAttempt(limit int, now time.Time) storage.LockoutFunc {
+	return func(attempt storage.LoginAttempt) storage.LoginAttempt {
+		if now.Sub(attempt.UpdatedAt) > loginFailureWindow {
+			attempt.Failures = 0
+		}
+		attempt.Failures++
+		attempt.UpdatedAt = now
+
+		if limit > 0 && attempt.Failures >= limit {
+			lockout := service.LockoutDuration(s.cfg.LoginBackoff, s.cfg.LoginMaxLockout, attempt.Failures-limit)
+			attempt.LockedUntil = now.Add(lockout)
+		}
+		return attempt
+	}
+}
+
+// resetLoginFailures сбрасывает счетчик ошибок аккаунта после успешного входа.
+// Счетчик адреса не сбрасывается, иначе вход в свой аккаунт позволил бы подбирать чужие пароли.
+func (s *server) resetLoginFailures(username string) {
+	if _, err := s.provider.DeleteLoginAttempts(s.ctx, []string{userAttemptKey(username)}); err != nil {
+		logger.Log.Sugar().Errorf("Failed to reset login failures for %s: %v", username, err)
+	}
+}
+
+// isAuthFailure сообщает, что запрос отклонен из-за неверных учетных данных
+func isAuthFailure(err error) bool {
+	return status.Code(err) == codes.Unauthenticated
+}
+
+// Unlock снимает блокировку входа. Аргумент вида ip:адрес снимает блокировку адреса,
+// остальные аргументы считаются именами пользователей.
+func (s *server) Unlock(targets []string) error {
+	keys := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if strings.HasPrefix(target, peerAttemptPrefix) || strings.HasPrefix(target, userAttemptPrefix) {
+			keys = append(keys, target)
+			continue
+		}
+		keys = append(keys, userAttemptKey(target))
+	}
+	if len(keys) == 0 {
+		return ErrUnlockTargets
+	}
+
+	removed, err := s.provider.DeleteLoginAttempts(s.ctx, keys)
+	if err != nil {
+		return err
+	}
+	logger.Log.Sugar().Infof("Login attempts cleared for %v, %d records removed", keys, removed)
+	return nil
+}
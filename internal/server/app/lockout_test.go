@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// withPeerAddr возвращает контекст соединения клиента с указанным адресом
+func withPeerAddr(ctx context.Context, addr string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return peer.NewContext(ctx, &peer.Peer{Addr: tcpAddr})
+}
+
+func TestLoginLockout(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		cfg: &config.Config{
+			SessionTTL:         time.Hour,
+			LoginMaxFailures:   5,
+			LoginMaxIPFailures: 20,
+			LoginBackoff:       30 * time.Second,
+			LoginMaxLockout:    15 * time.Minute,
+		},
+		ctx: context.Background(),
+	}
+
+	ctx := withPeerAddr(context.Background(), "10.0.0.1:51000")
+	keys := []string{"user:alice", "ip:10.0.0.1"}
+	passwordHash, _ := service.HashPassword("password")
+
+	t.Run("locked account", func(t *testing.T) {
+		mockProvider.On("GetLoginAttempts", mock.Anything, keys).
+			Return([]storage.LoginAttempt{{Key: "user:alice", Failures: 6, LockedUntil: time.Now().Add(time.Minute)}}, nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: "alice", Password: "password"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.ResourceExhausted, st.Code())
+
+		// клиент получает время ожидания в RetryInfo
+		assert.Len(t, st.Details(), 1)
+		retry, ok := st.Details()[0].(*errdetails.RetryInfo)
+		assert.True(t, ok)
+		assert.Equal(t, time.Minute, retry.RetryDelay.AsDuration())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.AssertNotCalled(t, "GetPasswordHash", mock.Anything, mock.Anything)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("lock expired", func(t *testing.T) {
+		mockProvider.On("GetLoginAttempts", mock.Anything, keys).
+			Return([]storage.LoginAttempt{{Key: "user:alice", Failures: 6, LockedUntil: time.Now().Add(-time.Second)}}, nil)
+		mockProvider.On("GetPasswordHash", mock.Anything, "alice").Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, "alice").Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf("alice"), mock.Anything).Return(nil)
+		mockProvider.On("DeleteLoginAttempts", mock.Anything, []string{"user:alice"}).Return(int64(1), nil)
+		mockProvider.On("AddAuditEvent", mock.Anything, auditEventOf("alice", service.LOGIN_SUCCESS)).Return(nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: "alice", Password: "password"})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("failure counted for account and address", func(t *testing.T) {
+		mockProvider.On("GetLoginAttempts", mock.Anything, keys).Return(nil, nil)
+		mockProvider.On("GetPasswordHash", mock.Anything, "alice").Return(passwordHash, nil)
+		mockProvider.On("RecordLoginFailure", mock.Anything, "user:alice", mock.Anything).Return(storage.LoginAttempt{}, nil)
+		mockProvider.On("RecordLoginFailure", mock.Anything, "ip:10.0.0.1", mock.Anything).Return(storage.LoginAttempt{}, nil)
+		mockProvider.On("AddAuditEvent", mock.Anything, auditEventOf("alice", service.LOGIN_FAILURE)).Return(nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: "alice", Password: "wrong"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("locked address on registration", func(t *testing.T) {
+		mockProvider.On("GetLoginAttempts", mock.Anything, []string{"ip:10.0.0.1"}).
+			Return([]storage.LoginAttempt{{Key: "ip:10.0.0.1", Failures: 20, LockedUntil: time.Now().Add(time.Minute)}}, nil)
+
+		resp, err := server.Register(ctx, &pb.RegisterRequest{Username: "bob", Password: "password"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.ResourceExhausted, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestNextAttempt(t *testing.T) {
+	server := &server{cfg: &config.Config{LoginBackoff: 30 * time.Second, LoginMaxLockout: 15 * time.Minute}}
+	now := time.Now()
+
+	t.Run("below limit", func(t *testing.T) {
+		attempt := server.nextAttempt(5, now)(storage.LoginAttempt{Failures: 3, UpdatedAt: now.Add(-time.Minute)})
+		assert.Equal(t, 4, attempt.Failures)
+		assert.True(t, attempt.LockedUntil.IsZero())
+	})
+
+	t.Run("limit reached", func(t *testing.T) {
+		attempt := server.nextAttempt(5, now)(storage.LoginAttempt{Failures: 4, UpdatedAt: now.Add(-time.Minute)})
+		assert.Equal(t, 5, attempt.Failures)
+		assert.Equal(t, now.Add(30*time.Second), attempt.LockedUntil)
+	})
+
+	t.Run("backoff doubled", func(t *testing.T) {
+		attempt := server.nextAttempt(5, now)(storage.LoginAttempt{Failures: 6, UpdatedAt: now.Add(-time.Minute)})
+		assert.Equal(t, now.Add(2*time.Minute), attempt.LockedUntil)
+	})
+
+	t.Run("old failures forgotten", func(t *testing.T) {
+		attempt := server.nextAttempt(5, now)(storage.LoginAttempt{Failures: 10, UpdatedAt: now.Add(-2 * loginFailureWindow)})
+		assert.Equal(t, 1, attempt.Failures)
+		assert.True(t, attempt.LockedUntil.IsZero())
+	})
+
+	t.Run("lockout disabled", func(t *testing.T) {
+		attempt := server.nextAttempt(0, now)(storage.LoginAttempt{Failures: 100, UpdatedAt: now})
+		assert.True(t, attempt.LockedUntil.IsZero())
+	})
+}
+
+func TestUnlock(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{provider: mockProvider, cfg: &config.Config{}, ctx: context.Background()}
+
+	t.Run("users and addresses", func(t *testing.T) {
+		mockProvider.On("DeleteLoginAttempts", mock.Anything, []string{"user:alice", "ip:10.0.0.1"}).Return(int64(2), nil)
+
+		err := server.Unlock([]string{"alice", "ip:10.0.0.1"})
+		assert.NoError(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("no targets", func(t *testing.T) {
+		err := server.Unlock(nil)
+		assert.ErrorIs(t, err, ErrUnlockTargets)
+	})
+}
@@ -2,6 +2,8 @@ package app
 
 import (
 	"context"
+	"errors"
+	"keeper/internal/logger"
 	"keeper/internal/server/service"
 	pb "keeper/proto"
 
@@ -9,17 +11,105 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Login выполняет вход по паролю. Неудачные попытки считаются по имени пользователя и адресу клиента,
+// после превышения лимита вход временно блокируется.
 func (s *server) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	passwordHash, err := service.GetHashStr(req.Password)
-	if err != nil {
+	keys := attemptKeys(ctx, req.Username)
+	if err := s.checkLockout(ctx, keys); err != nil {
 		return nil, err
 	}
 
-	err = s.provider.ExistUser(s.ctx, req.Username, passwordHash)
+	resp, err := s.passwordLogin(ctx, req)
+	if isAuthFailure(err) {
+		s.recordLoginFailure(keys)
+		s.audit(ctx, req.Username, service.LOGIN_FAILURE, "")
+	}
+	if err == nil && !resp.TotpRequired {
+		s.resetLoginFailures(req.Username)
+	}
+	return resp, err
+}
+
+func (s *server) passwordLogin(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	passwordHash, err := s.provider.GetPasswordHash(s.ctx, req.Username)
 	if err != nil {
+		// хэш пароля вычисляется и для неизвестного пользователя, чтобы время ответа не выдавало аккаунт
+		service.CheckPassword(req.Password, service.DummyPasswordHash)
+		return nil, status.Error(codes.Unauthenticated, "wrong credentials")
+	}
+
+	match, outdated, err := service.CheckPassword(req.Password, passwordHash)
+	if err != nil || !match {
 		return nil, status.Error(codes.Unauthenticated, "wrong credentials")
 	}
+
+	// пароль верный, заменяем устаревший хэш на argon2id
+	if outdated {
+		s.upgradePasswordHash(req.Username, req.Password)
+	}
+
+	// в режиме second-factor пользователю с привязанным сертификатом нужно его предъявить
+	if err := s.checkCertificateFactor(ctx, req.Username); err != nil {
+		if errors.Is(err, ErrCertRequired) {
+			return nil, status.Error(codes.Unauthenticated, "client certificate required")
+		}
+		logger.Log.Sugar().Errorf("Failed to check certificate of %s: %v", req.Username, err)
+		return nil, status.Error(codes.Internal, "failed to check certificate")
+	}
+
+	return s.completeLogin(ctx, req.Username, req.TotpCode)
+}
+
+// completeLogin проверяет одноразовый код, если он нужен, и создает сессию пользователя,
+// который уже подтвердил первый фактор паролем или сертификатом
+func (s *server) completeLogin(ctx context.Context, username string, totpCode string) (*pb.LoginResponse, error) {
+	err := s.checkSecondFactor(username, totpCode)
+	if err != nil {
+		if errors.Is(err, ErrTOTPRequired) {
+			return &pb.LoginResponse{
+				Message:      "Введите одноразовый код из приложения или код восстановления.",
+				TotpRequired: true,
+			}, nil
+		}
+		if errors.Is(err, ErrTOTPInvalid) {
+			return nil, status.Error(codes.Unauthenticated, "invalid one-time code")
+		}
+		logger.Log.Sugar().Errorf("Failed to check one-time code of %s: %v", username, err)
+		return nil, status.Error(codes.Internal, "failed to check one-time code")
+	}
+
+	// зашифрованный ключ хранилища нужен клиенту, который шифрует данные сам
+	vault, err := s.provider.GetVault(s.ctx, username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get vault params")
+	}
+
+	token, sessionID, err := s.issueSession(ctx, username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create session")
+	}
+	s.audit(ctx, username, service.LOGIN_SUCCESS, sessionID)
+
 	return &pb.LoginResponse{
-		Message: "Вы успешно вошли!",
+		Message:         "Вы успешно вошли!",
+		Token:           token,
+		WrappedVaultKey: vault.WrappedKey,
+		Username:        username,
 	}, nil
 }
+
+// upgradePasswordHash пересчитывает хэш пароля с текущими параметрами.
+// Ошибка не мешает входу, хэш будет обновлен при следующем входе.
+func (s *server) upgradePasswordHash(username string, password string) {
+	newHash, err := service.HashPassword(password)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to hash password: %v", err)
+		return
+	}
+
+	if err := s.provider.UpdatePasswordHash(s.ctx, username, newHash); err != nil {
+		logger.Log.Sugar().Errorf("Failed to upgrade password hash for %s: %v", username, err)
+		return
+	}
+	logger.Log.Sugar().Infof("Password hash upgraded for %s", username)
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
 	pb "keeper/proto"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -16,11 +21,31 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// expectLoginAttempts разрешает обращения к счетчикам неудачных попыток входа, блокировки нет
+func expectLoginAttempts(mockProvider *mocks.Provider) {
+	mockProvider.On("GetLoginAttempts", mock.Anything, mock.Anything).Return(nil, nil)
+	mockProvider.On("RecordLoginFailure", mock.Anything, mock.Anything, mock.Anything).Return(storage.LoginAttempt{}, nil).Maybe()
+	mockProvider.On("DeleteLoginAttempts", mock.Anything, mock.Anything).Return(int64(0), nil).Maybe()
+}
+
+// sessionOf сопоставляет сессию, создаваемую при входе, по имени пользователя
+func sessionOf(username string) interface{} {
+	return mock.MatchedBy(func(session storage.Session) bool {
+		return session.Username == username && session.ID != "" && session.ExpiresAt.After(session.CreatedAt)
+	})
+}
+
+// expectAudit разрешает запись событий журнала аудита
+func expectAudit(mockProvider *mocks.Provider) {
+	mockProvider.On("AddAuditEvent", mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
 // TestLogin тестирует метод Login
 func TestLogin(t *testing.T) {
 	mockProvider := new(mocks.Provider)
 	server := &server{
 		provider: mockProvider,
+		cfg:      &config.Config{SessionTTL: time.Hour},
 	}
 
 	ctx := context.Background()
@@ -28,26 +53,215 @@ func TestLogin(t *testing.T) {
 		Username: "testuser",
 		Password: "password",
 	}
+	passwordHash, _ := service.HashPassword(req.Password)
+	legacyHash, _ := service.GetHashStr(req.Password)
 
 	t.Run("successful login", func(t *testing.T) {
-		mockProvider.On("ExistUser", mock.Anything, req.Username, mock.Anything).Return(nil)
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, req.Username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, req.Username).Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{WrappedKey: "wrapped"}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf(req.Username), mock.Anything).Return(nil)
 
 		resp, err := server.Login(ctx, req)
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 		assert.Equal(t, "Вы успешно вошли!", resp.Message)
+		assert.NotEmpty(t, resp.Token)
+		assert.Equal(t, "wrapped", resp.WrappedVaultKey)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything, mock.Anything)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("legacy hash upgraded", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, req.Username).Return(legacyHash, nil)
+		mockProvider.On("UpdatePasswordHash", mock.Anything, req.Username, mock.MatchedBy(func(hash string) bool {
+			match, outdated, err := service.CheckPassword(req.Password, hash)
+			return err == nil && match && !outdated
+		})).Return(nil)
+		mockProvider.On("GetTOTP", mock.Anything, req.Username).Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf(req.Username), mock.Anything).Return(nil)
+
+		resp, err := server.Login(ctx, req)
+		assert.NoError(t, err)
+		assert.NotNil(t, resp)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, req.Username).Return(passwordHash, nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: req.Username, Password: "wrong"})
+		assert.Error(t, err)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
 
 		mockProvider.AssertExpectations(t)
 		mockProvider.ExpectedCalls = nil
 	})
 
 	t.Run("wrong credentials", func(t *testing.T) {
-		mockProvider.On("ExistUser", mock.Anything, req.Username, mock.Anything).Return(errors.New("wrong credentials"))
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, req.Username).Return("", errors.New("wrong credentials"))
+
+		resp, err := server.Login(ctx, req)
+		assert.Error(t, err)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("session error", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, req.Username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, req.Username).Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf(req.Username), mock.Anything).Return(errors.New("db error"))
 
 		resp, err := server.Login(ctx, req)
 		assert.Error(t, err)
 		assert.Nil(t, resp)
 		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Internal, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("totp code required", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, req.Username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, req.Username).Return(storage.TOTP{Secret: "sealed", Confirmed: true}, nil)
+
+		resp, err := server.Login(ctx, req)
+		assert.NoError(t, err)
+		assert.True(t, resp.TotpRequired)
+		assert.Empty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+// TestLoginWithTOTP тестирует вход с одноразовым кодом и кодом восстановления
+func TestLoginWithTOTP(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{SessionTTL: time.Hour, TOTPSkew: 1},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	ctx := context.Background()
+	username := "testuser"
+	passwordHash, _ := service.HashPassword("password")
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	secret, _ := service.GenerateTOTPSecret()
+	sealedSecret, _ := service.EncryptRecord(secret, dataKey, 1, totpAAD(username))
+	totp := storage.TOTP{Secret: sealedSecret, Confirmed: true}
+
+	expectSecret := func() {
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(totp, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+	}
+
+	t.Run("valid code", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		code, _ := service.TOTPCode(secret, service.TOTPStep(time.Now()))
+		expectSecret()
+		mockProvider.On("UseTOTPStep", mock.Anything, username, service.TOTPStep(time.Now())).Return(true, nil)
+		mockProvider.On("GetVault", mock.Anything, username).Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf(username), mock.Anything).Return(nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: username, Password: "password", TotpCode: code})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("replayed code", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		code, _ := service.TOTPCode(secret, service.TOTPStep(time.Now()))
+		expectSecret()
+		mockProvider.On("UseTOTPStep", mock.Anything, username, service.TOTPStep(time.Now())).Return(false, nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: username, Password: "password", TotpCode: code})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		code, _ := service.TOTPCode(secret, service.TOTPStep(time.Now())+5)
+		expectSecret()
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: username, Password: "password", TotpCode: code})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(totp, nil)
+		mockProvider.On("UseRecoveryCode", mock.Anything, username, service.GetRecoveryCodeHash("abcd-efgh-ijkl-mnop")).Return(true, nil)
+		mockProvider.On("GetVault", mock.Anything, username).Return(storage.Vault{}, nil)
+		mockProvider.On("CreateSession", mock.Anything, sessionOf(username), mock.Anything).Return(nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: username, Password: "password", TotpCode: "ABCDEFGHIJKLMNOP"})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("used recovery code", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(totp, nil)
+		mockProvider.On("UseRecoveryCode", mock.Anything, username, mock.Anything).Return(false, nil)
+
+		resp, err := server.Login(ctx, &pb.LoginRequest{Username: username, Password: "password", TotpCode: "abcd-efgh-ijkl-mnop"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
 		assert.Equal(t, codes.Unauthenticated, st.Code())
 
 		mockProvider.AssertExpectations(t)
@@ -0,0 +1,478 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// orgRoles роли участников из запроса клиента
+var orgRoles = map[pb.OrgRole]service.OrgRole{
+	pb.OrgRole_ORG_ROLE_OWNER:     service.ORG_OWNER,
+	pb.OrgRole_ORG_ROLE_ADMIN:     service.ORG_ADMIN,
+	pb.OrgRole_ORG_ROLE_MEMBER:    service.ORG_MEMBER,
+	pb.OrgRole_ORG_ROLE_READ_ONLY: service.ORG_READ_ONLY,
+}
+
+// orgRoleNames названия ролей для уведомлений
+var orgRoleNames = map[service.OrgRole]string{
+	service.ORG_OWNER:     "владелец",
+	service.ORG_ADMIN:     "администратор",
+	service.ORG_MEMBER:    "участник",
+	service.ORG_READ_ONLY: "только чтение",
+}
+
+// canManageMembers сообщает, может ли роль управлять участниками и коллекциями организации.
+// Назначать и менять владельцев может только владелец.
+func canManageMembers(role service.OrgRole) bool {
+	return role == service.ORG_OWNER || role == service.ORG_ADMIN
+}
+
+// canWriteItems сообщает, может ли роль добавлять записи в коллекции организации
+func canWriteItems(role service.OrgRole) bool {
+	return role != service.ORG_READ_ONLY
+}
+
+// validOrgName проверяет название организации или коллекции. Разделители запрещены,
+// потому что путь коллекции показывается как организация/коллекция, а клиент разбирает ввод по ::
+func validOrgName(name string) bool {
+	return name != "" && !strings.Contains(name, "/") && !strings.Contains(name, "::")
+}
+
+// CreateOrganization создает организацию, создатель становится ее владельцем.
+// Ключ организации генерируется сервером и выдается каждому участнику, зашифрованным его ключом.
+func (s *server) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.CreateOrganizationResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if !validOrgName(req.Name) {
+		return nil, status.Error(codes.InvalidArgument, "organization name must be non-empty and must not contain '/' or '::'")
+	}
+
+	orgKey, err := service.GenerateDataKey()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create organization")
+	}
+	wrappedKey, err := s.sealForUser(id.Username, orgKey, service.OrgKeyAAD(req.Name, id.Username))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to wrap organization key for %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to create organization")
+	}
+
+	owner := storage.OrgMember{OrgName: req.Name, Username: id.Username, Role: service.ORG_OWNER, WrappedKey: wrappedKey}
+	if _, err := s.provider.CreateOrganization(ctx, owner); err != nil {
+		if errors.Is(err, sqlite.ErrConflict) {
+			return nil, status.Error(codes.AlreadyExists, "organization already exists")
+		}
+		logger.Log.Sugar().Errorf("Failed to create organization %s: %v", req.Name, err)
+		return nil, status.Error(codes.Internal, "failed to create organization")
+	}
+	logger.Log.Sugar().Infof("%s created organization %s", id.Username, req.Name)
+
+	return &pb.CreateOrganizationResponse{Message: "Организация создана."}, nil
+}
+
+// SetOrgMember добавляет пользователя в организацию или меняет его роль.
+// Доступно владельцам и администраторам, назначать и менять владельцев может только владелец.
+func (s *server) SetOrgMember(ctx context.Context, req *pb.SetOrgMemberRequest) (*pb.SetOrgMemberResponse, error) {
+	actor, err := s.orgActor(ctx, req.Organization)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageMembers(actor.Role) {
+		return nil, status.Error(codes.PermissionDenied, "not allowed to manage members")
+	}
+	role, ok := orgRoles[req.Role]
+	if !ok || req.Username == "" {
+		return nil, status.Error(codes.InvalidArgument, "username and role required")
+	}
+	if err := s.checkOwnerChange(actor, req.Username, role); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.provider.GetVault(ctx, req.Username); err != nil {
+		if errors.Is(err, sqlite.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		logger.Log.Sugar().Errorf("Failed to get user %s: %v", req.Username, err)
+		return nil, status.Error(codes.Internal, "failed to update member")
+	}
+
+	// ключ организации выдается участнику, зашифрованным его ключом
+	orgKey, err := s.orgKey(actor)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to open key of organization %s for %s: %v", actor.OrgName, actor.Username, err)
+		return nil, status.Error(codes.Internal, "failed to update member")
+	}
+	wrappedKey, err := s.sealForUser(req.Username, orgKey, service.OrgKeyAAD(actor.OrgName, req.Username))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to wrap organization key for %s: %v", req.Username, err)
+		return nil, status.Error(codes.Internal, "failed to update member")
+	}
+
+	member := storage.OrgMember{OrgID: actor.OrgID, OrgName: actor.OrgName, Username: req.Username, Role: role, WrappedKey: wrappedKey}
+	if err := s.provider.SaveOrgMember(ctx, member); err != nil {
+		return nil, memberStatus(actor.OrgName, err)
+	}
+
+	s.notifyUser(req.Username, fmt.Sprintf("ОБНОВЛЕНИЕ! Ваша роль в организации %s: %s", actor.OrgName, orgRoleNames[role]))
+	logger.Log.Sugar().Infof("%s set role %s of %s in %s", actor.Username, role, req.Username, actor.OrgName)
+
+	return &pb.SetOrgMemberResponse{Message: "Роль участника сохранена."}, nil
+}
+
+// RemoveOrgMember удаляет участника из организации. Участник может выйти из организации сам,
+// удалять других могут владельцы и администраторы. Последнего владельца удалить нельзя.
+func (s *server) RemoveOrgMember(ctx context.Context, req *pb.RemoveOrgMemberRequest) (*pb.RemoveOrgMemberResponse, error) {
+	actor, err := s.orgActor(ctx, req.Organization)
+	if err != nil {
+		return nil, err
+	}
+	if req.Username == "" {
+		return nil, status.Error(codes.InvalidArgument, "username required")
+	}
+	if req.Username != actor.Username {
+		if !canManageMembers(actor.Role) {
+			return nil, status.Error(codes.PermissionDenied, "not allowed to manage members")
+		}
+		if err := s.checkOwnerChange(actor, req.Username, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.provider.RemoveOrgMember(ctx, actor.OrgID, req.Username); err != nil {
+		return nil, memberStatus(actor.OrgName, err)
+	}
+
+	s.notifyUser(req.Username, fmt.Sprintf("ОБНОВЛЕНИЕ! Вы больше не состоите в организации %s", actor.OrgName))
+	logger.Log.Sugar().Infof("%s removed %s from %s", actor.Username, req.Username, actor.OrgName)
+
+	return &pb.RemoveOrgMemberResponse{Message: "Участник удален."}, nil
+}
+
+// CreateCollection создает коллекцию записей организации. Доступно владельцам и администраторам.
+func (s *server) CreateCollection(ctx context.Context, req *pb.CreateCollectionRequest) (*pb.CreateCollectionResponse, error) {
+	actor, err := s.orgActor(ctx, req.Organization)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageMembers(actor.Role) {
+		return nil, status.Error(codes.PermissionDenied, "not allowed to manage collections")
+	}
+	if !validOrgName(req.Name) {
+		return nil, status.Error(codes.InvalidArgument, "collection name must be non-empty and must not contain '/' or '::'")
+	}
+
+	if _, err := s.provider.CreateCollection(ctx, actor.OrgID, req.Name); err != nil {
+		if errors.Is(err, sqlite.ErrConflict) {
+			return nil, status.Error(codes.AlreadyExists, "collection already exists")
+		}
+		logger.Log.Sugar().Errorf("Failed to create collection in %s: %v", actor.OrgName, err)
+		return nil, status.Error(codes.Internal, "failed to create collection")
+	}
+
+	return &pb.CreateCollectionResponse{Message: "Коллекция создана."}, nil
+}
+
+// CreateCollectionItem добавляет командную запись в коллекцию. Запись и ее название шифруются
+// ключом организации. Участникам с ролью только для чтения запись недоступна.
+func (s *server) CreateCollectionItem(ctx context.Context, req *pb.CreateCollectionItemRequest) (*pb.CreateCollectionItemResponse, error) {
+	actor, err := s.orgActor(ctx, req.Organization)
+	if err != nil {
+		return nil, err
+	}
+	if !canWriteItems(actor.Role) {
+		return nil, status.Error(codes.PermissionDenied, "read-only members cannot add items")
+	}
+
+	collection, err := s.provider.GetCollection(ctx, actor.OrgID, req.Collection)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrCollectionNotFound) {
+			return nil, status.Error(codes.NotFound, "collection not found")
+		}
+		logger.Log.Sugar().Errorf("Failed to get collection of %s: %v", actor.OrgName, err)
+		return nil, status.Error(codes.Internal, "failed to create item")
+	}
+
+	dataType, ok := itemDataType(req.Item)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, ErrCreateFormat.Error())
+	}
+	data, err := encodeItem(req.Item, dataType)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	title := req.Item.Title
+
+	orgKey, err := s.orgKey(actor)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to open key of organization %s for %s: %v", actor.OrgName, actor.Username, err)
+		return nil, status.Error(codes.Internal, "failed to create item")
+	}
+	index := service.TitleIndex(orgKey, title)
+	titleCipher, err := service.EncryptRecord(title, orgKey, firstKeyVersion, service.CollectionTitleAAD(collection.ID, index))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create item")
+	}
+
+	row := storage.DataRow{
+		Username:     actor.Username,
+		Title:        title,
+		TitleIndex:   index,
+		TitleCipher:  titleCipher,
+		DataType:     dataType,
+		OrgID:        actor.OrgID,
+		CollectionID: collection.ID,
+	}
+	seal := func(id int64) (string, error) {
+		row.ID = id
+		return service.EncryptRecord(data, orgKey, firstKeyVersion,
+			service.CollectionRecordAAD(collection.ID, id, dataType, title))
+	}
+	if err := s.provider.CreateCollectionItem(ctx, row, seal); err != nil {
+		if errors.Is(err, sqlite.ErrCreateData) {
+			return nil, status.Error(codes.AlreadyExists, "item already exists")
+		}
+		logger.Log.Sugar().Errorf("Failed to create item in %s: %v", actor.OrgName, err)
+		return nil, status.Error(codes.Internal, "failed to create item")
+	}
+
+	s.auditItem(ctx, actor.Username, service.ITEM_CREATE, row)
+	return &pb.CreateCollectionItemResponse{Message: "Данные записаны!"}, nil
+}
+
+// ListOrganizations возвращает организации пользователя, его роль и коллекции каждой организации
+func (s *server) ListOrganizations(ctx context.Context, req *pb.ListOrganizationsRequest) (*pb.ListOrganizationsResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	memberships, err := s.provider.ListMemberships(ctx, id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to list organizations of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to list organizations")
+	}
+
+	resp := &pb.ListOrganizationsResponse{Organizations: make([]*pb.Organization, 0, len(memberships))}
+	for _, member := range memberships {
+		collections, err := s.provider.ListCollections(ctx, member.OrgID)
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to list collections of %s: %v", member.OrgName, err)
+			return nil, status.Error(codes.Internal, "failed to list organizations")
+		}
+		org := &pb.Organization{Name: member.OrgName}
+		for role, value := range orgRoles {
+			if value == member.Role {
+				org.Role = role
+			}
+		}
+		for _, collection := range collections {
+			org.Collections = append(org.Collections, collection.Name)
+		}
+		resp.Organizations = append(resp.Organizations, org)
+	}
+	return resp, nil
+}
+
+// orgActor возвращает членство пользователя из контекста в организации orgName
+func (s *server) orgActor(ctx context.Context, orgName string) (storage.OrgMember, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return storage.OrgMember{}, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	// организация, в которой пользователь не состоит, для него не существует
+	actor, err := s.provider.GetMembership(ctx, orgName, id.Username)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrOrgNotFound) {
+			return storage.OrgMember{}, status.Error(codes.NotFound, "organization not found")
+		}
+		logger.Log.Sugar().Errorf("Failed to get membership of %s: %v", id.Username, err)
+		return storage.OrgMember{}, status.Error(codes.Internal, "failed to get organization")
+	}
+	return actor, nil
+}
+
+// checkOwnerChange запрещает не владельцам назначать владельцев и менять или удалять их.
+// Для удаления участника role пустая.
+func (s *server) checkOwnerChange(actor storage.OrgMember, username string, role service.OrgRole) error {
+	if actor.Role == service.ORG_OWNER {
+		return nil
+	}
+	if role == service.ORG_OWNER {
+		return status.Error(codes.PermissionDenied, "only owners can appoint owners")
+	}
+
+	target, err := s.provider.GetMembership(s.ctx, actor.OrgName, username)
+	if errors.Is(err, sqlite.ErrOrgNotFound) {
+		return nil
+	}
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get membership of %s: %v", username, err)
+		return status.Error(codes.Internal, "failed to update member")
+	}
+	if target.Role == service.ORG_OWNER {
+		return status.Error(codes.PermissionDenied, "only owners can change owners")
+	}
+	return nil
+}
+
+// memberStatus преобразует ошибку изменения состава организации в ответ клиенту
+func memberStatus(orgName string, err error) error {
+	switch {
+	case errors.Is(err, sqlite.ErrMemberNotFound):
+		return status.Error(codes.NotFound, "member not found")
+	case errors.Is(err, sqlite.ErrLastOwner):
+		return status.Error(codes.FailedPrecondition, "organization must keep at least one owner")
+	default:
+		logger.Log.Sugar().Errorf("Failed to update members of %s: %v", orgName, err)
+		return status.Error(codes.Internal, "failed to update member")
+	}
+}
+
+// orgKey расшифровывает ключ организации, выданный участнику
+func (s *server) orgKey(member storage.OrgMember) (string, error) {
+	return s.openForUser(member.Username, member.WrappedKey, service.OrgKeyAAD(member.OrgName, member.Username))
+}
+
+// openTeamTitle расшифровывает название командной записи ключом организации
+func openTeamTitle(row storage.DataRow, orgKey string) (string, error) {
+	header, body, err := service.ParseHeader(row.TitleCipher)
+	if err != nil {
+		return "", err
+	}
+	if !header.Bound {
+		return "", ErrUnboundData
+	}
+	return service.DecryptWithAAD(body, orgKey, service.CollectionTitleAAD(row.CollectionID, row.TitleIndex))
+}
+
+// getTeamData возвращает данные командной записи, если пользователь состоит в ее организации
+func (s *server) getTeamData(username string, itemID int64) (*pb.Item, error) {
+	row, member, err := s.provider.GetTeamData(s.ctx, username, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgKey, err := s.orgKey(member)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to open key of organization %s for %s: %v", member.OrgName, username, err)
+		return nil, err
+	}
+	row.Title, err = openTeamTitle(row, orgKey)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to decrypt title of team record %d: %v", row.ID, err)
+		return nil, err
+	}
+
+	plainText, err := openTeamData(row, orgKey)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Decryption error: %v\n", err)
+		return nil, err
+	}
+	return decodeItem(row.Title, row.DataType, plainText)
+}
+
+// openTeamData расшифровывает данные командной записи с открытым названием row.Title ключом организации
+func openTeamData(row storage.DataRow, orgKey string) (string, error) {
+	_, body, err := service.ParseHeader(row.Data)
+	if err != nil {
+		return "", err
+	}
+	return service.DecryptWithAAD(body, orgKey, service.CollectionRecordAAD(row.CollectionID, row.ID, row.DataType, row.Title))
+}
+
+// editableTeamData возвращает актуальную командную запись, если роль пользователя в ее организации
+// позволяет изменять записи. Командные записи шифрует сервер ключом организации.
+func (s *server) editableTeamData(username string, row storage.DataRow) (editTarget, error) {
+	current, member, err := s.provider.GetTeamData(s.ctx, username, row.ID)
+	if err != nil {
+		return editTarget{}, err
+	}
+	if !canWriteItems(member.Role) {
+		return editTarget{}, ErrReadOnly
+	}
+	current.Title = row.Title
+	return editTarget{row: current, member: member}, nil
+}
+
+// saveTeamUpdate шифрует ключом организации новое название и данные командной записи и сохраняет их,
+// если версия записи не изменилась с момента выбора. Прежняя версия попадает в историю записи с автором изменения.
+func (s *server) saveTeamUpdate(author identity, member storage.OrgMember, current storage.DataRow, title string, plainText string) error {
+	orgKey, err := s.orgKey(member)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to open key of organization %s for %s: %v", member.OrgName, member.Username, err)
+		return err
+	}
+
+	updated := current
+	updated.Title = title
+	updated.TitleIndex = service.TitleIndex(orgKey, title)
+	updated.TitleCipher, err = service.EncryptRecord(title, orgKey, firstKeyVersion, service.CollectionTitleAAD(current.CollectionID, updated.TitleIndex))
+	if err != nil {
+		return err
+	}
+	updated.Data, err = service.EncryptRecord(plainText, orgKey, firstKeyVersion,
+		service.CollectionRecordAAD(current.CollectionID, current.ID, current.DataType, title))
+	if err != nil {
+		return err
+	}
+	revision := storage.Revision{Author: author.Username, SessionID: author.SessionID, CreatedAt: time.Now()}
+	return s.provider.UpdateCollectionItem(s.ctx, updated, current.Version, revision)
+}
+
+// deleteTeamData окончательно удаляет командную запись. Любые записи коллекций удаляют владельцы
+// и администраторы организации, остальные участники с доступом на запись - только добавленные ими.
+func (s *server) deleteTeamData(username string, row storage.DataRow) error {
+	current, member, err := s.provider.GetTeamData(s.ctx, username, row.ID)
+	if err != nil {
+		return err
+	}
+	if !canManageMembers(member.Role) && (!canWriteItems(member.Role) || current.Username != username) {
+		return ErrNoDeleteAccess
+	}
+	return s.provider.DeleteCollectionItem(s.ctx, row.ID)
+}
+
+// getTeamTitles возвращает записи коллекций организаций пользователя с расшифрованными названиями
+func (s *server) getTeamTitles(username string) ([]storage.DataRow, error) {
+	rows, err := s.provider.GetTeamTitles(s.ctx, username)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	memberships, err := s.provider.ListMemberships(s.ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	// ключ каждой организации расшифровывается один раз
+	orgKeys := make(map[int64]string, len(memberships))
+	for _, member := range memberships {
+		orgKeys[member.OrgID], err = s.orgKey(member)
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to open key of organization %s for %s: %v", member.OrgName, username, err)
+			return nil, err
+		}
+	}
+	for i := range rows {
+		rows[i].Title, err = openTeamTitle(rows[i], orgKeys[rows[i].OrgID])
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to decrypt title of team record %d: %v", rows[i].ID, err)
+			return nil, err
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,446 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestOrganizations(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	// ключи пользователей
+	dataKeys := make(map[string]string)
+	userKeys := make(map[string]storage.UserKey)
+	for _, username := range []string{"alice", "bob", "carol"} {
+		dataKeys[username], _ = service.GenerateDataKey()
+		wrappedKey, _ := keyring.Wrap(dataKeys[username])
+		userKeys[username] = storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	}
+	expectKeys := func() {
+		for username, key := range userKeys {
+			mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(key, nil).Maybe()
+			mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(key, nil).Maybe()
+		}
+	}
+
+	// member возвращает участника организации acme с выданным ключом организации
+	orgKey, _ := service.GenerateDataKey()
+	member := func(username string, role service.OrgRole) storage.OrgMember {
+		wrappedKey, _ := service.EncryptRecord(orgKey, dataKeys[username], 1, service.OrgKeyAAD("acme", username))
+		return storage.OrgMember{OrgID: 2, OrgName: "acme", Username: username, Role: role, WrappedKey: wrappedKey}
+	}
+	asUser := func(username string) context.Context {
+		return withIdentity(context.Background(), identity{Username: username, SessionID: "session-id"})
+	}
+	codeOf := func(err error) codes.Code {
+		st, _ := status.FromError(err)
+		return st.Code()
+	}
+
+	t.Run("organization created", func(t *testing.T) {
+		var owner storage.OrgMember
+		expectKeys()
+		mockProvider.On("CreateOrganization", mock.Anything, mock.MatchedBy(func(m storage.OrgMember) bool {
+			owner = m
+			return m.OrgName == "acme" && m.Username == "alice" && m.Role == service.ORG_OWNER
+		})).Return(int64(2), nil)
+
+		resp, err := server.CreateOrganization(asUser("alice"), &pb.CreateOrganizationRequest{Name: "acme"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Организация создана.", resp.Message)
+
+		// создатель открывает ключ организации своим ключом
+		_, err = server.orgKey(owner)
+		assert.NoError(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("organization exists", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("CreateOrganization", mock.Anything, mock.Anything).Return(int64(0), sqlite.ErrConflict)
+
+		_, err := server.CreateOrganization(asUser("alice"), &pb.CreateOrganizationRequest{Name: "acme"})
+		assert.Equal(t, codes.AlreadyExists, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("invalid organization name", func(t *testing.T) {
+		_, err := server.CreateOrganization(asUser("alice"), &pb.CreateOrganizationRequest{Name: "acme/dev"})
+		assert.Equal(t, codes.InvalidArgument, codeOf(err))
+	})
+
+	t.Run("member added", func(t *testing.T) {
+		bob := newClient()
+		server.clients["bob::1"] = bob
+		defer delete(server.clients, "bob::1")
+
+		var saved storage.OrgMember
+		expectKeys()
+		mockProvider.On("GetMembership", mock.Anything, "acme", "alice").Return(member("alice", service.ORG_OWNER), nil)
+		mockProvider.On("GetVault", mock.Anything, "bob").Return(storage.Vault{}, nil)
+		mockProvider.On("SaveOrgMember", mock.Anything, mock.MatchedBy(func(m storage.OrgMember) bool {
+			saved = m
+			return m.OrgID == 2 && m.Username == "bob" && m.Role == service.ORG_MEMBER
+		})).Return(nil)
+
+		_, err := server.SetOrgMember(asUser("alice"), &pb.SetOrgMemberRequest{Organization: "acme", Username: "bob", Role: pb.OrgRole_ORG_ROLE_MEMBER})
+		assert.NoError(t, err)
+
+		// новый участник получает тот же ключ организации
+		key, err := server.orgKey(saved)
+		assert.NoError(t, err)
+		assert.Equal(t, orgKey, key)
+
+		notification := <-bob.ch
+		assert.Contains(t, notification.Message, "Ваша роль в организации acme: участник")
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("admin cannot appoint owner", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "bob").Return(member("bob", service.ORG_ADMIN), nil)
+
+		_, err := server.SetOrgMember(asUser("bob"), &pb.SetOrgMemberRequest{Organization: "acme", Username: "carol", Role: pb.OrgRole_ORG_ROLE_OWNER})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("admin cannot remove owner", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "bob").Return(member("bob", service.ORG_ADMIN), nil)
+		mockProvider.On("GetMembership", mock.Anything, "acme", "alice").Return(member("alice", service.ORG_OWNER), nil)
+
+		_, err := server.RemoveOrgMember(asUser("bob"), &pb.RemoveOrgMemberRequest{Organization: "acme", Username: "alice"})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("member cannot manage members", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "bob").Return(member("bob", service.ORG_MEMBER), nil)
+
+		_, err := server.SetOrgMember(asUser("bob"), &pb.SetOrgMemberRequest{Organization: "acme", Username: "carol", Role: pb.OrgRole_ORG_ROLE_MEMBER})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+		_, err = server.CreateCollection(asUser("bob"), &pb.CreateCollectionRequest{Organization: "acme", Name: "devops"})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("last owner cannot leave", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "alice").Return(member("alice", service.ORG_OWNER), nil)
+		mockProvider.On("RemoveOrgMember", mock.Anything, int64(2), "alice").Return(sqlite.ErrLastOwner)
+
+		_, err := server.RemoveOrgMember(asUser("alice"), &pb.RemoveOrgMemberRequest{Organization: "acme", Username: "alice"})
+		assert.Equal(t, codes.FailedPrecondition, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("member leaves", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "carol").Return(member("carol", service.ORG_READ_ONLY), nil)
+		mockProvider.On("RemoveOrgMember", mock.Anything, int64(2), "carol").Return(nil)
+
+		_, err := server.RemoveOrgMember(asUser("carol"), &pb.RemoveOrgMemberRequest{Organization: "acme", Username: "carol"})
+		assert.NoError(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("not a member", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "carol").Return(storage.OrgMember{}, sqlite.ErrOrgNotFound)
+
+		_, err := server.CreateCollection(asUser("carol"), &pb.CreateCollectionRequest{Organization: "acme", Name: "devops"})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team item created and read", func(t *testing.T) {
+		var created storage.DataRow
+		var data string
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetMembership", mock.Anything, "acme", "bob").Return(member("bob", service.ORG_MEMBER), nil)
+		mockProvider.On("GetCollection", mock.Anything, int64(2), "devops").Return(storage.Collection{ID: 5, OrgID: 2, Name: "devops"}, nil)
+		mockProvider.On("CreateCollectionItem", mock.Anything, mock.MatchedBy(func(row storage.DataRow) bool {
+			created = row
+			return row.CollectionID == 5 && row.Username == "bob" && row.TitleIndex == service.TitleIndex(orgKey, "vpn")
+		}), mock.Anything).Run(func(args mock.Arguments) {
+			data, _ = args.Get(2).(storage.SealFunc)(11)
+		}).Return(nil)
+
+		_, err := server.CreateCollectionItem(asUser("bob"), &pb.CreateCollectionItemRequest{
+			Organization: "acme", Collection: "devops", Item: &pb.Item{Title: "vpn", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "token"}}},
+		})
+		assert.NoError(t, err)
+
+		// участник с правом только на чтение читает запись ключом организации
+		created.ID, created.Data, created.Title = 11, data, ""
+		mockProvider.On("GetTeamData", mock.Anything, "carol", int64(11)).Return(created, member("carol", service.ORG_READ_ONLY), nil)
+		item, err := server.getTeamData("carol", 11)
+		assert.NoError(t, err)
+		assert.Equal(t, "vpn", item.Title)
+		assert.Equal(t, "token", item.GetText().Text)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("read-only member cannot add items", func(t *testing.T) {
+		mockProvider.On("GetMembership", mock.Anything, "acme", "carol").Return(member("carol", service.ORG_READ_ONLY), nil)
+
+		_, err := server.CreateCollectionItem(asUser("carol"), &pb.CreateCollectionItemRequest{
+			Organization: "acme", Collection: "devops", Item: &pb.Item{Title: "vpn", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "token"}}},
+		})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	// командная запись alice в коллекции acme/devops
+	teamIndex := service.TitleIndex(orgKey, "vpn")
+	teamTitle, _ := service.EncryptRecord("vpn", orgKey, 1, service.CollectionTitleAAD(5, teamIndex))
+	encoded, _ := encodeItem(&pb.Item{Title: "vpn", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "token"}}}, service.TEXT)
+	teamData, _ := service.EncryptRecord(encoded, orgKey, 1, service.CollectionRecordAAD(5, 11, service.TEXT, "vpn"))
+	teamRow := storage.DataRow{ID: 11, Username: "alice", TitleIndex: teamIndex, TitleCipher: teamTitle, DataType: service.TEXT,
+		Version: 2, OrgID: 2, CollectionID: 5, Collection: "acme/devops"}
+	expectTeamTitles := func(username string, role service.OrgRole) {
+		mockProvider.On("GetVault", mock.Anything, username).Return(storage.Vault{}, nil).Maybe()
+		mockProvider.On("GetTeamTitles", mock.Anything, username).Return([]storage.DataRow{teamRow}, nil)
+		mockProvider.On("ListMemberships", mock.Anything, username).Return([]storage.OrgMember{member(username, role)}, nil)
+		current := teamRow
+		current.Data = teamData
+		mockProvider.On("GetTeamData", mock.Anything, username, int64(11)).Return(current, member(username, role), nil)
+	}
+
+	t.Run("team item updated", func(t *testing.T) {
+		var updated storage.DataRow
+		expectKeys()
+		expectAudit(mockProvider)
+		expectTeamTitles("bob", service.ORG_MEMBER)
+		mockProvider.On("UpdateCollectionItem", mock.Anything, mock.MatchedBy(func(row storage.DataRow) bool {
+			updated = row
+			return row.ID == 11 && row.CollectionID == 5
+		}), int64(2), mock.MatchedBy(func(revision storage.Revision) bool {
+			return revision.Author == "bob" && revision.SessionID == "session-id"
+		})).Return(nil)
+
+		resp, err := server.UpdateItem(asUser("bob"), &pb.UpdateItemRequest{
+			Title: "vpn", Collection: "acme/devops", Version: 2,
+			Item: &pb.Item{Title: "vpn-new", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "new token"}}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), resp.Version)
+
+		// название и данные зашифрованы ключом организации, автор записи не меняется
+		assert.Equal(t, "alice", updated.Username)
+		assert.Equal(t, service.TitleIndex(orgKey, "vpn-new"), updated.TitleIndex)
+		title, err := openTeamTitle(updated, orgKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "vpn-new", title)
+		_, body, _ := service.ParseHeader(updated.Data)
+		plainText, err := service.DecryptWithAAD(body, orgKey, service.CollectionRecordAAD(5, 11, service.TEXT, "vpn-new"))
+		assert.NoError(t, err)
+		item, err := decodeItem("vpn-new", service.TEXT, plainText)
+		assert.NoError(t, err)
+		assert.Equal(t, "new token", item.GetText().Text)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team item changed by another member", func(t *testing.T) {
+		expectKeys()
+		expectTeamTitles("bob", service.ORG_MEMBER)
+
+		_, err := server.UpdateItem(asUser("bob"), &pb.UpdateItemRequest{
+			Title: "vpn", Collection: "acme/devops", Version: 1,
+			Item: &pb.Item{Title: "vpn", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "new token"}}},
+		})
+		assert.Equal(t, codes.Aborted, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("read-only member cannot update team item", func(t *testing.T) {
+		expectKeys()
+		expectTeamTitles("carol", service.ORG_READ_ONLY)
+
+		_, err := server.UpdateItem(asUser("carol"), &pb.UpdateItemRequest{
+			Title: "vpn", Collection: "acme/devops", Version: 2,
+			Item: &pb.Item{Title: "vpn", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "new token"}}},
+		})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team item deleted by admin", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		expectTeamTitles("carol", service.ORG_ADMIN)
+		mockProvider.On("DeleteCollectionItem", mock.Anything, int64(11)).Return(nil)
+
+		resp, err := server.DeleteItem(asUser("carol"), &pb.DeleteItemRequest{Title: "vpn", Collection: "acme/devops"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Запись коллекции удалена.", resp.Message)
+		assert.Zero(t, resp.ExpiresAtUnix)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team item delete access", func(t *testing.T) {
+		// участник удаляет только добавленные им записи, участник только для чтения - никакие
+		current := teamRow
+		mockProvider.On("GetTeamData", mock.Anything, "bob", int64(11)).Return(current, member("bob", service.ORG_MEMBER), nil).Once()
+		_, err := server.trashData("bob", teamRow)
+		assert.ErrorIs(t, err, ErrNoDeleteAccess)
+
+		current.Username = "carol"
+		mockProvider.On("GetTeamData", mock.Anything, "carol", int64(11)).Return(current, member("carol", service.ORG_READ_ONLY), nil).Once()
+		_, err = server.trashData("carol", teamRow)
+		assert.ErrorIs(t, err, ErrNoDeleteAccess)
+
+		current.Username = "bob"
+		mockProvider.On("GetTeamData", mock.Anything, "bob", int64(11)).Return(current, member("bob", service.ORG_MEMBER), nil).Once()
+		mockProvider.On("DeleteCollectionItem", mock.Anything, int64(11)).Return(nil)
+		expiresAt, err := server.trashData("bob", teamRow)
+		assert.NoError(t, err)
+		assert.True(t, expiresAt.IsZero())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	// версия записи до изменения, зашифрованная ключом организации
+	oldIndex := service.TitleIndex(orgKey, "vpn-old")
+	oldTitle, _ := service.EncryptRecord("vpn-old", orgKey, 1, service.CollectionTitleAAD(5, oldIndex))
+	oldEncoded, _ := encodeItem(&pb.Item{Title: "vpn-old", Payload: &pb.Item_Text{Text: &pb.TextItem{Text: "old token"}}}, service.TEXT)
+	oldData, _ := service.EncryptRecord(oldEncoded, orgKey, 1, service.CollectionRecordAAD(5, 11, service.TEXT, "vpn-old"))
+	teamRevision := storage.Revision{ID: 7, Version: 1, TitleIndex: oldIndex, TitleCipher: oldTitle, Data: oldData, Author: "alice"}
+
+	t.Run("team item history listed", func(t *testing.T) {
+		expectKeys()
+		expectTeamTitles("carol", service.ORG_READ_ONLY)
+		listed := teamRevision
+		listed.Data = ""
+		mockProvider.On("ListCollectionRevisions", mock.Anything, int64(11)).Return([]storage.Revision{listed}, nil)
+
+		resp, err := server.ListRevisions(asUser("carol"), &pb.ListRevisionsRequest{Title: "vpn", Collection: "acme/devops"})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Revisions, 1)
+		assert.Equal(t, "vpn-old", resp.Revisions[0].Title)
+		assert.Equal(t, "alice", resp.Revisions[0].Author)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team revision read", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		expectTeamTitles("carol", service.ORG_READ_ONLY)
+		mockProvider.On("GetCollectionRevision", mock.Anything, int64(11), int64(7)).Return(teamRevision, nil)
+
+		resp, err := server.GetRevision(asUser("carol"), &pb.GetRevisionRequest{Title: "vpn", Collection: "acme/devops", RevisionId: 7})
+		assert.NoError(t, err)
+		assert.Equal(t, "vpn-old", resp.Item.Title)
+		assert.Equal(t, "old token", resp.Item.GetText().Text)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("team revision restored", func(t *testing.T) {
+		var updated storage.DataRow
+		expectKeys()
+		expectAudit(mockProvider)
+		expectTeamTitles("bob", service.ORG_MEMBER)
+		mockProvider.On("GetCollectionRevision", mock.Anything, int64(11), int64(7)).Return(teamRevision, nil)
+		mockProvider.On("UpdateCollectionItem", mock.Anything, mock.MatchedBy(func(row storage.DataRow) bool {
+			updated = row
+			return row.ID == 11
+		}), int64(2), mock.Anything).Return(nil)
+
+		resp, err := server.RestoreRevision(asUser("bob"), &pb.RestoreRevisionRequest{Title: "vpn", Collection: "acme/devops", RevisionId: 7})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), resp.Version)
+
+		title, err := openTeamTitle(updated, orgKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "vpn-old", title)
+		plainText, err := openTeamData(updated, orgKey)
+		assert.NoError(t, err)
+		item, err := decodeItem(title, service.TEXT, plainText)
+		assert.NoError(t, err)
+		assert.Equal(t, "old token", item.GetText().Text)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("read-only member cannot restore team revision", func(t *testing.T) {
+		expectKeys()
+		expectTeamTitles("carol", service.ORG_READ_ONLY)
+
+		_, err := server.RestoreRevision(asUser("carol"), &pb.RestoreRevisionRequest{Title: "vpn", Collection: "acme/devops", RevisionId: 7})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("organizations listed", func(t *testing.T) {
+		mockProvider.On("ListMemberships", mock.Anything, "bob").Return([]storage.OrgMember{member("bob", service.ORG_ADMIN)}, nil)
+		mockProvider.On("ListCollections", mock.Anything, int64(2)).Return([]storage.Collection{{ID: 5, OrgID: 2, Name: "devops"}}, nil)
+
+		resp, err := server.ListOrganizations(asUser("bob"), &pb.ListOrganizationsRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Organizations, 1)
+		assert.Equal(t, "acme", resp.Organizations[0].Name)
+		assert.Equal(t, pb.OrgRole_ORG_ROLE_ADMIN, resp.Organizations[0].Role)
+		assert.Equal(t, []string{"devops"}, resp.Organizations[0].Collections)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := server.ListOrganizations(context.Background(), &pb.ListOrganizationsRequest{})
+		assert.Equal(t, codes.Unauthenticated, codeOf(err))
+	})
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChangePassword меняет пароль пользователя после проверки старого. Ключи данных на сервере
+// обернуты мастер-ключом и от пароля не зависят, а при шифровании на клиенте вместе с паролем
+// заменяется ключ хранилища, зашифрованный ключом из нового пароля.
+// Остальные сессии пользователя удаляются, их стримы получают уведомление и закрываются.
+func (s *server) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.NewPassword == "" {
+		return nil, status.Error(codes.InvalidArgument, "new password required")
+	}
+
+	// проверка старого пароля ограничивается так же, как вход, чтобы украденный токен не позволял его подбирать
+	keys := attemptKeys(ctx, id.Username)
+	if err := s.checkLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := s.provider.GetPasswordHash(ctx, id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get password hash of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+	match, _, err := service.CheckPassword(req.OldPassword, passwordHash)
+	if err != nil || !match {
+		s.recordLoginFailure(keys)
+		return nil, status.Error(codes.PermissionDenied, "wrong password")
+	}
+
+	vault, err := s.provider.GetVault(ctx, id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get vault params of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+	if vault.ClientEncryption {
+		if req.KdfSalt == "" || req.WrappedVaultKey == "" {
+			return nil, status.Error(codes.InvalidArgument, "vault params required for client encryption")
+		}
+		vault.KdfSalt, vault.WrappedKey = req.KdfSalt, req.WrappedVaultKey
+	} else if req.KdfSalt != "" || req.WrappedVaultKey != "" {
+		return nil, status.Error(codes.InvalidArgument, "account does not use client encryption")
+	}
+
+	newHash, err := service.HashPassword(req.NewPassword)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+
+	revoked, err := s.provider.ChangePassword(ctx, id.Username, newHash, vault, id.SessionID)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to change password of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+	s.resetLoginFailures(id.Username)
+
+	// токены других сессий уже удалены, но открытые стримы проверялись только при подключении
+	s.revokeStreams(id.Username, "\nПароль изменен, сессия на этом устройстве завершена. Войдите с новым паролем.",
+		func(sessionID string) bool { return sessionID != id.SessionID })
+	logger.Log.Sugar().Infof("Password of %s changed, %d sessions revoked", id.Username, revoked)
+
+	return &pb.ChangePasswordResponse{
+		Message:         "Пароль изменен. Сессии на других устройствах завершены.",
+		RevokedSessions: int32(revoked),
+	}, nil
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestChangePassword(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		clients:  make(map[string]*client),
+		cfg:      &config.Config{SessionTTL: time.Hour, LoginMaxFailures: 5},
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "current"})
+	passwordHash, _ := service.HashPassword("old")
+	newPassword := mock.MatchedBy(func(hash string) bool {
+		match, _, err := service.CheckPassword("new", hash)
+		return err == nil && match
+	})
+
+	t.Run("other sessions revoked", func(t *testing.T) {
+		current, other, stranger := newClient(), newClient(), newClient()
+		current.sessionID, other.sessionID, stranger.sessionID = "current", "other", "stranger"
+		server.clients[username+"::1"] = current
+		server.clients[username+"::2"] = other
+		server.clients["otheruser::3"] = stranger
+
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetVault", mock.Anything, username).Return(storage.Vault{}, nil)
+		mockProvider.On("ChangePassword", mock.Anything, username, newPassword, storage.Vault{}, "current").Return(int64(2), nil)
+
+		resp, err := server.ChangePassword(ctx, &pb.ChangePasswordRequest{OldPassword: "old", NewPassword: "new"})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), resp.RevokedSessions)
+
+		// стрим другой сессии получает сигнал на закрытие, стримы текущей сессии и других пользователей остаются
+		assert.True(t, isClosed(other.revoked))
+		assert.NotEmpty(t, other.revokeReason)
+		assert.False(t, isClosed(current.revoked))
+		assert.False(t, isClosed(stranger.revoked))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+		server.clients = make(map[string]*client)
+	})
+
+	t.Run("wrong old password", func(t *testing.T) {
+		mockProvider.On("GetLoginAttempts", mock.Anything, []string{"user:" + username}).Return(nil, nil)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("RecordLoginFailure", mock.Anything, "user:"+username, mock.Anything).Return(storage.LoginAttempt{}, nil)
+
+		resp, err := server.ChangePassword(ctx, &pb.ChangePasswordRequest{OldPassword: "wrong", NewPassword: "new"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.PermissionDenied, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("vault key rewrapped for client encryption", func(t *testing.T) {
+		vault := storage.Vault{ClientEncryption: true, KdfSalt: "old-salt", WrappedKey: "old-key"}
+		newVault := storage.Vault{ClientEncryption: true, KdfSalt: "new-salt", WrappedKey: "new-key"}
+
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetVault", mock.Anything, username).Return(vault, nil)
+		mockProvider.On("ChangePassword", mock.Anything, username, newPassword, newVault, "current").Return(int64(0), nil)
+
+		_, err := server.ChangePassword(ctx, &pb.ChangePasswordRequest{
+			OldPassword:     "old",
+			NewPassword:     "new",
+			KdfSalt:         "new-salt",
+			WrappedVaultKey: "new-key",
+		})
+		assert.NoError(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("vault key missing for client encryption", func(t *testing.T) {
+		expectLoginAttempts(mockProvider)
+		expectAudit(mockProvider)
+		mockProvider.On("GetPasswordHash", mock.Anything, username).Return(passwordHash, nil)
+		mockProvider.On("GetVault", mock.Anything, username).Return(storage.Vault{ClientEncryption: true, KdfSalt: "salt", WrappedKey: "key"}, nil)
+
+		resp, err := server.ChangePassword(ctx, &pb.ChangePasswordRequest{OldPassword: "old", NewPassword: "new"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+// isClosed проверяет, закрыт ли канал
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
 	"keeper/internal/server/storage/sqlite"
 	pb "keeper/proto"
 
@@ -11,21 +12,44 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Register создает пользователя. Попытки зарегистрировать занятое имя считаются по адресу клиента,
+// чтобы ограничить перебор существующих аккаунтов.
 func (s *server) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	passwordHash, err := service.GetHashStr(req.Password)
+	keys := attemptKeys(ctx, "")
+	if err := s.checkLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	vault := storage.Vault{
+		ClientEncryption: req.ClientEncryption,
+		KdfSalt:          req.KdfSalt,
+		WrappedKey:       req.WrappedVaultKey,
+	}
+	if vault.ClientEncryption && (vault.KdfSalt == "" || vault.WrappedKey == "") {
+		return nil, status.Error(codes.InvalidArgument, "vault params required for client encryption")
+	}
+
+	passwordHash, err := service.HashPassword(req.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.provider.CreateUser(ctx, req.Username, passwordHash)
+	err = s.provider.CreateUser(ctx, req.Username, passwordHash, vault)
 	if err != nil {
 		if errors.Is(err, sqlite.ErrConflict) {
+			s.recordLoginFailure(keys)
 			return nil, status.Error(codes.AlreadyExists, "username already exists")
 		}
 		return nil, status.Error(codes.Internal, "failed to create user")
 	}
 
+	token, _, err := s.issueSession(ctx, req.Username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create session")
+	}
+
 	return &pb.RegisterResponse{
-		Message: "Регистрация завершена! Переподключитесь и войдите.",
+		Message: "Регистрация завершена! Вы уже вошли в аккаунт.",
+		Token:   token,
 	}, nil
 }
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/storage"
 	"keeper/internal/server/storage/sqlite"
 	pb "keeper/proto"
 
@@ -22,6 +25,7 @@ func TestRegister(t *testing.T) {
 	mockProvider := new(mocks.Provider)
 	server := &server{
 		provider: mockProvider,
+		cfg:      &config.Config{SessionTTL: time.Hour},
 	}
 
 	ctx := context.Background()
@@ -31,12 +35,14 @@ func TestRegister(t *testing.T) {
 	}
 
 	t.Run("successful registration", func(t *testing.T) {
-		mockProvider.On("CreateUser", ctx, req.Username, mock.Anything).Return(nil)
+		mockProvider.On("CreateUser", ctx, req.Username, mock.Anything, storage.Vault{}).Return(nil)
+		mockProvider.On("CreateSession", ctx, sessionOf(req.Username), mock.Anything).Return(nil)
 
 		resp, err := server.Register(ctx, req)
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
-		assert.Equal(t, "Регистрация завершена! Переподключитесь и войдите.", resp.Message)
+		assert.Equal(t, "Регистрация завершена! Вы уже вошли в аккаунт.", resp.Message)
+		assert.NotEmpty(t, resp.Token)
 
 		mockProvider.AssertExpectations(t)
 		// Очищаем ожидаемые вызовы после завершения теста
@@ -44,7 +50,7 @@ func TestRegister(t *testing.T) {
 	})
 
 	t.Run("user already exists", func(t *testing.T) {
-		mockProvider.On("CreateUser", ctx, req.Username, mock.Anything).Return(sqlite.ErrConflict)
+		mockProvider.On("CreateUser", ctx, req.Username, mock.Anything, storage.Vault{}).Return(sqlite.ErrConflict)
 
 		resp, err := server.Register(ctx, req)
 		assert.Error(t, err)
@@ -58,7 +64,7 @@ func TestRegister(t *testing.T) {
 	})
 
 	t.Run("internal error", func(t *testing.T) {
-		mockProvider.On("CreateUser", ctx, req.Username, mock.Anything).Return(errors.New("internal error"))
+		mockProvider.On("CreateUser", ctx, req.Username, mock.Anything, storage.Vault{}).Return(errors.New("internal error"))
 
 		resp, err := server.Register(ctx, req)
 		assert.Error(t, err)
@@ -70,4 +76,31 @@ func TestRegister(t *testing.T) {
 		// Очищаем ожидаемые вызовы после завершения теста
 		mockProvider.ExpectedCalls = nil
 	})
+	t.Run("client encryption without vault params", func(t *testing.T) {
+		resp, err := server.Register(ctx, &pb.RegisterRequest{Username: "testuser", Password: "password", ClientEncryption: true})
+		assert.Error(t, err)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+	})
+
+	t.Run("client encryption", func(t *testing.T) {
+		e2eReq := &pb.RegisterRequest{
+			Username:         "testuser",
+			Password:         "authkey",
+			ClientEncryption: true,
+			KdfSalt:          "salt",
+			WrappedVaultKey:  "wrapped",
+		}
+		vault := storage.Vault{ClientEncryption: true, KdfSalt: "salt", WrappedKey: "wrapped"}
+		mockProvider.On("CreateUser", ctx, e2eReq.Username, mock.Anything, vault).Return(nil)
+		mockProvider.On("CreateSession", ctx, sessionOf(e2eReq.Username), mock.Anything).Return(nil)
+
+		resp, err := server.Register(ctx, e2eReq)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Token)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
 }
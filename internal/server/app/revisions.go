@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRevisionLimit наибольшее количество версий, которое пользователь может хранить для каждой записи
+const maxRevisionLimit = 100
+
+// historyTarget возвращает запись, с историей которой работает пользователь. История своей записи
+// доступна только владельцу: в ней могут быть значения, сохраненные до того, как к записи открыли доступ.
+// Историю записи коллекции collection видят участники ее организации.
+func (s *server) historyTarget(ctx context.Context, username string, collection string, title string) (editTarget, error) {
+	if collection == "" {
+		current, err := s.findData(username, title)
+		if err != nil {
+			return editTarget{}, err
+		}
+		return editTarget{row: current, wrappedKey: current.ItemKey}, nil
+	}
+
+	row, err := s.findItem(ctx, username, "", collection, title)
+	if err != nil {
+		return editTarget{}, err
+	}
+	current, member, err := s.provider.GetTeamData(ctx, username, row.ID)
+	if err != nil {
+		return editTarget{}, err
+	}
+	current.Title = row.Title
+	return editTarget{row: current, member: member}, nil
+}
+
+// getRevision возвращает версию записи target из истории
+func (s *server) getRevision(ctx context.Context, target editTarget, revisionID int64) (storage.Revision, error) {
+	if target.row.CollectionID != 0 {
+		return s.provider.GetCollectionRevision(ctx, target.row.ID, revisionID)
+	}
+	return s.provider.GetRevision(ctx, target.row.ID, revisionID)
+}
+
+// openRevision расшифровывает название и данные версии записи target. Возвращает запись с названием
+// и данными версии и открытые данные. Данные, зашифрованные на клиенте, возвращаются как есть, sealed равен true.
+func (s *server) openRevision(target editTarget, revision storage.Revision) (storage.DataRow, string, bool, error) {
+	row := target.row
+	row.TitleIndex, row.TitleCipher = revision.TitleIndex, revision.TitleCipher
+	row.Data, row.ItemKey = revision.Data, revision.ItemKey
+
+	// версия командной записи зашифрована ключом организации
+	if row.CollectionID != 0 {
+		orgKey, err := s.orgKey(target.member)
+		if err != nil {
+			return storage.DataRow{}, "", false, err
+		}
+		if row.Title, err = openTeamTitle(row, orgKey); err != nil {
+			return storage.DataRow{}, "", false, err
+		}
+		plainText, err := openTeamData(row, orgKey)
+		if err != nil {
+			return storage.DataRow{}, "", false, err
+		}
+		return row, plainText, false, nil
+	}
+
+	title, err := s.openTitle(row)
+	if err != nil {
+		return storage.DataRow{}, "", false, err
+	}
+	row.Title = title
+
+	if sealed, found := strings.CutPrefix(row.Data, service.ClientSealedPrefix); found {
+		return row, sealed, true, nil
+	}
+
+	// общая запись расшифровывается копией ключа записи, которая была у владельца в этой версии
+	plainText, bound, err := s.decryptRecord(row)
+	if err != nil {
+		return storage.DataRow{}, "", false, err
+	}
+	if !bound && s.cfg.StrictAAD {
+		return storage.DataRow{}, "", false, ErrUnboundData
+	}
+	return row, plainText, false, nil
+}
+
+// revisionStatus преобразует ошибку операции с историей записи в ответ клиенту
+func revisionStatus(username string, err error) error {
+	switch {
+	case errors.Is(err, sqlite.ErrDataNotFound):
+		return status.Error(codes.NotFound, "item not found")
+	case errors.Is(err, sqlite.ErrRevisionNotFound):
+		return status.Error(codes.NotFound, "revision not found")
+	case errors.Is(err, sqlite.ErrTitleExists):
+		return status.Error(codes.AlreadyExists, "item with this title already exists")
+	case errors.Is(err, sqlite.ErrConflict):
+		return status.Error(codes.Aborted, "item changed, try again")
+	case errors.Is(err, ErrReadOnly):
+		return status.Error(codes.PermissionDenied, "no write access to item")
+	default:
+		logger.Log.Sugar().Errorf("Revision operation of %s failed: %v", username, err)
+		return status.Error(codes.Internal, "revision operation failed")
+	}
+}
+
+// ListRevisions возвращает историю своей записи или записи коллекции
+func (s *server) ListRevisions(ctx context.Context, req *pb.ListRevisionsRequest) (*pb.ListRevisionsResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title required")
+	}
+
+	target, err := s.historyTarget(ctx, id.Username, req.Collection, req.Title)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	// названия версий командной записи расшифровываются ключом организации
+	var revisions []storage.Revision
+	var orgKey string
+	if target.row.CollectionID != 0 {
+		revisions, err = s.provider.ListCollectionRevisions(ctx, target.row.ID)
+		if err == nil {
+			orgKey, err = s.orgKey(target.member)
+		}
+	} else {
+		revisions, err = s.provider.ListRevisions(ctx, target.row.ID)
+	}
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+
+	result := make([]*pb.Revision, 0, len(revisions))
+	for _, revision := range revisions {
+		row := storage.DataRow{Username: id.Username, TitleIndex: revision.TitleIndex, TitleCipher: revision.TitleCipher, CollectionID: target.row.CollectionID}
+		var title string
+		if row.CollectionID != 0 {
+			title, err = openTeamTitle(row, orgKey)
+		} else {
+			title, err = s.openTitle(row)
+		}
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to decrypt title of revision %d: %v", revision.ID, err)
+			return nil, status.Error(codes.Internal, "failed to list revisions")
+		}
+		result = append(result, &pb.Revision{
+			Id:            revision.ID,
+			Version:       revision.Version,
+			Title:         title,
+			Author:        revision.Author,
+			SessionId:     revision.SessionID,
+			CreatedAtUnix: revision.CreatedAt.Unix(),
+		})
+	}
+	return &pb.ListRevisionsResponse{Revisions: result}, nil
+}
+
+// GetRevision возвращает данные версии своей записи или записи коллекции из истории
+func (s *server) GetRevision(ctx context.Context, req *pb.GetRevisionRequest) (*pb.GetRevisionResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" || req.RevisionId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "title and revision id required")
+	}
+
+	target, err := s.historyTarget(ctx, id.Username, req.Collection, req.Title)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	revision, err := s.getRevision(ctx, target, req.RevisionId)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	row, plainText, sealed, err := s.openRevision(target, revision)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.REVISION_READ, target.row)
+	if sealed {
+		return &pb.GetRevisionResponse{Item: &pb.Item{Title: row.Title, Payload: &pb.Item_Sealed{Sealed: plainText}}}, nil
+	}
+	item, err := decodeItem(row.Title, row.DataType, plainText)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	return &pb.GetRevisionResponse{Item: item}, nil
+}
+
+// RestoreRevision делает версию из истории текущим значением своей записи или записи коллекции. Текущее значение
+// при этом тоже попадает в историю, поэтому восстановление можно отменить.
+// Данные перешифровываются текущим ключом, общая запись остается доступна получателям.
+func (s *server) RestoreRevision(ctx context.Context, req *pb.RestoreRevisionRequest) (*pb.RestoreRevisionResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" || req.RevisionId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "title and revision id required")
+	}
+
+	target, err := s.historyTarget(ctx, id.Username, req.Collection, req.Title)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	// восстановление изменяет запись коллекции, участникам только для чтения оно недоступно
+	if target.row.CollectionID != 0 && !canWriteItems(target.member.Role) {
+		return nil, revisionStatus(id.Username, ErrReadOnly)
+	}
+	revision, err := s.getRevision(ctx, target, req.RevisionId)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	row, plainText, sealed, err := s.openRevision(target, revision)
+	if err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+
+	target.sealed = sealed
+	if err := s.saveUpdate(id, target, row.Title, plainText); err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.REVISION_RESTORE, target.row)
+	message := fmt.Sprintf("Восстановлена версия %d записи: %s", revision.Version, row.Title)
+	return &pb.RestoreRevisionResponse{Message: message, Version: target.row.Version + 1}, nil
+}
+
+// SetRevisionLimit меняет количество прежних версий, которые хранятся для каждой записи пользователя.
+// Лишние версии удаляются сразу, 0 отключает историю.
+func (s *server) SetRevisionLimit(ctx context.Context, req *pb.SetRevisionLimitRequest) (*pb.SetRevisionLimitResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Limit < 0 || req.Limit > maxRevisionLimit {
+		return nil, status.Error(codes.InvalidArgument, "limit must be between 0 and 100")
+	}
+
+	if err := s.provider.SetRevisionLimit(ctx, id.Username, int(req.Limit)); err != nil {
+		return nil, revisionStatus(id.Username, err)
+	}
+	return &pb.SetRevisionLimitResponse{Message: fmt.Sprintf("Хранится версий каждой записи: %d", req.Limit)}, nil
+}
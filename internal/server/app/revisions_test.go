@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRevisions(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	expectKeys := func() {
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+		mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+	}
+
+	// текущая версия 4 называется "home wifi", в истории версия 3 называлась "wifi"
+	index := service.TitleIndex(dataKey, "home wifi")
+	titleCipher, _ := service.EncryptRecord("home wifi", dataKey, 1, service.TitleAAD("alice", index))
+	current := storage.DataRow{ID: 7, Username: "alice", TitleIndex: index, TitleCipher: titleCipher, DataType: service.TEXT, Version: 4}
+	current.Data, _ = service.EncryptRecord(`{"text":"new"}`, dataKey, 1, service.RecordAAD("alice", 7, service.TEXT, "home wifi"))
+
+	oldIndex := service.TitleIndex(dataKey, "wifi")
+	oldTitleCipher, _ := service.EncryptRecord("wifi", dataKey, 1, service.TitleAAD("alice", oldIndex))
+	revision := storage.Revision{ID: 21, ItemID: 7, Version: 3, TitleIndex: oldIndex, TitleCipher: oldTitleCipher,
+		Author: "alice", SessionID: "session-id", CreatedAt: time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)}
+	revision.Data, _ = service.EncryptRecord(`{"text":"old"}`, dataKey, 1, service.RecordAAD("alice", 7, service.TEXT, "wifi"))
+
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "other-session"})
+	codeOf := func(err error) codes.Code {
+		st, _ := status.FromError(err)
+		return st.Code()
+	}
+
+	t.Run("list revisions", func(t *testing.T) {
+		listed := revision
+		listed.Data = ""
+		expectKeys()
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("ListRevisions", mock.Anything, int64(7)).Return([]storage.Revision{listed}, nil)
+
+		resp, err := server.ListRevisions(ctx, &pb.ListRevisionsRequest{Title: "home wifi"})
+		assert.NoError(t, err)
+		assert.Equal(t, []*pb.Revision{{
+			Id:            21,
+			Version:       3,
+			Title:         "wifi",
+			Author:        "alice",
+			SessionId:     "session-id",
+			CreatedAtUnix: revision.CreatedAt.Unix(),
+		}}, resp.Revisions)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("view revision", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("GetRevision", mock.Anything, int64(7), int64(21)).Return(revision, nil)
+
+		resp, err := server.GetRevision(ctx, &pb.GetRevisionRequest{Title: "home wifi", RevisionId: 21})
+		assert.NoError(t, err)
+		assert.Equal(t, "wifi", resp.Item.Title)
+		assert.Equal(t, "old", resp.Item.GetText().Text)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("view sealed revision", func(t *testing.T) {
+		sealed := revision
+		sealed.Data = service.ClientSealedPrefix + "abcdef"
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("GetRevision", mock.Anything, int64(7), int64(21)).Return(sealed, nil)
+
+		resp, err := server.GetRevision(ctx, &pb.GetRevisionRequest{Title: "home wifi", RevisionId: 21})
+		assert.NoError(t, err)
+		assert.Equal(t, "wifi", resp.Item.Title)
+		assert.Equal(t, "abcdef", resp.Item.GetSealed())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unknown revision", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("GetRevision", mock.Anything, int64(7), int64(22)).Return(storage.Revision{}, sqlite.ErrRevisionNotFound)
+
+		_, err := server.GetRevision(ctx, &pb.GetRevisionRequest{Title: "home wifi", RevisionId: 22})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("restore revision", func(t *testing.T) {
+		var restored storage.DataRow
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("GetRevision", mock.Anything, int64(7), int64(21)).Return(revision, nil)
+		mockProvider.On("UpdateData", mock.Anything, mock.MatchedBy(func(r storage.DataRow) bool {
+			restored = r
+			return r.ID == 7 && r.TitleIndex == oldIndex
+		}), int64(4), mock.MatchedBy(func(author storage.Revision) bool {
+			return author.Author == "alice" && author.SessionID == "other-session" && !author.CreatedAt.IsZero()
+		})).Return(nil)
+
+		resp, err := server.RestoreRevision(ctx, &pb.RestoreRevisionRequest{Title: "home wifi", RevisionId: 21})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), resp.Version)
+
+		// восстановленные данные перешифрованы и привязаны к названию версии
+		restored.Username, restored.DataType, restored.Title = "alice", service.TEXT, "wifi"
+		plainText, bound, err := server.decryptRecord(restored)
+		assert.NoError(t, err)
+		assert.True(t, bound)
+		assert.Equal(t, `{"text":"old"}`, plainText)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("restore over taken title", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("GetRevision", mock.Anything, int64(7), int64(21)).Return(revision, nil)
+		mockProvider.On("UpdateData", mock.Anything, mock.Anything, int64(4), mock.Anything).Return(sqlite.ErrTitleExists)
+
+		_, err := server.RestoreRevision(ctx, &pb.RestoreRevisionRequest{Title: "home wifi", RevisionId: 21})
+		assert.Equal(t, codes.AlreadyExists, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("revisions of shared item", func(t *testing.T) {
+		// получатель ищет запись по своему ключу названий и не находит ее
+		mockProvider.On("GetUserKey", mock.Anything, "bob", 1).Return(userKey, nil)
+		mockProvider.On("GetData", mock.Anything, "bob", mock.Anything).Return(storage.DataRow{}, sqlite.ErrDataNotFound)
+
+		bob := withIdentity(context.Background(), identity{Username: "bob", SessionID: "bob-session"})
+		_, err := server.ListRevisions(bob, &pb.ListRevisionsRequest{Title: "home wifi"})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("set limit", func(t *testing.T) {
+		mockProvider.On("SetRevisionLimit", mock.Anything, "alice", 3).Return(nil)
+
+		_, err := server.SetRevisionLimit(ctx, &pb.SetRevisionLimitRequest{Limit: 3})
+		assert.NoError(t, err)
+
+		_, err = server.SetRevisionLimit(ctx, &pb.SetRevisionLimitRequest{Limit: maxRevisionLimit + 1})
+		assert.Equal(t, codes.InvalidArgument, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := server.ListRevisions(context.Background(), &pb.ListRevisionsRequest{Title: "wifi"})
+		assert.Equal(t, codes.Unauthenticated, codeOf(err))
+	})
+}
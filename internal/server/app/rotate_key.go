@@ -0,0 +1,190 @@
+package app
+
+import (
+	"strings"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+)
+
+// bindingRotationID - строка прогресса в key_rotations для перешифровки непривязанных данных.
+// Привязка не зависит от мастер-ключа, поэтому у нее свой курсор, общий для всех ротаций:
+// записи, сохраненные до появления привязки, перешифровываются и после уже завершенной ротации.
+const bindingRotationID = "aad-binding"
+
+// RotateKey перешифровывает текущим мастер-ключом ключи пользователей, а данные,
+// которые еще зашифрованы мастер-ключом напрямую или не привязаны к записи, вместе с историей записей перешифровывает ключом пользователя. Работа идет пачками, каждая пачка
+// сохраняется в своей транзакции вместе с прогрессом, поэтому прерванную ротацию можно
+// продолжить повторным запуском. Пока ротация не завершена, старые ключи должны оставаться в связке.
+func (s *server) RotateKey() error {
+	rotationID := s.keyring.CurrentID()
+	rotation, err := s.provider.GetRotation(s.ctx, rotationID)
+	if err != nil {
+		return err
+	}
+	binding, err := s.provider.GetRotation(s.ctx, bindingRotationID)
+	if err != nil {
+		return err
+	}
+	if rotation.Finished && binding.Finished {
+		logger.Log.Sugar().Infof("Rotation to key %s already finished", rotationID)
+		return nil
+	}
+
+	// сначала ключи пользователей, чтобы данные перешифровывались уже ключами, обернутыми текущим мастер-ключом
+	if !rotation.Finished {
+		if err := s.rewrapUserKeys(rotation); err != nil {
+			return err
+		}
+	}
+	if !binding.Finished {
+		if err := s.reencryptLegacyData(binding); err != nil {
+			return err
+		}
+		if err := s.reencryptRevisions(binding); err != nil {
+			return err
+		}
+		if err := s.provider.FinishRotation(s.ctx, binding.ID); err != nil {
+			return err
+		}
+	}
+
+	// ротация завершается только после данных: записи без заголовка зашифрованы старым мастер-ключом
+	if !rotation.Finished {
+		if err := s.provider.FinishRotation(s.ctx, rotationID); err != nil {
+			return err
+		}
+	}
+	logger.Log.Sugar().Infof("Rotation to key %s finished, old keys can be removed from keyring", rotationID)
+	return nil
+}
+
+func (s *server) rewrapUserKeys(rotation storage.Rotation) error {
+	afterID := rotation.KeysAfter
+	for {
+		keys, err := s.provider.GetUserKeysAfter(s.ctx, afterID, s.cfg.RotateBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		var updates []storage.CipherUpdate
+		for _, key := range keys {
+			if s.keyring.IsCurrent(key.WrappedKey) {
+				continue
+			}
+
+			dataKey, err := s.keyring.Unwrap(key.WrappedKey)
+			if err != nil {
+				logger.Log.Sugar().Errorf("Failed to unwrap key of %s: %v", key.Username, err)
+				return err
+			}
+			wrappedKey, err := s.keyring.Wrap(dataKey)
+			if err != nil {
+				return err
+			}
+			updates = append(updates, storage.CipherUpdate{ID: key.ID, Old: key.WrappedKey, New: wrappedKey})
+		}
+
+		afterID = keys[len(keys)-1].ID
+		if err := s.provider.SaveRewrappedKeys(s.ctx, rotation.ID, updates, afterID); err != nil {
+			return err
+		}
+		logger.Log.Sugar().Infof("Rewrapped %d user keys, last id %d", len(updates), afterID)
+	}
+}
+
+func (s *server) reencryptLegacyData(rotation storage.Rotation) error {
+	afterID := rotation.DataAfter
+	for {
+		rows, err := s.provider.GetDataAfter(s.ctx, afterID, s.cfg.RotateBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		var updates []storage.CipherUpdate
+		for _, row := range rows {
+			cipherText, err := s.rebindRecord(row)
+			if err != nil {
+				logger.Log.Sugar().Errorf("Failed to re-encrypt data %d: %v", row.ID, err)
+				return err
+			}
+			if cipherText != "" {
+				updates = append(updates, storage.CipherUpdate{ID: row.ID, Old: row.Data, New: cipherText})
+			}
+		}
+
+		afterID = rows[len(rows)-1].ID
+		if err := s.provider.SaveReencryptedData(s.ctx, rotation.ID, updates, afterID); err != nil {
+			return err
+		}
+		logger.Log.Sugar().Infof("Re-encrypted %d records, last id %d", len(updates), afterID)
+	}
+}
+
+// reencryptRevisions перешифровывает версии из истории: при изменении записи ее шифртекст
+// попадает в историю как есть, в том числе зашифрованный старым мастер-ключом или без привязки
+func (s *server) reencryptRevisions(rotation storage.Rotation) error {
+	afterID := rotation.RevisionsAfter
+	for {
+		revisions, err := s.provider.GetRevisionsAfter(s.ctx, afterID, s.cfg.RotateBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+
+		var updates []storage.CipherUpdate
+		for _, revision := range revisions {
+			cipherText, err := s.rebindRecord(revision.Row)
+			if err != nil {
+				logger.Log.Sugar().Errorf("Failed to re-encrypt revision %d: %v", revision.ID, err)
+				return err
+			}
+			if cipherText != "" {
+				updates = append(updates, storage.CipherUpdate{ID: revision.ID, Old: revision.Row.Data, New: cipherText})
+			}
+		}
+
+		afterID = revisions[len(revisions)-1].ID
+		if err := s.provider.SaveReencryptedRevisions(s.ctx, rotation.ID, updates, afterID); err != nil {
+			return err
+		}
+		logger.Log.Sugar().Infof("Re-encrypted %d revisions, last id %d", len(updates), afterID)
+	}
+}
+
+// rebindRecord перешифровывает данные записи ключом пользователя с привязкой к записи.
+// Возвращает пустую строку, если данные перешифровывать не нужно.
+func (s *server) rebindRecord(row storage.DataRow) (string, error) {
+	// данные, зашифрованные на клиенте, сервер не трогает
+	if strings.HasPrefix(row.Data, service.ClientSealedPrefix) {
+		return "", nil
+	}
+	// привязанные к записи данные зашифрованы ключом пользователя и от мастер-ключа не зависят
+	header, _, err := service.ParseHeader(row.Data)
+	if err != nil {
+		return "", err
+	}
+	if header.Bound {
+		return "", nil
+	}
+
+	// новый шифртекст привязывается к открытому названию записи
+	row.Title, err = s.openTitle(row)
+	if err != nil {
+		return "", err
+	}
+	plainText, _, err := s.decryptRecord(row)
+	if err != nil {
+		return "", err
+	}
+	return s.encryptRecord(row, plainText)
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRotateKey(t *testing.T) {
+	oldSecret := "thisis32byteencryptionkey1234567"
+	newSecret := "anotherthirtytwobyteslongkey0001"
+
+	mockProvider := new(mocks.Provider)
+	oldKeyring, _ := service.NewKeyring("1", oldSecret, nil)
+	keyring, _ := service.NewKeyring("2", newSecret, map[string]string{"1": oldSecret})
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{RotateBatchSize: 10},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	t.Run("already finished", func(t *testing.T) {
+		mockProvider.On("GetRotation", mock.Anything, "2").Return(storage.Rotation{ID: "2", Finished: true}, nil)
+		mockProvider.On("GetRotation", mock.Anything, bindingRotationID).Return(storage.Rotation{ID: bindingRotationID, Finished: true}, nil)
+
+		err := server.RotateKey()
+		assert.NoError(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.AssertNotCalled(t, "GetUserKeysAfter", mock.Anything, mock.Anything, mock.Anything)
+		mockProvider.AssertNotCalled(t, "GetDataAfter", mock.Anything, mock.Anything, mock.Anything)
+		mockProvider.AssertNotCalled(t, "GetRevisionsAfter", mock.Anything, mock.Anything, mock.Anything)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("bind records after finished rotation", func(t *testing.T) {
+		dataKey, _ := service.GenerateDataKey()
+		wrapped, _ := keyring.Wrap(dataKey)
+		row := storage.DataRow{ID: 8, Username: "testuser", Title: "unbound", DataType: service.TEXT}
+		// запись с заголовком u1: зашифрована ключом пользователя без привязки
+		unboundCipher, _ := service.Encrypt("unbound", dataKey)
+		unboundData := "u1:" + unboundCipher
+		index := service.TitleIndex(dataKey, row.Title)
+		title, _ := service.EncryptRecord(row.Title, dataKey, 1, service.TitleAAD("testuser", index))
+
+		// ротация на ключ 2 завершилась до появления привязки, у привязки свой курсор
+		mockProvider.On("GetRotation", mock.Anything, "2").Return(storage.Rotation{ID: "2", DataAfter: 10, Finished: true}, nil)
+		mockProvider.On("GetRotation", mock.Anything, bindingRotationID).Return(storage.Rotation{ID: bindingRotationID, DataAfter: 5}, nil)
+
+		mockProvider.On("GetDataAfter", mock.Anything, int64(5), 10).Return([]storage.DataRow{
+			{ID: 8, Username: "testuser", TitleIndex: index, TitleCipher: title, DataType: service.TEXT, Data: unboundData},
+		}, nil)
+		mockProvider.On("GetDataAfter", mock.Anything, int64(8), 10).Return(nil, nil)
+		mockProvider.On("GetLatestUserKey", mock.Anything, "testuser").Return(storage.UserKey{Version: 1, WrappedKey: wrapped}, nil)
+		mockProvider.On("GetUserKey", mock.Anything, "testuser", 1).Return(storage.UserKey{Version: 1, WrappedKey: wrapped}, nil)
+		var reencrypted string
+		mockProvider.On("SaveReencryptedData", mock.Anything, bindingRotationID, mock.MatchedBy(func(updates []storage.CipherUpdate) bool {
+			if len(updates) != 1 || updates[0].ID != 8 || updates[0].Old != unboundData {
+				return false
+			}
+			reencrypted = updates[0].New
+			return true
+		}), int64(8)).Return(nil)
+		bound, _ := service.EncryptRecord("unbound", dataKey, 1, recordAAD(row))
+		// прежняя версия записи сохранена в историю зашифрованной старым мастер-ключом
+		revisionData, _ := service.Encrypt("old value", oldSecret)
+		revisionTitle, _ := service.EncryptRecord("old title", dataKey, 1, service.TitleAAD("testuser", "old-index"))
+		mockProvider.On("GetRevisionsAfter", mock.Anything, int64(0), 10).Return([]storage.RevisionRow{
+			{ID: 3, Row: storage.DataRow{ID: 8, Username: "testuser", TitleIndex: "old-index", TitleCipher: revisionTitle, DataType: service.TEXT, Data: revisionData}},
+			{ID: 4, Row: storage.DataRow{ID: 8, Username: "testuser", TitleIndex: index, TitleCipher: title, DataType: service.TEXT, Data: bound}},
+		}, nil)
+		mockProvider.On("GetRevisionsAfter", mock.Anything, int64(4), 10).Return(nil, nil)
+		var revision string
+		mockProvider.On("SaveReencryptedRevisions", mock.Anything, bindingRotationID, mock.MatchedBy(func(updates []storage.CipherUpdate) bool {
+			if len(updates) != 1 || updates[0].ID != 3 || updates[0].Old != revisionData {
+				return false
+			}
+			revision = updates[0].New
+			return true
+		}), int64(4)).Return(nil)
+		mockProvider.On("FinishRotation", mock.Anything, bindingRotationID).Return(nil)
+
+		err := server.RotateKey()
+		assert.NoError(t, err)
+
+		// версия из истории привязана к записи со своим названием
+		header, body, err := service.ParseHeader(revision)
+		assert.NoError(t, err)
+		assert.Equal(t, service.KeyHeader{Version: 1, Bound: true}, header)
+		plainText, err := service.DecryptWithAAD(body, dataKey, service.RecordAAD("testuser", 8, service.TEXT, "old title"))
+		assert.NoError(t, err)
+		assert.Equal(t, "old value", plainText)
+
+		header, body, err = service.ParseHeader(reencrypted)
+		assert.NoError(t, err)
+		assert.Equal(t, service.KeyHeader{Version: 1, Bound: true}, header)
+		plainText, err = service.DecryptWithAAD(body, dataKey, recordAAD(row))
+		assert.NoError(t, err)
+		assert.Equal(t, "unbound", plainText)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.AssertNotCalled(t, "GetUserKeysAfter", mock.Anything, mock.Anything, mock.Anything)
+		mockProvider.AssertNotCalled(t, "FinishRotation", mock.Anything, "2")
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("rewrap keys and re-encrypt legacy data", func(t *testing.T) {
+		dataKey, _ := service.GenerateDataKey()
+		oldWrapped, _ := oldKeyring.Wrap(dataKey)
+		legacyData, _ := service.Encrypt("legacy", oldSecret)
+		boundRow := storage.DataRow{ID: 2, Username: "testuser", Title: "bound", DataType: service.TEXT}
+		boundData, _ := service.EncryptRecord("bound", dataKey, 1, recordAAD(boundRow))
+		sealedData := service.ClientSealedPrefix + "abcdef"
+		legacyIndex := service.TitleIndex(dataKey, "legacy")
+		legacyTitle, _ := service.EncryptRecord("legacy", dataKey, 1, service.TitleAAD("testuser", legacyIndex))
+
+		// продолжаем прерванную ротацию: первая пачка ключей уже обработана
+		mockProvider.On("GetRotation", mock.Anything, "2").Return(storage.Rotation{ID: "2", KeysAfter: 3}, nil)
+		mockProvider.On("GetRotation", mock.Anything, bindingRotationID).Return(storage.Rotation{ID: bindingRotationID}, nil)
+
+		mockProvider.On("GetUserKeysAfter", mock.Anything, int64(3), 10).
+			Return([]storage.KeyRow{{ID: 4, Username: "testuser", WrappedKey: oldWrapped}}, nil)
+		mockProvider.On("GetUserKeysAfter", mock.Anything, int64(4), 10).Return(nil, nil)
+		var rewrapped string
+		mockProvider.On("SaveRewrappedKeys", mock.Anything, "2", mock.MatchedBy(func(updates []storage.CipherUpdate) bool {
+			if len(updates) != 1 || updates[0].ID != 4 || updates[0].Old != oldWrapped {
+				return false
+			}
+			rewrapped = updates[0].New
+			return true
+		}), int64(4)).Return(nil)
+
+		mockProvider.On("GetDataAfter", mock.Anything, int64(0), 10).Return([]storage.DataRow{
+			{ID: 1, Username: "testuser", TitleIndex: legacyIndex, TitleCipher: legacyTitle, DataType: service.PASSWORD, Data: legacyData},
+			{ID: 2, Username: "testuser", TitleIndex: "bound", DataType: service.TEXT, Data: boundData},
+			{ID: 3, Username: "e2euser", TitleIndex: "sealed", DataType: service.TEXT, Data: sealedData},
+		}, nil)
+		mockProvider.On("GetDataAfter", mock.Anything, int64(3), 10).Return(nil, nil)
+		mockProvider.On("GetRevisionsAfter", mock.Anything, int64(0), 10).Return(nil, nil)
+		mockProvider.On("GetLatestUserKey", mock.Anything, "testuser").Return(storage.UserKey{Version: 1, WrappedKey: oldWrapped}, nil)
+		mockProvider.On("GetUserKey", mock.Anything, "testuser", 1).Return(storage.UserKey{Version: 1, WrappedKey: oldWrapped}, nil)
+		var reencrypted string
+		mockProvider.On("SaveReencryptedData", mock.Anything, bindingRotationID, mock.MatchedBy(func(updates []storage.CipherUpdate) bool {
+			if len(updates) != 1 || updates[0].ID != 1 || updates[0].Old != legacyData {
+				return false
+			}
+			reencrypted = updates[0].New
+			return true
+		}), int64(3)).Return(nil)
+		mockProvider.On("FinishRotation", mock.Anything, bindingRotationID).Return(nil)
+		mockProvider.On("FinishRotation", mock.Anything, "2").Return(nil)
+
+		err := server.RotateKey()
+		assert.NoError(t, err)
+
+		// ключ пользователя обернут новым мастер-ключом
+		assert.True(t, keyring.IsCurrent(rewrapped))
+		unwrapped, err := keyring.Unwrap(rewrapped)
+		assert.NoError(t, err)
+		assert.Equal(t, dataKey, unwrapped)
+
+		// старая запись зашифрована ключом пользователя и привязана к записи
+		header, body, err := service.ParseHeader(reencrypted)
+		assert.NoError(t, err)
+		assert.Equal(t, service.KeyHeader{Version: 1, Bound: true}, header)
+		plainText, err := service.DecryptWithAAD(body, dataKey, service.RecordAAD("testuser", 1, service.PASSWORD, "legacy"))
+		assert.NoError(t, err)
+		assert.Equal(t, "legacy", plainText)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
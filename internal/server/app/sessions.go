@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListSessions возвращает активные сессии пользователя: устройство, адрес, время входа
+// и последней активности. Отмечаются текущая сессия и сессии с открытым стримом.
+func (s *server) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	sessions, err := s.provider.ListSessions(ctx, id.Username, time.Now())
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to list sessions of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to list sessions")
+	}
+
+	connected := s.connectedSessions(id.Username)
+	resp := &pb.ListSessionsResponse{Sessions: make([]*pb.SessionInfo, 0, len(sessions))}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &pb.SessionInfo{
+			Id:             session.ID,
+			Device:         session.Device,
+			Ip:             session.IP,
+			CreatedAtUnix:  session.CreatedAt.Unix(),
+			LastSeenAtUnix: session.LastSeenAt.Unix(),
+			Current:        session.ID == id.SessionID,
+			Connected:      connected[session.ID],
+		})
+	}
+	return resp, nil
+}
+
+// RevokeSession удаляет сессию пользователя, ее токен перестает действовать,
+// а открытый стрим получает уведомление и закрывается. Можно отозвать и текущую сессию.
+func (s *server) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "session id required")
+	}
+
+	// сессия ищется только среди сессий пользователя, чужую отозвать нельзя
+	err = s.provider.DeleteSession(ctx, id.Username, req.SessionId)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrSessionNotFound) {
+			return nil, status.Error(codes.NotFound, "session not found")
+		}
+		logger.Log.Sugar().Errorf("Failed to delete session of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to revoke session")
+	}
+
+	s.revokeStreams(id.Username, "\nСессия завершена с другого устройства.",
+		func(sessionID string) bool { return sessionID == req.SessionId })
+	logger.Log.Sugar().Infof("Session %s of %s revoked", req.SessionId, id.Username)
+
+	return &pb.RevokeSessionResponse{Message: "Сессия завершена."}, nil
+}
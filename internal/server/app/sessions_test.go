@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestIssueSession(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{SessionTTL: time.Hour},
+	}
+
+	t.Run("device and address saved", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(deviceMetadataKey, " laptop "))
+		ctx = withPeerAddr(ctx, "10.0.0.1:51000")
+		saved := mock.MatchedBy(func(session storage.Session) bool {
+			return session.Username == "alice" && session.Device == "laptop" && session.IP == "10.0.0.1"
+		})
+		mockProvider.On("CreateSession", mock.Anything, saved, mock.Anything).Return(nil)
+
+		token, sessionID, err := server.issueSession(ctx, "alice")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.NotEmpty(t, sessionID)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("long device name truncated", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(deviceMetadataKey, strings.Repeat("x", 100)))
+		truncated := mock.MatchedBy(func(session storage.Session) bool {
+			return len(session.Device) == maxDeviceLength && session.IP == ""
+		})
+		mockProvider.On("CreateSession", mock.Anything, truncated, mock.Anything).Return(nil)
+
+		_, _, err := server.issueSession(ctx, "alice")
+		assert.NoError(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
+
+func TestListSessions(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "current"})
+
+	t.Run("sessions listed", func(t *testing.T) {
+		created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		seen := created.Add(time.Hour)
+		sessions := []storage.Session{
+			{ID: "current", Username: username, Device: "laptop", IP: "10.0.0.1", CreatedAt: created, LastSeenAt: seen},
+			{ID: "other", Username: username, Device: "phone", IP: "10.0.0.2", CreatedAt: created, LastSeenAt: created},
+		}
+		// стрим открыт только у второй сессии, стрим другого пользователя не учитывается
+		other := newClient()
+		other.sessionID = "other"
+		server.clients[username+"::1"] = other
+		stranger := newClient()
+		stranger.sessionID = "current"
+		server.clients["stranger::1"] = stranger
+
+		mockProvider.On("ListSessions", mock.Anything, username, mock.Anything).Return(sessions, nil)
+
+		resp, err := server.ListSessions(ctx, &pb.ListSessionsRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Sessions, 2)
+		assert.Equal(t, "laptop", resp.Sessions[0].Device)
+		assert.Equal(t, seen.Unix(), resp.Sessions[0].LastSeenAtUnix)
+		assert.True(t, resp.Sessions[0].Current)
+		assert.False(t, resp.Sessions[0].Connected)
+		assert.False(t, resp.Sessions[1].Current)
+		assert.True(t, resp.Sessions[1].Connected)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+		server.clients = make(map[string]*client)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		resp, err := server.ListSessions(context.Background(), &pb.ListSessionsRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+}
+
+func TestRevokeSession(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider: mockProvider,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "current"})
+
+	t.Run("session revoked", func(t *testing.T) {
+		current, other := newClient(), newClient()
+		current.sessionID, other.sessionID = "current", "other"
+		server.clients[username+"::1"] = current
+		server.clients[username+"::2"] = other
+
+		mockProvider.On("DeleteSession", mock.Anything, username, "other").Return(nil)
+
+		resp, err := server.RevokeSession(ctx, &pb.RevokeSessionRequest{SessionId: "other"})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Message)
+
+		// закрывается только стрим отозванной сессии
+		assert.False(t, isClosed(current.revoked))
+		assert.True(t, isClosed(other.revoked))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+		server.clients = make(map[string]*client)
+	})
+
+	t.Run("session not found", func(t *testing.T) {
+		mockProvider.On("DeleteSession", mock.Anything, username, "unknown").Return(sqlite.ErrSessionNotFound)
+
+		resp, err := server.RevokeSession(ctx, &pb.RevokeSessionRequest{SessionId: "unknown"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.NotFound, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("empty session id", func(t *testing.T) {
+		resp, err := server.RevokeSession(ctx, &pb.RevokeSessionRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+	})
+}
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrShareSealed описывает попытку поделиться записью, зашифрованной на клиенте.
+	ErrShareSealed = errors.New("client-encrypted item cannot be shared")
+	// ErrShareNotFound описывает отзыв доступа, который не был открыт.
+	ErrShareNotFound = errors.New("share not found")
+	// ErrNotShared описывает общую запись, данные которой не зашифрованы ключом записи.
+	ErrNotShared = errors.New("item is not encrypted with item key")
+)
+
+// sharePermissions уровни доступа из запроса клиента
+var sharePermissions = map[pb.SharePermission]service.SharePermission{
+	pb.SharePermission_SHARE_PERMISSION_READ:  service.SHARE_READ,
+	pb.SharePermission_SHARE_PERMISSION_WRITE: service.SHARE_WRITE,
+}
+
+// sharePermissionNames названия уровней доступа для уведомлений
+var sharePermissionNames = map[service.SharePermission]string{
+	service.SHARE_READ:  "чтение",
+	service.SHARE_WRITE: "чтение и запись",
+}
+
+// ShareItem открывает другому пользователю доступ к записи на чтение или на чтение и запись.
+// Повторный вызов меняет уровень доступа. Получатель получает уведомление в открытые стримы команд.
+func (s *server) ShareItem(ctx context.Context, req *pb.ShareItemRequest) (*pb.ShareItemResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" || req.Recipient == "" {
+		return nil, status.Error(codes.InvalidArgument, "title and recipient required")
+	}
+	if req.Recipient == id.Username {
+		return nil, status.Error(codes.InvalidArgument, "cannot share item with yourself")
+	}
+	permission, ok := sharePermissions[req.Permission]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown permission")
+	}
+
+	if _, err := s.provider.GetVault(ctx, req.Recipient); err != nil {
+		if errors.Is(err, sqlite.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "recipient not found")
+		}
+		logger.Log.Sugar().Errorf("Failed to get recipient %s: %v", req.Recipient, err)
+		return nil, status.Error(codes.Internal, "failed to share item")
+	}
+
+	row, err := s.updateShares(id.Username, req.Title, func(shares []storage.Share) ([]storage.Share, error) {
+		for i := range shares {
+			if shares[i].Username == req.Recipient {
+				shares[i].Permission = permission
+				return shares, nil
+			}
+		}
+		return append(shares, storage.Share{Username: req.Recipient, Permission: permission}), nil
+	})
+	if err != nil {
+		return nil, shareStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_SHARE, row)
+	s.notifyUser(req.Recipient, fmt.Sprintf("ОБНОВЛЕНИЕ! Пользователь %s открыл вам доступ к записи: %s (%s)",
+		id.Username, req.Title, sharePermissionNames[permission]))
+	logger.Log.Sugar().Infof("%s shared item with %s", id.Username, req.Recipient)
+
+	return &pb.ShareItemResponse{Message: "Доступ открыт."}, nil
+}
+
+// RevokeShare закрывает доступ пользователя к записи. Запись перешифровывается новым ключом,
+// который выдается только владельцу и оставшимся получателям.
+func (s *server) RevokeShare(ctx context.Context, req *pb.RevokeShareRequest) (*pb.RevokeShareResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" || req.Recipient == "" {
+		return nil, status.Error(codes.InvalidArgument, "title and recipient required")
+	}
+
+	row, err := s.updateShares(id.Username, req.Title, func(shares []storage.Share) ([]storage.Share, error) {
+		kept := make([]storage.Share, 0, len(shares))
+		for _, share := range shares {
+			if share.Username != req.Recipient {
+				kept = append(kept, share)
+			}
+		}
+		if len(kept) == len(shares) {
+			return nil, ErrShareNotFound
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return nil, shareStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_UNSHARE, row)
+	s.notifyUser(req.Recipient, fmt.Sprintf("ОБНОВЛЕНИЕ! Пользователь %s закрыл вам доступ к записи: %s", id.Username, req.Title))
+	logger.Log.Sugar().Infof("%s revoked share from %s", id.Username, req.Recipient)
+
+	return &pb.RevokeShareResponse{Message: "Доступ закрыт."}, nil
+}
+
+// shareStatus преобразует ошибку изменения доступа в ответ клиенту
+func shareStatus(username string, err error) error {
+	switch {
+	case errors.Is(err, sqlite.ErrDataNotFound):
+		return status.Error(codes.NotFound, "item not found")
+	case errors.Is(err, ErrShareNotFound):
+		return status.Error(codes.NotFound, "share not found")
+	case errors.Is(err, ErrShareSealed):
+		return status.Error(codes.FailedPrecondition, "client-encrypted items cannot be shared")
+	case errors.Is(err, sqlite.ErrConflict):
+		return status.Error(codes.Aborted, "item changed, try again")
+	default:
+		logger.Log.Sugar().Errorf("Failed to update shares of %s: %v", username, err)
+		return status.Error(codes.Internal, "failed to update sharing")
+	}
+}
+
+// updateShares меняет список получателей записи функцией change и перешифровывает запись новым ключом.
+// Ключ меняется при каждом изменении, поэтому получатель, потерявший доступ, не расшифрует новые данные
+// даже сохраненной копией прежнего ключа.
+func (s *server) updateShares(owner string, title string, change func([]storage.Share) ([]storage.Share, error)) (storage.DataRow, error) {
+	row, err := s.findData(owner, title)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+	// данные, зашифрованные на клиенте, сервер перешифровать не может
+	if strings.HasPrefix(row.Data, service.ClientSealedPrefix) {
+		return storage.DataRow{}, ErrShareSealed
+	}
+
+	plainText, bound, err := s.decryptRecord(row)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Decryption error: %v\n", err)
+		return storage.DataRow{}, err
+	}
+	if !bound && s.cfg.StrictAAD {
+		logger.Log.Sugar().Errorf("Record %d of %s is not bound to owner", row.ID, owner)
+		return storage.DataRow{}, ErrUnboundData
+	}
+
+	shares, err := s.provider.GetShares(s.ctx, row.ID)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+	shares, err = change(shares)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+
+	update, err := s.rekeyItem(row, plainText, shares)
+	if err != nil {
+		return storage.DataRow{}, err
+	}
+	return row, s.provider.SaveItemShares(s.ctx, update)
+}
+
+// rekeyItem шифрует запись новым ключом записи следующего поколения
+// и выдает ключ владельцу и каждому получателю, шифруя его их ключами
+func (s *server) rekeyItem(row storage.DataRow, plainText string, shares []storage.Share) (storage.ItemShares, error) {
+	generation := 1
+	if header, _, err := service.ParseHeader(row.Data); err == nil && header.Shared {
+		generation = header.Version + 1
+	}
+
+	itemKey, err := service.GenerateDataKey()
+	if err != nil {
+		return storage.ItemShares{}, err
+	}
+	data, err := service.EncryptSharedRecord(plainText, itemKey, generation, recordAAD(row))
+	if err != nil {
+		return storage.ItemShares{}, err
+	}
+	ownerKey, err := s.sealForUser(row.Username, itemKey, service.ItemKeyAAD(row.ID, row.Username, generation))
+	if err != nil {
+		return storage.ItemShares{}, err
+	}
+
+	for i := range shares {
+		shares[i].ItemID = row.ID
+		shares[i].WrappedKey, err = s.sealForUser(shares[i].Username, itemKey, service.ItemKeyAAD(row.ID, shares[i].Username, generation))
+		if err != nil {
+			return storage.ItemShares{}, err
+		}
+	}
+
+	return storage.ItemShares{ItemID: row.ID, OldData: row.Data, Data: data, ItemKey: ownerKey, Shares: shares}, nil
+}
+
+// openItemKey расшифровывает ключ общей записи, выданный пользователю holder
+func (s *server) openItemKey(itemID int64, holder string, wrappedKey string, generation int) (string, error) {
+	return s.openForUser(holder, wrappedKey, service.ItemKeyAAD(itemID, holder, generation))
+}
+
+// getSharedData возвращает данные чужой записи, к которой пользователю открыт доступ
+func (s *server) getSharedData(username string, itemID int64) (*pb.Item, error) {
+	row, share, err := s.provider.GetSharedData(s.ctx, username, itemID)
+	if err != nil {
+		return nil, err
+	}
+	row.Title, err = s.openTitle(row)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to decrypt title of record %d: %v", row.ID, err)
+		return nil, err
+	}
+
+	header, body, err := service.ParseHeader(row.Data)
+	if err != nil {
+		return nil, err
+	}
+	if !header.Shared {
+		logger.Log.Sugar().Errorf("Shared record %d is not encrypted with item key", row.ID)
+		return nil, ErrNotShared
+	}
+
+	itemKey, err := s.openItemKey(row.ID, username, share.WrappedKey, header.Version)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to open key of record %d for %s: %v", row.ID, username, err)
+		return nil, err
+	}
+	plainText, err := service.DecryptWithAAD(body, itemKey, recordAAD(row))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Decryption error: %v\n", err)
+		return nil, err
+	}
+	return decodeItem(row.Title, row.DataType, plainText)
+}
+
+// notifyUser отправляет уведомление во все открытые стримы пользователя
+func (s *server) notifyUser(username string, message string) {
+	s.broadcastMessage(username, "", message)
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestShareItem(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	// ключи пользователей
+	userKeys := make(map[string]storage.UserKey)
+	for _, username := range []string{"alice", "bob", "carol"} {
+		dataKey, _ := service.GenerateDataKey()
+		wrappedKey, _ := keyring.Wrap(dataKey)
+		userKeys[username] = storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	}
+	expectKeys := func() {
+		for username, key := range userKeys {
+			mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(key, nil).Maybe()
+			mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(key, nil).Maybe()
+		}
+	}
+	aliceKey, _ := keyring.Unwrap(userKeys["alice"].WrappedKey)
+	index := service.TitleIndex(aliceKey, "wifi")
+	titleCipher, _ := service.EncryptRecord("wifi", aliceKey, 1, service.TitleAAD("alice", index))
+	row := storage.DataRow{ID: 7, Username: "alice", TitleIndex: index, TitleCipher: titleCipher, DataType: service.TEXT}
+	row.Data, _ = service.EncryptRecord(`{"text":"secret"}`, aliceKey, 1, service.RecordAAD("alice", 7, service.TEXT, "wifi"))
+
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+
+	// readShared читает запись от имени получателя
+	readShared := func(username string, saved storage.ItemShares) (*pb.Item, error) {
+		shared := row
+		shared.Data = saved.Data
+		shared.ItemKey = saved.ItemKey
+		var share storage.Share
+		for _, item := range saved.Shares {
+			if item.Username == username {
+				share = item
+			}
+		}
+		mockProvider.On("GetSharedData", mock.Anything, username, int64(7)).Return(shared, share, nil).Once()
+		return server.getSharedData(username, 7)
+	}
+
+	var shared storage.ItemShares
+
+	t.Run("shared with recipient", func(t *testing.T) {
+		bob := newClient()
+		server.clients["bob::1"] = bob
+		defer delete(server.clients, "bob::1")
+
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "bob").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+		mockProvider.On("GetShares", mock.Anything, int64(7)).Return(nil, nil)
+		mockProvider.On("SaveItemShares", mock.Anything, mock.MatchedBy(func(update storage.ItemShares) bool {
+			shared = update
+			return update.ItemID == 7 && update.OldData == row.Data
+		})).Return(nil)
+
+		resp, err := server.ShareItem(ctx, &pb.ShareItemRequest{Title: "wifi", Recipient: "bob"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Доступ открыт.", resp.Message)
+
+		// запись зашифрована ключом записи первого поколения
+		header, _, err := service.ParseHeader(shared.Data)
+		assert.NoError(t, err)
+		assert.Equal(t, service.KeyHeader{Version: 1, Bound: true, Shared: true}, header)
+		assert.Equal(t, []storage.Share{{ItemID: 7, Username: "bob", Permission: service.SHARE_READ, WrappedKey: shared.Shares[0].WrappedKey}}, shared.Shares)
+
+		// получатель читает запись своей копией ключа
+		item, err := readShared("bob", shared)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", item.GetText().Text)
+
+		// владелец читает запись своей копией ключа
+		owned := row
+		owned.Data, owned.ItemKey, owned.Title = shared.Data, shared.ItemKey, "wifi"
+		plainText, bound, err := server.decryptRecord(owned)
+		assert.NoError(t, err)
+		assert.True(t, bound)
+		assert.Equal(t, `{"text":"secret"}`, plainText)
+
+		// получатель уведомлен в открытый стрим
+		notification := <-bob.ch
+		assert.Contains(t, notification.Message, "alice открыл вам доступ к записи: wifi (чтение)")
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("revoked recipient cut off", func(t *testing.T) {
+		current := row
+		current.Data, current.ItemKey = shared.Data, shared.ItemKey
+		carol := storage.Share{ItemID: 7, Username: "carol", Permission: service.SHARE_WRITE, WrappedKey: "stale"}
+		before := shared
+
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(current, nil)
+		mockProvider.On("GetShares", mock.Anything, int64(7)).Return([]storage.Share{shared.Shares[0], carol}, nil)
+		mockProvider.On("SaveItemShares", mock.Anything, mock.MatchedBy(func(update storage.ItemShares) bool {
+			shared = update
+			return update.OldData == current.Data
+		})).Return(nil)
+
+		_, err := server.RevokeShare(ctx, &pb.RevokeShareRequest{Title: "wifi", Recipient: "bob"})
+		assert.NoError(t, err)
+
+		// новый ключ записи выдан только оставшемуся получателю
+		header, _, _ := service.ParseHeader(shared.Data)
+		assert.Equal(t, 2, header.Version)
+		assert.Len(t, shared.Shares, 1)
+		assert.Equal(t, "carol", shared.Shares[0].Username)
+		item, err := readShared("carol", shared)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", item.GetText().Text)
+
+		// сохраненная копия прежнего ключа не расшифровывает новые данные
+		stale := shared
+		stale.Shares = before.Shares
+		_, err = readShared("bob", stale)
+		assert.Error(t, err)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("revoke unknown recipient", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+		mockProvider.On("GetShares", mock.Anything, int64(7)).Return(nil, nil)
+
+		resp, err := server.RevokeShare(ctx, &pb.RevokeShareRequest{Title: "wifi", Recipient: "bob"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.NotFound, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("client-encrypted item", func(t *testing.T) {
+		sealed := row
+		sealed.Data = service.ClientSealedPrefix + "abcdef"
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "bob").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(sealed, nil)
+
+		resp, err := server.ShareItem(ctx, &pb.ShareItemRequest{Title: "wifi", Recipient: "bob"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("item not found", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "bob").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", mock.Anything).Return(storage.DataRow{}, sqlite.ErrDataNotFound)
+
+		resp, err := server.ShareItem(ctx, &pb.ShareItemRequest{Title: "missing", Recipient: "bob"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.NotFound, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("recipient not found", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, "mallory").Return(storage.Vault{}, sqlite.ErrUserNotFound)
+
+		resp, err := server.ShareItem(ctx, &pb.ShareItemRequest{Title: "wifi", Recipient: "mallory"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.NotFound, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("share with yourself", func(t *testing.T) {
+		resp, err := server.ShareItem(ctx, &pb.ShareItemRequest{Title: "wifi", Recipient: "alice"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		resp, err := server.ShareItem(context.Background(), &pb.ShareItemRequest{Title: "wifi", Recipient: "bob"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+}
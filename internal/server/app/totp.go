@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// totpIssuer название сервиса в приложении-аутентификаторе
+const totpIssuer = "GophKeeper"
+
+var (
+	// ErrTOTPRequired описывает вход без одноразового кода при включенном TOTP.
+	ErrTOTPRequired = errors.New("totp code required")
+	// ErrTOTPInvalid описывает неверный или уже использованный одноразовый код.
+	ErrTOTPInvalid = errors.New("invalid totp code")
+)
+
+// totpAAD привязывает зашифрованный секрет TOTP к пользователю
+func totpAAD(username string) []byte {
+	return []byte("totp:" + username)
+}
+
+// EnrollTOTP создает новый секрет TOTP. Второй фактор включается только после ConfirmTOTP,
+// чтобы пользователь не потерял доступ из-за неверно настроенного приложения.
+func (s *server) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	secret, err := service.GenerateTOTPSecret()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate secret")
+	}
+
+	// секрет хранится зашифрованным ключом пользователя
+	sealed, err := s.sealForUser(id.Username, secret, totpAAD(id.Username))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to encrypt totp secret of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to save secret")
+	}
+
+	err = s.provider.SaveTOTP(ctx, id.Username, sealed)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrConflict) {
+			return nil, status.Error(codes.AlreadyExists, "totp already enabled")
+		}
+		logger.Log.Sugar().Errorf("Failed to save totp secret of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to save secret")
+	}
+
+	return &pb.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    service.TOTPURI(totpIssuer, id.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP включает второй фактор, если пользователь ввел верный код из приложения,
+// и возвращает коды восстановления. В БД хранятся только их хэши.
+func (s *server) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	totp, err := s.provider.GetTOTP(ctx, id.Username)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrTOTPNotFound) {
+			return nil, status.Error(codes.FailedPrecondition, "totp enrollment not started")
+		}
+		return nil, status.Error(codes.Internal, "failed to get secret")
+	}
+	if totp.Confirmed {
+		return nil, status.Error(codes.AlreadyExists, "totp already enabled")
+	}
+
+	secret, err := s.openForUser(id.Username, totp.Secret, totpAAD(id.Username))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to decrypt totp secret of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to get secret")
+	}
+
+	step, ok, err := service.ValidateTOTP(secret, req.Code, time.Now(), s.cfg.TOTPSkew)
+	if err != nil || !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid one-time code")
+	}
+
+	recoveryCodes, err := service.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate recovery codes")
+	}
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, service.GetRecoveryCodeHash(code))
+	}
+
+	err = s.provider.ConfirmTOTP(ctx, id.Username, step, hashes)
+	if err != nil {
+		if errors.Is(err, sqlite.ErrTOTPNotFound) {
+			// секрет подтвержден параллельным запросом
+			return nil, status.Error(codes.AlreadyExists, "totp already enabled")
+		}
+		logger.Log.Sugar().Errorf("Failed to confirm totp of %s: %v", id.Username, err)
+		return nil, status.Error(codes.Internal, "failed to enable totp")
+	}
+	logger.Log.Sugar().Infof("TOTP enabled for %s", id.Username)
+
+	return &pb.ConfirmTOTPResponse{
+		Message:       "Двухфакторная аутентификация включена. Сохраните коды восстановления, каждый можно использовать один раз:",
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// checkSecondFactor проверяет одноразовый код или код восстановления, если у пользователя включен TOTP
+func (s *server) checkSecondFactor(username string, code string) error {
+	totp, err := s.provider.GetTOTP(s.ctx, username)
+	if errors.Is(err, sqlite.ErrTOTPNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !totp.Confirmed {
+		return nil
+	}
+	if code == "" {
+		return ErrTOTPRequired
+	}
+
+	if !service.IsTOTPCode(code) {
+		used, err := s.provider.UseRecoveryCode(s.ctx, username, service.GetRecoveryCodeHash(code))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrTOTPInvalid
+		}
+		logger.Log.Sugar().Infof("Recovery code used by %s", username)
+		return nil
+	}
+
+	secret, err := s.openForUser(username, totp.Secret, totpAAD(username))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to decrypt totp secret of %s: %v", username, err)
+		return err
+	}
+
+	step, ok, err := service.ValidateTOTP(secret, code, time.Now(), s.cfg.TOTPSkew)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTOTPInvalid
+	}
+
+	// код каждого шага принимается только один раз
+	used, err := s.provider.UseTOTPStep(s.ctx, username, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrTOTPInvalid
+	}
+	return nil
+}
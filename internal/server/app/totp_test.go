@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnrollTOTP(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{TOTPSkew: 1},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "session"})
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+
+	t.Run("secret saved encrypted", func(t *testing.T) {
+		var sealed string
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("SaveTOTP", mock.Anything, username, mock.MatchedBy(func(secret string) bool {
+			sealed = secret
+			return true
+		})).Return(nil)
+
+		resp, err := server.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+		assert.NoError(t, err)
+		assert.Contains(t, resp.Uri, "otpauth://totp/GophKeeper:testuser?")
+		assert.Contains(t, resp.Uri, "secret="+resp.Secret)
+
+		// в БД секрет зашифрован ключом пользователя
+		assert.NotContains(t, sealed, resp.Secret)
+		header, body, err := service.ParseHeader(sealed)
+		assert.NoError(t, err)
+		secret, err := service.DecryptWithAAD(body, dataKey, totpAAD(username))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, header.Version)
+		assert.Equal(t, resp.Secret, secret)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(userKey, nil)
+		mockProvider.On("SaveTOTP", mock.Anything, username, mock.Anything).Return(sqlite.ErrConflict)
+
+		resp, err := server.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.AlreadyExists, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		resp, err := server.EnrollTOTP(context.Background(), &pb.EnrollTOTPRequest{})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Unauthenticated, st.Code())
+	})
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{TOTPSkew: 1},
+		keyring:  keyring,
+		ctx:      context.Background(),
+	}
+
+	username := "testuser"
+	ctx := withIdentity(context.Background(), identity{Username: username, SessionID: "session"})
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	secret, _ := service.GenerateTOTPSecret()
+	sealedSecret, _ := service.EncryptRecord(secret, dataKey, 1, totpAAD(username))
+
+	t.Run("valid code enables totp", func(t *testing.T) {
+		step := service.TOTPStep(time.Now())
+		code, _ := service.TOTPCode(secret, step)
+		var hashes []string
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{Secret: sealedSecret}, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+		mockProvider.On("ConfirmTOTP", mock.Anything, username, step, mock.MatchedBy(func(h []string) bool {
+			hashes = h
+			return true
+		})).Return(nil)
+
+		resp, err := server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: code})
+		assert.NoError(t, err)
+		assert.Len(t, resp.RecoveryCodes, len(hashes))
+
+		// сохраняются только хэши кодов восстановления
+		for i, code := range resp.RecoveryCodes {
+			assert.Equal(t, service.GetRecoveryCodeHash(code), hashes[i])
+		}
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{Secret: sealedSecret}, nil)
+		mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(storage.UserKey{Version: 1, WrappedKey: wrappedKey}, nil)
+
+		resp, err := server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: "000000x"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.InvalidArgument, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("enrollment not started", func(t *testing.T) {
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{}, sqlite.ErrTOTPNotFound)
+
+		resp, err := server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: "123456"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.FailedPrecondition, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		mockProvider.On("GetTOTP", mock.Anything, username).Return(storage.TOTP{Secret: sealedSecret, Confirmed: true}, nil)
+
+		resp, err := server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: "123456"})
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.AlreadyExists, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
@@ -0,0 +1,216 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotOwner описывает удаление записи, владельцем которой пользователь не является.
+	ErrNotOwner = errors.New("only owner can delete item")
+	// ErrNoDeleteAccess описывает удаление записи коллекции, которое роль пользователя не разрешает.
+	ErrNoDeleteAccess = errors.New("no access to delete collection item")
+)
+
+// trashPurgeInterval период, с которым сервер удаляет из корзин записи с истекшим сроком хранения
+const trashPurgeInterval = time.Hour
+
+// trashExpiry возвращает время, после которого запись, удаленная в deletedAt, будет удалена окончательно
+func (s *server) trashExpiry(deletedAt time.Time) time.Time {
+	return deletedAt.Add(s.cfg.TrashRetention)
+}
+
+// trashData переносит свою запись пользователя в корзину и возвращает время ее окончательного удаления.
+// Общие записи остаются у получателей до очистки корзины, но не показываются им.
+// Корзина принадлежит пользователю, поэтому запись коллекции удаляется сразу и время возвращается пустым.
+func (s *server) trashData(username string, row storage.DataRow) (time.Time, error) {
+	if row.CollectionID != 0 {
+		return time.Time{}, s.deleteTeamData(username, row)
+	}
+	if row.Username != username {
+		return time.Time{}, ErrNotOwner
+	}
+	deletedAt := time.Now()
+	if err := s.provider.TrashData(s.ctx, username, row.ID, deletedAt); err != nil {
+		return time.Time{}, err
+	}
+	return s.trashExpiry(deletedAt), nil
+}
+
+// notifyDeleted сообщает остальным сессиям пользователя, что запись удалена в корзину
+// или, для записи коллекции, удалена окончательно
+func (s *server) notifyDeleted(username string, sessionID string, row storage.DataRow) {
+	message := fmt.Sprintf("ОБНОВЛЕНИЕ! Запись удалена в корзину: %s", row.Title)
+	if row.CollectionID != 0 {
+		message = fmt.Sprintf("ОБНОВЛЕНИЕ! Запись коллекции %s удалена: %s", row.Collection, row.Title)
+	}
+	go s.broadcastMessage(username, sessionID, message)
+}
+
+// trashStatus преобразует ошибку операции с корзиной в ответ клиенту
+func trashStatus(username string, err error) error {
+	switch {
+	case errors.Is(err, sqlite.ErrDataNotFound):
+		return status.Error(codes.NotFound, "item not found")
+	case errors.Is(err, ErrNotOwner):
+		return status.Error(codes.PermissionDenied, "only owner can delete item")
+	case errors.Is(err, ErrNoDeleteAccess):
+		return status.Error(codes.PermissionDenied, "no access to delete collection item")
+	case errors.Is(err, sqlite.ErrTitleExists):
+		return status.Error(codes.AlreadyExists, "item with this title already exists")
+	default:
+		logger.Log.Sugar().Errorf("Trash operation of %s failed: %v", username, err)
+		return status.Error(codes.Internal, "trash operation failed")
+	}
+}
+
+// DeleteItem переносит свою запись в корзину. Запись можно восстановить, пока не истек
+// срок хранения корзины, после этого сервер удаляет ее окончательно. Запись коллекции удаляется сразу.
+func (s *server) DeleteItem(ctx context.Context, req *pb.DeleteItemRequest) (*pb.DeleteItemResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title required")
+	}
+
+	row, err := s.findItem(ctx, id.Username, "", req.Collection, req.Title)
+	if err != nil {
+		return nil, trashStatus(id.Username, err)
+	}
+	expiresAt, err := s.trashData(id.Username, row)
+	if err != nil {
+		return nil, trashStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_DELETE, row)
+	s.notifyDeleted(id.Username, id.SessionID, row)
+	if row.CollectionID != 0 {
+		return &pb.DeleteItemResponse{Message: "Запись коллекции удалена."}, nil
+	}
+	return &pb.DeleteItemResponse{Message: "Запись перемещена в корзину.", ExpiresAtUnix: expiresAt.Unix()}, nil
+}
+
+// ListTrash возвращает записи пользователя в корзине с временем их окончательного удаления
+func (s *server) ListTrash(ctx context.Context, _ *pb.ListTrashRequest) (*pb.ListTrashResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	rows, err := s.provider.ListTrash(ctx, id.Username)
+	if err != nil {
+		return nil, trashStatus(id.Username, err)
+	}
+	items := make([]*pb.TrashItem, 0, len(rows))
+	for _, row := range rows {
+		title, err := s.openTitle(row)
+		if err != nil {
+			logger.Log.Sugar().Errorf("Failed to decrypt title of record %d: %v", row.ID, err)
+			return nil, status.Error(codes.Internal, "failed to list trash")
+		}
+		items = append(items, &pb.TrashItem{
+			Id:            row.ID,
+			Title:         title,
+			DeletedAtUnix: row.DeletedAt.Unix(),
+			ExpiresAtUnix: s.trashExpiry(row.DeletedAt).Unix(),
+		})
+	}
+	return &pb.ListTrashResponse{Items: items}, nil
+}
+
+// RestoreItem возвращает запись из корзины. Если название за это время заняла другая запись,
+// возвращается AlreadyExists, и ту запись нужно сначала переименовать или удалить.
+func (s *server) RestoreItem(ctx context.Context, req *pb.RestoreItemRequest) (*pb.RestoreItemResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Id <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "item id required")
+	}
+
+	// название нужно для ответа, журнала и уведомления
+	title, err := s.trashedTitle(id.Username, req.Id)
+	if err != nil {
+		return nil, trashStatus(id.Username, err)
+	}
+	if err := s.provider.RestoreData(ctx, id.Username, req.Id); err != nil {
+		return nil, trashStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_RESTORE, storage.DataRow{ID: req.Id})
+	go s.broadcastMessage(id.Username, id.SessionID, fmt.Sprintf("ОБНОВЛЕНИЕ! Запись восстановлена из корзины: %s", title))
+	return &pb.RestoreItemResponse{Message: "Запись восстановлена: " + title}, nil
+}
+
+// trashedTitle возвращает расшифрованное название записи из корзины пользователя
+func (s *server) trashedTitle(username string, itemID int64) (string, error) {
+	rows, err := s.provider.ListTrash(s.ctx, username)
+	if err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		if row.ID == itemID {
+			return s.openTitle(row)
+		}
+	}
+	return "", sqlite.ErrDataNotFound
+}
+
+// EmptyTrash окончательно удаляет все записи из корзины пользователя
+func (s *server) EmptyTrash(ctx context.Context, _ *pb.EmptyTrashRequest) (*pb.EmptyTrashResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+
+	deleted, err := s.provider.EmptyTrash(ctx, id.Username)
+	if err != nil {
+		return nil, trashStatus(id.Username, err)
+	}
+
+	s.audit(ctx, id.Username, service.TRASH_EMPTY, "")
+	return &pb.EmptyTrashResponse{Message: fmt.Sprintf("Удалено записей: %d", deleted), Deleted: deleted}, nil
+}
+
+// purgeTrash окончательно удаляет записи, срок хранения которых в корзине истек к моменту now
+func (s *server) purgeTrash(now time.Time) {
+	purged, err := s.provider.PurgeTrash(s.ctx, now.Add(-s.cfg.TrashRetention))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to purge trash: %v", err)
+		return
+	}
+	if purged > 0 {
+		logger.Log.Sugar().Infof("Purged %d expired trash items", purged)
+	}
+}
+
+// runTrashPurger при запуске и затем каждые trashPurgeInterval удаляет записи с истекшим сроком
+// хранения в корзине. Завершается при остановке сервера.
+func (s *server) runTrashPurger() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	s.purgeTrash(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			s.purgeTrash(now)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
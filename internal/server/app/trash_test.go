@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTrash(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{TrashRetention: 48 * time.Hour},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	dataKey, _ := service.GenerateDataKey()
+	wrappedKey, _ := keyring.Wrap(dataKey)
+	userKey := storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	expectKeys := func() {
+		mockProvider.On("GetUserKey", mock.Anything, "alice", 1).Return(userKey, nil).Maybe()
+		mockProvider.On("GetLatestUserKey", mock.Anything, "alice").Return(userKey, nil).Maybe()
+	}
+
+	index := service.TitleIndex(dataKey, "wifi")
+	titleCipher, _ := service.EncryptRecord("wifi", dataKey, 1, service.TitleAAD("alice", index))
+	row := storage.DataRow{ID: 7, Username: "alice", TitleIndex: index, TitleCipher: titleCipher, DataType: service.TEXT, Version: 3}
+
+	ctx := withIdentity(context.Background(), identity{Username: "alice", SessionID: "session-id"})
+	codeOf := func(err error) codes.Code {
+		st, _ := status.FromError(err)
+		return st.Code()
+	}
+
+	t.Run("delete own item", func(t *testing.T) {
+		var deletedAt time.Time
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+		mockProvider.On("TrashData", mock.Anything, "alice", int64(7), mock.MatchedBy(func(at time.Time) bool {
+			deletedAt = at
+			return true
+		})).Return(nil)
+
+		resp, err := server.DeleteItem(ctx, &pb.DeleteItemRequest{Title: "wifi"})
+		assert.NoError(t, err)
+		assert.Equal(t, deletedAt.Add(48*time.Hour).Unix(), resp.ExpiresAtUnix)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("delete missing item", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(storage.DataRow{}, sqlite.ErrDataNotFound)
+
+		_, err := server.DeleteItem(ctx, &pb.DeleteItemRequest{Title: "wifi"})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("foreign item", func(t *testing.T) {
+		shared := row
+		shared.Username = "bob"
+		_, err := server.trashData("alice", shared)
+		assert.ErrorIs(t, err, ErrNotOwner)
+	})
+
+	t.Run("list trash", func(t *testing.T) {
+		deletedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+		trashed := row
+		trashed.DeletedAt = deletedAt
+		expectKeys()
+		mockProvider.On("ListTrash", mock.Anything, "alice").Return([]storage.DataRow{trashed}, nil)
+
+		resp, err := server.ListTrash(ctx, &pb.ListTrashRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, []*pb.TrashItem{{
+			Id:            7,
+			Title:         "wifi",
+			DeletedAtUnix: deletedAt.Unix(),
+			ExpiresAtUnix: deletedAt.Add(48 * time.Hour).Unix(),
+		}}, resp.Items)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("restore item", func(t *testing.T) {
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("ListTrash", mock.Anything, "alice").Return([]storage.DataRow{row}, nil)
+		mockProvider.On("RestoreData", mock.Anything, "alice", int64(7)).Return(nil)
+
+		resp, err := server.RestoreItem(ctx, &pb.RestoreItemRequest{Id: 7})
+		assert.NoError(t, err)
+		assert.Equal(t, "Запись восстановлена: wifi", resp.Message)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("restore over taken title", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("ListTrash", mock.Anything, "alice").Return([]storage.DataRow{row}, nil)
+		mockProvider.On("RestoreData", mock.Anything, "alice", int64(7)).Return(sqlite.ErrTitleExists)
+
+		_, err := server.RestoreItem(ctx, &pb.RestoreItemRequest{Id: 7})
+		assert.Equal(t, codes.AlreadyExists, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("restore item not in trash", func(t *testing.T) {
+		mockProvider.On("ListTrash", mock.Anything, "alice").Return([]storage.DataRow{}, nil)
+
+		_, err := server.RestoreItem(ctx, &pb.RestoreItemRequest{Id: 8})
+		assert.Equal(t, codes.NotFound, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("empty trash", func(t *testing.T) {
+		expectAudit(mockProvider)
+		mockProvider.On("EmptyTrash", mock.Anything, "alice").Return(int64(2), nil)
+
+		resp, err := server.EmptyTrash(ctx, &pb.EmptyTrashRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), resp.Deleted)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("purge expired items", func(t *testing.T) {
+		now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+		mockProvider.On("PurgeTrash", mock.Anything, now.Add(-48*time.Hour)).Return(int64(1), nil)
+
+		server.purgeTrash(now)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := server.DeleteItem(context.Background(), &pb.DeleteItemRequest{Title: "wifi"})
+		assert.Equal(t, codes.Unauthenticated, codeOf(err))
+		_, err = server.EmptyTrash(context.Background(), &pb.EmptyTrashRequest{})
+		assert.Equal(t, codes.Unauthenticated, codeOf(err))
+	})
+}
+
+func TestBroadcastMessage(t *testing.T) {
+	server := &server{clients: make(map[string]*client)}
+
+	// стрим сессии, в которой удалена запись, другая сессия того же пользователя и другой пользователь
+	current, other, stranger := newClient(), newClient(), newClient()
+	for clientID, c := range map[string]*client{"alice::1": current, "alice::2": other, "bob::1": stranger} {
+		c.sessionID = clientID
+		server.clients[clientID] = c
+	}
+	// клиент, восстановленный из БД, не связан со стримом
+	server.clients["alice::3"] = &client{sessionID: "alice::3"}
+
+	server.broadcastMessage("alice", "alice::1", "ОБНОВЛЕНИЕ! Запись удалена в корзину: wifi")
+
+	assert.Empty(t, current.ch)
+	assert.Empty(t, stranger.ch)
+	if assert.Len(t, other.ch, 1) {
+		msg := <-other.ch
+		assert.Equal(t, "server", msg.Username)
+		assert.Equal(t, "ОБНОВЛЕНИЕ! Запись удалена в корзину: wifi", msg.Message)
+	}
+}
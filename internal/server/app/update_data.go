@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"keeper/internal/logger"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrReadOnly описывает изменение записи, к которой у пользователя нет доступа на запись.
+var ErrReadOnly = errors.New("no write access to item")
+
+// editTarget запись, выбранная для изменения
+type editTarget struct {
+	// запись из БД на момент выбора, ее версию должна сохранить БД к моменту изменения
+	row storage.DataRow
+	// ключ общей записи, выданный пользователю
+	wrappedKey string
+	// новые данные шифрует клиент
+	sealed bool
+	// членство пользователя в организации командной записи
+	member storage.OrgMember
+}
+
+// editableData возвращает актуальную запись, которую пользователь может изменить.
+// Свои записи можно изменять всегда, чужие - только с доступом на запись,
+// записи коллекций - всем участникам организации, кроме участников только для чтения.
+func (s *server) editableData(username string, row storage.DataRow, clientEncryption bool) (editTarget, error) {
+	if row.CollectionID != 0 {
+		return s.editableTeamData(username, row)
+	}
+
+	if row.Username != username {
+		current, share, err := s.provider.GetSharedData(s.ctx, username, row.ID)
+		if err != nil {
+			return editTarget{}, err
+		}
+		if share.Permission != service.SHARE_WRITE {
+			return editTarget{}, ErrReadOnly
+		}
+		return editTarget{row: current, wrappedKey: share.WrappedKey}, nil
+	}
+
+	current, err := s.provider.GetData(s.ctx, username, row.TitleIndex)
+	if err != nil {
+		return editTarget{}, err
+	}
+	// общие записи шифрует сервер ключом записи, даже если свои данные пользователь шифрует сам
+	header, _, err := service.ParseHeader(current.Data)
+	shared := err == nil && header.Shared
+	return editTarget{row: current, wrappedKey: current.ItemKey, sealed: clientEncryption && !shared}, nil
+}
+
+// updateData заменяет название и данные выбранной записи данными item того же типа.
+// Запись сохраняется, только если с момента выбора ее версия не изменилась. Возвращает новое название.
+func (s *server) updateData(author identity, target editTarget, item *pb.Item) (string, error) {
+	var plainText string
+	var err error
+	if target.sealed {
+		plainText, err = sealedPayload(item)
+	} else {
+		plainText, err = encodeItem(item, target.row.DataType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.saveUpdate(author, target, item.Title, plainText); err != nil {
+		return "", err
+	}
+	return item.Title, nil
+}
+
+// saveUpdate шифрует новое название и данные выбранной записи и сохраняет их, если версия записи
+// не изменилась с момента выбора. Прежняя версия попадает в историю записи с автором изменения.
+// Для записей, которые шифрует клиент, plainText уже зашифрован.
+func (s *server) saveUpdate(author identity, target editTarget, title string, plainText string) error {
+	current := target.row
+	if current.CollectionID != 0 {
+		return s.saveTeamUpdate(author, target.member, current, title, plainText)
+	}
+	// название шифруется ключом владельца, даже если запись изменяет получатель
+	updated, err := s.newDataRow(current.Username, title, current.DataType)
+	if err != nil {
+		return err
+	}
+	updated.ID = current.ID
+
+	if target.sealed {
+		updated.Data = service.ClientSealedPrefix + plainText
+	} else {
+		updated.Data, err = s.sealUpdate(author.Username, current, updated, target.wrappedKey, plainText)
+		if err != nil {
+			logger.Log.Sugar().Errorf("Encryption error: %v\n", err)
+			return err
+		}
+	}
+
+	revision := storage.Revision{Author: author.Username, SessionID: author.SessionID, CreatedAt: time.Now()}
+	return s.provider.UpdateData(s.ctx, updated, current.Version, revision)
+}
+
+// sealUpdate шифрует новые данные записи. Общая запись шифруется ее текущим ключом записи,
+// открытым копией пользователя username, остальные - актуальным ключом владельца.
+func (s *server) sealUpdate(username string, current storage.DataRow, updated storage.DataRow, wrappedKey string, plainText string) (string, error) {
+	header, _, err := service.ParseHeader(current.Data)
+	if err == nil && header.Shared {
+		itemKey, err := s.openItemKey(current.ID, username, wrappedKey, header.Version)
+		if err != nil {
+			return "", err
+		}
+		return service.EncryptSharedRecord(plainText, itemKey, header.Version, recordAAD(updated))
+	}
+
+	version, dataKey, err := s.currentUserKey(current.Username)
+	if err != nil {
+		return "", err
+	}
+	return service.EncryptRecord(plainText, dataKey, version, recordAAD(updated))
+}
+
+// notifyItemOwner сообщает владельцу общей записи, что ее изменил получатель
+func (s *server) notifyItemOwner(username string, owner string, title string) {
+	if owner == username {
+		return
+	}
+	s.notifyUser(owner, fmt.Sprintf("ОБНОВЛЕНИЕ! Пользователь %s изменил запись: %s", username, title))
+}
+
+// updateStatus преобразует ошибку изменения записи в ответ клиенту
+func updateStatus(username string, err error) error {
+	switch {
+	case errors.Is(err, sqlite.ErrDataNotFound):
+		return status.Error(codes.NotFound, "item not found")
+	case errors.Is(err, ErrReadOnly):
+		return status.Error(codes.PermissionDenied, "no write access to item")
+	case errors.Is(err, ErrCreateFormat):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNotSealed):
+		return status.Error(codes.InvalidArgument, "data must be sealed by client")
+	case errors.Is(err, sqlite.ErrTitleExists):
+		return status.Error(codes.AlreadyExists, "item with this title already exists")
+	case errors.Is(err, sqlite.ErrConflict):
+		return status.Error(codes.Aborted, "item changed, reload it and try again")
+	default:
+		logger.Log.Sugar().Errorf("Failed to update item of %s: %v", username, err)
+		return status.Error(codes.Internal, "failed to update item")
+	}
+}
+
+// UpdateItem заменяет данные своей записи, общей записи с доступом на запись или записи коллекции.
+// Клиент передает версию записи, которую изменяет. Если запись за это время изменили,
+// возвращается Aborted, и клиент должен перечитать запись.
+func (s *server) UpdateItem(ctx context.Context, req *pb.UpdateItemRequest) (*pb.UpdateItemResponse, error) {
+	id, err := identityFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing identity")
+	}
+	if req.Title == "" || req.Version <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "title and version required")
+	}
+
+	vault, err := s.provider.GetVault(ctx, id.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Failed to get vault params: %v", err)
+		return nil, status.Error(codes.Internal, "failed to update item")
+	}
+
+	row, err := s.findItem(ctx, id.Username, req.Owner, req.Collection, req.Title)
+	if err != nil {
+		return nil, updateStatus(id.Username, err)
+	}
+	target, err := s.editableData(id.Username, row, vault.ClientEncryption)
+	if err != nil {
+		return nil, updateStatus(id.Username, err)
+	}
+	if target.row.Version != req.Version {
+		return nil, updateStatus(id.Username, sqlite.ErrConflict)
+	}
+
+	title, err := s.updateData(id, target, req.Item)
+	if err != nil {
+		return nil, updateStatus(id.Username, err)
+	}
+
+	s.auditItem(ctx, id.Username, service.ITEM_UPDATE, target.row)
+	s.notifyItemOwner(id.Username, target.row.Username, title)
+	return &pb.UpdateItemResponse{Message: "Данные изменены!", Version: req.Version + 1}, nil
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/config"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUpdateItem(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	keyring, _ := service.NewKeyring("1", "thisis32byteencryptionkey1234567", nil)
+	server := &server{
+		provider: mockProvider,
+		cfg:      &config.Config{},
+		keyring:  keyring,
+		clients:  make(map[string]*client),
+		ctx:      context.Background(),
+	}
+
+	// ключи пользователей
+	dataKeys := make(map[string]string)
+	userKeys := make(map[string]storage.UserKey)
+	for _, username := range []string{"alice", "bob"} {
+		dataKeys[username], _ = service.GenerateDataKey()
+		wrappedKey, _ := keyring.Wrap(dataKeys[username])
+		userKeys[username] = storage.UserKey{Version: 1, WrappedKey: wrappedKey}
+	}
+	expectKeys := func() {
+		for username, key := range userKeys {
+			mockProvider.On("GetUserKey", mock.Anything, username, 1).Return(key, nil).Maybe()
+			mockProvider.On("GetLatestUserKey", mock.Anything, username).Return(key, nil).Maybe()
+		}
+	}
+
+	aliceKey := dataKeys["alice"]
+	index := service.TitleIndex(aliceKey, "wifi")
+	titleCipher, _ := service.EncryptRecord("wifi", aliceKey, 1, service.TitleAAD("alice", index))
+	row := storage.DataRow{ID: 7, Username: "alice", TitleIndex: index, TitleCipher: titleCipher, DataType: service.TEXT, Version: 3}
+	row.Data, _ = service.EncryptRecord(`{"text":"old"}`, aliceKey, 1, service.RecordAAD("alice", 7, service.TEXT, "wifi"))
+
+	// общая запись, ключ которой выдан alice и bob с доступом на запись
+	itemKey, _ := service.GenerateDataKey()
+	sharedRow := row
+	sharedRow.Data, _ = service.EncryptSharedRecord(`{"text":"old"}`, itemKey, 2, service.RecordAAD("alice", 7, service.TEXT, "wifi"))
+	sharedRow.ItemKey, _ = service.EncryptRecord(itemKey, aliceKey, 1, service.ItemKeyAAD(7, "alice", 2))
+	bobItemKey, _ := service.EncryptRecord(itemKey, dataKeys["bob"], 1, service.ItemKeyAAD(7, "bob", 2))
+	bobShare := storage.Share{ItemID: 7, Username: "bob", Permission: service.SHARE_WRITE, WrappedKey: bobItemKey}
+
+	textItem := func(title string, text string) *pb.Item {
+		return &pb.Item{Title: title, Payload: &pb.Item_Text{Text: &pb.TextItem{Text: text}}}
+	}
+	asUser := func(username string) context.Context {
+		return withIdentity(context.Background(), identity{Username: username, SessionID: "session-id"})
+	}
+	codeOf := func(err error) codes.Code {
+		st, _ := status.FromError(err)
+		return st.Code()
+	}
+
+	t.Run("own item renamed", func(t *testing.T) {
+		var updated storage.DataRow
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+		mockProvider.On("UpdateData", mock.Anything, mock.MatchedBy(func(r storage.DataRow) bool {
+			updated = r
+			return r.ID == 7 && r.TitleIndex == service.TitleIndex(aliceKey, "home wifi")
+		}), int64(3), mock.Anything).Return(nil)
+
+		resp, err := server.UpdateItem(asUser("alice"), &pb.UpdateItemRequest{Title: "wifi", Version: 3, Item: textItem("home wifi", "new::note")})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), resp.Version)
+
+		// данные привязаны к новому названию
+		updated.Username, updated.DataType, updated.Title = "alice", service.TEXT, "home wifi"
+		plainText, bound, err := server.decryptRecord(updated)
+		assert.NoError(t, err)
+		assert.True(t, bound)
+		item, err := decodeItem("home wifi", service.TEXT, plainText)
+		assert.NoError(t, err)
+		assert.Equal(t, "new::note", item.GetText().Text)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+
+		_, err := server.UpdateItem(asUser("alice"), &pb.UpdateItemRequest{Title: "wifi", Version: 2, Item: textItem("wifi", "new::note")})
+		assert.Equal(t, codes.Aborted, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("changed on another device", func(t *testing.T) {
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, "alice").Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(row, nil)
+		mockProvider.On("UpdateData", mock.Anything, mock.Anything, int64(3), mock.Anything).Return(sqlite.ErrConflict)
+
+		_, err := server.UpdateItem(asUser("alice"), &pb.UpdateItemRequest{Title: "wifi", Version: 3, Item: textItem("wifi", "new::note")})
+		assert.Equal(t, codes.Aborted, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("shared item updated by recipient", func(t *testing.T) {
+		alice := newClient()
+		server.clients["alice::1"] = alice
+		defer delete(server.clients, "alice::1")
+
+		var updated storage.DataRow
+		expectKeys()
+		expectAudit(mockProvider)
+		mockProvider.On("GetVault", mock.Anything, mock.Anything).Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(sharedRow, nil)
+		mockProvider.On("GetSharedData", mock.Anything, "bob", int64(7)).Return(sharedRow, bobShare, nil)
+		mockProvider.On("UpdateData", mock.Anything, mock.MatchedBy(func(r storage.DataRow) bool {
+			updated = r
+			return r.ID == 7 && r.TitleIndex == index
+		}), int64(3), mock.Anything).Return(nil)
+
+		_, err := server.UpdateItem(asUser("bob"), &pb.UpdateItemRequest{Title: "wifi", Owner: "alice", Version: 3, Item: textItem("wifi", "new::note")})
+		assert.NoError(t, err)
+
+		// данные зашифрованы тем же ключом записи, владелец читает их своей копией ключа
+		header, _, _ := service.ParseHeader(updated.Data)
+		assert.Equal(t, service.KeyHeader{Version: 2, Bound: true, Shared: true}, header)
+		owned := sharedRow
+		owned.Data, owned.Title = updated.Data, "wifi"
+		plainText, _, err := server.decryptRecord(owned)
+		assert.NoError(t, err)
+		item, err := decodeItem("wifi", service.TEXT, plainText)
+		assert.NoError(t, err)
+		assert.Equal(t, "new::note", item.GetText().Text)
+
+		notification := <-alice.ch
+		assert.Contains(t, notification.Message, "bob изменил запись: wifi")
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("read-only recipient", func(t *testing.T) {
+		readOnly := bobShare
+		readOnly.Permission = service.SHARE_READ
+		expectKeys()
+		mockProvider.On("GetVault", mock.Anything, mock.Anything).Return(storage.Vault{}, nil)
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(sharedRow, nil)
+		mockProvider.On("GetSharedData", mock.Anything, "bob", int64(7)).Return(sharedRow, readOnly, nil)
+
+		_, err := server.UpdateItem(asUser("bob"), &pb.UpdateItemRequest{Title: "wifi", Owner: "alice", Version: 3, Item: textItem("wifi", "new::note")})
+		assert.Equal(t, codes.PermissionDenied, codeOf(err))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("client-encrypted item", func(t *testing.T) {
+		sealed := row
+		sealed.Data = service.ClientSealedPrefix + "abcdef"
+		payload, _ := service.Encrypt("new", aliceKey)
+		expectKeys()
+		mockProvider.On("GetData", mock.Anything, "alice", index).Return(sealed, nil)
+		mockProvider.On("UpdateData", mock.Anything, mock.MatchedBy(func(r storage.DataRow) bool {
+			return r.Data == service.ClientSealedPrefix+payload
+		}), int64(3), mock.Anything).Return(nil)
+
+		target, err := server.editableData("alice", row, true)
+		assert.NoError(t, err)
+		assert.True(t, target.sealed)
+
+		// открытые данные от клиента, который шифрует данные сам, не принимаются
+		_, err = server.updateData(identity{Username: "alice", SessionID: "session-id"}, target, textItem("wifi", "new"))
+		assert.ErrorIs(t, err, ErrNotSealed)
+
+		title, err := server.updateData(identity{Username: "alice", SessionID: "session-id"}, target, &pb.Item{Title: "wifi", Payload: &pb.Item_Sealed{Sealed: payload}})
+		assert.NoError(t, err)
+		assert.Equal(t, "wifi", title)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("version required", func(t *testing.T) {
+		_, err := server.UpdateItem(asUser("alice"), &pb.UpdateItemRequest{Title: "wifi", Item: textItem("wifi", "new::note")})
+		assert.Equal(t, codes.InvalidArgument, codeOf(err))
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := server.UpdateItem(context.Background(), &pb.UpdateItemRequest{Title: "wifi", Version: 3})
+		assert.Equal(t, codes.Unauthenticated, codeOf(err))
+	})
+}
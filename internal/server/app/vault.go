@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSaltSecretName имя секрета сервера, из которого выводятся фиктивные соли
+const fakeSaltSecretName = "fake-kdf-salt"
+
+// GetVaultParams возвращает параметры шифрования на стороне клиента, нужные до входа:
+// по соли клиент выводит ключи из мастер-пароля. Аккаунт без шифрования на клиенте и неизвестный
+// пользователь получают одинаковый ответ с фиктивной солью, чтобы по нему нельзя было узнать, есть ли аккаунт.
+func (s *server) GetVaultParams(ctx context.Context, req *pb.VaultParamsRequest) (*pb.VaultParamsResponse, error) {
+	vault, err := s.provider.GetVault(ctx, req.Username)
+	if err != nil && !errors.Is(err, sqlite.ErrUserNotFound) {
+		return nil, status.Error(codes.Internal, "failed to get vault params")
+	}
+
+	if !vault.ClientEncryption {
+		return &pb.VaultParamsResponse{KdfSalt: service.FakeSalt(s.fakeSaltSecret, req.Username)}, nil
+	}
+	return &pb.VaultParamsResponse{
+		ClientEncryption: vault.ClientEncryption,
+		KdfSalt:          vault.KdfSalt,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"keeper/internal/mocks"
+	"keeper/internal/server/service"
+	"keeper/internal/server/storage"
+	"keeper/internal/server/storage/sqlite"
+	pb "keeper/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestGetVaultParams тестирует метод GetVaultParams
+func TestGetVaultParams(t *testing.T) {
+	mockProvider := new(mocks.Provider)
+	server := &server{
+		provider:       mockProvider,
+		fakeSaltSecret: "fake-salt-secret",
+	}
+
+	ctx := context.Background()
+	req := &pb.VaultParamsRequest{Username: "testuser"}
+
+	t.Run("client encryption", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, req.Username).
+			Return(storage.Vault{ClientEncryption: true, KdfSalt: "salt", WrappedKey: "wrapped"}, nil)
+
+		resp, err := server.GetVaultParams(ctx, req)
+		assert.NoError(t, err)
+		assert.True(t, resp.ClientEncryption)
+		assert.Equal(t, "salt", resp.KdfSalt)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{}, sqlite.ErrUserNotFound)
+
+		resp, err := server.GetVaultParams(ctx, req)
+		assert.NoError(t, err)
+		// ответ выглядит как ответ для аккаунта без шифрования на клиенте
+		assert.False(t, resp.ClientEncryption)
+		assert.Len(t, resp.KdfSalt, 32)
+
+		again, err := server.GetVaultParams(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, resp.KdfSalt, again.KdfSalt)
+		assert.NotEqual(t, resp.KdfSalt, service.FakeSalt("fake-salt-secret", "otheruser"))
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("unknown user and account without client encryption look the same", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{}, sqlite.ErrUserNotFound).Once()
+		unknown, err := server.GetVaultParams(ctx, req)
+		assert.NoError(t, err)
+
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{ClientEncryption: false}, nil).Once()
+		existing, err := server.GetVaultParams(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, unknown.ClientEncryption, existing.ClientEncryption)
+		assert.Equal(t, unknown.KdfSalt, existing.KdfSalt)
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		mockProvider.On("GetVault", mock.Anything, req.Username).Return(storage.Vault{}, errors.New("db error"))
+
+		resp, err := server.GetVaultParams(ctx, req)
+		assert.Nil(t, resp)
+		st, _ := status.FromError(err)
+		assert.Equal(t, codes.Internal, st.Code())
+
+		mockProvider.AssertExpectations(t)
+		mockProvider.ExpectedCalls = nil
+	})
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var flagRunAddr string
@@ -11,6 +16,24 @@ var flagDSN string
 var flagSecret string
 var flagCertPath string
 var flagCertKeyPath string
+var flagSessionTTL time.Duration
+var flagSecretID string
+var flagSecretKeyring string
+var flagRotateBatchSize int
+var flagStrictAAD bool
+var flagTOTPSkew int
+var flagClientCAPath string
+var flagCertMode string
+var flagLoginMaxFailures int
+var flagLoginMaxIPFailures int
+var flagLoginBackoff time.Duration
+var flagLoginMaxLockout time.Duration
+var flagKeyProvider string
+var flagKeyFile string
+var flagKeyCommand string
+var flagKeySalt string
+var flagDev bool
+var flagTrashRetention time.Duration
 
 const (
 	envServerAddress = "SERVER_ADDRESS"
@@ -19,16 +42,79 @@ const (
 	envSecret        = "SECRET"
 	envCertPath      = "CERT_PATH"
 	envCertKeyPath   = "CERT_KEY_PATH"
+	envSessionTTL    = "SESSION_TTL"
+	envSecretID      = "SECRET_ID"
+	envSecretKeyring = "SECRET_KEYRING"
+	envStrictAAD     = "STRICT_AAD"
+	envTOTPSkew      = "TOTP_SKEW"
+	envClientCAPath  = "CLIENT_CA_PATH"
+	envCertMode      = "CERT_MODE"
+	envLoginFailures = "LOGIN_MAX_FAILURES"
+	envIPFailures    = "LOGIN_MAX_IP_FAILURES"
+	envLoginBackoff  = "LOGIN_BACKOFF"
+	envLoginLockout  = "LOGIN_MAX_LOCKOUT"
+	envKeyProvider   = "KEY_PROVIDER"
+	envKeyFile       = "KEY_FILE"
+	envKeyCommand    = "KEY_COMMAND"
+	envKeySalt       = "KEY_SALT"
+	envKeyPassphrase = "KEY_PASSPHRASE"
+	envDev           = "DEV"
+	envRetention     = "TRASH_RETENTION"
+)
+
+// команды сервера
+const (
+	// CommandServe запускает сервер, команда по умолчанию.
+	CommandServe = "serve"
+	// CommandRotateKey перешифровывает данные текущим мастер-ключом.
+	CommandRotateKey = "rotate-key"
+	// CommandUnlock снимает блокировку входа с пользователей и адресов, переданных аргументами.
+	CommandUnlock = "unlock"
+	// CommandExportAudit выгружает журнал аудита в JSON Lines, аргументами можно ограничить пользователей.
+	CommandExportAudit = "export-audit"
+)
+
+// режимы аутентификации по клиентскому сертификату
+const (
+	// CertModeLogin позволяет входить по привязанному сертификату без пароля.
+	CertModeLogin = "login"
+	// CertModeSecondFactor требует привязанный сертификат вместе с паролем.
+	CertModeSecondFactor = "second-factor"
+)
+
+var (
+	// ErrKeyringFormat описывает ошибку разбора связки старых мастер-ключей.
+	ErrKeyringFormat = errors.New("keyring format must be id=secret,id=secret")
+	// ErrCertMode описывает неизвестный режим аутентификации по сертификату.
+	ErrCertMode = errors.New("cert mode must be login or second-factor")
+	// ErrTOTPSkew описывает отрицательное расхождение часов для одноразовых кодов.
+	ErrTOTPSkew = errors.New("totp skew must not be negative")
 )
 
 // Config определяет конфигурацию приложения, собираемую из аргументов командной строки и переменных окружения.
 type Config struct {
-	RunAddr     string // Адрес и порт для запуска сервера.
-	LogLevel    string // Уровень логирования.
-	DSN         string // Data Source Name для подключения к БД.
-	Secret      string // Секрет для шифрования данных.
-	CertPath    string // путь до файла с сертификатом
-	CertKeyPath string // путь до ключа
+	RunAddr            string            // Адрес и порт для запуска сервера.
+	LogLevel           string            // Уровень логирования.
+	DSN                string            // Data Source Name для подключения к БД.
+	Secret             string            // мастер-ключ, загруженный из источника KeyProvider
+	CertPath           string            // путь до файла с сертификатом
+	CertKeyPath        string            // путь до ключа
+	SessionTTL         time.Duration     // время жизни токена сессии
+	Command            string            // команда сервера: serve, rotate-key, unlock или export-audit
+	SecretID           string            // идентификатор текущего мастер-ключа
+	OldSecrets         map[string]string // старые мастер-ключи по идентификаторам, нужны на время ротации
+	RotateBatchSize    int               // количество записей, перешифровываемых в одной транзакции
+	StrictAAD          bool              // отклонять записи, не привязанные к владельцу через AAD
+	TOTPSkew           int               // допустимое расхождение часов клиента в шагах TOTP по 30 секунд
+	ClientCAPath       string            // путь до CA клиентских сертификатов, пустой путь отключает mTLS
+	CertMode           string            // режим аутентификации по сертификату: login или second-factor
+	LoginMaxFailures   int               // неудачных попыток входа в аккаунт до блокировки
+	LoginMaxIPFailures int               // неудачных попыток входа с одного адреса до блокировки
+	LoginBackoff       time.Duration     // первая блокировка, каждая следующая ошибка удваивает ее
+	LoginMaxLockout    time.Duration     // максимальная длительность блокировки
+	Args               []string          // аргументы команды после флагов
+	Dev                bool              // режим разработки, разрешает встроенный мастер-ключ
+	TrashRetention     time.Duration     // сколько удаленные записи хранятся в корзине до окончательного удаления
 }
 
 // GetConfig парсит аргументы командной строки и переменные окружения,
@@ -36,15 +122,41 @@ type Config struct {
 //
 // Возвращает сконфигурированный экземпляр *Config.
 func GetConfig() (*Config, error) {
+	// первым аргументом может идти команда: keeper-server rotate-key -j ...
+	command := CommandServe
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
 	// парсим аргументы командной строки
 	flag.StringVar(&flagRunAddr, "a", "localhost:50051", "address and port to run server")
 	flag.StringVar(&flagLogLevel, "l", "info", "log level")
 	flag.StringVar(&flagDSN, "d", "DB.db", "DB DSN")
-	flag.StringVar(&flagSecret, "j", "thisis32byteencryptionkey1234567", "secret for encryption")
+	flag.StringVar(&flagSecret, "j", DefaultSecret, "secret for encryption, the default one requires -dev")
 	flag.StringVar(&flagCertPath, "cr", "certs/keeper.crt", "path to cert")
 	flag.StringVar(&flagCertKeyPath, "ck", "certs/key.pem", "path to cert key")
-	flag.Parse()
+	flag.DurationVar(&flagSessionTTL, "st", 24*time.Hour, "session token lifetime")
+	flag.StringVar(&flagSecretID, "ji", "1", "id of current secret")
+	flag.StringVar(&flagSecretKeyring, "jk", "", "old secrets used during rotation, loaded by the key provider: id=secret,id=secret")
+	flag.IntVar(&flagRotateBatchSize, "rb", 100, "rows re-encrypted in one transaction by rotate-key")
+	flag.BoolVar(&flagStrictAAD, "sa", false, "reject records encrypted without additional data")
+	flag.IntVar(&flagTOTPSkew, "ts", 1, "allowed TOTP clock drift in 30 second steps")
+	flag.StringVar(&flagClientCAPath, "cca", "", "path to client CA, enables mutual TLS")
+	flag.StringVar(&flagCertMode, "cm", CertModeSecondFactor, "client certificate mode: login or second-factor")
+	flag.IntVar(&flagLoginMaxFailures, "lf", 5, "failed logins per account before lockout")
+	flag.IntVar(&flagLoginMaxIPFailures, "lfi", 20, "failed logins per client address before lockout")
+	flag.DurationVar(&flagLoginBackoff, "lb", 30*time.Second, "first lockout duration, doubled on each further failure")
+	flag.DurationVar(&flagLoginMaxLockout, "ll", 15*time.Minute, "maximum lockout duration")
+	flag.StringVar(&flagKeyProvider, "kp", KeyProviderSecret, "master key provider: secret, file, passphrase or command")
+	flag.StringVar(&flagKeyFile, "kf", "", "path to master key file for file key provider")
+	flag.StringVar(&flagKeyCommand, "kc", "", "command printing master key for command key provider")
+	flag.StringVar(&flagKeySalt, "ks", "", "salt for passphrase key provider, passphrase is read from KEY_PASSPHRASE")
+	flag.BoolVar(&flagDev, "dev", false, "development mode, allows built-in default secret")
+	flag.DurationVar(&flagTrashRetention, "tr", 30*24*time.Hour, "how long deleted items stay in trash")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return nil, err
+	}
 
 	// если есть переменные окружения, используем их значения
 	if envRunAddr := os.Getenv(envServerAddress); envRunAddr != "" {
@@ -67,13 +179,170 @@ func GetConfig() (*Config, error) {
 	if envCertKey := os.Getenv(envCertKeyPath); envCertKey != "" {
 		flagCertKeyPath = envCertKey
 	}
+	if envTTL := os.Getenv(envSessionTTL); envTTL != "" {
+		ttl, err := time.ParseDuration(envTTL)
+		if err != nil {
+			return nil, err
+		}
+		flagSessionTTL = ttl
+	}
+	if envID := os.Getenv(envSecretID); envID != "" {
+		flagSecretID = envID
+	}
+	envKeyring := os.Getenv(envSecretKeyring)
+	if envKeyring != "" {
+		flagSecretKeyring = envKeyring
+	}
+
+	if envStrict := os.Getenv(envStrictAAD); envStrict != "" {
+		strict, err := strconv.ParseBool(envStrict)
+		if err != nil {
+			return nil, err
+		}
+		flagStrictAAD = strict
+	}
+
+	if envSkew := os.Getenv(envTOTPSkew); envSkew != "" {
+		skew, err := strconv.Atoi(envSkew)
+		if err != nil {
+			return nil, err
+		}
+		flagTOTPSkew = skew
+	}
+	if flagTOTPSkew < 0 {
+		return nil, ErrTOTPSkew
+	}
+
+	if envCA := os.Getenv(envClientCAPath); envCA != "" {
+		flagClientCAPath = envCA
+	}
+	if envMode := os.Getenv(envCertMode); envMode != "" {
+		flagCertMode = envMode
+	}
+	if flagCertMode != CertModeLogin && flagCertMode != CertModeSecondFactor {
+		return nil, ErrCertMode
+	}
+
+	if envFailures := os.Getenv(envLoginFailures); envFailures != "" {
+		failures, err := strconv.Atoi(envFailures)
+		if err != nil {
+			return nil, err
+		}
+		flagLoginMaxFailures = failures
+	}
+	if envFailures := os.Getenv(envIPFailures); envFailures != "" {
+		failures, err := strconv.Atoi(envFailures)
+		if err != nil {
+			return nil, err
+		}
+		flagLoginMaxIPFailures = failures
+	}
+	if envBackoff := os.Getenv(envLoginBackoff); envBackoff != "" {
+		backoff, err := time.ParseDuration(envBackoff)
+		if err != nil {
+			return nil, err
+		}
+		flagLoginBackoff = backoff
+	}
+	if envLockout := os.Getenv(envLoginLockout); envLockout != "" {
+		lockout, err := time.ParseDuration(envLockout)
+		if err != nil {
+			return nil, err
+		}
+		flagLoginMaxLockout = lockout
+	}
+
+	if envProvider := os.Getenv(envKeyProvider); envProvider != "" {
+		flagKeyProvider = envProvider
+	}
+	if envFile := os.Getenv(envKeyFile); envFile != "" {
+		flagKeyFile = envFile
+	}
+	if envCommand := os.Getenv(envKeyCommand); envCommand != "" {
+		flagKeyCommand = envCommand
+	}
+	if envSalt := os.Getenv(envKeySalt); envSalt != "" {
+		flagKeySalt = envSalt
+	}
+	if envDevMode := os.Getenv(envDev); envDevMode != "" {
+		dev, err := strconv.ParseBool(envDevMode)
+		if err != nil {
+			return nil, err
+		}
+		flagDev = dev
+	}
+	if envTrash := os.Getenv(envRetention); envTrash != "" {
+		retention, err := time.ParseDuration(envTrash)
+		if err != nil {
+			return nil, err
+		}
+		flagTrashRetention = retention
+	}
+
+	keyringSources, err := parseKeyring(flagSecretKeyring)
+	if err != nil {
+		return nil, err
+	}
+
+	// парольная фраза читается только из окружения, чтобы не попасть в список процессов
+	keyProvider, err := newKeyProvider(flagKeyProvider, flagSecret, flagKeyFile, os.Getenv(envKeyPassphrase), flagKeySalt, flagKeyCommand)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := loadSecret(context.Background(), keyProvider, flagDev)
+	if err != nil {
+		return nil, err
+	}
+
+	// старые ключи загружаются тем же источником, что и текущий, старые фразы - тоже только из окружения
+	if flagKeyProvider == KeyProviderPassphrase && len(keyringSources) > 0 && envKeyring == "" {
+		return nil, ErrKeyringFlag
+	}
+	oldSecrets, err := loadOldSecrets(context.Background(), flagKeyProvider, keyringSources, flagKeySalt)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
-		RunAddr:     flagRunAddr,
-		LogLevel:    flagLogLevel,
-		DSN:         flagDSN,
-		Secret:      flagSecret,
-		CertPath:    flagCertPath,
-		CertKeyPath: flagCertKeyPath,
+		RunAddr:            flagRunAddr,
+		LogLevel:           flagLogLevel,
+		DSN:                flagDSN,
+		Secret:             secret,
+		CertPath:           flagCertPath,
+		CertKeyPath:        flagCertKeyPath,
+		SessionTTL:         flagSessionTTL,
+		Command:            command,
+		SecretID:           flagSecretID,
+		OldSecrets:         oldSecrets,
+		RotateBatchSize:    flagRotateBatchSize,
+		StrictAAD:          flagStrictAAD,
+		TOTPSkew:           flagTOTPSkew,
+		ClientCAPath:       flagClientCAPath,
+		CertMode:           flagCertMode,
+		LoginMaxFailures:   flagLoginMaxFailures,
+		LoginMaxIPFailures: flagLoginMaxIPFailures,
+		LoginBackoff:       flagLoginBackoff,
+		LoginMaxLockout:    flagLoginMaxLockout,
+		Args:               flag.CommandLine.Args(),
+		Dev:                flagDev,
+		TrashRetention:     flagTrashRetention,
 	}, nil
 }
+
+// parseKeyring разбирает связку старых мастер-ключей в формате id=secret,id=secret.
+// Вместо ключа может стоять путь к файлу, парольная фраза или команда, в зависимости от источника ключа.
+func parseKeyring(keyring string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	if keyring == "" {
+		return secrets, nil
+	}
+
+	for _, pair := range strings.Split(keyring, ",") {
+		id, secret, found := strings.Cut(pair, "=")
+		if !found || id == "" || secret == "" {
+			return nil, ErrKeyringFormat
+		}
+		secrets[id] = secret
+	}
+	return secrets, nil
+}
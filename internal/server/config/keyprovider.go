@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// DefaultSecret встроенный мастер-ключ для локальной разработки. Сервер запускается с ним только с флагом -dev.
+const DefaultSecret = "thisis32byteencryptionkey1234567"
+
+// источники мастер-ключа
+const (
+	// KeyProviderSecret берет ключ из флага -j или переменной SECRET, источник по умолчанию.
+	KeyProviderSecret = "secret"
+	// KeyProviderFile читает ключ из файла.
+	KeyProviderFile = "file"
+	// KeyProviderPassphrase выводит ключ из парольной фразы с помощью argon2id.
+	KeyProviderPassphrase = "passphrase"
+	// KeyProviderCommand берет ключ из вывода внешней команды.
+	KeyProviderCommand = "command"
+)
+
+// параметры argon2id для вывода мастер-ключа из парольной фразы. Менять их нельзя:
+// ключ получится другим, и данные, зашифрованные прежним ключом, не расшифруются.
+const (
+	passphraseTime    = 3
+	passphraseMemory  = 64 * 1024
+	passphraseThreads = 4
+	passphraseKeyLen  = 32
+)
+
+// keyCommandTimeout ограничивает время работы внешней команды, выдающей ключ
+const keyCommandTimeout = 10 * time.Second
+
+var (
+	// ErrDefaultSecret описывает запуск со встроенным мастер-ключом без флага -dev.
+	ErrDefaultSecret = errors.New("built-in default secret is allowed only with -dev")
+	// ErrKeyProvider описывает неизвестный источник мастер-ключа.
+	ErrKeyProvider = errors.New("key provider must be secret, file, passphrase or command")
+	// ErrEmptyKey описывает пустой ключ, полученный из источника.
+	ErrEmptyKey = errors.New("key provider returned empty key")
+	// ErrKeyFileMode описывает файл ключа, доступный не только владельцу.
+	ErrKeyFileMode = errors.New("key file must not be accessible by group or others")
+	// ErrPassphraseSalt описывает отсутствие соли для вывода ключа из парольной фразы.
+	ErrPassphraseSalt = errors.New("passphrase key provider requires salt")
+	// ErrKeyringFlag описывает старые парольные фразы, переданные флагом, а не через окружение.
+	ErrKeyringFlag = errors.New("old passphrases are read only from SECRET_KEYRING")
+)
+
+// KeyProvider загружает мастер-ключ, которым оборачиваются ключи пользователей.
+type KeyProvider interface {
+	LoadKey(ctx context.Context) (string, error)
+}
+
+// StaticKeyProvider возвращает ключ, переданный в конфигурации.
+type StaticKeyProvider struct {
+	secret string
+}
+
+// NewStaticKeyProvider создает источник с заданным ключом
+func NewStaticKeyProvider(secret string) *StaticKeyProvider {
+	return &StaticKeyProvider{secret: secret}
+}
+
+// LoadKey возвращает заданный ключ
+func (p *StaticKeyProvider) LoadKey(ctx context.Context) (string, error) {
+	if p.secret == "" {
+		return "", ErrEmptyKey
+	}
+	return p.secret, nil
+}
+
+// FileKeyProvider читает ключ из файла. Перевод строки в конце файла отбрасывается.
+type FileKeyProvider struct {
+	path string
+}
+
+// NewFileKeyProvider создает источник, читающий ключ из файла path
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{path: path}
+}
+
+// LoadKey читает ключ из файла. Файл, доступный группе или остальным пользователям, отклоняется.
+func (p *FileKeyProvider) LoadKey(ctx context.Context) (string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("%w: %s", ErrKeyFileMode, p.path)
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimRight(string(data), "\r\n")
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+	return key, nil
+}
+
+// PassphraseKeyProvider выводит 32-байтовый ключ из парольной фразы и соли с помощью argon2id.
+type PassphraseKeyProvider struct {
+	passphrase string
+	salt       string
+}
+
+// NewPassphraseKeyProvider создает источник, выводящий ключ из парольной фразы
+func NewPassphraseKeyProvider(passphrase string, salt string) *PassphraseKeyProvider {
+	return &PassphraseKeyProvider{passphrase: passphrase, salt: salt}
+}
+
+// LoadKey выводит ключ. Одна и та же фраза с той же солью всегда дает один и тот же ключ.
+func (p *PassphraseKeyProvider) LoadKey(ctx context.Context) (string, error) {
+	if p.passphrase == "" {
+		return "", ErrEmptyKey
+	}
+	if p.salt == "" {
+		return "", ErrPassphraseSalt
+	}
+	key := argon2.IDKey([]byte(p.passphrase), []byte(p.salt), passphraseTime, passphraseMemory, passphraseThreads, passphraseKeyLen)
+	return string(key), nil
+}
+
+// CommandKeyProvider берет ключ из стандартного вывода внешней команды,
+// например клиента менеджера секретов. Команда выполняется через sh -c.
+type CommandKeyProvider struct {
+	command string
+	timeout time.Duration
+}
+
+// NewCommandKeyProvider создает источник, запускающий команду command
+func NewCommandKeyProvider(command string) *CommandKeyProvider {
+	return &CommandKeyProvider{command: command, timeout: keyCommandTimeout}
+}
+
+// LoadKey запускает команду и возвращает ее вывод без перевода строки в конце
+func (p *CommandKeyProvider) LoadKey(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("key command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	key := strings.TrimRight(stdout.String(), "\r\n")
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+	return key, nil
+}
+
+// newKeyProvider создает источник мастер-ключа по названию
+func newKeyProvider(name string, secret string, keyFile string, passphrase string, salt string, command string) (KeyProvider, error) {
+	switch name {
+	case KeyProviderSecret:
+		return NewStaticKeyProvider(secret), nil
+	case KeyProviderFile:
+		return NewFileKeyProvider(keyFile), nil
+	case KeyProviderPassphrase:
+		return NewPassphraseKeyProvider(passphrase, salt), nil
+	case KeyProviderCommand:
+		return NewCommandKeyProvider(command), nil
+	default:
+		return nil, ErrKeyProvider
+	}
+}
+
+// loadSecret загружает мастер-ключ и отказывается работать со встроенным ключом вне режима разработки
+func loadSecret(ctx context.Context, provider KeyProvider, dev bool) (string, error) {
+	secret, err := provider.LoadKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	if secret == DefaultSecret && !dev {
+		return "", ErrDefaultSecret
+	}
+	return secret, nil
+}
+
+// loadOldSecrets загружает старые мастер-ключи тем же источником, что и текущий. Для каждого
+// идентификатора связка хранит значение, которое источник понимает так же, как настройку текущего ключа:
+// сам ключ, путь к файлу, парольную фразу с той же солью или команду.
+func loadOldSecrets(ctx context.Context, providerName string, sources map[string]string, salt string) (map[string]string, error) {
+	secrets := make(map[string]string, len(sources))
+	for id, source := range sources {
+		provider, err := newKeyProvider(providerName, source, source, source, salt, source)
+		if err != nil {
+			return nil, err
+		}
+		// старый ключ нужен, чтобы уйти с него, поэтому встроенный ключ здесь разрешен
+		key, err := provider.LoadKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("old secret %q: %w", id, err)
+		}
+		secrets[id] = key
+	}
+	return secrets, nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("key read", func(t *testing.T) {
+		path := filepath.Join(dir, "master.key")
+		assert.NoError(t, os.WriteFile(path, []byte("0123456789abcdef0123456789abcdef\n"), 0o600))
+
+		key, err := NewFileKeyProvider(path).LoadKey(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "0123456789abcdef0123456789abcdef", key)
+	})
+
+	t.Run("readable by others", func(t *testing.T) {
+		path := filepath.Join(dir, "shared.key")
+		assert.NoError(t, os.WriteFile(path, []byte("0123456789abcdef0123456789abcdef"), 0o644))
+
+		_, err := NewFileKeyProvider(path).LoadKey(context.Background())
+		assert.ErrorIs(t, err, ErrKeyFileMode)
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		path := filepath.Join(dir, "empty.key")
+		assert.NoError(t, os.WriteFile(path, []byte("\n"), 0o600))
+
+		_, err := NewFileKeyProvider(path).LoadKey(context.Background())
+		assert.ErrorIs(t, err, ErrEmptyKey)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := NewFileKeyProvider(filepath.Join(dir, "missing.key")).LoadKey(context.Background())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestPassphraseKeyProvider(t *testing.T) {
+	t.Run("same passphrase gives same key", func(t *testing.T) {
+		first, err := NewPassphraseKeyProvider("correct horse", "keeper-salt").LoadKey(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, first, 32)
+
+		second, err := NewPassphraseKeyProvider("correct horse", "keeper-salt").LoadKey(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		other, err := NewPassphraseKeyProvider("correct horse", "other-salt").LoadKey(context.Background())
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, other)
+	})
+
+	t.Run("salt required", func(t *testing.T) {
+		_, err := NewPassphraseKeyProvider("correct horse", "").LoadKey(context.Background())
+		assert.ErrorIs(t, err, ErrPassphraseSalt)
+	})
+
+	t.Run("passphrase required", func(t *testing.T) {
+		_, err := NewPassphraseKeyProvider("", "keeper-salt").LoadKey(context.Background())
+		assert.ErrorIs(t, err, ErrEmptyKey)
+	})
+}
+
+func TestCommandKeyProvider(t *testing.T) {
+	t.Run("key from output", func(t *testing.T) {
+		key, err := NewCommandKeyProvider("echo 0123456789abcdef0123456789abcdef").LoadKey(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "0123456789abcdef0123456789abcdef", key)
+	})
+
+	t.Run("command failed", func(t *testing.T) {
+		_, err := NewCommandKeyProvider("echo denied >&2; exit 1").LoadKey(context.Background())
+		assert.ErrorContains(t, err, "denied")
+	})
+
+	t.Run("empty output", func(t *testing.T) {
+		_, err := NewCommandKeyProvider("true").LoadKey(context.Background())
+		assert.ErrorIs(t, err, ErrEmptyKey)
+	})
+}
+
+func TestLoadSecret(t *testing.T) {
+	t.Run("default secret rejected", func(t *testing.T) {
+		_, err := loadSecret(context.Background(), NewStaticKeyProvider(DefaultSecret), false)
+		assert.ErrorIs(t, err, ErrDefaultSecret)
+	})
+
+	t.Run("default secret in dev mode", func(t *testing.T) {
+		secret, err := loadSecret(context.Background(), NewStaticKeyProvider(DefaultSecret), true)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSecret, secret)
+	})
+
+	t.Run("default secret from command rejected", func(t *testing.T) {
+		_, err := loadSecret(context.Background(), NewCommandKeyProvider("echo "+DefaultSecret), false)
+		assert.ErrorIs(t, err, ErrDefaultSecret)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := newKeyProvider("vault", "", "", "", "", "")
+		assert.ErrorIs(t, err, ErrKeyProvider)
+	})
+}
+
+func TestLoadOldSecrets(t *testing.T) {
+	t.Run("keys from files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "old.key")
+		assert.NoError(t, os.WriteFile(path, []byte("0123456789abcdef0123456789abcdef\n"), 0o600))
+
+		secrets, err := loadOldSecrets(context.Background(), KeyProviderFile, map[string]string{"1": path}, "")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"1": "0123456789abcdef0123456789abcdef"}, secrets)
+	})
+
+	t.Run("keys from passphrases", func(t *testing.T) {
+		secrets, err := loadOldSecrets(context.Background(), KeyProviderPassphrase, map[string]string{"1": "old horse"}, "keeper-salt")
+		assert.NoError(t, err)
+		expected, _ := NewPassphraseKeyProvider("old horse", "keeper-salt").LoadKey(context.Background())
+		assert.Equal(t, expected, secrets["1"])
+	})
+
+	t.Run("plain keys", func(t *testing.T) {
+		secrets, err := loadOldSecrets(context.Background(), KeyProviderSecret, map[string]string{"1": DefaultSecret}, "")
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSecret, secrets["1"])
+	})
+
+	t.Run("key file readable by others", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "shared.key")
+		assert.NoError(t, os.WriteFile(path, []byte("0123456789abcdef0123456789abcdef"), 0o644))
+
+		_, err := loadOldSecrets(context.Background(), KeyProviderFile, map[string]string{"1": path}, "")
+		assert.ErrorIs(t, err, ErrKeyFileMode)
+	})
+}
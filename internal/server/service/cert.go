@@ -0,0 +1,24 @@
+package service
+
+import (
+	"crypto/x509"
+)
+
+// CertIdentities возвращает имена, по которым сертификат сопоставляется с пользователем:
+// subject целиком и все SAN с префиксом типа, например email:alice@example.com.
+func CertIdentities(cert *x509.Certificate) []string {
+	var identities []string
+	if subject := cert.Subject.String(); subject != "" {
+		identities = append(identities, "subject:"+subject)
+	}
+	for _, email := range cert.EmailAddresses {
+		identities = append(identities, "email:"+email)
+	}
+	for _, dns := range cert.DNSNames {
+		identities = append(identities, "dns:"+dns)
+	}
+	for _, uri := range cert.URIs {
+		identities = append(identities, "uri:"+uri.String())
+	}
+	return identities
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// TestCertIdentities проверяет имена, извлекаемые из сертификата
+func TestCertIdentities(t *testing.T) {
+	device, _ := url.Parse("spiffe://keeper/device/1")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice", Organization: []string{"Keeper"}},
+		EmailAddresses: []string{"alice@example.com"},
+		DNSNames:       []string{"laptop.example.com"},
+		URIs:           []*url.URL{device},
+	}
+
+	expected := []string{
+		"subject:CN=alice,O=Keeper",
+		"email:alice@example.com",
+		"dns:laptop.example.com",
+		"uri:spiffe://keeper/device/1",
+	}
+	if identities := CertIdentities(cert); !reflect.DeepEqual(identities, expected) {
+		t.Errorf("Expected %v, got %v", expected, identities)
+	}
+
+	if identities := CertIdentities(&x509.Certificate{}); len(identities) != 0 {
+		t.Errorf("Expected no identities, got %v", identities)
+	}
+}
@@ -20,6 +20,12 @@ func generateRandom(size int) ([]byte, error) {
 
 // Encrypt шифрует данные с использованием ключа шифрования
 func Encrypt(plainText string, key string) (string, error) {
+	return EncryptWithAAD(plainText, key, nil)
+}
+
+// EncryptWithAAD шифрует данные и аутентифицирует вместе с ними дополнительные данные.
+// Расшифровать результат можно только с теми же дополнительными данными.
+func EncryptWithAAD(plainText string, key string, additionalData []byte) (string, error) {
 	// Преобразование строки в байтовый срез
 	plainTextBytes := []byte(plainText)
 	encryptionKey := []byte(key)
@@ -39,12 +45,17 @@ func Encrypt(plainText string, key string) (string, error) {
 		return "", err
 	}
 
-	cipherText := aesgcm.Seal(nonce, nonce, plainTextBytes, nil)
+	cipherText := aesgcm.Seal(nonce, nonce, plainTextBytes, additionalData)
 	return hex.EncodeToString(cipherText), nil
 }
 
 // Decrypt расшифровывает данные с использованием ключа шифрования
 func Decrypt(cipherTextHex string, key string) (string, error) {
+	return DecryptWithAAD(cipherTextHex, key, nil)
+}
+
+// DecryptWithAAD расшифровывает данные, зашифрованные с дополнительными данными
+func DecryptWithAAD(cipherTextHex string, key string, additionalData []byte) (string, error) {
 	encryptionKey := []byte(key)
 
 	cipherText, err := hex.DecodeString(cipherTextHex)
@@ -68,10 +79,26 @@ func Decrypt(cipherTextHex string, key string) (string, error) {
 	}
 
 	nonce, cipherText := cipherText[:nonceSize], cipherText[nonceSize:]
-	plainText, err := aesgcm.Open(nil, nonce, cipherText, nil)
+	plainText, err := aesgcm.Open(nil, nonce, cipherText, additionalData)
 	if err != nil {
 		return "", err
 	}
 
 	return string(plainText), nil
 }
+
+// ClientSealedPrefix отмечает данные, зашифрованные на клиенте ключом хранилища.
+// Сервер такие данные не расшифровывает и возвращает клиенту как есть.
+const ClientSealedPrefix = "c:"
+
+// минимальный размер шифртекста AES-GCM: nonce и тег аутентификации
+const minSealedSize = 12 + 16
+
+// IsSealed проверяет, что строка похожа на шифртекст AES-GCM в hex-представлении
+func IsSealed(cipherTextHex string) bool {
+	cipherText, err := hex.DecodeString(cipherTextHex)
+	if err != nil {
+		return false
+	}
+	return len(cipherText) >= minSealedSize
+}
@@ -75,3 +75,23 @@ func TestDecryptInvalidCipherText(t *testing.T) {
 		t.Fatalf("Expected error for invalid ciphertext, got nil")
 	}
 }
+
+// TestIsSealed проверяет распознавание шифртекста в hex-представлении
+func TestIsSealed(t *testing.T) {
+	key := "thisis32byteencryptionkey1234567" // 32 байта
+
+	encryptedText, err := Encrypt("data", key)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	if !IsSealed(encryptedText) {
+		t.Errorf("Expected ciphertext to be recognized as sealed")
+	}
+	if IsSealed("not hex") {
+		t.Errorf("Expected non-hex string not to be recognized as sealed")
+	}
+	if IsSealed("abcd") {
+		t.Errorf("Expected short string not to be recognized as sealed")
+	}
+}
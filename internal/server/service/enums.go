@@ -10,6 +10,9 @@ const (
 	GET_DATA
 	CHOSE_CREATE_DATA
 	CREATE_DATA
+	CHOSE_UPDATE_DATA
+	UPDATE_DATA
+	CHOSE_DELETE_DATA
 )
 
 type DataType int
@@ -20,3 +23,45 @@ const (
 	BYTE
 	CARD
 )
+
+// AuditAction определяет тип события журнала аудита
+type AuditAction string
+
+// События журнала аудита. Значения сохраняются в БД и попадают в экспорт.
+const (
+	LOGIN_SUCCESS AuditAction = "login_success"
+	LOGIN_FAILURE AuditAction = "login_failure"
+	ITEM_READ     AuditAction = "item_read"
+	ITEM_CREATE   AuditAction = "item_create"
+	ITEM_UPDATE   AuditAction = "item_update"
+	ITEM_DELETE   AuditAction = "item_delete"
+	ITEM_RESTORE  AuditAction = "item_restore"
+	ITEM_SHARE    AuditAction = "item_share"
+	ITEM_UNSHARE  AuditAction = "item_unshare"
+	TRASH_EMPTY   AuditAction = "trash_empty"
+	// чтение и восстановление прежней версии записи из истории
+	REVISION_READ    AuditAction = "revision_read"
+	REVISION_RESTORE AuditAction = "revision_restore"
+	// выгрузка журнала аудита оператором командой export-audit
+	AUDIT_EXPORT AuditAction = "audit_export"
+)
+
+// SharePermission определяет доступ получателя к общей записи
+type SharePermission string
+
+// Уровни доступа к общей записи. Значения сохраняются в БД.
+const (
+	SHARE_READ  SharePermission = "read"
+	SHARE_WRITE SharePermission = "write"
+)
+
+// OrgRole определяет роль участника организации
+type OrgRole string
+
+// Роли участников организации. Значения сохраняются в БД.
+const (
+	ORG_OWNER     OrgRole = "owner"
+	ORG_ADMIN     OrgRole = "admin"
+	ORG_MEMBER    OrgRole = "member"
+	ORG_READ_ONLY OrgRole = "read_only"
+)
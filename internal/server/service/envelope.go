@@ -0,0 +1,143 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dataKeySize размер ключа шифрования данных пользователя (AES-256)
+const dataKeySize = 32
+
+// заголовки шифртекста, зашифрованного ключом пользователя: <префикс><версия>:<hex>
+const (
+	// userKeyPrefix отмечает записи, зашифрованные без дополнительных данных
+	userKeyPrefix = "u"
+	// boundKeyPrefix отмечает записи, привязанные к владельцу, id, типу и названию через AAD
+	boundKeyPrefix = "a"
+	// sharedKeyPrefix отмечает общие записи, зашифрованные ключом записи. Вместо версии
+	// в заголовке поколение ключа записи, оно растет при каждом изменении доступа
+	sharedKeyPrefix = "s"
+)
+
+// ErrInvalidHeader описывает ошибку разбора заголовка шифртекста.
+var ErrInvalidHeader = errors.New("invalid ciphertext header")
+
+// KeyHeader описывает заголовок шифртекста записи.
+type KeyHeader struct {
+	Version int  // версия ключа пользователя, 0 для данных, зашифрованных мастер-ключом
+	Bound   bool // шифртекст привязан к записи через дополнительные данные AES-GCM
+	Shared  bool // запись зашифрована ключом записи, Version содержит поколение ключа
+}
+
+// GenerateDataKey генерирует случайный ключ шифрования данных пользователя
+func GenerateDataKey() (string, error) {
+	key, err := generateRandom(dataKeySize)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// RecordAAD собирает дополнительные данные записи. Длины строк входят в AAD,
+// чтобы разные наборы полей не давали одинаковую последовательность байт.
+func RecordAAD(username string, id int64, dataType DataType, title string) []byte {
+	return fmt.Appendf(nil, "%d:%d:%d:%s:%d:%s", id, dataType, len(username), username, len(title), title)
+}
+
+// titleIndexLabel отделяет ключ слепого индекса от ключа шифрования, выведенных из одного ключа пользователя
+const titleIndexLabel = "keeper title index v1"
+
+// TitleIndex вычисляет слепой индекс названия записи: HMAC-SHA256 от названия ключом,
+// выведенным из ключа пользователя. Одинаковые названия дают одинаковый индекс только у одного пользователя.
+func TitleIndex(dataKey string, title string) string {
+	keyMAC := hmac.New(sha256.New, []byte(dataKey))
+	keyMAC.Write([]byte(titleIndexLabel))
+
+	mac := hmac.New(sha256.New, keyMAC.Sum(nil))
+	mac.Write([]byte(title))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TitleAAD собирает дополнительные данные зашифрованного названия. Название привязано к владельцу
+// и слепому индексу, поэтому его нельзя подменить названием другой записи.
+func TitleAAD(username string, titleIndex string) []byte {
+	return fmt.Appendf(nil, "title:%d:%s:%s", len(username), username, titleIndex)
+}
+
+// ItemKeyAAD собирает дополнительные данные ключа общей записи, зашифрованного ключом пользователя.
+// Поколение входит в AAD, поэтому ключ, выданный до отзыва доступа, нельзя выдать за текущий.
+func ItemKeyAAD(itemID int64, username string, generation int) []byte {
+	return fmt.Appendf(nil, "item key:%d:%d:%d:%s", itemID, generation, len(username), username)
+}
+
+// OrgKeyAAD собирает дополнительные данные ключа организации, зашифрованного ключом участника
+func OrgKeyAAD(orgName string, username string) []byte {
+	return fmt.Appendf(nil, "org key:%d:%s:%d:%s", len(orgName), orgName, len(username), username)
+}
+
+// CollectionRecordAAD собирает дополнительные данные командной записи. Вместо владельца
+// запись привязана к коллекции, поэтому ее нельзя перенести в другую коллекцию.
+func CollectionRecordAAD(collectionID int64, id int64, dataType DataType, title string) []byte {
+	return fmt.Appendf(nil, "collection:%d:%d:%d:%d:%s", collectionID, id, dataType, len(title), title)
+}
+
+// CollectionTitleAAD собирает дополнительные данные зашифрованного названия командной записи
+func CollectionTitleAAD(collectionID int64, titleIndex string) []byte {
+	return fmt.Appendf(nil, "collection title:%d:%s", collectionID, titleIndex)
+}
+
+// EncryptRecord шифрует данные ключом пользователя с дополнительными данными записи
+// и добавляет заголовок с версией ключа. По версии при расшифровке выбирается нужный ключ,
+// поэтому смена мастер-ключа не затрагивает данные.
+func EncryptRecord(plainText string, dataKey string, version int, additionalData []byte) (string, error) {
+	cipherText, err := EncryptWithAAD(plainText, dataKey, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d:%s", boundKeyPrefix, version, cipherText), nil
+}
+
+// EncryptSharedRecord шифрует данные общей записи ключом записи заданного поколения
+func EncryptSharedRecord(plainText string, itemKey string, generation int, additionalData []byte) (string, error) {
+	cipherText, err := EncryptWithAAD(plainText, itemKey, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d:%s", sharedKeyPrefix, generation, cipherText), nil
+}
+
+// ParseHeader возвращает заголовок и шифртекст без заголовка.
+// Для данных, зашифрованных напрямую мастер-ключом, заголовка нет и версия равна 0.
+func ParseHeader(cipherText string) (KeyHeader, string, error) {
+	header, body, found := strings.Cut(cipherText, ":")
+	if !found {
+		return KeyHeader{}, cipherText, nil
+	}
+
+	var keyHeader KeyHeader
+	versionStr, ok := strings.CutPrefix(header, userKeyPrefix)
+	if !ok {
+		versionStr, ok = strings.CutPrefix(header, boundKeyPrefix)
+		keyHeader.Bound = true
+	}
+	if !ok {
+		// общая запись всегда привязана к записи, Bound остается true
+		versionStr, ok = strings.CutPrefix(header, sharedKeyPrefix)
+		keyHeader.Shared = true
+	}
+	if !ok {
+		return KeyHeader{}, "", ErrInvalidHeader
+	}
+
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || version < 1 {
+		return KeyHeader{}, "", ErrInvalidHeader
+	}
+	keyHeader.Version = version
+	return keyHeader, body, nil
+}
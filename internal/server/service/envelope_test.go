@@ -0,0 +1,118 @@
+package service
+
+import (
+	"testing"
+)
+
+// TestGenerateDataKey проверяет размер ключа пользователя
+func TestGenerateDataKey(t *testing.T) {
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(dataKey) != dataKeySize {
+		t.Errorf("Expected key length %d, got %d", dataKeySize, len(dataKey))
+	}
+}
+
+// TestEncryptRecord проверяет заголовок с версией ключа и привязку к записи
+func TestEncryptRecord(t *testing.T) {
+	dataKey, _ := GenerateDataKey()
+	aad := RecordAAD("testuser", 5, PASSWORD, "title")
+
+	cipherText, err := EncryptRecord("secret", dataKey, 7, aad)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	header, body, err := ParseHeader(cipherText)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if header.Version != 7 || !header.Bound {
+		t.Errorf("Expected bound version 7, got %+v", header)
+	}
+
+	plainText, err := DecryptWithAAD(body, dataKey, aad)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if plainText != "secret" {
+		t.Errorf("Expected 'secret', got '%s'", plainText)
+	}
+
+	// запись другого владельца, с другим id, типом или названием не расшифровывается
+	others := [][]byte{
+		RecordAAD("otheruser", 5, PASSWORD, "title"),
+		RecordAAD("testuser", 6, PASSWORD, "title"),
+		RecordAAD("testuser", 5, CARD, "title"),
+		RecordAAD("testuser", 5, PASSWORD, "other"),
+		nil,
+	}
+	for _, other := range others {
+		if _, err := DecryptWithAAD(body, dataKey, other); err == nil {
+			t.Errorf("Expected error for additional data '%s'", other)
+		}
+	}
+}
+
+// TestRecordAAD проверяет, что разные поля не дают одинаковых дополнительных данных
+func TestRecordAAD(t *testing.T) {
+	first := RecordAAD("user:1", 1, TEXT, "title")
+	second := RecordAAD("user", 1, TEXT, "1:title")
+	if string(first) == string(second) {
+		t.Errorf("Expected different additional data, got '%s'", first)
+	}
+}
+
+// TestTitleIndex проверяет, что индекс зависит от названия и ключа пользователя
+func TestTitleIndex(t *testing.T) {
+	dataKey, _ := GenerateDataKey()
+	otherKey, _ := GenerateDataKey()
+
+	index := TitleIndex(dataKey, "bank")
+	if len(index) != 64 {
+		t.Errorf("Expected hex HMAC-SHA256, got '%s'", index)
+	}
+	if index != TitleIndex(dataKey, "bank") {
+		t.Errorf("Expected same index for same title")
+	}
+	if index == TitleIndex(dataKey, "bank2") {
+		t.Errorf("Expected different index for different title")
+	}
+	if index == TitleIndex(otherKey, "bank") {
+		t.Errorf("Expected different index for different user key")
+	}
+}
+
+// TestParseHeader проверяет разбор заголовков
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		input   string
+		header  KeyHeader
+		body    string
+		wantErr bool
+	}{
+		{"abcdef", KeyHeader{}, "abcdef", false},
+		{"u1:abcdef", KeyHeader{Version: 1}, "abcdef", false},
+		{"u12:abcdef", KeyHeader{Version: 12}, "abcdef", false},
+		{"a3:abcdef", KeyHeader{Version: 3, Bound: true}, "abcdef", false},
+		{"s2:abcdef", KeyHeader{Version: 2, Bound: true, Shared: true}, "abcdef", false},
+		{"s0:abcdef", KeyHeader{}, "", true},
+		{"x1:abcdef", KeyHeader{}, "", true},
+		{"u0:abcdef", KeyHeader{}, "", true},
+		{"uA:abcdef", KeyHeader{}, "", true},
+		{"a:abcdef", KeyHeader{}, "", true},
+	}
+
+	for _, test := range tests {
+		header, body, err := ParseHeader(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("For input '%s', unexpected error: %v", test.input, err)
+			continue
+		}
+		if header != test.header || body != test.body {
+			t.Errorf("For input '%s', got (%+v, '%s')", test.input, header, body)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Глобальные команды стрима, которые доступны в любом состоянии диалога
+const (
+	CommandBack   = "/back"
+	CommandCancel = "/cancel"
+	CommandHelp   = "/help"
+	CommandMenu   = "/menu"
+)
+
+// CommandInit первое сообщение клиента после открытия стрима
+const CommandInit = "/init"
+
+// ErrUnknownInput описывает ввод, который не подходит к текущему состоянию диалога.
+var ErrUnknownInput = errors.New("unknown input")
+
+// Conversation диалог с клиентом, которым управляет машина состояний
+type Conversation interface {
+	State() State
+	SetState(state State)
+	Reply(message string)
+	// Reset сбрасывает данные незавершенного действия
+	Reset()
+}
+
+// StateHandler описывает состояние диалога в таблице машины состояний
+type StateHandler[C Conversation] struct {
+	// Help подсказка к состоянию для команды /help
+	Help string
+	// Back состояние, в которое возвращает команда /back
+	Back State
+	// Enter отправляет клиенту приглашение при входе в состояние. Если войти в состояние нельзя,
+	// возвращает false, и диалог переходит в состояние Back. Может быть nil.
+	Enter func(conv C) bool
+	// Handle обрабатывает ввод клиента и возвращает следующее состояние.
+	// Если ввод не подходит к состоянию, возвращает ErrUnknownInput.
+	Handle func(conv C, input string) (State, error)
+}
+
+// menuAction пункт главного меню
+type menuAction struct {
+	title string
+	state State
+}
+
+// Machine машина состояний диалога, заданная таблицей обработчиков состояний.
+// Главное меню строится из зарегистрированных действий.
+type Machine[C Conversation] struct {
+	states  map[State]StateHandler[C]
+	menu    State
+	actions []menuAction
+}
+
+// NewMachine создает машину состояний с главным меню в состоянии menu
+func NewMachine[C Conversation](menu State) *Machine[C] {
+	m := &Machine[C]{states: make(map[State]StateHandler[C]), menu: menu}
+	m.states[menu] = StateHandler[C]{
+		Help: "Введите номер действия.",
+		Back: menu,
+		Enter: func(conv C) bool {
+			conv.Reply(m.menuPrompt())
+			return true
+		},
+		Handle: m.selectAction,
+	}
+	return m
+}
+
+// Register добавляет в таблицу обработчик состояния
+func (m *Machine[C]) Register(state State, handler StateHandler[C]) {
+	m.states[state] = handler
+}
+
+// AddAction добавляет пункт главного меню, который переводит диалог в состояние state
+func (m *Machine[C]) AddAction(title string, state State) {
+	m.actions = append(m.actions, menuAction{title: title, state: state})
+}
+
+// Handle обрабатывает ввод клиента в текущем состоянии диалога
+func (m *Machine[C]) Handle(conv C, input string) {
+	current := conv.State()
+	switch input {
+	case CommandHelp:
+		conv.Reply(m.help(current))
+		return
+	case CommandBack:
+		// данные шага собираются заново при входе в предыдущее состояние
+		conv.Reset()
+		m.enter(conv, m.states[current].Back)
+		return
+	case CommandCancel:
+		conv.Reset()
+		conv.Reply("\nДействие отменено.")
+		m.enter(conv, m.menu)
+		return
+	case CommandMenu:
+		conv.Reset()
+		m.enter(conv, m.menu)
+		return
+	}
+
+	handler, ok := m.states[current]
+	if !ok || handler.Handle == nil {
+		m.enter(conv, m.menu)
+		return
+	}
+	next, err := handler.Handle(conv, input)
+	if err != nil {
+		conv.Reply("\nНеизвестная команда, /help - подсказка.")
+		m.enter(conv, current)
+		return
+	}
+	if next != current {
+		m.enter(conv, next)
+	}
+}
+
+// Resume отправляет клиенту приглашение текущего состояния продолженного диалога
+func (m *Machine[C]) Resume(conv C) {
+	m.enter(conv, conv.State())
+}
+
+// enter переводит диалог в состояние state и отправляет клиенту его приглашение
+func (m *Machine[C]) enter(conv C, state State) {
+	// число переходов назад ограничено, чтобы ошибка в таблице не зациклила диалог
+	for i := 0; i < len(m.states); i++ {
+		handler, ok := m.states[state]
+		if !ok || handler.Enter == nil || handler.Enter(conv) {
+			break
+		}
+		state = handler.Back
+	}
+	conv.SetState(state)
+}
+
+// selectAction переводит диалог в состояние выбранного пункта главного меню
+func (m *Machine[C]) selectAction(conv C, input string) (State, error) {
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(m.actions) {
+		return m.menu, ErrUnknownInput
+	}
+	return m.actions[number-1].state, nil
+}
+
+func (m *Machine[C]) menuPrompt() string {
+	var builder strings.Builder
+	builder.WriteString("\nВыбирете действие:")
+	for i, action := range m.actions {
+		fmt.Fprintf(&builder, "\n%d) %s", i+1, action.title)
+	}
+	return builder.String()
+}
+
+func (m *Machine[C]) help(state State) string {
+	var builder strings.Builder
+	if help := m.states[state].Help; help != "" {
+		builder.WriteString("\n" + help)
+	}
+	builder.WriteString("\nКоманды:")
+	fmt.Fprintf(&builder, "\n%s - вернуться на шаг назад", CommandBack)
+	fmt.Fprintf(&builder, "\n%s - отменить действие", CommandCancel)
+	fmt.Fprintf(&builder, "\n%s - главное меню", CommandMenu)
+	fmt.Fprintf(&builder, "\n%s - подсказка", CommandHelp)
+	return builder.String()
+}
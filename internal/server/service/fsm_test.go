@@ -0,0 +1,128 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+// testConversation диалог, который запоминает состояние и ответы машины состояний
+type testConversation struct {
+	state   State
+	replies []string
+	resets  int
+	// запись выбрана в состоянии GET_DATA
+	selected string
+}
+
+func (c *testConversation) State() State         { return c.state }
+func (c *testConversation) SetState(state State) { c.state = state }
+func (c *testConversation) Reply(message string) { c.replies = append(c.replies, message) }
+func (c *testConversation) Reset()               { c.resets++; c.selected = "" }
+
+func (c *testConversation) lastReply() string {
+	if len(c.replies) == 0 {
+		return ""
+	}
+	return c.replies[len(c.replies)-1]
+}
+
+func newTestMachine(titles bool) *Machine[*testConversation] {
+	m := NewMachine[*testConversation](SELECT_ACTION)
+	m.AddAction("GET", GET_DATA)
+	m.Register(GET_DATA, StateHandler[*testConversation]{
+		Help: "Введите название записи.",
+		Back: SELECT_ACTION,
+		Enter: func(c *testConversation) bool {
+			if !titles {
+				c.Reply("нет записей")
+				return false
+			}
+			c.Reply("записи: wifi")
+			return true
+		},
+		Handle: func(c *testConversation, input string) (State, error) {
+			if input != "wifi" {
+				return GET_DATA, ErrUnknownInput
+			}
+			c.selected = input
+			return CONNECTED, nil
+		},
+	})
+	return m
+}
+
+// TestMachineTransitions проверяет переходы по таблице состояний и выбор пункта меню
+func TestMachineTransitions(t *testing.T) {
+	m := newTestMachine(true)
+	conv := &testConversation{state: SELECT_ACTION}
+
+	m.Handle(conv, "1")
+	if conv.state != GET_DATA || conv.lastReply() != "записи: wifi" {
+		t.Errorf("Expected GET_DATA with titles, got %v %q", conv.state, conv.lastReply())
+	}
+
+	m.Handle(conv, "wifi")
+	if conv.state != CONNECTED || conv.selected != "wifi" {
+		t.Errorf("Expected CONNECTED with selected item, got %v %q", conv.state, conv.selected)
+	}
+}
+
+// TestMachineUnknownInput проверяет, что неподходящий ввод не игнорируется, а повторяет приглашение
+func TestMachineUnknownInput(t *testing.T) {
+	m := newTestMachine(true)
+	conv := &testConversation{state: SELECT_ACTION}
+
+	m.Handle(conv, "7")
+	if conv.state != SELECT_ACTION || len(conv.replies) != 2 {
+		t.Fatalf("Expected error and menu, got %v %q", conv.state, conv.replies)
+	}
+	if !strings.Contains(conv.replies[0], "Неизвестная команда") || !strings.Contains(conv.replies[1], "1) GET") {
+		t.Errorf("Unexpected replies %q", conv.replies)
+	}
+
+	conv.state = GET_DATA
+	m.Handle(conv, "bank")
+	if conv.state != GET_DATA || conv.lastReply() != "записи: wifi" {
+		t.Errorf("Expected repeated titles, got %v %q", conv.state, conv.lastReply())
+	}
+}
+
+// TestMachineCommands проверяет глобальные команды /back, /cancel, /menu и /help
+func TestMachineCommands(t *testing.T) {
+	m := newTestMachine(true)
+
+	conv := &testConversation{state: GET_DATA}
+	m.Handle(conv, CommandBack)
+	if conv.state != SELECT_ACTION || conv.resets != 1 {
+		t.Errorf("Expected back to menu with reset step data, got %v %d", conv.state, conv.resets)
+	}
+
+	conv = &testConversation{state: GET_DATA}
+	m.Handle(conv, CommandCancel)
+	if conv.state != SELECT_ACTION || conv.resets != 1 || conv.replies[0] != "\nДействие отменено." {
+		t.Errorf("Expected cancelled action, got %v %d %q", conv.state, conv.resets, conv.replies)
+	}
+
+	conv = &testConversation{state: CONNECTED}
+	m.Handle(conv, CommandMenu)
+	if conv.state != SELECT_ACTION || conv.resets != 1 || !strings.Contains(conv.lastReply(), "Выбирете действие") {
+		t.Errorf("Expected menu, got %v %q", conv.state, conv.lastReply())
+	}
+
+	conv = &testConversation{state: GET_DATA}
+	m.Handle(conv, CommandHelp)
+	if conv.state != GET_DATA || !strings.Contains(conv.lastReply(), "Введите название записи.") || !strings.Contains(conv.lastReply(), CommandBack) {
+		t.Errorf("Expected help of GET_DATA, got %v %q", conv.state, conv.lastReply())
+	}
+}
+
+// TestMachineEnterRejected проверяет возврат в состояние Back, если войти в состояние нельзя
+func TestMachineEnterRejected(t *testing.T) {
+	m := newTestMachine(false)
+	conv := &testConversation{state: SELECT_ACTION}
+
+	m.Handle(conv, "1")
+	if conv.state != SELECT_ACTION || len(conv.replies) != 2 || conv.replies[0] != "нет записей" {
+		t.Errorf("Expected menu after rejected state, got %v %q", conv.state, conv.replies)
+	}
+}
@@ -1,9 +1,62 @@
 package service
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// параметры argon2id для новых хэшей паролей
+const (
+	argonTime    uint32 = 3
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 2
+	argonKeyLen  uint32 = 32
+	argonSaltLen        = 16
+)
+
+// argonPrefix префикс хэша в формате PHC, по нему отличаем новые хэши от старых SHA-256
+const argonPrefix = "$argon2id$"
+
+// DummyPasswordHash хэш argon2id с текущими параметрами, с которым сравнивается пароль неизвестного
+// пользователя. Проверка занимает столько же времени, сколько для существующего пользователя,
+// поэтому по времени ответа нельзя узнать, есть ли аккаунт.
+var DummyPasswordHash = fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+	argonPrefix, argon2.Version, argonMemory, argonTime, argonThreads,
+	base64.RawStdEncoding.EncodeToString(make([]byte, argonSaltLen)),
+	base64.RawStdEncoding.EncodeToString(make([]byte, argonKeyLen)),
 )
 
+// fakeSaltLabel отделяет фиктивную соль от других значений, которые могут выводиться из того же секрета
+const fakeSaltLabel = "keeper fake kdf salt v1"
+
+// fakeSaltSize размер соли, которую генерирует клиент при включении шифрования на клиенте
+const fakeSaltSize = 16
+
+// FakeSalt возвращает соль вывода ключей, которую сервер отдает для аккаунта без шифрования на клиенте
+// и для неизвестного пользователя. Соль детерминирована: HMAC-SHA256 от имени ключом secret, поэтому
+// повторные запросы не отличают неизвестного пользователя от существующего. Секрет не зависит
+// от мастер-ключа, и соль не меняется после ротации.
+func FakeSalt(secret string, username string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fakeSaltLabel))
+	mac.Write([]byte{0})
+	mac.Write([]byte(username))
+	return hex.EncodeToString(mac.Sum(nil)[:fakeSaltSize])
+}
+
+// ErrInvalidHash описывает ошибку разбора сохраненного хэша пароля.
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// GetHashStr возвращает несоленый SHA-256 хэш пароля.
+// Используется только для проверки паролей, сохраненных до перехода на argon2id.
 func GetHashStr(password string) (string, error) {
 	// Хэширование пароля
 	src := []byte(password)
@@ -16,3 +69,65 @@ func GetHashStr(password string) (string, error) {
 
 	return string(passwordHash), nil
 }
+
+// HashPassword хэширует пароль с помощью argon2id со случайной солью.
+// Соль и параметры сохраняются вместе с хэшем: $argon2id$v=19$m=65536,t=3,p=2$<соль>$<хэш>
+func HashPassword(password string) (string, error) {
+	salt, err := generateRandom(argonSaltLen)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argonPrefix, argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword сравнивает пароль с сохраненным хэшем за постоянное время.
+// Второе значение сообщает, что хэш устарел (SHA-256 или старые параметры) и его нужно пересчитать.
+func CheckPassword(password string, storedHash string) (bool, bool, error) {
+	if !strings.HasPrefix(storedHash, argonPrefix) {
+		legacyHash, err := GetHashStr(password)
+		if err != nil {
+			return false, false, err
+		}
+		match := subtle.ConstantTimeCompare([]byte(legacyHash), []byte(storedHash)) == 1
+		return match, true, nil
+	}
+
+	// $argon2id$v=19$m=65536,t=3,p=2$<соль>$<хэш>
+	parts := strings.Split(storedHash, "$")
+	if len(parts) != 6 {
+		return false, false, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrInvalidHash
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, false, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	match := subtle.ConstantTimeCompare(key, otherKey) == 1
+
+	outdated := memory != argonMemory || iterations != argonTime || threads != argonThreads || uint32(len(key)) != argonKeyLen
+	return match, outdated, nil
+}
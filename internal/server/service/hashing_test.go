@@ -35,3 +35,86 @@ func hashBytes(s string) []byte {
 	h.Write([]byte(s))
 	return h.Sum(nil)
 }
+
+// TestHashPassword проверяет, что хэш соленый и проходит проверку
+func TestHashPassword(t *testing.T) {
+	first, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if first == second {
+		t.Errorf("Expected different hashes for the same password")
+	}
+
+	match, outdated, err := CheckPassword("password", first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !match || outdated {
+		t.Errorf("Expected match=true outdated=false, got match=%v outdated=%v", match, outdated)
+	}
+
+	match, _, err = CheckPassword("wrong", first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if match {
+		t.Errorf("Expected wrong password not to match")
+	}
+}
+
+// TestCheckPasswordLegacy проверяет, что старые SHA-256 хэши принимаются и помечаются как устаревшие
+func TestCheckPasswordLegacy(t *testing.T) {
+	legacy := string(hashBytes("password"))
+
+	match, outdated, err := CheckPassword("password", legacy)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !match || !outdated {
+		t.Errorf("Expected match=true outdated=true, got match=%v outdated=%v", match, outdated)
+	}
+
+	match, _, _ = CheckPassword("wrong", legacy)
+	if match {
+		t.Errorf("Expected wrong password not to match")
+	}
+}
+
+// TestCheckPasswordInvalidHash проверяет разбор поврежденного хэша
+func TestCheckPasswordInvalidHash(t *testing.T) {
+	_, _, err := CheckPassword("password", "$argon2id$v=19$broken")
+	if err != ErrInvalidHash {
+		t.Errorf("Expected ErrInvalidHash, got %v", err)
+	}
+}
+
+// TestDummyPasswordHash проверяет, что фиктивный хэш разбирается, вычисляется с текущими параметрами и не совпадает с паролем
+func TestDummyPasswordHash(t *testing.T) {
+	match, outdated, err := CheckPassword("", DummyPasswordHash)
+	if err != nil || match || outdated {
+		t.Errorf("Expected valid non-matching current hash, got match=%v outdated=%v err=%v", match, outdated, err)
+	}
+}
+
+// TestFakeSalt проверяет, что фиктивная соль зависит только от секрета и имени и имеет размер настоящей соли
+func TestFakeSalt(t *testing.T) {
+	salt := FakeSalt("secret", "alice")
+	if len(salt) != 2*fakeSaltSize {
+		t.Errorf("Expected salt of %d hex chars, got %q", 2*fakeSaltSize, salt)
+	}
+	if again := FakeSalt("secret", "alice"); again != salt {
+		t.Errorf("Expected stable salt, got %q and %q", salt, again)
+	}
+	if other := FakeSalt("secret", "bob"); other == salt {
+		t.Errorf("Expected different salts for different users")
+	}
+	if other := FakeSalt("other secret", "alice"); other == salt {
+		t.Errorf("Expected different salts for different secrets")
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// masterKeyPrefix начинает заголовок шифртекста, зашифрованного мастер-ключом: m<id>:<hex>
+const masterKeyPrefix = "m"
+
+var (
+	// ErrUnknownKeyID описывает ошибку расшифровки ключом, которого нет в связке.
+	ErrUnknownKeyID = errors.New("unknown master key id")
+	// ErrInvalidKeyID описывает ошибку некорректного идентификатора мастер-ключа.
+	ErrInvalidKeyID = errors.New("invalid master key id")
+	// ErrNoMatchingKey описывает ошибку, когда шифртекст не подошел ни к одному ключу связки.
+	ErrNoMatchingKey = errors.New("no matching master key")
+)
+
+// Keyring хранит текущий мастер-ключ и старые ключи, которые нужны на время ротации.
+type Keyring struct {
+	currentID string
+	keys      map[string]string
+}
+
+// NewKeyring создает связку мастер-ключей. Шифрование всегда идет текущим ключом,
+// расшифровка - ключом из заголовка шифртекста.
+func NewKeyring(currentID string, current string, old map[string]string) (*Keyring, error) {
+	keys := make(map[string]string, len(old)+1)
+	for id, key := range old {
+		keys[id] = key
+	}
+	keys[currentID] = current
+
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":,=") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKeyID, id)
+		}
+		if _, err := aes.NewCipher([]byte(key)); err != nil {
+			return nil, fmt.Errorf("master key %q: %w", id, err)
+		}
+	}
+
+	return &Keyring{currentID: currentID, keys: keys}, nil
+}
+
+// CurrentID возвращает идентификатор текущего мастер-ключа
+func (k *Keyring) CurrentID() string {
+	return k.currentID
+}
+
+// Wrap шифрует данные текущим мастер-ключом и добавляет заголовок с его идентификатором
+func (k *Keyring) Wrap(plainText string) (string, error) {
+	cipherText, err := Encrypt(plainText, k.keys[k.currentID])
+	if err != nil {
+		return "", err
+	}
+	return masterKeyPrefix + k.currentID + ":" + cipherText, nil
+}
+
+// Unwrap расшифровывает данные мастер-ключом из заголовка.
+// Шифртекст без заголовка записан до появления связки, для него перебираются все ключи.
+func (k *Keyring) Unwrap(cipherText string) (string, error) {
+	header, body, found := strings.Cut(cipherText, ":")
+	if !found {
+		return k.unwrapLegacy(cipherText)
+	}
+
+	id, ok := strings.CutPrefix(header, masterKeyPrefix)
+	if !ok {
+		return "", ErrInvalidHeader
+	}
+
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKeyID, id)
+	}
+	return Decrypt(body, key)
+}
+
+// IsCurrent сообщает, что шифртекст зашифрован текущим мастер-ключом и ротация ему не нужна
+func (k *Keyring) IsCurrent(cipherText string) bool {
+	return strings.HasPrefix(cipherText, masterKeyPrefix+k.currentID+":")
+}
+
+func (k *Keyring) unwrapLegacy(cipherText string) (string, error) {
+	// сначала текущий ключ, затем остальные
+	if plainText, err := Decrypt(cipherText, k.keys[k.currentID]); err == nil {
+		return plainText, nil
+	}
+	for id, key := range k.keys {
+		if id == k.currentID {
+			continue
+		}
+		if plainText, err := Decrypt(cipherText, key); err == nil {
+			return plainText, nil
+		}
+	}
+	return "", ErrNoMatchingKey
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	oldMasterKey = "thisis32byteencryptionkey1234567" // 32 байта
+	newMasterKey = "anotherthirtytwobyteslongkey0001" // 32 байта
+)
+
+// TestKeyringWrapUnwrap проверяет шифрование текущим ключом и расшифровку по заголовку
+func TestKeyringWrapUnwrap(t *testing.T) {
+	keyring, err := NewKeyring("2", newMasterKey, map[string]string{"1": oldMasterKey})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wrapped, err := keyring.Wrap("datakey")
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if !keyring.IsCurrent(wrapped) {
+		t.Errorf("Expected wrapped key to use current master key")
+	}
+
+	plainText, err := keyring.Unwrap(wrapped)
+	if err != nil {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+	if plainText != "datakey" {
+		t.Errorf("Expected 'datakey', got '%s'", plainText)
+	}
+}
+
+// TestKeyringRotation проверяет, что данные старого ключа читаются во время ротации
+func TestKeyringRotation(t *testing.T) {
+	oldKeyring, _ := NewKeyring("1", oldMasterKey, nil)
+	newKeyring, _ := NewKeyring("2", newMasterKey, map[string]string{"1": oldMasterKey})
+
+	wrapped, _ := oldKeyring.Wrap("datakey")
+	if newKeyring.IsCurrent(wrapped) {
+		t.Errorf("Expected old ciphertext not to be current")
+	}
+
+	plainText, err := newKeyring.Unwrap(wrapped)
+	if err != nil || plainText != "datakey" {
+		t.Errorf("Expected 'datakey', got '%s' (err=%v)", plainText, err)
+	}
+
+	// после ротации старый ключ убирается из связки
+	finalKeyring, _ := NewKeyring("2", newMasterKey, nil)
+	_, err = finalKeyring.Unwrap(wrapped)
+	if !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("Expected ErrUnknownKeyID, got %v", err)
+	}
+}
+
+// TestKeyringLegacy проверяет расшифровку шифртекста без заголовка
+func TestKeyringLegacy(t *testing.T) {
+	keyring, _ := NewKeyring("2", newMasterKey, map[string]string{"1": oldMasterKey})
+
+	legacy, _ := Encrypt("datakey", oldMasterKey)
+	plainText, err := keyring.Unwrap(legacy)
+	if err != nil || plainText != "datakey" {
+		t.Errorf("Expected 'datakey', got '%s' (err=%v)", plainText, err)
+	}
+
+	foreign, _ := Encrypt("datakey", "0123456789abcdef0123456789abcdef")
+	if _, err := keyring.Unwrap(foreign); !errors.Is(err, ErrNoMatchingKey) {
+		t.Errorf("Expected ErrNoMatchingKey, got %v", err)
+	}
+}
+
+// TestNewKeyringInvalid проверяет проверку ключей и идентификаторов
+func TestNewKeyringInvalid(t *testing.T) {
+	if _, err := NewKeyring("1", "shortkey", nil); err == nil {
+		t.Errorf("Expected error for invalid key size")
+	}
+	if _, err := NewKeyring("a:b", oldMasterKey, nil); !errors.Is(err, ErrInvalidKeyID) {
+		t.Errorf("Expected ErrInvalidKeyID, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import "time"
+
+// LockoutDuration возвращает длительность блокировки после excess ошибок сверх допустимых:
+// первая блокировка длится base, каждая следующая вдвое дольше, но не дольше max.
+func LockoutDuration(base, max time.Duration, excess int) time.Duration {
+	if excess < 0 {
+		return 0
+	}
+
+	lockout := base
+	for i := 0; i < excess; i++ {
+		if lockout >= max/2 {
+			return max
+		}
+		lockout *= 2
+	}
+	if lockout > max {
+		return max
+	}
+	return lockout
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLockoutDuration проверяет экспоненциальный рост блокировки и ее ограничение сверху
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		excess   int
+		expected time.Duration
+	}{
+		{-1, 0},
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{5, 15 * time.Minute},
+		{100, 15 * time.Minute},
+	}
+
+	for _, test := range tests {
+		lockout := LockoutDuration(30*time.Second, 15*time.Minute, test.excess)
+		if lockout != test.expected {
+			t.Errorf("For excess %d, expected %v, got %v", test.excess, test.expected, lockout)
+		}
+	}
+}
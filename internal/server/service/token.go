@@ -0,0 +1,24 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// tokenSize размер токена сессии в байтах
+const tokenSize = 32
+
+// GenerateToken генерирует случайный токен сессии в hex-представлении
+func GenerateToken() (string, error) {
+	b, err := generateRandom(tokenSize)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetTokenHash возвращает SHA-256 хэш токена, в БД хранится только он
+func GetTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+)
+
+// TestGenerateToken проверяет, что токены уникальны и имеют нужную длину
+func TestGenerateToken(t *testing.T) {
+	first, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(first) != tokenSize*2 {
+		t.Errorf("Expected length %d, got %d", tokenSize*2, len(first))
+	}
+	if first == second {
+		t.Errorf("Expected different tokens, got equal '%s'", first)
+	}
+}
+
+// TestGetTokenHash проверяет, что хэш детерминирован и не совпадает с токеном
+func TestGetTokenHash(t *testing.T) {
+	token := "sometoken"
+
+	if GetTokenHash(token) != GetTokenHash(token) {
+		t.Errorf("Expected equal hashes for the same token")
+	}
+	if GetTokenHash(token) == token {
+		t.Errorf("Expected hash to differ from token")
+	}
+	if GetTokenHash(token) == GetTokenHash("othertoken") {
+		t.Errorf("Expected different hashes for different tokens")
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// параметры TOTP (RFC 6238), их понимают все приложения-аутентификаторы
+const (
+	totpSecretSize = 20 // размер секрета, рекомендованный RFC 4226 для HMAC-SHA1
+	totpDigits     = 6
+	totpPeriod     = 30 // длительность шага в секундах
+)
+
+// количество и размер кодов восстановления
+const (
+	recoveryCodesCount = 10
+	recoveryCodeSize   = 10
+)
+
+// base32 без выравнивания, как принято в otpauth URI
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret генерирует секрет TOTP в base32
+func GenerateTOTPSecret() (string, error) {
+	secret, err := generateRandom(totpSecretSize)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPStep возвращает номер шага TOTP для заданного времени
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode вычисляет одноразовый код для шага по алгоритму HOTP (RFC 4226)
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// динамическое усечение
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo), nil
+}
+
+// ValidateTOTP проверяет код с учетом расхождения часов в skew шагов в обе стороны.
+// Возвращает шаг, которому соответствует код, чтобы повторно его использовать было нельзя.
+func ValidateTOTP(secret string, code string, t time.Time, skew int) (int64, bool, error) {
+	if len(code) != totpDigits {
+		return 0, false, nil
+	}
+
+	current := TOTPStep(t)
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// IsTOTPCode проверяет, что строка похожа на одноразовый код, а не на код восстановления
+func IsTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// TOTPURI собирает otpauth URI для приложения-аутентификатора
+func TOTPURI(issuer string, account string, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// GenerateRecoveryCodes генерирует одноразовые коды восстановления вида xxxx-xxxx-xxxx-xxxx
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		b, err := generateRandom(recoveryCodeSize)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+	}
+	return codes, nil
+}
+
+// GetRecoveryCodeHash возвращает хэш кода восстановления без учета регистра и разделителей
+func GetRecoveryCodeHash(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return GetTokenHash(normalized)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// секрет из тестовых векторов RFC 6238: "12345678901234567890" в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCode проверяет коды по тестовым векторам RFC 6238 для SHA1 (последние 6 цифр)
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if code != test.code {
+			t.Errorf("For time %d, expected '%s', got '%s'", test.unix, test.code, code)
+		}
+	}
+}
+
+// TestValidateTOTP проверяет допустимое расхождение часов
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	previous, _ := TOTPCode(rfcSecret, TOTPStep(now)-1)
+	old, _ := TOTPCode(rfcSecret, TOTPStep(now)-2)
+
+	step, ok, err := ValidateTOTP(rfcSecret, previous, now, 1)
+	if err != nil || !ok {
+		t.Fatalf("Expected previous code to be valid with skew 1, got %v, %v", ok, err)
+	}
+	if step != TOTPStep(now)-1 {
+		t.Errorf("Expected step %d, got %d", TOTPStep(now)-1, step)
+	}
+
+	if _, ok, _ := ValidateTOTP(rfcSecret, previous, now, 0); ok {
+		t.Errorf("Expected previous code to be invalid without skew")
+	}
+	if _, ok, _ := ValidateTOTP(rfcSecret, old, now, 1); ok {
+		t.Errorf("Expected code two steps old to be invalid with skew 1")
+	}
+	if _, ok, _ := ValidateTOTP(rfcSecret, "12345", now, 1); ok {
+		t.Errorf("Expected short code to be invalid")
+	}
+}
+
+// TestTOTPURI проверяет otpauth URI
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("GophKeeper", "test user", rfcSecret)
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("Unexpected URI: %s", uri)
+	}
+	if parsed.Path != "/GophKeeper:test user" {
+		t.Errorf("Unexpected label: %s", parsed.Path)
+	}
+	if parsed.Query().Get("secret") != rfcSecret || parsed.Query().Get("issuer") != "GophKeeper" {
+		t.Errorf("Unexpected params: %s", parsed.RawQuery)
+	}
+}
+
+// TestGenerateRecoveryCodes проверяет формат и уникальность кодов восстановления
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(codes) != recoveryCodesCount {
+		t.Fatalf("Expected %d codes, got %d", recoveryCodesCount, len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("Unexpected code format: %s", code)
+		}
+		if IsTOTPCode(code) {
+			t.Errorf("Recovery code looks like TOTP code: %s", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != len(codes) {
+		t.Errorf("Expected unique codes")
+	}
+
+	// код восстановления можно ввести без дефисов и в верхнем регистре
+	if GetRecoveryCodeHash(codes[0]) != GetRecoveryCodeHash(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Errorf("Expected normalized hashes to match")
+	}
+}
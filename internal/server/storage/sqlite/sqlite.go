@@ -9,7 +9,9 @@ import (
 	"keeper/internal/server/config"
 	"keeper/internal/server/service"
 	"keeper/internal/server/storage"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
@@ -32,6 +34,24 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 	// ErrDataNotFound описывает ошибку получения пользоввателя из базы данных.
 	ErrDataNotFound = errors.New("data not found")
+	// ErrSessionNotFound описывает ошибку получения сессии из базы данных.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrKeyNotFound описывает ошибку получения ключа пользователя из базы данных.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrTOTPNotFound описывает ошибку получения секрета TOTP из базы данных.
+	ErrTOTPNotFound = errors.New("totp not found")
+	// ErrOrgNotFound описывает организацию, которой нет или в которой пользователь не состоит.
+	ErrOrgNotFound = errors.New("organization not found")
+	// ErrMemberNotFound описывает пользователя, который не состоит в организации.
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrCollectionNotFound описывает ошибку получения коллекции организации.
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrTitleExists описывает переименование записи в название, которое у владельца уже занято.
+	ErrTitleExists = errors.New("title already exists")
+	// ErrLastOwner описывает удаление или понижение последнего владельца организации.
+	ErrLastOwner = errors.New("organization must keep at least one owner")
+	// ErrRevisionNotFound описывает ошибку получения версии записи из истории.
+	ErrRevisionNotFound = errors.New("revision not found")
 )
 
 // Storage реализует интерфейс StorageProvider и предоставляет методы для работы с хранилищем URL.
@@ -42,7 +62,7 @@ type Storage struct {
 
 // New инициализирует новый экземпляр Storage с подключением к базе данных, указанной в конфигурации.
 func NewProvider(cfg *config.Config) (storage.Provider, error) {
-	db, err := sql.Open("sqlite3", cfg.DSN)
+	db, err := sql.Open("sqlite3", withForeignKeys(cfg.DSN))
 	if err != nil {
 		logger.Log.Sugar().Errorf("Не удалось подключиться к БД: %s", err)
 		return nil, ErrCreateConnect
@@ -56,6 +76,18 @@ func NewProvider(cfg *config.Config) (storage.Provider, error) {
 	return &Storage{db: db}, nil
 }
 
+// withForeignKeys включает проверку внешних ключей для каждого соединения пула,
+// без нее SQLite игнорирует ON DELETE CASCADE
+func withForeignKeys(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=on"
+	}
+	return dsn + "?_foreign_keys=on"
+}
+
 // Init выполняет инициализацию хранилища, включая создание необходимых таблиц.
 func (s *Storage) Init() error {
 	var initErr error
@@ -85,13 +117,31 @@ func (s *Storage) Init() error {
 			return
 		}
 
+		// параметры шифрования на стороне клиента
+		for column, definition := range map[string]string{
+			"client_encryption": "INTEGER NOT NULL DEFAULT 0",
+			"kdf_salt":          "TEXT NOT NULL DEFAULT ''",
+			"wrapped_vault_key": "TEXT NOT NULL DEFAULT ''",
+			// сколько прежних версий каждой записи хранится в истории
+			"revision_limit": "INTEGER NOT NULL DEFAULT 10",
+		} {
+			if err = addColumnIfNotExists(ctx, tx, "users", column, definition); err != nil {
+				initErr = fmt.Errorf("ошибка при добавлении колонки %s: %v", column, err)
+				return
+			}
+		}
+
 		_, err = tx.ExecContext(ctx, `
             CREATE TABLE IF NOT EXISTS user_data (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
-                title VARCHAR(50) NOT NULL,
+                title_index TEXT NOT NULL,
+                title_cipher TEXT NOT NULL DEFAULT '',
                 username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
                 data_type INTEGER NOT NULL,
                 data TEXT NOT NULL,
+                item_key TEXT NOT NULL DEFAULT '',
+                version INTEGER NOT NULL DEFAULT 1,
+                deleted_at TIMESTAMP,
                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
             );
         `)
@@ -100,6 +150,87 @@ func (s *Storage) Init() error {
 			return
 		}
 
+		// название записи хранится зашифрованным, а в бывшей колонке title остается слепой индекс.
+		// Пока сервер не зашифрует старые записи, в ней лежит открытое название, а title_cipher пуст.
+		hasTitle, err := columnExists(ctx, tx, "user_data", "title")
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при проверке колонки title: %v", err)
+			return
+		}
+		if hasTitle {
+			if _, err = tx.ExecContext(ctx, `ALTER TABLE user_data RENAME COLUMN title TO title_index`); err != nil {
+				initErr = fmt.Errorf("ошибка при переименовании колонки title: %v", err)
+				return
+			}
+		}
+		if err = addColumnIfNotExists(ctx, tx, "user_data", "title_cipher", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки title_cipher: %v", err)
+			return
+		}
+		// ключ общей записи для владельца
+		if err = addColumnIfNotExists(ctx, tx, "user_data", "item_key", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки item_key: %v", err)
+			return
+		}
+		// версия записи растет при каждом изменении данных и защищает от одновременного изменения
+		if err = addColumnIfNotExists(ctx, tx, "user_data", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки version: %v", err)
+			return
+		}
+		// время удаления записи в корзину, NULL у действующих записей
+		if err = addColumnIfNotExists(ctx, tx, "user_data", "deleted_at", "TIMESTAMP"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки deleted_at: %v", err)
+			return
+		}
+
+		// получатели общих записей и ключ записи, зашифрованный ключом получателя
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS item_shares (
+				item_id INTEGER NOT NULL REFERENCES user_data(id) ON DELETE CASCADE,
+				username VARCHAR(255) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+				permission TEXT NOT NULL,
+				wrapped_key TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (item_id, username)
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы item_shares: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_item_shares_username ON item_shares(username);`)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании индекса: %v", err)
+			return
+		}
+
+		// прежние версии записей в том виде, в каком они хранились в user_data, и кто их заменил
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS item_revisions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				item_id INTEGER NOT NULL REFERENCES user_data(id) ON DELETE CASCADE,
+				version INTEGER NOT NULL,
+				title_index TEXT NOT NULL,
+				title_cipher TEXT NOT NULL,
+				data TEXT NOT NULL,
+				item_key TEXT NOT NULL,
+				author VARCHAR(255) NOT NULL,
+				session_id TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы item_revisions: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_item_revisions_item ON item_revisions(item_id, id);`)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании индекса: %v", err)
+			return
+		}
+
 		_, err = tx.ExecContext(ctx, `
 			CREATE TABLE IF NOT EXISTS clients (
 				client_id TEXT PRIMARY KEY,
@@ -112,8 +243,290 @@ func (s *Storage) Init() error {
 			initErr = fmt.Errorf("ошибка при создании таблицы clients: %v", err)
 			return
 		}
+		// сессия, в которой открыт стрим, и данные незавершенного действия для продолжения диалога
+		for column, definition := range map[string]string{
+			"session_id": "TEXT NOT NULL DEFAULT ''",
+			"context":    "TEXT NOT NULL DEFAULT ''",
+		} {
+			if err = addColumnIfNotExists(ctx, tx, "clients", column, definition); err != nil {
+				initErr = fmt.Errorf("ошибка при добавлении колонки %s: %v", column, err)
+				return
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS sessions (
+				id TEXT PRIMARY KEY,
+				token_hash TEXT NOT NULL UNIQUE,
+				username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				expires_at TIMESTAMP NOT NULL
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы sessions: %v", err)
+			return
+		}
+
+		// устройство, адрес и последняя активность для списка сессий
+		for column, definition := range map[string]string{
+			"device":       "TEXT NOT NULL DEFAULT ''",
+			"ip":           "TEXT NOT NULL DEFAULT ''",
+			"last_seen_at": "TIMESTAMP",
+		} {
+			if err = addColumnIfNotExists(ctx, tx, "sessions", column, definition); err != nil {
+				initErr = fmt.Errorf("ошибка при добавлении колонки %s: %v", column, err)
+				return
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS user_keys (
+				username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+				version INTEGER NOT NULL,
+				wrapped_key TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (username, version)
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы user_keys: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS key_rotations (
+				id TEXT PRIMARY KEY,
+				keys_after INTEGER NOT NULL DEFAULT 0,
+				data_after INTEGER NOT NULL DEFAULT 0,
+				started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMP
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы key_rotations: %v", err)
+			return
+		}
+		// прогресс перешифровки истории записей
+		if err = addColumnIfNotExists(ctx, tx, "key_rotations", "revisions_after", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки revisions_after: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS user_totp (
+				username VARCHAR(255) PRIMARY KEY REFERENCES users(username) ON DELETE CASCADE,
+				secret TEXT NOT NULL,
+				confirmed INTEGER NOT NULL DEFAULT 0,
+				last_step INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы user_totp: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS recovery_codes (
+				username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+				code_hash TEXT NOT NULL,
+				used_at TIMESTAMP,
+				PRIMARY KEY (username, code_hash)
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы recovery_codes: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS user_certs (
+				identity TEXT PRIMARY KEY,
+				username VARCHAR(255) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы user_certs: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS login_attempts (
+				attempt_key TEXT PRIMARY KEY,
+				failures INTEGER NOT NULL DEFAULT 0,
+				locked_until TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы login_attempts: %v", err)
+			return
+		}
+
+		// журнал аудита не ссылается на users: события неудачного входа пишутся и для несуществующих имен,
+		// а записи удаленного аккаунта остаются для оператора
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS audit_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username VARCHAR(255) NOT NULL,
+				action TEXT NOT NULL,
+				item TEXT NOT NULL DEFAULT '',
+				session_id TEXT NOT NULL DEFAULT '',
+				ip TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы audit_events: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_audit_events_username ON audit_events(username, id);`)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании индекса: %v", err)
+			return
+		}
+		// события с записью ссылаются на нее по id, открытые названия из прежних событий удаляются
+		hasItemID, err := columnExists(ctx, tx, "audit_events", "item_id")
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при проверке колонки item_id: %v", err)
+			return
+		}
+		if !hasItemID {
+			if _, err = tx.ExecContext(ctx, `ALTER TABLE audit_events ADD COLUMN item_id INTEGER NOT NULL DEFAULT 0`); err != nil {
+				initErr = fmt.Errorf("ошибка при добавлении колонки item_id: %v", err)
+				return
+			}
+			if _, err = tx.ExecContext(ctx, `UPDATE audit_events SET item = '' WHERE action <> ?`, service.AUDIT_EXPORT); err != nil {
+				initErr = fmt.Errorf("ошибка при удалении названий из audit_events: %v", err)
+				return
+			}
+		}
+		if err = addColumnIfNotExists(ctx, tx, "audit_events", "collection_item", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки collection_item: %v", err)
+			return
+		}
+
+		// организации, их участники и коллекции командных записей
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS organizations (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы organizations: %v", err)
+			return
+		}
 
-		_, err = tx.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_title_username_unique ON user_data(title, username);`)
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS org_members (
+				org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+				username VARCHAR(255) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+				role TEXT NOT NULL,
+				wrapped_key TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (org_id, username)
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы org_members: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_org_members_username ON org_members(username);`)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании индекса: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS collections (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (org_id, name)
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы collections: %v", err)
+			return
+		}
+
+		// командные записи принадлежат коллекции, а не пользователю. Название зашифровано ключом
+		// организации, слепой индекс уникален в пределах коллекции
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS collection_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+				title_index TEXT NOT NULL,
+				title_cipher TEXT NOT NULL,
+				data_type INTEGER NOT NULL,
+				data TEXT NOT NULL,
+				created_by VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (collection_id, title_index)
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы collection_items: %v", err)
+			return
+		}
+		// версия командной записи защищает от одновременного изменения участниками организации
+		if err = addColumnIfNotExists(ctx, tx, "collection_items", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+			initErr = fmt.Errorf("ошибка при добавлении колонки version: %v", err)
+			return
+		}
+
+		// прежние версии командных записей, история удаляется вместе с записью
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS collection_revisions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				item_id INTEGER NOT NULL REFERENCES collection_items(id) ON DELETE CASCADE,
+				version INTEGER NOT NULL,
+				title_index TEXT NOT NULL,
+				title_cipher TEXT NOT NULL,
+				data TEXT NOT NULL,
+				author VARCHAR(255) NOT NULL,
+				session_id TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы collection_revisions: %v", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_collection_revisions_item ON collection_revisions(item_id, id);`)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании индекса: %v", err)
+			return
+		}
+
+		// секреты сервера, которые не зависят от мастер-ключа и не меняются при его ротации
+		_, err = tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS server_secrets (
+				name TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			);
+        `)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при создании таблицы server_secrets: %v", err)
+			return
+		}
+
+		// название уникально только среди действующих записей, в корзине может лежать запись с тем же названием.
+		// Индекс предыдущих версий покрывал все записи, поэтому он пересоздается
+		_, err = tx.ExecContext(ctx, `DROP INDEX IF EXISTS idx_title_username_unique;`)
+		if err != nil {
+			initErr = fmt.Errorf("ошибка при удалении индекса: %v", err)
+			return
+		}
+		_, err = tx.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_title_username_active ON user_data(title_index, username) WHERE deleted_at IS NULL;`)
 		if err != nil {
 			initErr = fmt.Errorf("ошибка при создании индекса: %v", err)
 			return
@@ -128,150 +541,1649 @@ func (s *Storage) Init() error {
 	return initErr
 }
 
-func (s *Storage) CreateUser(ctx context.Context, username string, password string) error {
-	// Подготовка SQL-запроса для вставки
-	query := `
-        INSERT INTO users (username, password_hash)
-        VALUES (?, ?)
-    `
-	// Выполнение SQL-запроса
-	_, err := s.db.ExecContext(ctx, query, username, password)
-	if err != nil {
-		// Проверка, если ошибка связана с существующим username
-		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
-			return ErrConflict
-		}
-		return ErrCreateUser
-	}
-
-	return nil
-}
-
-// ExistUser проверяет существование пользователя в базе данных.
-func (s *Storage) ExistUser(ctx context.Context, username, password string) error {
-	// Подготовка SQL-запроса для выборки пароля
-	query := `
-	SELECT EXISTS (SELECT 1 FROM users WHERE username = ? AND password_hash = ?)
-	`
-
-	var isExist int
-	err := s.db.QueryRowContext(ctx, query, username, password).Scan(&isExist)
+// addColumnIfNotExists добавляет колонку в существующую таблицу, если ее еще нет.
+// Нужна для миграции баз, созданных предыдущими версиями сервера.
+func addColumnIfNotExists(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(ctx, tx, table, column)
 	if err != nil {
 		return err
 	}
-
-	// Если isExist равен 0, значит пользователь не найден
-	if isExist == 0 {
-		return ErrUserNotFound
+	if exists {
+		return nil
 	}
 
-	return nil // Возвращаем nil, если пользователь найден
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
 
-// GetDataByUser возвращает все значения title для заданного username из таблицы user_data
-func (s *Storage) GetTitlesByUser(ctx context.Context, username string) ([]string, error) {
-	// Подготовка SQL-запроса для выборки title
-	query := `
-        SELECT title FROM user_data WHERE username = ?
-    `
-
-	// Выполнение SQL-запроса с использованием контекста
-	rows, err := s.db.QueryContext(ctx, query, username)
+// columnExists проверяет наличие колонки в таблице.
+func columnExists(ctx context.Context, tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 	defer rows.Close()
 
-	var titles []string
 	for rows.Next() {
-		var title string
-		if err := rows.Scan(&title); err != nil {
-			return nil, err
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
 		}
-		titles = append(titles, title)
-	}
-
-	// Проверка на наличие ошибок после обработки строк
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
-
-	return titles, nil
+	return false, rows.Err()
 }
 
-// GetData возвращает значение data для заданных username и title из таблицы user_data
-func (s *Storage) GetData(ctx context.Context, username string, title string) (string, error) {
-	// Подготовка SQL-запроса для выборки data
+func (s *Storage) CreateUser(ctx context.Context, username string, password string, vault storage.Vault) error {
+	// Подготовка SQL-запроса для вставки
 	query := `
-        SELECT data FROM user_data WHERE username = ? AND title = ?
+        INSERT INTO users (username, password_hash, client_encryption, kdf_salt, wrapped_vault_key)
+        VALUES (?, ?, ?, ?, ?)
     `
+	// Выполнение SQL-запроса
+	_, err := s.db.ExecContext(ctx, query, username, password, vault.ClientEncryption, vault.KdfSalt, vault.WrappedKey)
+	if err != nil {
+		// Проверка, если ошибка связана с существующим username
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrConflict
+		}
+		return ErrCreateUser
+	}
 
-	var data string
+	return nil
+}
 
-	// Выполнение SQL-запроса с использованием контекста
-	err := s.db.QueryRowContext(ctx, query, username, title).Scan(&data)
+// GetPasswordHash возвращает сохраненный хэш пароля пользователя.
+func (s *Storage) GetPasswordHash(ctx context.Context, username string) (string, error) {
+	query := `SELECT password_hash FROM users WHERE username = ?`
+
+	var passwordHash string
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&passwordHash)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", ErrDataNotFound
+			return "", ErrUserNotFound
 		}
-		logger.Log.Sugar().Errorf("Error get data: %v", err)
 		return "", err
 	}
 
-	return data, nil
+	return passwordHash, nil
 }
 
-// CreateData добавляет новую запись в таблицу user_data
-func (s *Storage) CreateData(ctx context.Context, username string, title string, data_type service.DataType, data string) error {
-	// Подготовка SQL-запроса для вставки
-	query := `
-        INSERT INTO user_data (username, title, data_type, data)
-        VALUES (?, ?, ?, ?)
-    `
+// GetVault возвращает параметры шифрования на стороне клиента.
+func (s *Storage) GetVault(ctx context.Context, username string) (storage.Vault, error) {
+	query := `SELECT client_encryption, kdf_salt, wrapped_vault_key FROM users WHERE username = ?`
 
-	// Выполнение SQL-запроса с использованием контекста
-	_, err := s.db.ExecContext(ctx, query, username, title, data_type, data)
+	var vault storage.Vault
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&vault.ClientEncryption, &vault.KdfSalt, &vault.WrappedKey)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Error create data: %v", err)
-		return ErrCreateData
+		if err == sql.ErrNoRows {
+			return storage.Vault{}, ErrUserNotFound
+		}
+		return storage.Vault{}, err
 	}
 
-	return nil
+	return vault, nil
 }
 
-func (s *Storage) AddClient(ctx context.Context, clientID, username string, state service.State) error {
-	query := `INSERT INTO clients (client_id, username, state) VALUES (?, ?, ?)`
-	_, err := s.db.ExecContext(ctx, query, clientID, username, state)
+// UpdatePasswordHash заменяет хэш пароля пользователя.
+func (s *Storage) UpdatePasswordHash(ctx context.Context, username string, passwordHash string) error {
+	query := `UPDATE users SET password_hash = ? WHERE username = ?`
+	_, err := s.db.ExecContext(ctx, query, passwordHash, username)
 	return err
 }
 
-func (s *Storage) UpdateClientState(ctx context.Context, clientID string, state service.State) error {
-	query := `UPDATE clients SET state = ? WHERE client_id = ?`
-	_, err := s.db.ExecContext(ctx, query, state, clientID)
-	return err
-}
+// ChangePassword в одной транзакции заменяет хэш пароля и ключ хранилища пользователя
+// и удаляет все его сессии, кроме keepSessionID. Возвращает количество удаленных сессий.
+func (s *Storage) ChangePassword(ctx context.Context, username string, passwordHash string, vault storage.Vault, keepSessionID string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
 
-func (s *Storage) RemoveClient(ctx context.Context, clientID string) error {
-	query := `DELETE FROM clients WHERE client_id = ?`
-	_, err := s.db.ExecContext(ctx, query, clientID)
-	return err
-}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET password_hash = ?, kdf_salt = ?, wrapped_vault_key = ? WHERE username = ?`,
+		passwordHash, vault.KdfSalt, vault.WrappedKey, username)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrUserNotFound
+	}
 
-func (s *Storage) GetAllClients(ctx context.Context) ([]storage.Client, error) {
-	query := `SELECT client_id, username, state FROM clients`
-	rows, err := s.db.QueryContext(ctx, query)
+	result, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE username = ? AND id != ?`, username, keepSessionID)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
-	defer rows.Close()
+
+	return revoked, tx.Commit()
+}
+
+// таблицы с данными пользователя в порядке удаления, таблица users удаляется последней.
+// Из item_shares удаляется доступ к чужим записям, доступ к записям пользователя удаляется вместе с ними.
+// Командные записи принадлежат организации и остаются, удаляется только членство. Организации,
+// в которых пользователь единственный участник, удаляются до этого вместе с коллекциями и записями.
+var userTables = []string{"item_shares", "org_members", "user_data", "clients", "sessions", "user_keys", "recovery_codes", "user_totp", "user_certs"}
+
+// DeleteUser в одной транзакции удаляет пользователя и все его данные. Строки удаляются явно,
+// не полагаясь на ON DELETE CASCADE, чтобы вернуть количество удаленных строк по таблицам.
+// Если пользователь последний владелец организации, в которой есть другие участники,
+// возвращает ErrLastOwner: ключ организации остался бы без владельца.
+func (s *Storage) DeleteUser(ctx context.Context, username string) (map[string]int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	deleted := make(map[string]int64, len(userTables)+2)
+
+	// организации, в которых пользователь единственный участник, больше никому не доступны
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM organizations
+		WHERE id IN (SELECT org_id FROM org_members WHERE username = ?)
+		AND id NOT IN (SELECT org_id FROM org_members WHERE username <> ?)
+	`, username, username)
+	if err != nil {
+		return nil, fmt.Errorf("delete from organizations: %w", err)
+	}
+	deleted["organizations"], err = result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	var orphaned int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM org_members m
+		WHERE m.username = ? AND m.role = ?
+		AND NOT EXISTS (SELECT 1 FROM org_members o WHERE o.org_id = m.org_id AND o.username <> m.username AND o.role = ?)
+	`, username, service.ORG_OWNER, service.ORG_OWNER).Scan(&orphaned)
+	if err != nil {
+		return nil, err
+	}
+	if orphaned > 0 {
+		return nil, ErrLastOwner
+	}
+
+	for _, table := range append(userTables, "users") {
+		result, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE username = ?`, username)
+		if err != nil {
+			return nil, fmt.Errorf("delete from %s: %w", table, err)
+		}
+		deleted[table], err = result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if deleted["users"] == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return deleted, tx.Commit()
+}
+
+// dataColumns колонки user_data в порядке, который ожидает scanDataRow
+const dataColumns = `id, username, title_index, title_cipher, data_type, data, item_key, version`
+
+// GetTitlesByUser возвращает записи пользователя без данных: слепые индексы и зашифрованные названия
+func (s *Storage) GetTitlesByUser(ctx context.Context, username string) ([]storage.DataRow, error) {
+	query := `SELECT id, username, title_index, title_cipher, data_type, '', item_key, version FROM user_data WHERE username = ? AND deleted_at IS NULL ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	return scanDataRows(rows)
+}
+
+// GetData возвращает запись пользователя по слепому индексу названия
+func (s *Storage) GetData(ctx context.Context, username string, titleIndex string) (storage.DataRow, error) {
+	query := `SELECT ` + dataColumns + ` FROM user_data WHERE username = ? AND title_index = ? AND deleted_at IS NULL`
+
+	row, err := scanDataRow(s.db.QueryRowContext(ctx, query, username, titleIndex))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.DataRow{}, ErrDataNotFound
+		}
+		logger.Log.Sugar().Errorf("Error get data: %v", err)
+		return storage.DataRow{}, err
+	}
+
+	return row, nil
+}
+
+// CreateData добавляет новую запись в таблицу user_data. Из row берутся владелец, тип,
+// слепой индекс и зашифрованное название. Данные шифруются функцией seal после вставки,
+// когда известен id записи, и сохраняются в той же транзакции.
+func (s *Storage) CreateData(ctx context.Context, row storage.DataRow, seal storage.SealFunc) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	// Подготовка SQL-запроса для вставки
+	query := `
+        INSERT INTO user_data (username, title_index, title_cipher, data_type, data)
+        VALUES (?, ?, ?, ?, '')
+    `
+
+	// Выполнение SQL-запроса с использованием контекста
+	result, err := tx.ExecContext(ctx, query, row.Username, row.TitleIndex, row.TitleCipher, row.DataType)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Error create data: %v", err)
+		return ErrCreateData
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	data, err := seal(id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE user_data SET data = ? WHERE id = ?`, data, id); err != nil {
+		logger.Log.Sugar().Errorf("Error create data: %v", err)
+		return ErrCreateData
+	}
+
+	return tx.Commit()
+}
+
+// GetPlainTitlesAfter возвращает очередную пачку записей с незашифрованным названием по возрастанию id.
+// Открытое название таких записей лежит в TitleIndex.
+func (s *Storage) GetPlainTitlesAfter(ctx context.Context, afterID int64, limit int) ([]storage.DataRow, error) {
+	query := `SELECT ` + dataColumns + ` FROM user_data WHERE id > ? AND title_cipher = '' ORDER BY id LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDataRows(rows)
+}
+
+// SaveEncryptedTitles в одной транзакции заменяет открытые названия записей слепыми индексами
+// и зашифрованными названиями. Записи, название которых уже зашифровано, не меняются.
+func (s *Storage) SaveEncryptedTitles(ctx context.Context, rows []storage.DataRow) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	query := `UPDATE user_data SET title_index = ?, title_cipher = ? WHERE id = ? AND title_cipher = ''`
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, query, row.TitleIndex, row.TitleCipher, row.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// scanDataRow читает запись user_data, выбранную колонками dataColumns
+func scanDataRow(row scanner) (storage.DataRow, error) {
+	var data storage.DataRow
+	err := row.Scan(&data.ID, &data.Username, &data.TitleIndex, &data.TitleCipher, &data.DataType, &data.Data, &data.ItemKey, &data.Version)
+	return data, err
+}
+
+// scanDataRows читает записи user_data и закрывает rows
+func scanDataRows(rows *sql.Rows) ([]storage.DataRow, error) {
+	defer rows.Close()
+
+	var data []storage.DataRow
+	for rows.Next() {
+		row, err := scanDataRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, row)
+	}
+	return data, rows.Err()
+}
+
+// ReplaceData заменяет шифртекст записи, если он не изменился с момента чтения
+func (s *Storage) ReplaceData(ctx context.Context, update storage.CipherUpdate) error {
+	query := `UPDATE user_data SET data = ? WHERE id = ? AND data = ?`
+	_, err := s.db.ExecContext(ctx, query, update.New, update.ID, update.Old)
+	return err
+}
+
+// UpdateData заменяет название и данные записи row.ID и увеличивает ее версию, если версия в БД
+// все еще равна version. Прежняя версия в той же транзакции сохраняется в историю с автором и временем
+// изменения из author, а история сокращается до лимита владельца записи.
+// Если запись изменилась или удалена в корзину, возвращает ErrConflict,
+// если у владельца уже есть запись с таким названием, возвращает ErrTitleExists.
+func (s *Storage) UpdateData(ctx context.Context, row storage.DataRow, version int64, author storage.Revision) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO item_revisions (item_id, version, title_index, title_cipher, data, item_key, author, session_id, created_at)
+		SELECT id, version, title_index, title_cipher, data, item_key, ?, ?, ?
+		FROM user_data WHERE id = ? AND version = ? AND deleted_at IS NULL
+	`, author.Author, author.SessionID, author.CreatedAt.UTC(), row.ID, version)
+	if err != nil {
+		return err
+	}
+	archived, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if archived == 0 {
+		return ErrConflict
+	}
+
+	query := `UPDATE user_data SET title_index = ?, title_cipher = ?, data = ?, version = version + 1 WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, row.TitleIndex, row.TitleCipher, row.Data, row.ID); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrTitleExists
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, pruneRevisionsQuery(`r.item_id = ?`), row.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pruneRevisionsQuery возвращает запрос, который удаляет из истории записей, отобранных условием filter,
+// версии сверх лимита владельца записи
+func pruneRevisionsQuery(filter string) string {
+	return `
+		DELETE FROM item_revisions WHERE id IN (
+			SELECT r.id FROM item_revisions r
+			JOIN user_data d ON d.id = r.item_id
+			JOIN users u ON u.username = d.username
+			WHERE ` + filter + ` AND (SELECT COUNT(*) FROM item_revisions n WHERE n.item_id = r.item_id AND n.id > r.id) >= u.revision_limit
+		)
+	`
+}
+
+// revisionColumns колонки item_revisions в порядке, который ожидает scanRevision
+const revisionColumns = `id, item_id, version, title_index, title_cipher, data, item_key, author, session_id, created_at`
+
+// scanRevision читает версию записи, выбранную колонками revisionColumns
+func scanRevision(row scanner) (storage.Revision, error) {
+	var revision storage.Revision
+	err := row.Scan(&revision.ID, &revision.ItemID, &revision.Version, &revision.TitleIndex, &revision.TitleCipher,
+		&revision.Data, &revision.ItemKey, &revision.Author, &revision.SessionID, &revision.CreatedAt)
+	return revision, err
+}
+
+// ListRevisions возвращает историю записи без данных, начиная с последних версий
+func (s *Storage) ListRevisions(ctx context.Context, itemID int64) ([]storage.Revision, error) {
+	query := `
+		SELECT id, item_id, version, title_index, title_cipher, '', item_key, author, session_id, created_at
+		FROM item_revisions WHERE item_id = ? ORDER BY id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []storage.Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision возвращает версию записи из истории. Если ее нет, возвращает ErrRevisionNotFound.
+func (s *Storage) GetRevision(ctx context.Context, itemID int64, revisionID int64) (storage.Revision, error) {
+	query := `SELECT ` + revisionColumns + ` FROM item_revisions WHERE item_id = ? AND id = ?`
+	revision, err := scanRevision(s.db.QueryRowContext(ctx, query, itemID, revisionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.Revision{}, ErrRevisionNotFound
+		}
+		return storage.Revision{}, err
+	}
+	return revision, nil
+}
+
+// SetRevisionLimit меняет количество версий, которые хранятся в истории каждой записи пользователя,
+// и сразу удаляет версии сверх нового лимита
+func (s *Storage) SetRevisionLimit(ctx context.Context, username string, limit int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET revision_limit = ? WHERE username = ?`, limit, username)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, pruneRevisionsQuery(`d.username = ?`), username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TrashData переносит запись пользователя в корзину и увеличивает ее версию. Получатели общей записи
+// перестают ее видеть, но доступ сохраняется до окончательного удаления.
+// Если действующей записи с таким id у пользователя нет, возвращает ErrDataNotFound.
+func (s *Storage) TrashData(ctx context.Context, username string, itemID int64, deletedAt time.Time) error {
+	query := `UPDATE user_data SET deleted_at = ?, version = version + 1 WHERE id = ? AND username = ? AND deleted_at IS NULL`
+	trashed, err := s.execAffected(ctx, query, deletedAt.UTC(), itemID, username)
+	if err != nil {
+		return err
+	}
+	if !trashed {
+		return ErrDataNotFound
+	}
+	return nil
+}
+
+// ListTrash возвращает записи пользователя в корзине без данных, начиная с удаленных последними
+func (s *Storage) ListTrash(ctx context.Context, username string) ([]storage.DataRow, error) {
+	query := `
+		SELECT id, username, title_index, title_cipher, data_type, item_key, version, deleted_at
+		FROM user_data WHERE username = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trash []storage.DataRow
+	for rows.Next() {
+		var row storage.DataRow
+		if err := rows.Scan(&row.ID, &row.Username, &row.TitleIndex, &row.TitleCipher, &row.DataType,
+			&row.ItemKey, &row.Version, &row.DeletedAt); err != nil {
+			return nil, err
+		}
+		trash = append(trash, row)
+	}
+	return trash, rows.Err()
+}
+
+// RestoreData возвращает запись из корзины и увеличивает ее версию. Если записи с таким id
+// в корзине пользователя нет, возвращает ErrDataNotFound, если название уже занято
+// действующей записью, возвращает ErrTitleExists.
+func (s *Storage) RestoreData(ctx context.Context, username string, itemID int64) error {
+	query := `UPDATE user_data SET deleted_at = NULL, version = version + 1 WHERE id = ? AND username = ? AND deleted_at IS NOT NULL`
+	restored, err := s.execAffected(ctx, query, itemID, username)
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrTitleExists
+		}
+		return err
+	}
+	if !restored {
+		return ErrDataNotFound
+	}
+	return nil
+}
+
+// EmptyTrash окончательно удаляет записи из корзины пользователя вместе с доступами получателей
+// и возвращает количество удаленных записей
+func (s *Storage) EmptyTrash(ctx context.Context, username string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM user_data WHERE username = ? AND deleted_at IS NOT NULL`, username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeTrash окончательно удаляет записи, которые лежат в корзине с момента раньше before,
+// и возвращает количество удаленных записей
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM user_data WHERE deleted_at IS NOT NULL AND deleted_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetShares возвращает получателей общей записи
+func (s *Storage) GetShares(ctx context.Context, itemID int64) ([]storage.Share, error) {
+	query := `SELECT item_id, username, permission, wrapped_key FROM item_shares WHERE item_id = ? ORDER BY username`
+	rows, err := s.db.QueryContext(ctx, query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []storage.Share
+	for rows.Next() {
+		var share storage.Share
+		if err := rows.Scan(&share.ItemID, &share.Username, &share.Permission, &share.WrappedKey); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// SaveItemShares в одной транзакции сохраняет данные, перешифрованные новым ключом записи,
+// ключ для владельца и список получателей. Получатели, которых нет в списке, теряют доступ.
+// Версия записи увеличивается, поэтому изменение, подготовленное с прежним ключом записи, не сохранится.
+// Если запись изменилась с момента чтения, возвращает ErrConflict.
+func (s *Storage) SaveItemShares(ctx context.Context, shares storage.ItemShares) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `UPDATE user_data SET data = ?, item_key = ?, version = version + 1 WHERE id = ? AND data = ?`,
+		shares.Data, shares.ItemKey, shares.ItemID, shares.OldData)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM item_shares WHERE item_id = ?`, shares.ItemID); err != nil {
+		return err
+	}
+	query := `INSERT INTO item_shares (item_id, username, permission, wrapped_key) VALUES (?, ?, ?, ?)`
+	for _, share := range shares.Shares {
+		if _, err := tx.ExecContext(ctx, query, shares.ItemID, share.Username, share.Permission, share.WrappedKey); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSharedTitles возвращает записи, к которым пользователю открыт доступ, без данных
+func (s *Storage) GetSharedTitles(ctx context.Context, username string) ([]storage.DataRow, error) {
+	query := `
+		SELECT d.id, d.username, d.title_index, d.title_cipher, d.data_type, '', d.item_key, d.version
+		FROM item_shares sh JOIN user_data d ON d.id = sh.item_id
+		WHERE sh.username = ? AND d.deleted_at IS NULL ORDER BY d.id
+	`
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	return scanDataRows(rows)
+}
+
+// GetSharedData возвращает общую запись и доступ к ней пользователя.
+// Если доступа нет, возвращает ErrDataNotFound.
+func (s *Storage) GetSharedData(ctx context.Context, username string, itemID int64) (storage.DataRow, storage.Share, error) {
+	query := `
+		SELECT d.id, d.username, d.title_index, d.title_cipher, d.data_type, d.data, d.item_key, d.version, sh.permission, sh.wrapped_key
+		FROM item_shares sh JOIN user_data d ON d.id = sh.item_id
+		WHERE sh.username = ? AND sh.item_id = ? AND d.deleted_at IS NULL
+	`
+	var row storage.DataRow
+	share := storage.Share{ItemID: itemID, Username: username}
+	err := s.db.QueryRowContext(ctx, query, username, itemID).Scan(&row.ID, &row.Username, &row.TitleIndex, &row.TitleCipher,
+		&row.DataType, &row.Data, &row.ItemKey, &row.Version, &share.Permission, &share.WrappedKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.DataRow{}, storage.Share{}, ErrDataNotFound
+		}
+		return storage.DataRow{}, storage.Share{}, err
+	}
+	return row, share, nil
+}
+
+// CreateOrganization создает организацию и добавляет создателя владельцем.
+// Если организация с таким названием уже есть, возвращает ErrConflict.
+func (s *Storage) CreateOrganization(ctx context.Context, owner storage.OrgMember) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO organizations (name) VALUES (?)`, owner.OrgName)
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return 0, ErrConflict
+		}
+		return 0, err
+	}
+	orgID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO org_members (org_id, username, role, wrapped_key) VALUES (?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, query, orgID, owner.Username, owner.Role, owner.WrappedKey); err != nil {
+		return 0, err
+	}
+	return orgID, tx.Commit()
+}
+
+// memberColumns колонки участника организации в порядке, который ожидает scanOrgMember
+const memberColumns = `m.org_id, o.name, m.username, m.role, m.wrapped_key`
+
+// scanOrgMember читает участника организации, выбранного колонками memberColumns
+func scanOrgMember(row scanner) (storage.OrgMember, error) {
+	var member storage.OrgMember
+	err := row.Scan(&member.OrgID, &member.OrgName, &member.Username, &member.Role, &member.WrappedKey)
+	return member, err
+}
+
+// GetMembership возвращает членство пользователя в организации.
+// Если организации нет или пользователь в ней не состоит, возвращает ErrOrgNotFound.
+func (s *Storage) GetMembership(ctx context.Context, orgName string, username string) (storage.OrgMember, error) {
+	query := `SELECT ` + memberColumns + ` FROM org_members m JOIN organizations o ON o.id = m.org_id WHERE o.name = ? AND m.username = ?`
+	member, err := scanOrgMember(s.db.QueryRowContext(ctx, query, orgName, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.OrgMember{}, ErrOrgNotFound
+		}
+		return storage.OrgMember{}, err
+	}
+	return member, nil
+}
+
+// ListMemberships возвращает организации, в которых состоит пользователь, по названию
+func (s *Storage) ListMemberships(ctx context.Context, username string) ([]storage.OrgMember, error) {
+	query := `SELECT ` + memberColumns + ` FROM org_members m JOIN organizations o ON o.id = m.org_id WHERE m.username = ? ORDER BY o.name`
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []storage.OrgMember
+	for rows.Next() {
+		member, err := scanOrgMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// SaveOrgMember добавляет участника организации или меняет его роль и ключ.
+// Если в организации не остается владельца, возвращает ErrLastOwner.
+func (s *Storage) SaveOrgMember(ctx context.Context, member storage.OrgMember) error {
+	return s.changeMembers(ctx, member.OrgID, `
+		INSERT INTO org_members (org_id, username, role, wrapped_key) VALUES (?, ?, ?, ?)
+		ON CONFLICT (org_id, username) DO UPDATE SET role = excluded.role, wrapped_key = excluded.wrapped_key
+	`, member.OrgID, member.Username, member.Role, member.WrappedKey)
+}
+
+// RemoveOrgMember удаляет участника организации. Если участника нет, возвращает ErrMemberNotFound,
+// если в организации не остается владельца - ErrLastOwner.
+func (s *Storage) RemoveOrgMember(ctx context.Context, orgID int64, username string) error {
+	return s.changeMembers(ctx, orgID, `DELETE FROM org_members WHERE org_id = ? AND username = ?`, orgID, username)
+}
+
+// changeMembers в транзакции меняет состав организации и проверяет, что у нее остался владелец
+func (s *Storage) changeMembers(ctx context.Context, orgID int64, query string, args ...interface{}) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrMemberNotFound
+	}
+
+	var owners int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM org_members WHERE org_id = ? AND role = ?`, orgID, service.ORG_OWNER).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return tx.Commit()
+}
+
+// CreateCollection создает коллекцию организации. Если такая коллекция уже есть, возвращает ErrConflict.
+func (s *Storage) CreateCollection(ctx context.Context, orgID int64, name string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `INSERT INTO collections (org_id, name) VALUES (?, ?)`, orgID, name)
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return 0, ErrConflict
+		}
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetCollection возвращает коллекцию организации по названию
+func (s *Storage) GetCollection(ctx context.Context, orgID int64, name string) (storage.Collection, error) {
+	collection := storage.Collection{OrgID: orgID, Name: name}
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM collections WHERE org_id = ? AND name = ?`, orgID, name).Scan(&collection.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.Collection{}, ErrCollectionNotFound
+		}
+		return storage.Collection{}, err
+	}
+	return collection, nil
+}
+
+// ListCollections возвращает коллекции организации по названию
+func (s *Storage) ListCollections(ctx context.Context, orgID int64) ([]storage.Collection, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, org_id, name FROM collections WHERE org_id = ? ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []storage.Collection
+	for rows.Next() {
+		var collection storage.Collection
+		if err := rows.Scan(&collection.ID, &collection.OrgID, &collection.Name); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+// CreateCollectionItem добавляет командную запись в коллекцию row.CollectionID. Автор записи
+// берется из row.Username. Данные шифруются функцией seal после вставки, когда известен id записи.
+func (s *Storage) CreateCollectionItem(ctx context.Context, row storage.DataRow, seal storage.SealFunc) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	query := `
+		INSERT INTO collection_items (collection_id, title_index, title_cipher, data_type, data, created_by)
+		VALUES (?, ?, ?, ?, '', ?)
+	`
+	result, err := tx.ExecContext(ctx, query, row.CollectionID, row.TitleIndex, row.TitleCipher, row.DataType, row.Username)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Error create data: %v", err)
+		return ErrCreateData
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	data, err := seal(id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE collection_items SET data = ? WHERE id = ?`, data, id); err != nil {
+		logger.Log.Sugar().Errorf("Error create data: %v", err)
+		return ErrCreateData
+	}
+
+	return tx.Commit()
+}
+
+// collectionRevisionLimit количество прежних версий, которые хранятся для каждой командной записи.
+// Совпадает с лимитом пользователя по умолчанию.
+const collectionRevisionLimit = 10
+
+// UpdateCollectionItem заменяет название и данные командной записи row.ID и увеличивает ее версию,
+// если версия в БД все еще равна version. Автор записи не меняется. Прежняя версия в той же транзакции
+// сохраняется в историю с автором и временем изменения из author, а история сокращается до collectionRevisionLimit.
+// Если запись изменилась или удалена, возвращает ErrConflict, если в коллекции уже есть запись
+// с таким названием, возвращает ErrTitleExists.
+func (s *Storage) UpdateCollectionItem(ctx context.Context, row storage.DataRow, version int64, author storage.Revision) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO collection_revisions (item_id, version, title_index, title_cipher, data, author, session_id, created_at)
+		SELECT id, version, title_index, title_cipher, data, ?, ?, ?
+		FROM collection_items WHERE id = ? AND version = ?
+	`, author.Author, author.SessionID, author.CreatedAt.UTC(), row.ID, version)
+	if err != nil {
+		return err
+	}
+	archived, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if archived == 0 {
+		return ErrConflict
+	}
+
+	query := `UPDATE collection_items SET title_index = ?, title_cipher = ?, data = ?, version = version + 1 WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, row.TitleIndex, row.TitleCipher, row.Data, row.ID); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrTitleExists
+		}
+		return err
+	}
+
+	prune := `
+		DELETE FROM collection_revisions WHERE item_id = ? AND id NOT IN (
+			SELECT id FROM collection_revisions WHERE item_id = ? ORDER BY id DESC LIMIT ?
+		)
+	`
+	if _, err := tx.ExecContext(ctx, prune, row.ID, row.ID, collectionRevisionLimit); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListCollectionRevisions возвращает историю командной записи без данных, начиная с последних версий
+func (s *Storage) ListCollectionRevisions(ctx context.Context, itemID int64) ([]storage.Revision, error) {
+	query := `
+		SELECT id, item_id, version, title_index, title_cipher, '', '', author, session_id, created_at
+		FROM collection_revisions WHERE item_id = ? ORDER BY id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []storage.Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetCollectionRevision возвращает версию командной записи из истории. Если ее нет, возвращает ErrRevisionNotFound.
+func (s *Storage) GetCollectionRevision(ctx context.Context, itemID int64, revisionID int64) (storage.Revision, error) {
+	query := `
+		SELECT id, item_id, version, title_index, title_cipher, data, '', author, session_id, created_at
+		FROM collection_revisions WHERE item_id = ? AND id = ?
+	`
+	revision, err := scanRevision(s.db.QueryRowContext(ctx, query, itemID, revisionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.Revision{}, ErrRevisionNotFound
+		}
+		return storage.Revision{}, err
+	}
+	return revision, nil
+}
+
+// DeleteCollectionItem окончательно удаляет командную запись. Если ее нет, возвращает ErrDataNotFound.
+func (s *Storage) DeleteCollectionItem(ctx context.Context, itemID int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM collection_items WHERE id = ?`, itemID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDataNotFound
+	}
+	return nil
+}
+
+// teamColumns колонки командной записи без данных в порядке, который ожидает scanTeamRow
+const teamColumns = `i.id, i.created_by, i.title_index, i.title_cipher, i.data_type, i.version, c.org_id, c.id, o.name || '/' || c.name`
+
+// teamFrom соединяет командные записи с коллекциями и членством пользователя
+const teamFrom = ` FROM collection_items i
+	JOIN collections c ON c.id = i.collection_id
+	JOIN organizations o ON o.id = c.org_id
+	JOIN org_members m ON m.org_id = c.org_id`
+
+// scanTeamRow читает командную запись, выбранную колонками teamColumns, и дополнительные колонки
+func scanTeamRow(row scanner, extra ...interface{}) (storage.DataRow, error) {
+	var data storage.DataRow
+	dest := []interface{}{&data.ID, &data.Username, &data.TitleIndex, &data.TitleCipher, &data.DataType, &data.Version, &data.OrgID, &data.CollectionID, &data.Collection}
+	err := row.Scan(append(dest, extra...)...)
+	return data, err
+}
+
+// GetTeamTitles возвращает без данных командные записи всех организаций, в которых состоит пользователь.
+// В Username записи указан ее автор.
+func (s *Storage) GetTeamTitles(ctx context.Context, username string) ([]storage.DataRow, error) {
+	query := `SELECT ` + teamColumns + teamFrom + ` WHERE m.username = ? ORDER BY o.name, c.name, i.id`
+	rows, err := s.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []storage.DataRow
+	for rows.Next() {
+		row, err := scanTeamRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, row)
+	}
+	return data, rows.Err()
+}
+
+// GetTeamData возвращает командную запись и членство пользователя в ее организации.
+// Если пользователь в организации не состоит, возвращает ErrDataNotFound.
+func (s *Storage) GetTeamData(ctx context.Context, username string, itemID int64) (storage.DataRow, storage.OrgMember, error) {
+	query := `SELECT ` + teamColumns + `, i.data, ` + memberColumns + teamFrom + ` WHERE m.username = ? AND i.id = ?`
+	var member storage.OrgMember
+	var data string
+	row, err := scanTeamRow(s.db.QueryRowContext(ctx, query, username, itemID),
+		&data, &member.OrgID, &member.OrgName, &member.Username, &member.Role, &member.WrappedKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.DataRow{}, storage.OrgMember{}, ErrDataNotFound
+		}
+		return storage.DataRow{}, storage.OrgMember{}, err
+	}
+	row.Data = data
+	return row, member, nil
+}
+
+func (s *Storage) AddClient(ctx context.Context, client storage.Client) error {
+	query := `INSERT INTO clients (client_id, username, state, session_id, context) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, client.ClientID, client.Username, client.State, client.SessionID, client.Context)
+	return err
+}
+
+func (s *Storage) UpdateClientState(ctx context.Context, clientID string, state service.State, context string) error {
+	query := `UPDATE clients SET state = ?, context = ? WHERE client_id = ?`
+	_, err := s.db.ExecContext(ctx, query, state, context, clientID)
+	return err
+}
+
+func (s *Storage) RemoveClient(ctx context.Context, clientID string) error {
+	query := `DELETE FROM clients WHERE client_id = ?`
+	_, err := s.db.ExecContext(ctx, query, clientID)
+	return err
+}
+
+// RemoveStaleClients удаляет клиентов, сессии которых завершены или истекли: их диалог продолжить нельзя
+func (s *Storage) RemoveStaleClients(ctx context.Context, now time.Time) error {
+	query := `DELETE FROM clients WHERE session_id NOT IN (SELECT id FROM sessions WHERE expires_at > ?)`
+	_, err := s.db.ExecContext(ctx, query, now.UTC())
+	return err
+}
+
+func (s *Storage) GetAllClients(ctx context.Context) ([]storage.Client, error) {
+	query := `SELECT client_id, username, state, session_id, context FROM clients`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	var clients []storage.Client
 	for rows.Next() {
-		var client storage.Client
-		if err := rows.Scan(&client.ClientID, &client.Username, &client.State); err != nil {
+		var client storage.Client
+		if err := rows.Scan(&client.ClientID, &client.Username, &client.State, &client.SessionID, &client.Context); err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// GetServerSecret возвращает секрет сервера name. Если секрета еще нет, сохраняет value,
+// поэтому при одновременном запуске все экземпляры получат одно значение.
+func (s *Storage) GetServerSecret(ctx context.Context, name string, value string) (string, error) {
+	if _, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO server_secrets (name, value) VALUES (?, ?)`, name, value); err != nil {
+		return "", err
+	}
+	var secret string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM server_secrets WHERE name = ?`, name).Scan(&secret)
+	return secret, err
+}
+
+// CreateSession сохраняет новую сессию пользователя
+func (s *Storage) CreateSession(ctx context.Context, session storage.Session, tokenHash string) error {
+	query := `
+		INSERT INTO sessions (id, token_hash, username, device, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.ExecContext(ctx, query, session.ID, tokenHash, session.Username, session.Device, session.IP,
+		session.CreatedAt.UTC(), session.CreatedAt.UTC(), session.ExpiresAt.UTC())
+	return err
+}
+
+// sessionColumns колонки сессии в порядке scanSession
+const sessionColumns = `id, username, device, ip, created_at, last_seen_at, expires_at`
+
+// GetSession возвращает сессию по хэшу токена
+func (s *Storage) GetSession(ctx context.Context, tokenHash string) (storage.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE token_hash = ?`
+
+	session, err := scanSession(s.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.Session{}, ErrSessionNotFound
+		}
+		return storage.Session{}, err
+	}
+
+	return session, nil
+}
+
+// ListSessions возвращает действующие сессии пользователя, последние активные первыми
+func (s *Storage) ListSessions(ctx context.Context, username string, now time.Time) ([]storage.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE username = ? AND expires_at > ? ORDER BY last_seen_at DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, username, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []storage.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
 			return nil, err
 		}
-		clients = append(clients, client)
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession удаляет сессию пользователя, после чего ее токен перестает действовать
+func (s *Storage) DeleteSession(ctx context.Context, username string, sessionID string) error {
+	deleted, err := s.execAffected(ctx, `DELETE FROM sessions WHERE id = ? AND username = ?`, sessionID, username)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// TouchSession обновляет время последней активности сессии
+func (s *Storage) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET last_seen_at = ? WHERE id = ?`, seenAt.UTC(), sessionID)
+	return err
+}
+
+// scanSession читает сессию из строки результата запроса
+func scanSession(row scanner) (storage.Session, error) {
+	var session storage.Session
+	var lastSeenAt sql.NullTime
+	err := row.Scan(&session.ID, &session.Username, &session.Device, &session.IP, &session.CreatedAt, &lastSeenAt, &session.ExpiresAt)
+	if err != nil {
+		return storage.Session{}, err
+	}
+	// сессии, созданные до появления колонки, считаются активными в момент входа
+	session.LastSeenAt = session.CreatedAt
+	if lastSeenAt.Valid {
+		session.LastSeenAt = lastSeenAt.Time
+	}
+	return session, nil
+}
+
+// CreateUserKey сохраняет ключ шифрования данных пользователя
+func (s *Storage) CreateUserKey(ctx context.Context, username string, key storage.UserKey) error {
+	query := `INSERT INTO user_keys (username, version, wrapped_key) VALUES (?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, username, key.Version, key.WrappedKey)
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// GetUserKey возвращает ключ пользователя заданной версии
+func (s *Storage) GetUserKey(ctx context.Context, username string, version int) (storage.UserKey, error) {
+	query := `SELECT version, wrapped_key FROM user_keys WHERE username = ? AND version = ?`
+	return s.scanUserKey(s.db.QueryRowContext(ctx, query, username, version))
+}
+
+// GetLatestUserKey возвращает последнюю версию ключа пользователя
+func (s *Storage) GetLatestUserKey(ctx context.Context, username string) (storage.UserKey, error) {
+	query := `SELECT version, wrapped_key FROM user_keys WHERE username = ? ORDER BY version DESC LIMIT 1`
+	return s.scanUserKey(s.db.QueryRowContext(ctx, query, username))
+}
+
+func (s *Storage) scanUserKey(row *sql.Row) (storage.UserKey, error) {
+	var key storage.UserKey
+	if err := row.Scan(&key.Version, &key.WrappedKey); err != nil {
+		if err == sql.ErrNoRows {
+			return storage.UserKey{}, ErrKeyNotFound
+		}
+		return storage.UserKey{}, err
+	}
+	return key, nil
+}
+
+// GetRotation возвращает прогресс ротации мастер-ключа, при первом обращении создает его
+func (s *Storage) GetRotation(ctx context.Context, rotationID string) (storage.Rotation, error) {
+	_, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO key_rotations (id) VALUES (?)`, rotationID)
+	if err != nil {
+		return storage.Rotation{}, err
+	}
+
+	query := `SELECT id, keys_after, data_after, revisions_after, finished_at IS NOT NULL FROM key_rotations WHERE id = ?`
+	var rotation storage.Rotation
+	err = s.db.QueryRowContext(ctx, query, rotationID).Scan(&rotation.ID, &rotation.KeysAfter, &rotation.DataAfter, &rotation.RevisionsAfter, &rotation.Finished)
+	if err != nil {
+		return storage.Rotation{}, err
+	}
+	return rotation, nil
+}
+
+// GetUserKeysAfter возвращает очередную пачку ключей пользователей по возрастанию rowid
+func (s *Storage) GetUserKeysAfter(ctx context.Context, afterID int64, limit int) ([]storage.KeyRow, error) {
+	query := `SELECT rowid, username, wrapped_key FROM user_keys WHERE rowid > ? ORDER BY rowid LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []storage.KeyRow
+	for rows.Next() {
+		var key storage.KeyRow
+		if err := rows.Scan(&key.ID, &key.Username, &key.WrappedKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// SaveRewrappedKeys в одной транзакции сохраняет перешифрованные ключи и прогресс ротации
+func (s *Storage) SaveRewrappedKeys(ctx context.Context, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	return s.saveRotationBatch(ctx,
+		`UPDATE user_keys SET wrapped_key = ? WHERE rowid = ? AND wrapped_key = ?`,
+		`UPDATE key_rotations SET keys_after = ? WHERE id = ?`,
+		rotationID, updates, lastID)
+}
+
+// GetDataAfter возвращает очередную пачку записей по возрастанию id
+func (s *Storage) GetDataAfter(ctx context.Context, afterID int64, limit int) ([]storage.DataRow, error) {
+	query := `SELECT ` + dataColumns + ` FROM user_data WHERE id > ? ORDER BY id LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDataRows(rows)
+}
+
+// SaveReencryptedData в одной транзакции сохраняет перешифрованные записи и прогресс ротации
+func (s *Storage) SaveReencryptedData(ctx context.Context, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	return s.saveRotationBatch(ctx,
+		`UPDATE user_data SET data = ? WHERE id = ? AND data = ?`,
+		`UPDATE key_rotations SET data_after = ? WHERE id = ?`,
+		rotationID, updates, lastID)
+}
+
+// GetRevisionsAfter возвращает очередную пачку версий из истории по возрастанию id вместе с владельцем,
+// id и типом записи, к которой относится версия
+func (s *Storage) GetRevisionsAfter(ctx context.Context, afterID int64, limit int) ([]storage.RevisionRow, error) {
+	query := `
+		SELECT r.id, d.id, d.username, r.title_index, r.title_cipher, d.data_type, r.data, r.item_key, r.version
+		FROM item_revisions r JOIN user_data d ON d.id = r.item_id
+		WHERE r.id > ? ORDER BY r.id LIMIT ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []storage.RevisionRow
+	for rows.Next() {
+		var revision storage.RevisionRow
+		row := &revision.Row
+		err := rows.Scan(&revision.ID, &row.ID, &row.Username, &row.TitleIndex, &row.TitleCipher, &row.DataType, &row.Data, &row.ItemKey, &row.Version)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// SaveReencryptedRevisions в одной транзакции сохраняет перешифрованные версии из истории и прогресс ротации
+func (s *Storage) SaveReencryptedRevisions(ctx context.Context, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	return s.saveRotationBatch(ctx,
+		`UPDATE item_revisions SET data = ? WHERE id = ? AND data = ?`,
+		`UPDATE key_rotations SET revisions_after = ? WHERE id = ?`,
+		rotationID, updates, lastID)
+}
+
+// FinishRotation отмечает ротацию завершенной
+func (s *Storage) FinishRotation(ctx context.Context, rotationID string) error {
+	query := `UPDATE key_rotations SET finished_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, query, rotationID)
+	return err
+}
+
+// SaveTOTP сохраняет новый неподтвержденный секрет TOTP.
+// Подтвержденный секрет не перезаписывается, в этом случае возвращается ErrConflict.
+func (s *Storage) SaveTOTP(ctx context.Context, username string, secret string) error {
+	query := `
+		INSERT INTO user_totp (username, secret) VALUES (?, ?)
+		ON CONFLICT(username) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed = 0
+	`
+	result, err := s.db.ExecContext(ctx, query, username, secret)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// GetTOTP возвращает секрет TOTP пользователя
+func (s *Storage) GetTOTP(ctx context.Context, username string) (storage.TOTP, error) {
+	query := `SELECT secret, confirmed, last_step FROM user_totp WHERE username = ?`
+
+	var totp storage.TOTP
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&totp.Secret, &totp.Confirmed, &totp.LastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.TOTP{}, ErrTOTPNotFound
+		}
+		return storage.TOTP{}, err
+	}
+	return totp, nil
+}
+
+// ConfirmTOTP в одной транзакции включает TOTP и заменяет коды восстановления пользователя
+func (s *Storage) ConfirmTOTP(ctx context.Context, username string, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE user_totp SET confirmed = 1, last_step = ? WHERE username = ? AND confirmed = 0`,
+		step, username)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = ?`, username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (username, code_hash) VALUES (?, ?)`, username, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep отмечает шаг TOTP использованным. Возвращает false, если код этого
+// или более позднего шага уже использовался.
+func (s *Storage) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_step = ? WHERE username = ? AND last_step < ?`
+	return s.execAffected(ctx, query, step, username, step)
+}
+
+// UseRecoveryCode отмечает код восстановления использованным. Возвращает false,
+// если кода нет или он уже использовался.
+func (s *Storage) UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error) {
+	query := `UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE username = ? AND code_hash = ? AND used_at IS NULL`
+	return s.execAffected(ctx, query, username, codeHash)
+}
+
+// BindCertificate закрепляет имена из сертификата за пользователем.
+// Если хотя бы одно имя уже закреплено за другим пользователем, возвращается ErrConflict.
+func (s *Storage) BindCertificate(ctx context.Context, username string, identities []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	for _, identity := range identities {
+		var owner string
+		err := tx.QueryRowContext(ctx, `SELECT username FROM user_certs WHERE identity = ?`, identity).Scan(&owner)
+		if err == nil {
+			if owner != username {
+				return ErrConflict
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_certs (identity, username) VALUES (?, ?)`, identity, username); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetCertificateUsers возвращает пользователей, за которыми закреплено хотя бы одно из имен сертификата
+func (s *Storage) GetCertificateUsers(ctx context.Context, identities []string) ([]string, error) {
+	if len(identities) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(identities)), ",")
+	query := `SELECT DISTINCT username FROM user_certs WHERE identity IN (` + placeholders + `)`
+	args := make([]interface{}, 0, len(identities))
+	for _, identity := range identities {
+		args = append(args, identity)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+// HasCertificate проверяет, закреплен ли за пользователем хотя бы один сертификат
+func (s *Storage) HasCertificate(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM user_certs WHERE username = ?)`, username).Scan(&exists)
+	return exists, err
+}
+
+// GetLoginAttempts возвращает сохраненные попытки входа по ключам. Ключи без ошибок входа пропускаются.
+func (s *Storage) GetLoginAttempts(ctx context.Context, keys []string) ([]storage.LoginAttempt, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	query := `SELECT attempt_key, failures, locked_until, updated_at FROM login_attempts WHERE attempt_key IN (` + placeholders + `)`
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []storage.LoginAttempt
+	for rows.Next() {
+		attempt, err := scanLoginAttempt(rows)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// RecordLoginFailure в одной транзакции читает попытки входа по ключу, вычисляет
+// новое состояние через lockout и сохраняет его
+func (s *Storage) RecordLoginFailure(ctx context.Context, key string, lockout storage.LockoutFunc) (storage.LoginAttempt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.LoginAttempt{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	row := tx.QueryRowContext(ctx, `SELECT attempt_key, failures, locked_until, updated_at FROM login_attempts WHERE attempt_key = ?`, key)
+	attempt, err := scanLoginAttempt(row)
+	if err == sql.ErrNoRows {
+		attempt, err = storage.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return storage.LoginAttempt{}, err
+	}
+
+	attempt = lockout(attempt)
+	var lockedUntil interface{}
+	if !attempt.LockedUntil.IsZero() {
+		lockedUntil = attempt.LockedUntil.UTC()
+	}
+	query := `
+		INSERT INTO login_attempts (attempt_key, failures, locked_until, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(attempt_key) DO UPDATE SET failures = excluded.failures, locked_until = excluded.locked_until, updated_at = excluded.updated_at
+	`
+	if _, err := tx.ExecContext(ctx, query, key, attempt.Failures, lockedUntil, attempt.UpdatedAt.UTC()); err != nil {
+		return storage.LoginAttempt{}, err
+	}
+
+	return attempt, tx.Commit()
+}
+
+// DeleteLoginAttempts сбрасывает счетчики и блокировки по ключам и возвращает количество удаленных записей
+func (s *Storage) DeleteLoginAttempts(ctx context.Context, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE attempt_key IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// auditColumns колонки audit_events в порядке, который ожидает scanAuditEvent
+const auditColumns = `id, username, action, item_id, collection_item, item, session_id, ip, created_at`
+
+// AddAuditEvent сохраняет событие журнала аудита
+func (s *Storage) AddAuditEvent(ctx context.Context, event storage.AuditEvent) error {
+	query := `INSERT INTO audit_events (username, action, item_id, collection_item, item, session_id, ip, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, event.Username, event.Action, event.ItemID, event.CollectionItem, event.Item, event.SessionID, event.IP, event.CreatedAt.UTC())
+	return err
+}
+
+// ListAuditEvents возвращает события пользователя от новых к старым, начиная с событий старше beforeID.
+// Нулевой beforeID означает первую страницу.
+func (s *Storage) ListAuditEvents(ctx context.Context, username string, beforeID int64, limit int) ([]storage.AuditEvent, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events WHERE username = ? AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, username, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
+// GetAuditEventsAfter возвращает события всех пользователей после afterID в порядке записи
+func (s *Storage) GetAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]storage.AuditEvent, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events WHERE id > ? ORDER BY id LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
+// scanAuditEvents читает события журнала аудита и закрывает rows
+func scanAuditEvents(rows *sql.Rows) ([]storage.AuditEvent, error) {
+	defer rows.Close()
+
+	var events []storage.AuditEvent
+	for rows.Next() {
+		var event storage.AuditEvent
+		err := rows.Scan(&event.ID, &event.Username, &event.Action, &event.ItemID, &event.CollectionItem, &event.Item, &event.SessionID, &event.IP, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// scanner общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLoginAttempt читает попытки входа из строки результата запроса
+func scanLoginAttempt(row scanner) (storage.LoginAttempt, error) {
+	var attempt storage.LoginAttempt
+	var lockedUntil sql.NullTime
+	err := row.Scan(&attempt.Key, &attempt.Failures, &lockedUntil, &attempt.UpdatedAt)
+	if err != nil {
+		return storage.LoginAttempt{}, err
+	}
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+// execAffected выполняет запрос и сообщает, была ли изменена хотя бы одна строка
+func (s *Storage) execAffected(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *Storage) saveRotationBatch(ctx context.Context, updateQuery, progressQuery string, rotationID string, updates []storage.CipherUpdate, lastID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
+		}
+	}()
+
+	for _, update := range updates {
+		// если запись изменилась после чтения, сервер уже перешифровал ее актуальным ключом
+		if _, err := tx.ExecContext(ctx, updateQuery, update.New, update.ID, update.Old); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, progressQuery, lastID, rotationID); err != nil {
+		return err
 	}
-	return clients, nil
+	return tx.Commit()
 }
@@ -3,23 +3,269 @@ package storage
 import (
 	"context"
 	"keeper/internal/server/service"
+	"time"
 )
 
+// Client описывает стрим команд клиента и состояние диалога в нем. Строка остается после
+// отключения клиента, чтобы при переподключении с тем же токеном диалог продолжился.
 type Client struct {
-	ClientID string
+	ClientID  string
+	Username  string
+	State     int
+	SessionID string
+	// данные незавершенного действия в JSON
+	Context string
+}
+
+// Session описывает сессию пользователя: устройство, адрес, с которого выполнен вход, и время последней активности.
+type Session struct {
+	ID         string
+	Username   string
+	Device     string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// Vault описывает параметры шифрования на стороне клиента.
+// Пустой Vault означает, что данные пользователя шифрует сервер.
+type Vault struct {
+	ClientEncryption bool
+	KdfSalt          string
+	WrappedKey       string
+}
+
+// UserKey описывает ключ шифрования данных пользователя, зашифрованный мастер-ключом.
+type UserKey struct {
+	Version    int
+	WrappedKey string
+}
+
+// KeyRow описывает ключ пользователя при ротации мастер-ключа.
+type KeyRow struct {
+	ID         int64
+	Username   string
+	WrappedKey string
+}
+
+// DataRow описывает зашифрованную запись пользователя.
+type DataRow struct {
+	ID       int64
 	Username string
-	State    int
+	// открытое название, в БД не хранится и заполняется сервером после расшифровки TitleCipher
+	Title string
+	// слепой индекс названия: HMAC от названия ключом пользователя, обеспечивает уникальность и поиск
+	TitleIndex string
+	// название, зашифрованное ключом пользователя. Пустое у записей, сохраненных до шифрования
+	// названий, у них в TitleIndex лежит открытое название
+	TitleCipher string
+	DataType    service.DataType
+	Data        string
+	// ключ общей записи, зашифрованный ключом владельца. Пустой, если записью не делились
+	ItemKey string
+	// версия записи, растет при каждом изменении данных
+	Version int64
+	// коллекция организации, которой принадлежит командная запись. У личных записей 0,
+	// у командных в Username указан автор записи
+	OrgID        int64
+	CollectionID int64
+	// путь коллекции для списка записей: организация/коллекция
+	Collection string
+	// время удаления в корзину, заполняется только в списке корзины
+	DeletedAt time.Time
+}
+
+// Revision описывает прежнюю версию записи из истории: название и данные в том виде, в каком
+// они хранились в записи, и кто и когда заменил их новой версией.
+type Revision struct {
+	ID          int64
+	ItemID      int64
+	Version     int64
+	TitleIndex  string
+	TitleCipher string
+	Data        string
+	// ключ общей записи для владельца на момент версии, данные могут быть зашифрованы прежним поколением ключа
+	ItemKey   string
+	Author    string
+	SessionID string
+	CreatedAt time.Time
+}
+
+// RevisionRow описывает версию из истории для ротации: Row - запись, к которой относится версия,
+// с названием, данными и ключом записи этой версии.
+type RevisionRow struct {
+	ID  int64
+	Row DataRow
+}
+
+// OrgMember описывает участника организации. Ключ организации зашифрован ключом участника.
+type OrgMember struct {
+	OrgID      int64
+	OrgName    string
+	Username   string
+	Role       service.OrgRole
+	WrappedKey string
+}
+
+// Collection описывает коллекцию записей организации.
+type Collection struct {
+	ID    int64
+	OrgID int64
+	Name  string
+}
+
+// Share описывает доступ получателя к общей записи. Ключ записи зашифрован ключом получателя.
+type Share struct {
+	ItemID     int64
+	Username   string
+	Permission service.SharePermission
+	WrappedKey string
+}
+
+// ItemShares описывает новое поколение ключа общей записи: перешифрованные данные,
+// ключ записи для владельца и полный список получателей. Data заменяет OldData,
+// только если запись не изменилась с момента чтения.
+type ItemShares struct {
+	ItemID  int64
+	OldData string
+	Data    string
+	ItemKey string
+	Shares  []Share
+}
+
+// SealFunc шифрует запись по ее id. Вызывается при создании записи, когда id уже известен.
+type SealFunc func(id int64) (string, error)
+
+// CipherUpdate описывает замену шифртекста. Запись обновляется,
+// только если шифртекст не изменился с момента чтения.
+type CipherUpdate struct {
+	ID  int64
+	Old string
+	New string
+}
+
+// Rotation описывает прогресс ротации мастер-ключа, чтобы ее можно было продолжить после остановки.
+type Rotation struct {
+	ID             string
+	KeysAfter      int64
+	DataAfter      int64
+	RevisionsAfter int64
+	Finished       bool
+}
+
+// TOTP описывает второй фактор пользователя. Секрет зашифрован ключом пользователя.
+type TOTP struct {
+	Secret    string
+	Confirmed bool
+	LastStep  int64
+}
+
+// LoginAttempt описывает неудачные попытки входа по имени пользователя или адресу клиента.
+type LoginAttempt struct {
+	Key         string
+	Failures    int
+	LockedUntil time.Time
+	UpdatedAt   time.Time
+}
+
+// LockoutFunc вычисляет новое состояние попыток входа после очередной ошибки.
+// Вызывается в транзакции с текущим состоянием, для нового ключа состояние пустое.
+type LockoutFunc func(attempt LoginAttempt) LoginAttempt
+
+// AuditEvent описывает событие журнала аудита: вход или действие с записью хранилища.
+// Теги нужны для экспорта журнала в JSON Lines.
+type AuditEvent struct {
+	ID       int64               `json:"id"`
+	Username string              `json:"username"`
+	Action   service.AuditAction `json:"action"`
+	// запись, с которой выполнено действие. Название в журнал не пишется, чтобы не хранить его открытым
+	ItemID int64 `json:"item_id,omitempty"`
+	// ItemID указывает запись коллекции организации, а не личную запись
+	CollectionItem bool `json:"collection_item,omitempty"`
+	// подробности без секретов, например пользователи, журнал которых выгрузил оператор
+	Item      string    `json:"item,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Provider interface {
 	Init() error
-	CreateUser(ctx context.Context, username string, password string) error
-	ExistUser(ctx context.Context, username, password string) error
-	GetTitlesByUser(ctx context.Context, username string) ([]string, error)
-	GetData(ctx context.Context, username string, title string) (string, error)
-	CreateData(ctx context.Context, username string, title string, data_type service.DataType, data string) error
+	CreateUser(ctx context.Context, username string, password string, vault Vault) error
+	GetVault(ctx context.Context, username string) (Vault, error)
+	GetPasswordHash(ctx context.Context, username string) (string, error)
+	UpdatePasswordHash(ctx context.Context, username string, passwordHash string) error
+	ChangePassword(ctx context.Context, username string, passwordHash string, vault Vault, keepSessionID string) (int64, error)
+	DeleteUser(ctx context.Context, username string) (map[string]int64, error)
+	GetTitlesByUser(ctx context.Context, username string) ([]DataRow, error)
+	GetData(ctx context.Context, username string, titleIndex string) (DataRow, error)
+	CreateData(ctx context.Context, row DataRow, seal SealFunc) error
+	UpdateData(ctx context.Context, row DataRow, version int64, author Revision) error
+	ListRevisions(ctx context.Context, itemID int64) ([]Revision, error)
+	GetRevision(ctx context.Context, itemID int64, revisionID int64) (Revision, error)
+	SetRevisionLimit(ctx context.Context, username string, limit int) error
+	TrashData(ctx context.Context, username string, itemID int64, deletedAt time.Time) error
+	ListTrash(ctx context.Context, username string) ([]DataRow, error)
+	RestoreData(ctx context.Context, username string, itemID int64) error
+	EmptyTrash(ctx context.Context, username string) (int64, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	GetPlainTitlesAfter(ctx context.Context, afterID int64, limit int) ([]DataRow, error)
+	SaveEncryptedTitles(ctx context.Context, rows []DataRow) error
+	ReplaceData(ctx context.Context, update CipherUpdate) error
+	GetShares(ctx context.Context, itemID int64) ([]Share, error)
+	SaveItemShares(ctx context.Context, shares ItemShares) error
+	GetSharedTitles(ctx context.Context, username string) ([]DataRow, error)
+	GetSharedData(ctx context.Context, username string, itemID int64) (DataRow, Share, error)
+	CreateOrganization(ctx context.Context, owner OrgMember) (int64, error)
+	GetMembership(ctx context.Context, orgName string, username string) (OrgMember, error)
+	ListMemberships(ctx context.Context, username string) ([]OrgMember, error)
+	SaveOrgMember(ctx context.Context, member OrgMember) error
+	RemoveOrgMember(ctx context.Context, orgID int64, username string) error
+	CreateCollection(ctx context.Context, orgID int64, name string) (int64, error)
+	GetCollection(ctx context.Context, orgID int64, name string) (Collection, error)
+	ListCollections(ctx context.Context, orgID int64) ([]Collection, error)
+	CreateCollectionItem(ctx context.Context, row DataRow, seal SealFunc) error
+	UpdateCollectionItem(ctx context.Context, row DataRow, version int64, author Revision) error
+	ListCollectionRevisions(ctx context.Context, itemID int64) ([]Revision, error)
+	GetCollectionRevision(ctx context.Context, itemID int64, revisionID int64) (Revision, error)
+	DeleteCollectionItem(ctx context.Context, itemID int64) error
+	GetTeamTitles(ctx context.Context, username string) ([]DataRow, error)
+	GetTeamData(ctx context.Context, username string, itemID int64) (DataRow, OrgMember, error)
 	GetAllClients(ctx context.Context) ([]Client, error)
 	RemoveClient(ctx context.Context, clientID string) error
-	UpdateClientState(ctx context.Context, clientID string, state service.State) error
-	AddClient(ctx context.Context, clientID, username string, state service.State) error
+	RemoveStaleClients(ctx context.Context, now time.Time) error
+	UpdateClientState(ctx context.Context, clientID string, state service.State, context string) error
+	AddClient(ctx context.Context, client Client) error
+	GetServerSecret(ctx context.Context, name string, value string) (string, error)
+	CreateSession(ctx context.Context, session Session, tokenHash string) error
+	GetSession(ctx context.Context, tokenHash string) (Session, error)
+	ListSessions(ctx context.Context, username string, now time.Time) ([]Session, error)
+	DeleteSession(ctx context.Context, username string, sessionID string) error
+	TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error
+	CreateUserKey(ctx context.Context, username string, key UserKey) error
+	GetUserKey(ctx context.Context, username string, version int) (UserKey, error)
+	GetLatestUserKey(ctx context.Context, username string) (UserKey, error)
+	GetRotation(ctx context.Context, rotationID string) (Rotation, error)
+	GetUserKeysAfter(ctx context.Context, afterID int64, limit int) ([]KeyRow, error)
+	SaveRewrappedKeys(ctx context.Context, rotationID string, updates []CipherUpdate, lastID int64) error
+	GetDataAfter(ctx context.Context, afterID int64, limit int) ([]DataRow, error)
+	SaveReencryptedData(ctx context.Context, rotationID string, updates []CipherUpdate, lastID int64) error
+	GetRevisionsAfter(ctx context.Context, afterID int64, limit int) ([]RevisionRow, error)
+	SaveReencryptedRevisions(ctx context.Context, rotationID string, updates []CipherUpdate, lastID int64) error
+	FinishRotation(ctx context.Context, rotationID string) error
+	SaveTOTP(ctx context.Context, username string, secret string) error
+	GetTOTP(ctx context.Context, username string) (TOTP, error)
+	ConfirmTOTP(ctx context.Context, username string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, username string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error)
+	BindCertificate(ctx context.Context, username string, identities []string) error
+	GetCertificateUsers(ctx context.Context, identities []string) ([]string, error)
+	HasCertificate(ctx context.Context, username string) (bool, error)
+	GetLoginAttempts(ctx context.Context, keys []string) ([]LoginAttempt, error)
+	RecordLoginFailure(ctx context.Context, key string, lockout LockoutFunc) (LoginAttempt, error)
+	DeleteLoginAttempts(ctx context.Context, keys []string) (int64, error)
+	AddAuditEvent(ctx context.Context, event AuditEvent) error
+	ListAuditEvents(ctx context.Context, username string, beforeID int64, limit int) ([]AuditEvent, error)
+	GetAuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]AuditEvent, error)
 }